@@ -17,7 +17,13 @@ func main() {
 	listenAddr := flag.String("listen", getEnv("LISTEN_ADDR", ":8080"), "HTTP server listen address")
 	dbPath := flag.String("db", getEnv("DB_PATH", "./data/controlplane.db"), "SQLite database path")
 	activeTimeout := flag.Duration("active-timeout", 5*time.Minute, "Peer active timeout duration")
-	apiKey := flag.String("api-key", getEnv("API_KEY", ""), "Optional API key for authentication")
+	apiKey := flag.String("api-key", getEnv("API_KEY", ""), "API key for the admin API (admin API is disabled if empty)")
+	requireJoinToken := flag.Bool("require-join-token", getEnv("REQUIRE_JOIN_TOKEN", "") == "true", "Require a join token for new peers")
+	keySwitchDelay := flag.Duration("key-switch-delay", 90*time.Second, "How long after a key rotation or preshared key delivery peers switch to the new key")
+	stunListen := flag.String("stun-listen", getEnv("STUN_LISTEN_ADDR", ""), "Built-in STUN server address, e.g. :3478 (disabled if empty)")
+	stunAltPort := flag.Int("stun-alt-port", 0, "Alternate STUN port for CHANGE-REQUEST support (0 disables)")
+	stunAltIP := flag.String("stun-alt-ip", getEnv("STUN_ALT_IP", ""), "Alternate STUN IP for CHANGE-REQUEST support")
+	stunAdvertise := flag.String("stun-advertise-host", getEnv("STUN_ADVERTISE_HOST", ""), "Host advertised to nodes for the STUN server (defaults to the request host)")
 	
 	flag.Parse()
 
@@ -27,6 +33,14 @@ func main() {
 		DBPath:        *dbPath,
 		ActiveTimeout: *activeTimeout,
 		APIKey:        *apiKey,
+
+		RequireJoinToken: *requireJoinToken,
+		KeySwitchDelay:   *keySwitchDelay,
+
+		STUNListenAddr:    *stunListen,
+		STUNAltPort:       *stunAltPort,
+		STUNAltIP:         *stunAltIP,
+		STUNAdvertiseHost: *stunAdvertise,
 	}
 
 	// Create server
@@ -4,32 +4,53 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"maps"
 	"os"
 	"os/signal"
+	"slices"
+	"strings"
 	"syscall"
-	"time"
 
 	"github.com/Vaibhav2154/ShadowNet/internal/node"
 	"github.com/Vaibhav2154/ShadowNet/internal/node/config"
+	"github.com/Vaibhav2154/ShadowNet/internal/node/state"
+	"github.com/Vaibhav2154/ShadowNet/internal/node/wireguard"
 	"github.com/Vaibhav2154/ShadowNet/internal/shared/crypto"
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/utils"
 )
 
+// defaultControlPlaneURL is used when neither a flag nor the state
+// directory names a control plane
+const defaultControlPlaneURL = "http://localhost:8080"
+
 func main() {
-	// Parse command-line flags
-	cfg := config.DefaultConfig()
+	cfg, err := parseConfig(os.Args[1:], flag.ExitOnError)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
 
-	flag.StringVar(&cfg.ID, "id", getEnv("PEER_ID", ""), "Peer ID (required)")
-	flag.StringVar(&cfg.ControlPlaneURL, "controlplane-url", getEnv("CONTROLPLANE_URL", "http://localhost:8080"), "Control plane URL")
-	flag.StringVar(&cfg.PrivateKeyPath, "private-key-path", getEnv("PRIVATE_KEY_PATH", "./shadownet.key"), "Private key file path")
-	flag.IntVar(&cfg.ListenPort, "listen-port", 51820, "WireGuard listen port")
-	flag.StringVar(&cfg.STUNServer, "stun-server", getEnv("STUN_SERVER", "stun.l.google.com:19302"), "STUN server address")
-	flag.DurationVar(&cfg.PunchInterval, "punch-interval", 500*time.Millisecond, "NAT hole punch interval")
-	flag.StringVar(&cfg.TUNDeviceName, "tun-device", "tun0", "TUN device name")
-	flag.StringVar(&cfg.VirtualIP, "virtual-ip", "", "Virtual IP address (auto-assigned if empty)")
-	flag.StringVar(&cfg.VirtualNetmask, "virtual-netmask", "24", "Virtual network netmask")
-	flag.DurationVar(&cfg.HeartbeatInterval, "heartbeat-interval", 30*time.Second, "Heartbeat interval")
+	// Resume the identity saved in the state directory, if there is one
+	var stateDir *state.Dir
+	if cfg.StateDir != "" {
+		stateDir, err = state.Open(cfg.StateDir)
+		if err != nil {
+			log.Fatalf("Failed to open state directory: %v", err)
+		}
+		defer stateDir.Close()
 
-	flag.Parse()
+		if err := resumeIdentity(cfg, stateDir); err != nil {
+			log.Fatalf("Failed to load saved identity: %v", err)
+		}
+	}
+	if cfg.ControlPlaneURL == "" {
+		cfg.ControlPlaneURL = defaultControlPlaneURL
+	}
+	if cfg.PrivateKeyPath == "" {
+		cfg.PrivateKeyPath = "./shadownet.key"
+		if stateDir != nil {
+			cfg.PrivateKeyPath = stateDir.KeyPath()
+		}
+	}
 
 	// Generate peer ID if not provided
 	if cfg.ID == "" {
@@ -47,6 +68,10 @@ func main() {
 		cfg.VirtualIP = fmt.Sprintf("10.10.0.%d", hash+1)
 		log.Printf("Auto-assigned virtual IP: %s", cfg.VirtualIP)
 	}
+	if cfg.IPv6 && cfg.VirtualIPv6 == "" {
+		cfg.VirtualIPv6 = utils.OverlayIPv6(cfg.ID)
+		log.Printf("Auto-assigned virtual IPv6: %s", cfg.VirtualIPv6)
+	}
 
 	// Validate configuration
 	if err := cfg.Validate(); err != nil {
@@ -58,21 +83,65 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to create node: %v", err)
 	}
+	if stateDir != nil {
+		n.SetStateDir(stateDir)
+	}
+
+	// Reloads re-read the configuration file, environment and flags; the
+	// generated or resumed settings are kept
+	n.SetConfigLoader(func() (*config.Config, error) {
+		reloaded, err := parseConfig(os.Args[1:], flag.ContinueOnError)
+		if err != nil {
+			return nil, err
+		}
+		if reloaded.ID == "" {
+			reloaded.ID = cfg.ID
+		}
+		if reloaded.ControlPlaneURL == "" {
+			reloaded.ControlPlaneURL = cfg.ControlPlaneURL
+		}
+		if reloaded.PrivateKeyPath == "" {
+			reloaded.PrivateKeyPath = cfg.PrivateKeyPath
+		}
+		if reloaded.VirtualIP == "" {
+			reloaded.VirtualIP = cfg.VirtualIP
+		}
+		if reloaded.VirtualIPv6 == "" {
+			reloaded.VirtualIPv6 = cfg.VirtualIPv6
+		}
+		return reloaded, nil
+	})
 
 	// Start node
 	if err := n.Start(); err != nil {
 		log.Fatalf("Failed to start node: %v", err)
 	}
 
-	// Wait for interrupt signal
+	// Wait for interrupt signal; SIGHUP reloads the configuration
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
 
 	log.Println("Node running. Press Ctrl+C to stop.")
-	<-sigChan
+wait:
+	for {
+		select {
+		case <-hupChan:
+			log.Println("Received SIGHUP, reloading configuration")
+			if err := n.ReloadConfig(); err != nil {
+				log.Printf("Failed to reload configuration: %v", err)
+			}
+		case <-sigChan:
+			log.Println("Received shutdown signal")
+			break wait
+		case <-n.ShutdownRequested():
+			log.Println("Received shutdown request")
+			break wait
+		}
+	}
 
 	// Graceful shutdown
-	log.Println("Received shutdown signal")
 	if err := n.Stop(); err != nil {
 		log.Fatalf("Shutdown error: %v", err)
 	}
@@ -80,6 +149,181 @@ func main() {
 	log.Println("Node stopped successfully")
 }
 
+// parseConfig builds the configuration from command-line flags, falling
+// back to environment variables, the configuration file and defaults, in
+// that order
+func parseConfig(args []string, errorHandling flag.ErrorHandling) (*config.Config, error) {
+	cfg := config.DefaultConfig()
+	cfg.Hostname = defaultHostname()
+
+	// The file is read first; environment variables and flags then
+	// override it as flag defaults and values
+	configPath := configFlag(args)
+	if configPath == "" {
+		configPath = os.Getenv("SHADOWNET_CONFIG")
+	}
+	if configPath != "" {
+		if err := config.LoadFile(configPath, cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	fs := flag.NewFlagSet("node", errorHandling)
+
+	fs.String("config", configPath, "YAML configuration file; flags and environment variables override it")
+	fs.StringVar(&cfg.ID, "id", getEnv("PEER_ID", cfg.ID), "Peer ID (required)")
+	fs.StringVar(&cfg.ControlPlaneURL, "controlplane-url", getEnv("CONTROLPLANE_URL", cfg.ControlPlaneURL), "Control plane URL (default: the saved one, else "+defaultControlPlaneURL+")")
+	fallbackURLs := fs.String("controlplane-fallback-urls", getEnv("SHADOWNET_CONTROLPLANE_FALLBACK_URLS", strings.Join(cfg.ControlPlaneFallbacks, ",")), "Control plane URLs to fail over to in order, comma-separated")
+	fs.StringVar(&cfg.StateDir, "state-dir", getEnv("SHADOWNET_STATE_DIR", cfg.StateDir), "Directory for the node's identity, key and peer cache (empty disables)")
+	fs.StringVar(&cfg.JoinToken, "join-token", getEnv("JOIN_TOKEN", cfg.JoinToken), "Join token for control planes that require one")
+	fs.StringVar(&cfg.Hostname, "hostname", getEnv("SHADOWNET_HOSTNAME", cfg.Hostname), "Hostname reported to the control plane, used for the DNS name")
+	tags := fs.String("tags", getEnv("SHADOWNET_TAGS", strings.Join(cfg.Tags, ",")), "Tags reported to the control plane, comma-separated")
+	labels := fs.String("labels", getEnv("SHADOWNET_LABELS", formatLabels(cfg.Labels)), "Labels reported to the control plane, comma-separated key=value pairs")
+	fs.StringVar(&cfg.PrivateKeyPath, "private-key-path", getEnv("PRIVATE_KEY_PATH", cfg.PrivateKeyPath), "Private key file path (default: private.key in the state directory)")
+	fs.StringVar(&cfg.KeyEncryption, "key-encryption", getEnv("SHADOWNET_KEY_ENCRYPTION", cfg.KeyEncryption), "Private key file encryption: none, passphrase, keyring or credential")
+	fs.StringVar(&cfg.KeySecret, "key-secret", getEnv("SHADOWNET_KEY_SECRET", cfg.KeySecret), "Passphrase file (default: $"+wireguard.PassphraseEnv+"), keyring key (default "+wireguard.DefaultKeyringKey+") or systemd credential (default "+wireguard.DefaultCredentialName+")")
+	fs.IntVar(&cfg.ListenPort, "listen-port", cfg.ListenPort, "WireGuard listen port")
+	fs.StringVar(&cfg.WGBackend, "wg-backend", getEnv("WG_BACKEND", cfg.WGBackend), "WireGuard backend: auto, kernel or userspace (auto uses the kernel only without NAT)")
+	stunServers := fs.String("stun-servers", getEnv("STUN_SERVERS", getEnv("STUN_SERVER", strings.Join(cfg.STUNServers, ","))), "STUN server addresses, queried in parallel (comma-separated)")
+	fs.StringVar(stunServers, "stun-server", *stunServers, "Deprecated alias for --stun-servers")
+	fs.DurationVar(&cfg.STUNTimeout, "stun-timeout", cfg.STUNTimeout, "Per-server STUN response timeout")
+	fs.IntVar(&cfg.STUNRetries, "stun-retries", cfg.STUNRetries, "STUN retransmissions per server")
+	fs.BoolVar(&cfg.ControlPlaneSTUN, "controlplane-stun", cfg.ControlPlaneSTUN, "Prefer the control plane's built-in STUN server when it runs one")
+	fs.DurationVar(&cfg.MappingLifetimeProbe, "nat-lifetime-probe", cfg.MappingLifetimeProbe, "Upper bound for NAT mapping lifetime probing (0 disables)")
+	fs.DurationVar(&cfg.PunchInterval, "punch-interval", cfg.PunchInterval, "NAT hole punch interval")
+	advertiseRoutes := fs.String("advertise-routes", getEnv("SHADOWNET_ADVERTISE_ROUTES", strings.Join(cfg.AdvertiseRoutes, ",")), "Subnets behind this node to offer to the overlay, comma-separated CIDRs (used once approved)")
+	fs.BoolVar(&cfg.SNATRoutes, "snat-subnet-routes", getEnvBool("SHADOWNET_SNAT_SUBNET_ROUTES", cfg.SNATRoutes), "Masquerade overlay traffic to advertised subnets")
+	fs.BoolVar(&cfg.AdvertiseExitNode, "advertise-exit-node", getEnvBool("SHADOWNET_ADVERTISE_EXIT_NODE", cfg.AdvertiseExitNode), "Offer this node as internet egress for the overlay (used once approved)")
+	fs.StringVar(&cfg.ExitNode, "exit-node", getEnv("SHADOWNET_EXIT_NODE", cfg.ExitNode), "Peer ID or name to send internet traffic through")
+	fs.IntVar(&cfg.RouteTable, "route-table", cfg.RouteTable, "Routing table for overlay routes")
+	fs.IntVar(&cfg.RouteMetric, "route-metric", cfg.RouteMetric, "Metric of overlay routes")
+	splitInclude := fs.String("split-include", getEnv("SHADOWNET_SPLIT_INCLUDE", strings.Join(cfg.SplitInclude, ",")), "Only route these destinations through the overlay, comma-separated CIDRs")
+	splitExclude := fs.String("split-exclude", getEnv("SHADOWNET_SPLIT_EXCLUDE", strings.Join(cfg.SplitExclude, ",")), "Never route these destinations through the overlay, comma-separated CIDRs")
+	fs.StringVar(&cfg.TUNDeviceName, "tun-device", cfg.TUNDeviceName, "TUN device name")
+	fs.StringVar(&cfg.VirtualIP, "virtual-ip", cfg.VirtualIP, "Virtual IP address (auto-assigned if empty)")
+	fs.BoolVar(&cfg.IPv6, "ipv6", getEnvBool("SHADOWNET_IPV6", cfg.IPv6), "Use an IPv6 overlay address and IPv6 endpoints")
+	fs.StringVar(&cfg.VirtualIPv6, "virtual-ipv6", cfg.VirtualIPv6, "Virtual IPv6 address (derived from the ID if empty)")
+	fs.StringVar(&cfg.VirtualNetmask, "virtual-netmask", cfg.VirtualNetmask, "Virtual network netmask")
+	fs.DurationVar(&cfg.HeartbeatInterval, "heartbeat-interval", cfg.HeartbeatInterval, "Heartbeat interval")
+	fs.DurationVar(&cfg.EndpointCheckInterval, "endpoint-check-interval", cfg.EndpointCheckInterval, "How often to check the public endpoint for NAT mapping changes (0 disables)")
+	fs.DurationVar(&cfg.KeyRotationInterval, "key-rotation-interval", cfg.KeyRotationInterval, "Rotate the WireGuard key once it is this old (0 rotates only on demand)")
+	fs.BoolVar(&cfg.PresharedKeys, "preshared-keys", getEnvBool("SHADOWNET_PRESHARED_KEYS", cfg.PresharedKeys), "Add per-pair preshared keys to tunnels with peers that support them")
+	fs.DurationVar(&cfg.PSKRotationInterval, "psk-rotation-interval", cfg.PSKRotationInterval, "Replace preshared keys once they are this old")
+	fs.BoolVar(&cfg.PostQuantum, "pq", getEnvBool("SHADOWNET_PQ", cfg.PostQuantum), "Derive preshared keys from ML-KEM exchanges with peers that support them")
+	pqRequireTags := fs.String("pq-require-tags", getEnv("SHADOWNET_PQ_REQUIRE_TAGS", strings.Join(cfg.PQRequireTags, ",")), "Hold back tunnels to or from nodes with these tags until they are post-quantum protected, comma-separated")
+	fs.StringVar(&cfg.ControlSocket, "control-socket", getEnv("SHADOWNET_CONTROL_SOCKET", cfg.ControlSocket), "Local API Unix socket path (empty disables)")
+	fs.BoolVar(&cfg.MagicDNS, "dns", getEnvBool("SHADOWNET_DNS", cfg.MagicDNS), "Serve <peer>.<network>.<dns-domain> names on the virtual IP")
+	fs.StringVar(&cfg.DNSDomain, "dns-domain", getEnv("SHADOWNET_DNS_DOMAIN", cfg.DNSDomain), "Domain suffix for overlay names")
+	dnsUpstreams := fs.String("dns-upstreams", getEnv("SHADOWNET_DNS_UPSTREAMS", strings.Join(cfg.DNSUpstreams, ",")), "Resolvers for non-overlay names, comma-separated host:port (default: /etc/resolv.conf)")
+	fs.BoolVar(&cfg.DNSConfigureSystem, "dns-configure-system", getEnvBool("SHADOWNET_DNS_CONFIGURE_SYSTEM", cfg.DNSConfigureSystem), "Point the system resolver at MagicDNS while running")
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	cfg.ControlPlaneFallbacks = splitList(*fallbackURLs)
+	cfg.STUNServers = splitList(*stunServers)
+	cfg.DNSUpstreams = splitList(*dnsUpstreams)
+	cfg.Tags = splitList(*tags)
+	cfg.AdvertiseRoutes = splitList(*advertiseRoutes)
+	cfg.SplitInclude = splitList(*splitInclude)
+	cfg.SplitExclude = splitList(*splitExclude)
+	cfg.PQRequireTags = splitList(*pqRequireTags)
+
+	parsed, err := parseLabels(*labels)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Labels = parsed
+	return cfg, nil
+}
+
+// resumeIdentity fills in the ID, virtual IPs and control plane URL saved
+// in the state directory where flags and environment leave them empty. A
+// different --id is a different peer, so its addresses aren't reused.
+func resumeIdentity(cfg *config.Config, dir *state.Dir) error {
+	identity, err := dir.LoadIdentity()
+	if err != nil || identity == nil {
+		return err
+	}
+
+	if cfg.ControlPlaneURL == "" {
+		cfg.ControlPlaneURL = identity.ControlPlaneURL
+	}
+	if cfg.ID == "" {
+		cfg.ID = identity.ID
+		log.Printf("Resumed peer ID: %s", cfg.ID)
+	}
+	if cfg.ID != identity.ID {
+		return nil
+	}
+
+	if cfg.VirtualIP == "" {
+		cfg.VirtualIP = identity.VirtualIP
+	}
+	if cfg.IPv6 && cfg.VirtualIPv6 == "" {
+		cfg.VirtualIPv6 = identity.VirtualIPv6
+	}
+	return nil
+}
+
+// configFlag returns the --config value in args, if any, so the file can
+// be read before the other flags are defined
+func configFlag(args []string) string {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || name != "config" {
+			continue
+		}
+		if hasValue {
+			return value
+		}
+		if i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+// formatLabels formats labels as sorted, comma-separated key=value pairs
+func formatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for _, key := range slices.Sorted(maps.Keys(labels)) {
+		pairs = append(pairs, key+"="+labels[key])
+	}
+	return strings.Join(pairs, ",")
+}
+
+// parseLabels parses comma-separated key=value pairs
+func parseLabels(value string) (map[string]string, error) {
+	items := splitList(value)
+	if len(items) == 0 {
+		return nil, nil
+	}
+
+	labels := make(map[string]string, len(items))
+	for _, item := range items {
+		key, val, ok := strings.Cut(item, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("invalid label %q: expected key=value", item)
+		}
+		labels[strings.TrimSpace(key)] = strings.TrimSpace(val)
+	}
+	return labels, nil
+}
+
+// defaultHostname returns the machine's hostname, or "" if unknown
+func defaultHostname() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return ""
+	}
+	return hostname
+}
+
 // getEnv gets environment variable with fallback
 func getEnv(key, fallback string) string {
 	if value := os.Getenv(key); value != "" {
@@ -87,3 +331,24 @@ func getEnv(key, fallback string) string {
 	}
 	return fallback
 }
+
+// getEnvBool gets a boolean environment variable ("true" is true) with
+// fallback
+func getEnvBool(key string, fallback bool) bool {
+	if value := os.Getenv(key); value != "" {
+		return value == "true"
+	}
+	return fallback
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
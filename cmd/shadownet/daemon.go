@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/node/localapi"
+)
+
+// runUp starts the node daemon and waits until its local API answers.
+// Arguments after the flags are passed to the daemon.
+func runUp(args []string) error {
+	fs, socket := newFlagSet("up")
+	daemon := fs.String("daemon", "", "Node daemon binary (default: node next to this binary, then shadownet-node on PATH)")
+	logFile := fs.String("log-file", "/var/log/shadownet.log", "Daemon log file")
+	wait := fs.Duration("wait", 60*time.Second, "How long to wait for the daemon to come up")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: shadownet up [flags] [-- node flags]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	client := localapi.NewClient(*socket)
+	if _, err := client.Status(); err == nil {
+		fmt.Println("ShadowNet is already running")
+		return nil
+	}
+
+	binary, err := findDaemon(*daemon)
+	if err != nil {
+		return err
+	}
+
+	logOut, err := os.OpenFile(*logFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0640)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	defer logOut.Close()
+
+	// Pass the socket through so the CLI and daemon agree on it
+	daemonArgs := append([]string{"--control-socket", *socket}, fs.Args()...)
+	cmd := exec.Command(binary, daemonArgs...)
+	cmd.Stdout = logOut
+	cmd.Stderr = logOut
+	detach(cmd)
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start daemon: %w", err)
+	}
+
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	deadline := time.Now().Add(*wait)
+	for time.Now().Before(deadline) {
+		select {
+		case err := <-exited:
+			return fmt.Errorf("daemon exited during startup (%v); see %s", err, *logFile)
+		case <-time.After(500 * time.Millisecond):
+		}
+
+		if status, err := client.Status(); err == nil {
+			fmt.Printf("ShadowNet is up: %s (%s), pid %d\n", status.ID, status.VirtualIP, cmd.Process.Pid)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("daemon (pid %d) did not answer on %s within %s; see %s", cmd.Process.Pid, *socket, *wait, *logFile)
+}
+
+// runDown asks the daemon to shut down and waits until it is gone
+func runDown(args []string) error {
+	fs, socket := newFlagSet("down")
+	wait := fs.Duration("wait", 30*time.Second, "How long to wait for the daemon to stop")
+	fs.Parse(args)
+
+	client := localapi.NewClient(*socket)
+	if _, err := client.Action("shutdown"); err != nil {
+		if errors.Is(err, localapi.ErrNotRunning) {
+			fmt.Println("ShadowNet is not running")
+			return nil
+		}
+		return err
+	}
+
+	deadline := time.Now().Add(*wait)
+	for time.Now().Before(deadline) {
+		if _, err := client.Status(); errors.Is(err, localapi.ErrNotRunning) {
+			fmt.Println("ShadowNet is down")
+			return nil
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+
+	return fmt.Errorf("daemon still answering on %s after %s", *socket, *wait)
+}
+
+// findDaemon locates the node daemon binary
+func findDaemon(explicit string) (string, error) {
+	if explicit != "" {
+		return explicit, nil
+	}
+
+	if self, err := os.Executable(); err == nil {
+		for _, name := range []string{"node", "shadownet-node"} {
+			candidate := filepath.Join(filepath.Dir(self), name)
+			if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+				return candidate, nil
+			}
+		}
+	}
+
+	if path, err := exec.LookPath("shadownet-node"); err == nil {
+		return path, nil
+	}
+
+	return "", fmt.Errorf("node daemon not found; pass --daemon")
+}
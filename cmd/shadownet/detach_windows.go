@@ -0,0 +1,8 @@
+//go:build windows
+
+package main
+
+import "os/exec"
+
+// detach is a no-op on Windows; the daemon already outlives the CLI
+func detach(cmd *exec.Cmd) {}
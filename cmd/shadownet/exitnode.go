@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/node/localapi"
+)
+
+// runExitNode lists the available exit nodes or chooses one
+func runExitNode(args []string) error {
+	fs, socket := newFlagSet("exit-node")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: shadownet exit-node [flags] [<peer name or ID> | off]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	client := localapi.NewClient(*socket)
+
+	if fs.NArg() == 0 {
+		status, err := client.Status()
+		if err != nil {
+			return err
+		}
+		if len(status.ExitNodes) == 0 {
+			fmt.Println("No exit nodes available")
+			return nil
+		}
+
+		w := newTable()
+		fmt.Fprintln(w, "EXIT NODE\tIN USE")
+		for _, name := range status.ExitNodes {
+			inUse := ""
+			if name == status.ExitNode {
+				inUse = "yes"
+			}
+			fmt.Fprintf(w, "%s\t%s\n", name, orDash(inUse))
+		}
+		return w.Flush()
+	}
+
+	if fs.NArg() > 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	peer := fs.Arg(0)
+	if peer == "off" {
+		peer = ""
+	}
+
+	resp, err := client.SetExitNode(peer)
+	if err != nil {
+		return err
+	}
+	fmt.Println(resp.Message)
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/node/localapi"
+	"github.com/Vaibhav2154/ShadowNet/internal/node/state"
+	"github.com/Vaibhav2154/ShadowNet/internal/node/wireguard"
+)
+
+// runRotateKey starts a key rotation on the running node
+func runRotateKey(args []string) error {
+	fs, socket := newFlagSet("rotate-key")
+	fs.Parse(args)
+
+	client := localapi.NewClient(*socket)
+	if _, err := client.Action("rotate-key"); err != nil {
+		return err
+	}
+
+	status, err := client.Status()
+	if err != nil || status.NextPublicKey == "" {
+		fmt.Println("Key rotation started")
+		return nil
+	}
+	fmt.Printf("Switching to public key %s at %s\n", status.NextPublicKey, status.KeySwitchAt)
+	return nil
+}
+
+// runEncryptKey encrypts an existing unencrypted private key file. It
+// locks the state directory, so the node must be stopped.
+func runEncryptKey(args []string) error {
+	fs := flag.NewFlagSet("shadownet encrypt-key", flag.ExitOnError)
+	stateDir := fs.String("state-dir", getEnv("SHADOWNET_STATE_DIR", state.DefaultDir), "Node state directory")
+	keyPath := fs.String("key", "", "Private key file (default: private.key in the state directory)")
+	encryption := fs.String("encryption", getEnv("SHADOWNET_KEY_ENCRYPTION", ""), "Encryption: passphrase, keyring or credential")
+	secret := fs.String("secret", getEnv("SHADOWNET_KEY_SECRET", ""), "Passphrase file (default: $"+wireguard.PassphraseEnv+"), keyring key (default "+wireguard.DefaultKeyringKey+") or systemd credential (default "+wireguard.DefaultCredentialName+")")
+	fs.Parse(args)
+
+	if *encryption == "" || *encryption == wireguard.KeyEncryptionNone {
+		return fmt.Errorf("--encryption is required: passphrase, keyring or credential")
+	}
+
+	path := *keyPath
+	if *stateDir != "" {
+		dir, err := state.Open(*stateDir)
+		if err != nil {
+			return fmt.Errorf("%w (stop the node first)", err)
+		}
+		defer dir.Close()
+
+		if path == "" {
+			path = dir.KeyPath()
+		}
+	}
+	if path == "" {
+		return fmt.Errorf("--key is required without a state directory")
+	}
+
+	publicKey, err := wireguard.EncryptKeyFile(path, wireguard.KeyEncryption{Mode: *encryption, Secret: *secret})
+	if err != nil {
+		return err
+	}
+
+	abs, _ := filepath.Abs(path)
+	fmt.Printf("Encrypted %s (public key %s)\n", abs, publicKey)
+	fmt.Printf("Start the node with --key-encryption %s", *encryption)
+	if *secret != "" {
+		fmt.Printf(" --key-secret %s", *secret)
+	}
+	fmt.Println()
+	return nil
+}
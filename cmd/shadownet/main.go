@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/node/localapi"
+)
+
+// command is a shadownet subcommand
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) error
+}
+
+var commands = []command{
+	{"up", "Start the node daemon in the background", runUp},
+	{"down", "Stop the running node daemon", runDown},
+	{"status", "Show node status", runStatus},
+	{"peers", "List peers and their tunnel state", runPeers},
+	{"ping", "Ping a peer over the overlay and report the path", runPing},
+	{"exit-node", "List exit nodes or route internet traffic through one", runExitNode},
+	{"netcheck", "Report STUN results, NAT type and control plane latency", runNetcheck},
+	{"rotate-key", "Rotate the node's WireGuard key through the control plane", runRotateKey},
+	{"encrypt-key", "Encrypt the node's private key file at rest", runEncryptKey},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	name := os.Args[1]
+	if name == "-h" || name == "--help" || name == "help" {
+		usage()
+		return
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == name {
+			if err := cmd.run(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "shadownet %s: %v\n", name, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "shadownet: unknown command %q\n\n", name)
+	usage()
+	os.Exit(2)
+}
+
+// usage prints the list of subcommands
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: shadownet <command> [flags]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-12s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Run 'shadownet <command> -h' for command flags.")
+}
+
+// newFlagSet creates a flag set with the shared --socket flag
+func newFlagSet(name string) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet("shadownet "+name, flag.ExitOnError)
+	socket := fs.String("socket", getEnv("SHADOWNET_CONTROL_SOCKET", localapi.DefaultSocketPath), "Node local API socket")
+	return fs, socket
+}
+
+// printJSON writes v as indented JSON
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// newTable returns a tab-aligned writer for table output
+func newTable() *tabwriter.Writer {
+	return tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+}
+
+// getEnv gets environment variable with fallback
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/node/config"
+	"github.com/Vaibhav2154/ShadowNet/internal/node/control"
+	"github.com/Vaibhav2154/ShadowNet/internal/node/localapi"
+	"github.com/Vaibhav2154/ShadowNet/internal/node/stun"
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/proto"
+)
+
+// runNetcheck reports control plane latency, every STUN server's mapping
+// and the NAT behaviour. A running node probes from its WireGuard socket,
+// so the mapping is the one peers use; without one a new socket is used.
+func runNetcheck(args []string) error {
+	fs, socket := newFlagSet("netcheck")
+	controlPlaneURL := fs.String("controlplane-url", "", "Control plane URL when no node is running (default: $CONTROLPLANE_URL or http://localhost:8080)")
+	stunServers := fs.String("stun-servers", "", "STUN servers, comma-separated (default: the node's, else control plane STUN plus public servers)")
+	timeout := fs.Duration("timeout", 2*time.Second, "Per-request timeout when no node is running")
+	asJSON := fs.Bool("json", false, "Print JSON")
+	fs.Parse(args)
+
+	servers := splitList(*stunServers)
+	report, err := localapi.NewClient(*socket).Netcheck(servers)
+	if errors.Is(err, localapi.ErrNotRunning) {
+		url := *controlPlaneURL
+		if url == "" {
+			url = getEnv("CONTROLPLANE_URL", "http://localhost:8080")
+		}
+		report, err = netcheckStandalone(url, servers, *timeout)
+	}
+	if err != nil {
+		return err
+	}
+
+	return printNetcheck(report, *asJSON)
+}
+
+// netcheckStandalone runs the checks from a new UDP socket, over IPv4 and
+// IPv6
+func netcheckStandalone(url string, servers []string, timeout time.Duration) (*proto.NetcheckReport, error) {
+	report := &proto.NetcheckReport{ControlPlane: url}
+	client := control.NewClient(url)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	if err := client.CheckHealth(ctx); err != nil {
+		report.ControlPlaneError = err.Error()
+	} else {
+		report.ControlPlaneLatency = time.Since(start).Round(time.Millisecond).String()
+	}
+
+	if len(servers) == 0 {
+		if resp, err := client.GetSTUNServers(ctx); err == nil {
+			servers = append(servers, resp.Servers...)
+		}
+		servers = append(servers, config.DefaultConfig().STUNServers...)
+	}
+
+	conn, err := net.ListenPacket("udp", ":0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create UDP socket: %w", err)
+	}
+	defer conn.Close()
+	report.Socket = fmt.Sprintf("new socket %s (no node running; its mapping may differ from the node's)", conn.LocalAddr())
+
+	opts := stun.QueryOptions{Timeout: timeout, Retries: 1}
+	report.IPv4 = stun.Check(conn, servers, opts)
+	opts.Network = "udp6"
+	report.IPv6 = stun.Check(conn, servers, opts)
+	return report, nil
+}
+
+// printNetcheck prints a netcheck report
+func printNetcheck(report *proto.NetcheckReport, asJSON bool) error {
+	if asJSON {
+		return printJSON(report)
+	}
+
+	fmt.Printf("Probed from: %s\n", report.Socket)
+	fmt.Println("Control plane:")
+	if report.ControlPlaneError != "" {
+		fmt.Printf("  %s: %s\n", report.ControlPlane, report.ControlPlaneError)
+	} else {
+		fmt.Printf("  %s: %s\n", report.ControlPlane, report.ControlPlaneLatency)
+	}
+
+	printNetcheckFamily("IPv4", report.IPv4)
+	if report.IPv6 != nil {
+		printNetcheckFamily("IPv6", report.IPv6)
+	} else {
+		fmt.Println("IPv6: disabled on the node")
+	}
+
+	return nil
+}
+
+// printNetcheckFamily prints the STUN results over one address family
+func printNetcheckFamily(name string, family *proto.NetcheckFamily) {
+	fmt.Printf("%s STUN:\n", name)
+	w := newTable()
+	for _, entry := range family.STUN {
+		if entry.Error != "" {
+			fmt.Fprintf(w, "  %s\terror: %s\n", entry.Server, entry.Error)
+		} else {
+			fmt.Fprintf(w, "  %s\t%s\t%s\n", entry.Server, entry.Mapped, entry.Latency)
+		}
+	}
+	w.Flush()
+
+	if family.PublicEndpoint != "" {
+		fmt.Printf("%s endpoint: %s\n", name, family.PublicEndpoint)
+		fmt.Printf("Consistent mapping across servers: %t\n", family.ConsistentMapping)
+	}
+
+	if family.NAT != nil {
+		fmt.Printf("NAT type: %s (mapping: %s, filtering: %s, hairpinning: %t)\n",
+			family.NAT.Type, family.NAT.Mapping, family.NAT.Filtering, family.NAT.Hairpinning)
+	} else if family.NATError != "" {
+		fmt.Printf("NAT type: unknown (%s)\n", family.NATError)
+	}
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
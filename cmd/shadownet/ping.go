@@ -0,0 +1,232 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/node/localapi"
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/proto"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+)
+
+// runPing sends ICMP echo requests to a peer's virtual IP, which only
+// succeed through the WireGuard tunnel, and reports the path it takes
+func runPing(args []string) error {
+	fs, socket := newFlagSet("ping")
+	count := fs.Int("c", 3, "Number of pings")
+	timeout := fs.Duration("timeout", 2*time.Second, "Time to wait for each reply")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: shadownet ping [flags] <peer name, ID, ID prefix or virtual IP>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	peers, err := localapi.NewClient(*socket).Peers()
+	if err != nil {
+		return err
+	}
+
+	peer, err := findPeer(peers.Peers, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	target, err := virtualIP(peer)
+	if err != nil {
+		return err
+	}
+
+	conn, privileged, err := listenICMP()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	received := 0
+	id := os.Getpid() & 0xffff
+	for seq := 1; seq <= *count; seq++ {
+		rtt, err := echo(conn, privileged, target, id, seq, *timeout)
+		if err != nil {
+			fmt.Printf("no reply from %s (%s): %v\n", peerName(peer), target, err)
+		} else {
+			received++
+			fmt.Printf("pong from %s (%s) in %s\n", peerName(peer), target, rtt.Round(10*time.Microsecond))
+		}
+
+		if seq < *count {
+			time.Sleep(time.Second)
+		}
+	}
+
+	// Refresh the tunnel state now that the pings had a chance to trigger
+	// a handshake
+	if refreshed, err := localapi.NewClient(*socket).Peers(); err == nil {
+		if p, err := findPeer(refreshed.Peers, peer.PublicKey); err == nil {
+			peer = p
+		}
+	}
+
+	fmt.Printf("path: %s\n", describePath(peer))
+
+	if received == 0 {
+		return fmt.Errorf("%s is not reachable over the overlay", peerName(peer))
+	}
+	return nil
+}
+
+// findPeer matches a peer by exact ID, name, public key, virtual IP or
+// unique ID prefix
+func findPeer(peers []proto.TunnelStats, query string) (*proto.TunnelStats, error) {
+	var prefixMatches []*proto.TunnelStats
+	for i := range peers {
+		peer := &peers[i]
+		if peer.PeerID == query || peer.PublicKey == query || (peer.Name != "" && peer.Name == query) {
+			return peer, nil
+		}
+		if ip, err := virtualIP(peer); err == nil && ip.String() == query {
+			return peer, nil
+		}
+		if peer.PeerID != "" && strings.HasPrefix(peer.PeerID, query) {
+			prefixMatches = append(prefixMatches, peer)
+		}
+	}
+
+	switch len(prefixMatches) {
+	case 0:
+		return nil, fmt.Errorf("no peer matches %q", query)
+	case 1:
+		return prefixMatches[0], nil
+	default:
+		return nil, fmt.Errorf("%q matches %d peers", query, len(prefixMatches))
+	}
+}
+
+// virtualIP returns the address in the peer's first single-host allowed IP
+func virtualIP(peer *proto.TunnelStats) (netip.Addr, error) {
+	for _, allowedIP := range peer.AllowedIPs {
+		prefix, err := netip.ParsePrefix(allowedIP)
+		if err == nil && prefix.IsSingleIP() {
+			return prefix.Addr(), nil
+		}
+	}
+	return netip.Addr{}, fmt.Errorf("peer %s has no virtual IP", peerName(peer))
+}
+
+// describePath reports the tunnel's path from the device state. The
+// endpoint WireGuard holds is where the peer's last authenticated packet
+// came from, so after a recent handshake it is the path in use; without one
+// it is only the endpoint configured for the peer.
+func describePath(peer *proto.TunnelStats) string {
+	if peer.Endpoint == "" {
+		return "none (no endpoint known)"
+	}
+
+	var path string
+	if peer.Up {
+		path = fmt.Sprintf("direct via %s (handshake %s)", peer.Endpoint, since(peer.LastHandshake))
+	} else {
+		path = fmt.Sprintf("none established; configured endpoint %s", peer.Endpoint)
+		if peer.LastHandshake != "" {
+			path += fmt.Sprintf(" (last handshake %s)", since(peer.LastHandshake))
+		} else {
+			path += " (no handshake yet)"
+		}
+	}
+	if peer.Strategy != "" {
+		path += fmt.Sprintf(", strategy %s", peer.Strategy)
+	}
+	return path
+}
+
+// listenICMP opens a raw ICMP socket, falling back to an unprivileged
+// ping socket when not running as root
+func listenICMP() (*icmp.PacketConn, bool, error) {
+	conn, err := icmp.ListenPacket("ip4:icmp", "0.0.0.0")
+	if err == nil {
+		return conn, true, nil
+	}
+
+	conn, udpErr := icmp.ListenPacket("udp4", "0.0.0.0")
+	if udpErr != nil {
+		return nil, false, fmt.Errorf("failed to open ICMP socket: %w", errors.Join(err, udpErr))
+	}
+	return conn, false, nil
+}
+
+// echo sends one echo request and waits for its reply
+func echo(conn *icmp.PacketConn, privileged bool, target netip.Addr, id, seq int, timeout time.Duration) (time.Duration, error) {
+	request := icmp.Message{
+		Type: ipv4.ICMPTypeEcho,
+		Body: &icmp.Echo{ID: id, Seq: seq, Data: []byte("shadownet")},
+	}
+	packet, err := request.Marshal(nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to build echo request: %w", err)
+	}
+
+	var dst net.Addr = &net.IPAddr{IP: target.AsSlice()}
+	if !privileged {
+		dst = &net.UDPAddr{IP: target.AsSlice()}
+	}
+
+	start := time.Now()
+	if _, err := conn.WriteTo(packet, dst); err != nil {
+		return 0, fmt.Errorf("failed to send echo request: %w", err)
+	}
+
+	conn.SetReadDeadline(start.Add(timeout))
+	buf := make([]byte, 1500)
+	for {
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return 0, fmt.Errorf("timeout")
+			}
+			return 0, err
+		}
+
+		reply, err := icmp.ParseMessage(1, buf[:n])
+		if err != nil || reply.Type != ipv4.ICMPTypeEchoReply {
+			continue
+		}
+		body, ok := reply.Body.(*icmp.Echo)
+		if !ok || body.Seq != seq {
+			continue
+		}
+		// Unprivileged ping sockets rewrite the ID, and the kernel already
+		// filters replies for them
+		if privileged && body.ID != id {
+			continue
+		}
+		if !sameIP(from, target) {
+			continue
+		}
+
+		return time.Since(start), nil
+	}
+}
+
+// sameIP reports whether a reply came from the target
+func sameIP(from net.Addr, target netip.Addr) bool {
+	var ip net.IP
+	switch addr := from.(type) {
+	case *net.IPAddr:
+		ip = addr.IP
+	case *net.UDPAddr:
+		ip = addr.IP
+	}
+	addr, ok := netip.AddrFromSlice(ip)
+	return ok && addr.Unmap() == target
+}
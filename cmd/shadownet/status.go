@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/node/localapi"
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/proto"
+)
+
+// runStatus prints the node status
+func runStatus(args []string) error {
+	fs, socket := newFlagSet("status")
+	asJSON := fs.Bool("json", false, "Print JSON")
+	fs.Parse(args)
+
+	status, err := localapi.NewClient(*socket).Status()
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		return printJSON(status)
+	}
+
+	fmt.Printf("ID:              %s\n", status.ID)
+	fmt.Printf("Virtual IP:      %s\n", status.VirtualIP)
+	if status.VirtualIPv6 != "" {
+		fmt.Printf("Virtual IPv6:    %s\n", status.VirtualIPv6)
+	}
+	if status.DNSName != "" {
+		fmt.Printf("DNS name:        %s\n", status.DNSName)
+	}
+	fmt.Printf("Public endpoint: %s\n", status.PublicEndpoint)
+	if status.PublicEndpointV6 != "" {
+		fmt.Printf("IPv6 endpoint:   %s\n", status.PublicEndpointV6)
+	}
+	fmt.Printf("Public key:      %s\n", status.PublicKey)
+	if status.NextPublicKey != "" {
+		fmt.Printf("Next public key: %s (from %s)\n", status.NextPublicKey, status.KeySwitchAt)
+	}
+	fmt.Printf("Backend:         %s\n", status.Backend)
+	if status.SharedSocket {
+		fmt.Printf("NAT traversal:   STUN and hole punching on the WireGuard socket\n")
+	} else {
+		fmt.Printf("NAT traversal:   keepalives only (the kernel owns the WireGuard socket)\n")
+	}
+	if status.NAT != nil {
+		fmt.Printf("NAT:             %s (mapping: %s, filtering: %s)\n", status.NAT.Type, status.NAT.Mapping, status.NAT.Filtering)
+	}
+	if len(status.AdvertisedRoutes) > 0 {
+		fmt.Printf("Advertising:     %s\n", strings.Join(status.AdvertisedRoutes, ", "))
+	}
+	if len(status.Routes) > 0 {
+		fmt.Printf("Subnet routes:   %s\n", strings.Join(status.Routes, ", "))
+	}
+	if len(status.PQBlocked) > 0 {
+		fmt.Printf("PQ blocked:      %s (post-quantum required, not supported)\n", strings.Join(status.PQBlocked, ", "))
+	}
+	if status.ExitNode != "" {
+		fmt.Printf("Exit node:       %s\n", status.ExitNode)
+	} else if len(status.ExitNodes) > 0 {
+		fmt.Printf("Exit nodes:      %s (not in use)\n", strings.Join(status.ExitNodes, ", "))
+	}
+	if cp := status.ControlPlane; cp != nil {
+		state := "disconnected"
+		if cp.Connected {
+			state = "connected"
+		} else if cp.CachedPeers != "" {
+			state = "offline, using peers cached " + since(cp.CachedPeers)
+		}
+		fmt.Printf("Control plane:   %s (%s", cp.URL, state)
+		if cp.LastContact != "" {
+			fmt.Printf(", last contact %s", since(cp.LastContact))
+		}
+		fmt.Println(")")
+		if cp.LastError != "" {
+			fmt.Printf("                 last error: %s\n", cp.LastError)
+		}
+	}
+
+	up := 0
+	for _, peer := range status.Peers {
+		if peer.Up {
+			up++
+		}
+	}
+	fmt.Printf("Peers:           %d (%d up)\n", len(status.Peers), up)
+	return nil
+}
+
+// runPeers lists the node's peers
+func runPeers(args []string) error {
+	fs, socket := newFlagSet("peers")
+	asJSON := fs.Bool("json", false, "Print JSON")
+	fs.Parse(args)
+
+	peers, err := localapi.NewClient(*socket).Peers()
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		return printJSON(peers)
+	}
+
+	if peers.Count == 0 {
+		fmt.Println("No peers")
+		return nil
+	}
+
+	w := newTable()
+	fmt.Fprintln(w, "PEER\tVIRTUAL IP\tENDPOINT\tSTATE\tHANDSHAKE\tRX\tTX\tSTRATEGY\tPSK")
+	for _, peer := range peers.Peers {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			peerName(&peer),
+			strings.Join(peer.AllowedIPs, ","),
+			orDash(peer.Endpoint),
+			upDown(peer.Up),
+			since(peer.LastHandshake),
+			formatBytes(peer.RxBytes),
+			formatBytes(peer.TxBytes),
+			orDash(peer.Strategy),
+			tunnelKey(&peer),
+		)
+	}
+	return w.Flush()
+}
+
+// peerName returns the peer's name or ID, or a shortened key for unknown
+// peers
+func peerName(peer *proto.TunnelStats) string {
+	if peer.Name != "" {
+		return peer.Name
+	}
+	if peer.PeerID != "" {
+		return peer.PeerID
+	}
+	if len(peer.PublicKey) > 12 {
+		return peer.PublicKey[:12] + "..."
+	}
+	return peer.PublicKey
+}
+
+// upDown renders a tunnel state
+func upDown(up bool) string {
+	if up {
+		return "up"
+	}
+	return "down"
+}
+
+// orDash returns "-" for empty values
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// tunnelKey renders a tunnel's preshared key: post-quantum, or the pair's
+// epoch
+func tunnelKey(peer *proto.TunnelStats) string {
+	switch {
+	case peer.PQState == "active":
+		return "pq"
+	case peer.PQRequired:
+		return fmt.Sprintf("pq %s (required)", peer.PQState)
+	case peer.PSKEpoch != 0:
+		return fmt.Sprintf("epoch %d", peer.PSKEpoch)
+	case peer.PQState != "":
+		return "pq " + peer.PQState
+	}
+	return "-"
+}
+
+// since renders an RFC3339 timestamp as a relative time
+func since(timestamp string) string {
+	if timestamp == "" {
+		return "never"
+	}
+	t, err := time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		return timestamp
+	}
+	return time.Since(t).Round(time.Second).String() + " ago"
+}
+
+// formatBytes renders a byte count with a binary unit
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/proto"
+)
+
+// runEvents prints the control plane event log, optionally following it
+func runEvents(args []string) error {
+	fs, opts := newFlagSet("events")
+	limit := fs.Int("limit", 50, "Number of recent events to show")
+	follow := fs.Bool("f", false, "Follow the log, printing new events as they happen")
+	interval := fs.Duration("interval", 2*time.Second, "Poll interval when following")
+	fs.Parse(args)
+
+	c, output, err := opts.resolve()
+	if err != nil {
+		return err
+	}
+
+	query := url.Values{"limit": {strconv.Itoa(*limit)}}
+	var since int64
+	for {
+		var resp proto.EventsResponse
+		if err := c.get("/admin/events", query, &resp); err != nil {
+			return err
+		}
+
+		if !*follow && output == "json" {
+			return printJSON(resp)
+		}
+
+		for _, event := range resp.Events {
+			if output == "json" {
+				printJSON(event)
+			} else {
+				fmt.Printf("%s  %-16s %s\n", event.Time, event.Type, event.Message)
+			}
+			since = event.ID
+		}
+
+		if !*follow {
+			return nil
+		}
+
+		// After the initial page, fetch everything newer than the last
+		// event printed; while the log is empty every event is new
+		query.Del("limit")
+		if since > 0 {
+			query.Set("since", strconv.FormatInt(since, 10))
+		}
+		time.Sleep(*interval)
+	}
+}
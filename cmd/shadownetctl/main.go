@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// command is a shadownetctl subcommand; commands without a name are run
+// directly by their group
+type command struct {
+	group   string
+	name    string
+	summary string
+	run     func(args []string) error
+}
+
+var commands = []command{
+	{"peers", "list", "List peers", runPeersList},
+	{"peers", "get", "Show a peer", runPeersGet},
+	{"peers", "delete", "Delete a peer", runPeersDelete},
+	{"peers", "keys", "Show the key history of a peer", runPeersKeys},
+	{"routes", "list", "List advertised and approved subnet routes", runRoutesList},
+	{"routes", "approve", "Approve subnet routes of a peer", runRoutesApprove},
+	{"routes", "unapprove", "Withdraw approval for subnet routes of a peer", runRoutesUnapprove},
+	{"tokens", "list", "List join tokens", runTokensList},
+	{"tokens", "create", "Create a join token", runTokensCreate},
+	{"tokens", "revoke", "Revoke a join token", runTokensRevoke},
+	{"networks", "list", "List networks", runNetworksList},
+	{"networks", "get", "Show a network", runNetworksGet},
+	{"networks", "create", "Create a network", runNetworksCreate},
+	{"networks", "delete", "Delete an empty network", runNetworksDelete},
+	{"acl", "get", "Show a network's ACL policy", runACLGet},
+	{"acl", "set", "Replace a network's ACL policy from a JSON file", runACLSet},
+	{"events", "", "Show or follow the control plane event log", runEvents},
+	{"export", "", "Export networks, peers and join tokens as JSON", runExport},
+	{"import", "", "Import a state export", runImport},
+	{"profile", "list", "List profiles", runProfileList},
+	{"profile", "set", "Create or update a profile", runProfileSet},
+	{"profile", "use", "Select the default profile", runProfileUse},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	group := os.Args[1]
+	if group == "-h" || group == "--help" || group == "help" {
+		usage()
+		return
+	}
+
+	for _, cmd := range commands {
+		if cmd.group != group {
+			continue
+		}
+
+		args := os.Args[2:]
+		if cmd.name != "" {
+			if len(args) == 0 || args[0] != cmd.name {
+				continue
+			}
+			args = args[1:]
+		}
+
+		if err := cmd.run(args); err != nil {
+			fmt.Fprintf(os.Stderr, "shadownetctl %s: %v\n", group, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "shadownetctl: unknown command %q\n\n", joinArgs(os.Args[1:]))
+	usage()
+	os.Exit(2)
+}
+
+// usage prints the list of subcommands
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: shadownetctl <command> [subcommand] [flags]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-18s %s\n", joinArgs([]string{cmd.group, cmd.name}), cmd.summary)
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Run 'shadownetctl <command> [subcommand] -h' for command flags.")
+}
+
+// joinArgs joins the non-empty arguments with spaces
+func joinArgs(args []string) string {
+	s := ""
+	for _, arg := range args {
+		if arg == "" {
+			continue
+		}
+		if s != "" {
+			s += " "
+		}
+		s += arg
+	}
+	return s
+}
+
+// printJSON writes v as indented JSON
+func printJSON(v interface{}) error {
+	return newJSONEncoder(os.Stdout).Encode(v)
+}
+
+// newJSONEncoder returns an encoder writing indented JSON
+func newJSONEncoder(w io.Writer) *json.Encoder {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc
+}
+
+// newTable returns a tab-aligned writer for table output
+func newTable() *tabwriter.Writer {
+	return tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+}
+
+// getEnv gets environment variable with fallback
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// stringList is a flag that may be repeated
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/proto"
+)
+
+// runNetworksList lists networks
+func runNetworksList(args []string) error {
+	fs, opts := newFlagSet("networks list")
+	fs.Parse(args)
+
+	c, output, err := opts.resolve()
+	if err != nil {
+		return err
+	}
+
+	var resp proto.NetworksResponse
+	if err := c.get("/admin/networks", nil, &resp); err != nil {
+		return err
+	}
+
+	return render(output, resp, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "NAME\tACL RULES\tCREATED\tDESCRIPTION")
+		for _, network := range resp.Networks {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n",
+				network.Name, aclSummary(network.ACL), network.CreatedAt, orDash(network.Description))
+		}
+	})
+}
+
+// runNetworksGet shows a network
+func runNetworksGet(args []string) error {
+	fs, opts := newFlagSet("networks get")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: shadownetctl networks get <name> [flags]")
+		fs.PrintDefaults()
+	}
+	name := parseWithArg(fs, args)
+
+	c, output, err := opts.resolve()
+	if err != nil {
+		return err
+	}
+
+	var network proto.Network
+	if err := c.get("/admin/networks/"+url.PathEscape(name), nil, &network); err != nil {
+		return err
+	}
+
+	return render(output, network, func(w *tabwriter.Writer) {
+		fmt.Fprintf(w, "Name:\t%s\n", network.Name)
+		fmt.Fprintf(w, "Description:\t%s\n", orDash(network.Description))
+		fmt.Fprintf(w, "Created:\t%s\n", network.CreatedAt)
+		fmt.Fprintf(w, "ACL:\t%s\n", aclSummary(network.ACL))
+		printACLRules(w, network.ACL)
+	})
+}
+
+// runNetworksCreate creates a network
+func runNetworksCreate(args []string) error {
+	fs, opts := newFlagSet("networks create")
+	description := fs.String("description", "", "Description")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: shadownetctl networks create <name> [flags]")
+		fs.PrintDefaults()
+	}
+	name := parseWithArg(fs, args)
+
+	c, output, err := opts.resolve()
+	if err != nil {
+		return err
+	}
+
+	var network proto.Network
+	req := proto.Network{Name: name, Description: *description}
+	if err := c.do("POST", "/admin/networks", req, &network); err != nil {
+		return err
+	}
+
+	return render(output, network, func(w *tabwriter.Writer) {
+		fmt.Fprintf(w, "Created network %s\n", network.Name)
+	})
+}
+
+// runNetworksDelete deletes an empty network
+func runNetworksDelete(args []string) error {
+	fs, opts := newFlagSet("networks delete")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: shadownetctl networks delete <name> [flags]")
+		fs.PrintDefaults()
+	}
+	name := parseWithArg(fs, args)
+
+	c, output, err := opts.resolve()
+	if err != nil {
+		return err
+	}
+
+	var resp proto.RegisterResponse
+	if err := c.do("DELETE", "/admin/networks/"+url.PathEscape(name), nil, &resp); err != nil {
+		return err
+	}
+
+	return render(output, resp, func(w *tabwriter.Writer) {
+		fmt.Fprintf(w, "Deleted network %s\n", name)
+	})
+}
+
+// runACLGet shows a network's ACL policy
+func runACLGet(args []string) error {
+	fs, opts := newFlagSet("acl get")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: shadownetctl acl get <network> [flags]")
+		fs.PrintDefaults()
+	}
+	name := parseWithArg(fs, args)
+
+	c, output, err := opts.resolve()
+	if err != nil {
+		return err
+	}
+
+	var policy proto.ACLPolicy
+	if err := c.get("/admin/networks/"+url.PathEscape(name)+"/acl", nil, &policy); err != nil {
+		return err
+	}
+
+	return render(output, policy, func(w *tabwriter.Writer) {
+		fmt.Fprintf(w, "ACL of %s:\t%s\n", name, aclSummary(&policy))
+		printACLRules(w, &policy)
+	})
+}
+
+// runACLSet replaces a network's ACL policy with one read from a JSON file
+func runACLSet(args []string) error {
+	fs, opts := newFlagSet("acl set")
+	file := fs.String("f", "", "Policy file, {\"rules\": [{\"src\": [...], \"dst\": [...]}]} (- for stdin)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: shadownetctl acl set <network> -f <policy.json> [flags]")
+		fs.PrintDefaults()
+	}
+	name := parseWithArg(fs, args)
+	if *file == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	var policy proto.ACLPolicy
+	if err := readJSONFile(*file, &policy); err != nil {
+		return err
+	}
+
+	c, output, err := opts.resolve()
+	if err != nil {
+		return err
+	}
+
+	var updated proto.ACLPolicy
+	if err := c.do("PUT", "/admin/networks/"+url.PathEscape(name)+"/acl", policy, &updated); err != nil {
+		return err
+	}
+
+	return render(output, updated, func(w *tabwriter.Writer) {
+		fmt.Fprintf(w, "Updated ACL of %s:\t%s\n", name, aclSummary(&updated))
+	})
+}
+
+// aclSummary describes an ACL policy in a few words
+func aclSummary(policy *proto.ACLPolicy) string {
+	if policy == nil || len(policy.Rules) == 0 {
+		return "allow all"
+	}
+	return fmt.Sprintf("%d rules", len(policy.Rules))
+}
+
+// printACLRules writes one line per ACL rule
+func printACLRules(w io.Writer, policy *proto.ACLPolicy) {
+	if policy == nil {
+		return
+	}
+	for _, rule := range policy.Rules {
+		fmt.Fprintf(w, "  %s\t-> %s\n", strings.Join(rule.Sources, ","), strings.Join(rule.Destinations, ","))
+	}
+}
+
+// readJSONFile decodes a JSON file, or stdin for "-"
+func readJSONFile(path string, v interface{}) error {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %w", path, err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return nil
+}
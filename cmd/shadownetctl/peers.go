@@ -0,0 +1,253 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/proto"
+)
+
+// render prints v as JSON or, for table output, through the table function
+func render(output string, v interface{}, table func(w *tabwriter.Writer)) error {
+	if output == "json" {
+		return printJSON(v)
+	}
+
+	w := newTable()
+	table(w)
+	return w.Flush()
+}
+
+// runPeersList lists peers
+func runPeersList(args []string) error {
+	fs, opts := newFlagSet("peers list")
+	network := fs.String("network", "", "Only list peers of this network")
+	var tags, labels stringList
+	fs.Var(&tags, "tag", "Only list peers with this tag (repeatable)")
+	fs.Var(&labels, "label", "Only list peers with this key=value label (repeatable)")
+	fs.Parse(args)
+
+	c, output, err := opts.resolve()
+	if err != nil {
+		return err
+	}
+
+	query := url.Values{}
+	if *network != "" {
+		query.Set("network", *network)
+	}
+	for _, tag := range tags {
+		query.Add("tag", tag)
+	}
+	for _, label := range labels {
+		query.Add("label", label)
+	}
+
+	var resp proto.PeersResponse
+	if err := c.get("/admin/peers", query, &resp); err != nil {
+		return err
+	}
+
+	return render(output, resp, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "ID\tNAME\tNETWORK\tOS\tTAGS\tENDPOINT\tNAT\tLAST SEEN\tTUNNELS")
+		for _, peer := range resp.Peers {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				peer.ID, orDash(peer.Name), orDash(peer.Network), platform(&peer), orDash(strings.Join(peer.Tags, ",")),
+				endpoint(&peer), natType(&peer), since(peer.LastSeen), tunnelsUp(&peer))
+		}
+	})
+}
+
+// runPeersGet shows a peer
+func runPeersGet(args []string) error {
+	fs, opts := newFlagSet("peers get")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: shadownetctl peers get <id> [flags]")
+		fs.PrintDefaults()
+	}
+	id := parseWithArg(fs, args)
+
+	c, output, err := opts.resolve()
+	if err != nil {
+		return err
+	}
+
+	var peer proto.PeerInfo
+	if err := c.get("/admin/peers/"+url.PathEscape(id), nil, &peer); err != nil {
+		return err
+	}
+
+	return render(output, peer, func(w *tabwriter.Writer) {
+		fmt.Fprintf(w, "ID:\t%s\n", peer.ID)
+		fmt.Fprintf(w, "Name:\t%s\n", orDash(peer.Name))
+		fmt.Fprintf(w, "Network:\t%s\n", orDash(peer.Network))
+		fmt.Fprintf(w, "Hostname:\t%s\n", orDash(peer.Hostname))
+		fmt.Fprintf(w, "Platform:\t%s\n", platform(&peer))
+		fmt.Fprintf(w, "Version:\t%s\n", orDash(peer.Version))
+		fmt.Fprintf(w, "Tags:\t%s\n", orDash(strings.Join(peer.Tags, ", ")))
+		fmt.Fprintf(w, "Labels:\t%s\n", orDash(formatLabels(peer.Labels)))
+		fmt.Fprintf(w, "Advertised routes:\t%s\n", orDash(strings.Join(peer.AdvertisedRoutes, ", ")))
+		fmt.Fprintf(w, "Approved routes:\t%s\n", orDash(strings.Join(peer.ApprovedRoutes, ", ")))
+		fmt.Fprintf(w, "Public key:\t%s\n", peer.WGPublicKey)
+		if peer.NextWGPublicKey != "" {
+			fmt.Fprintf(w, "Next public key:\t%s (from %s)\n", peer.NextWGPublicKey, peer.KeySwitchAt)
+		}
+		fmt.Fprintf(w, "Endpoint:\t%s\n", endpoint(&peer))
+		fmt.Fprintf(w, "IPv6 endpoint:\t%s\n", endpointV6(&peer))
+		fmt.Fprintf(w, "NAT:\t%s\n", natType(&peer))
+		fmt.Fprintf(w, "Last seen:\t%s\n", since(peer.LastSeen))
+		fmt.Fprintf(w, "Tunnels:\t%s\n", tunnelsUp(&peer))
+		for _, tunnel := range peer.Tunnels {
+			fmt.Fprintf(w, "  %s\t%s\t%s\thandshake %s\n",
+				orDash(tunnel.PeerID), orDash(tunnel.Endpoint), upDown(tunnel.Up), since(tunnel.LastHandshake))
+		}
+	})
+}
+
+// runPeersDelete deletes a peer
+func runPeersDelete(args []string) error {
+	fs, opts := newFlagSet("peers delete")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: shadownetctl peers delete <id> [flags]")
+		fs.PrintDefaults()
+	}
+	id := parseWithArg(fs, args)
+
+	c, output, err := opts.resolve()
+	if err != nil {
+		return err
+	}
+
+	var resp proto.RegisterResponse
+	if err := c.do("DELETE", "/admin/peers/"+url.PathEscape(id), nil, &resp); err != nil {
+		return err
+	}
+
+	return render(output, resp, func(w *tabwriter.Writer) {
+		fmt.Fprintf(w, "Deleted peer %s\n", id)
+	})
+}
+
+// runPeersKeys shows the key history of a peer
+func runPeersKeys(args []string) error {
+	fs, opts := newFlagSet("peers keys")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: shadownetctl peers keys <id> [flags]")
+		fs.PrintDefaults()
+	}
+	id := parseWithArg(fs, args)
+
+	c, output, err := opts.resolve()
+	if err != nil {
+		return err
+	}
+
+	var resp proto.PeerKeysResponse
+	if err := c.get("/admin/peers/"+url.PathEscape(id)+"/keys", nil, &resp); err != nil {
+		return err
+	}
+
+	return render(output, resp, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "PUBLIC KEY\tADDED\tRETIRED")
+		for _, key := range resp.Keys {
+			retired := "in use"
+			if key.RetiredAt != "" {
+				retired = since(key.RetiredAt)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", key.PublicKey, since(key.AddedAt), retired)
+		}
+	})
+}
+
+// endpoint renders a peer's public endpoint
+func endpoint(peer *proto.PeerInfo) string {
+	if peer.EndpointIP == "" {
+		return "-"
+	}
+	return net.JoinHostPort(peer.EndpointIP, strconv.Itoa(peer.EndpointPort))
+}
+
+// endpointV6 renders a peer's IPv6 endpoint
+func endpointV6(peer *proto.PeerInfo) string {
+	if peer.EndpointIPv6 == "" {
+		return "-"
+	}
+	return net.JoinHostPort(peer.EndpointIPv6, strconv.Itoa(peer.EndpointPortV6))
+}
+
+// platform renders a peer's OS and architecture
+func platform(peer *proto.PeerInfo) string {
+	if peer.OS == "" {
+		return "-"
+	}
+	if peer.Arch == "" {
+		return peer.OS
+	}
+	return peer.OS + "/" + peer.Arch
+}
+
+// formatLabels renders labels as sorted key=value pairs
+func formatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for key, value := range labels {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ", ")
+}
+
+// natType renders a peer's NAT type
+func natType(peer *proto.PeerInfo) string {
+	if peer.NAT == nil {
+		return "-"
+	}
+	return peer.NAT.Type
+}
+
+// tunnelsUp renders how many of a peer's tunnels are up
+func tunnelsUp(peer *proto.PeerInfo) string {
+	if len(peer.Tunnels) == 0 {
+		return "-"
+	}
+	up := 0
+	for _, tunnel := range peer.Tunnels {
+		if tunnel.Up {
+			up++
+		}
+	}
+	return fmt.Sprintf("%d/%d up", up, len(peer.Tunnels))
+}
+
+// upDown renders a tunnel state
+func upDown(up bool) string {
+	if up {
+		return "up"
+	}
+	return "down"
+}
+
+// orDash returns "-" for empty values
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// since renders an RFC3339 timestamp as a relative time
+func since(timestamp string) string {
+	if timestamp == "" {
+		return "never"
+	}
+	t, err := time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		return timestamp
+	}
+	return time.Since(t).Round(time.Second).String() + " ago"
+}
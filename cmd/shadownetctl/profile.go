@@ -0,0 +1,275 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// defaultURL is used when neither flags, environment nor profile set a URL
+const defaultURL = "http://localhost:8080"
+
+// profile holds the connection settings for one control plane
+type profile struct {
+	URL    string `json:"url"`
+	APIKey string `json:"api_key,omitempty"`
+	Output string `json:"output,omitempty"` // table or json
+}
+
+// profileFile is the on-disk profile configuration
+type profileFile struct {
+	Current  string              `json:"current"`
+	Profiles map[string]*profile `json:"profiles"`
+}
+
+// profilePath returns the profile file location
+func profilePath() string {
+	if path := os.Getenv("SHADOWNETCTL_CONFIG"); path != "" {
+		return path
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = "."
+	}
+	return filepath.Join(dir, "shadownet", "shadownetctl.json")
+}
+
+// loadProfiles reads the profile file; a missing file is an empty one
+func loadProfiles() (*profileFile, error) {
+	file := &profileFile{Profiles: map[string]*profile{}}
+
+	data, err := os.ReadFile(profilePath())
+	if errors.Is(err, os.ErrNotExist) {
+		return file, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profiles: %w", err)
+	}
+
+	if err := json.Unmarshal(data, file); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", profilePath(), err)
+	}
+	if file.Profiles == nil {
+		file.Profiles = map[string]*profile{}
+	}
+
+	return file, nil
+}
+
+// save writes the profile file readable only by its owner, since it holds
+// API keys
+func (f *profileFile) save() error {
+	path := profilePath()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode profiles: %w", err)
+	}
+
+	if err := os.WriteFile(path, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("failed to write profiles: %w", err)
+	}
+
+	return nil
+}
+
+// options are the connection and output flags every command accepts
+type options struct {
+	profile string
+	url     string
+	apiKey  string
+	output  string
+}
+
+// newFlagSet creates a flag set with the shared connection and output flags
+func newFlagSet(name string) (*flag.FlagSet, *options) {
+	opts := &options{}
+	fs := flag.NewFlagSet("shadownetctl "+name, flag.ExitOnError)
+	fs.StringVar(&opts.profile, "profile", os.Getenv("SHADOWNETCTL_PROFILE"), "Profile to use (default: the current profile)")
+	fs.StringVar(&opts.url, "url", os.Getenv("SHADOWNETCTL_URL"), "Control plane URL (overrides the profile)")
+	fs.StringVar(&opts.apiKey, "api-key", os.Getenv("SHADOWNETCTL_API_KEY"), "Control plane API key (overrides the profile)")
+	fs.StringVar(&opts.output, "o", "", "Output format: table or json (default: the profile's, else table)")
+	return fs, opts
+}
+
+// resolve merges flags, environment and the selected profile into a
+// client and output format. Flags and environment win over the profile.
+func (o *options) resolve() (*client, string, error) {
+	file, err := loadProfiles()
+	if err != nil {
+		return nil, "", err
+	}
+
+	name := o.profile
+	if name == "" {
+		name = file.Current
+	}
+
+	selected := &profile{}
+	if name != "" {
+		p, ok := file.Profiles[name]
+		if !ok {
+			return nil, "", fmt.Errorf("unknown profile %q", name)
+		}
+		selected = p
+	}
+
+	url := firstNonEmpty(o.url, selected.URL, defaultURL)
+	apiKey := firstNonEmpty(o.apiKey, selected.APIKey)
+	output := firstNonEmpty(o.output, selected.Output, "table")
+	if output != "table" && output != "json" {
+		return nil, "", fmt.Errorf("invalid output format %q: use table or json", output)
+	}
+
+	return newClient(url, apiKey), output, nil
+}
+
+// firstNonEmpty returns the first non-empty value
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// runProfileList lists profiles
+func runProfileList(args []string) error {
+	fs := flag.NewFlagSet("shadownetctl profile list", flag.ExitOnError)
+	fs.Parse(args)
+
+	file, err := loadProfiles()
+	if err != nil {
+		return err
+	}
+
+	if len(file.Profiles) == 0 {
+		fmt.Printf("No profiles in %s\n", profilePath())
+		return nil
+	}
+
+	names := make([]string, 0, len(file.Profiles))
+	for name := range file.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w := newTable()
+	fmt.Fprintln(w, "CURRENT\tNAME\tURL\tAPI KEY\tOUTPUT")
+	for _, name := range names {
+		p := file.Profiles[name]
+		current := ""
+		if name == file.Current {
+			current = "*"
+		}
+		key := "-"
+		if p.APIKey != "" {
+			key = "set"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", current, name, p.URL, key, firstNonEmpty(p.Output, "table"))
+	}
+	return w.Flush()
+}
+
+// runProfileSet creates or updates a profile
+func runProfileSet(args []string) error {
+	fs := flag.NewFlagSet("shadownetctl profile set", flag.ExitOnError)
+	url := fs.String("url", "", "Control plane URL")
+	apiKey := fs.String("api-key", "", "Control plane API key")
+	output := fs.String("o", "", "Default output format: table or json")
+	use := fs.Bool("use", false, "Make this the current profile")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: shadownetctl profile set <name> [flags]")
+		fs.PrintDefaults()
+	}
+	name := parseWithArg(fs, args)
+
+	if *output != "" && *output != "table" && *output != "json" {
+		return fmt.Errorf("invalid output format %q: use table or json", *output)
+	}
+
+	file, err := loadProfiles()
+	if err != nil {
+		return err
+	}
+
+	p, ok := file.Profiles[name]
+	if !ok {
+		p = &profile{URL: defaultURL}
+		file.Profiles[name] = p
+	}
+	if *url != "" {
+		p.URL = strings.TrimRight(*url, "/")
+	}
+	if *apiKey != "" {
+		p.APIKey = *apiKey
+	}
+	if *output != "" {
+		p.Output = *output
+	}
+	if *use || file.Current == "" {
+		file.Current = name
+	}
+
+	if err := file.save(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Profile %s saved to %s\n", name, profilePath())
+	return nil
+}
+
+// runProfileUse selects the current profile
+func runProfileUse(args []string) error {
+	fs := flag.NewFlagSet("shadownetctl profile use", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: shadownetctl profile use <name>")
+	}
+	name := parseWithArg(fs, args)
+
+	file, err := loadProfiles()
+	if err != nil {
+		return err
+	}
+	if _, ok := file.Profiles[name]; !ok {
+		return fmt.Errorf("unknown profile %q", name)
+	}
+
+	file.Current = name
+	if err := file.save(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Using profile %s\n", name)
+	return nil
+}
+
+// parseWithArg parses flags around exactly one positional argument, which
+// may come before or after the flags
+func parseWithArg(fs *flag.FlagSet, args []string) string {
+	var positional string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		positional, args = args[0], args[1:]
+	}
+	fs.Parse(args)
+
+	if positional == "" && fs.NArg() > 0 {
+		positional = fs.Arg(0)
+		fs.Parse(fs.Args()[1:])
+	}
+	if positional == "" || fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	return positional
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/proto"
+)
+
+// runRoutesList lists peers that advertise or have approved subnet routes
+func runRoutesList(args []string) error {
+	fs, opts := newFlagSet("routes list")
+	network := fs.String("network", "", "Only list peers of this network")
+	pending := fs.Bool("pending", false, "Only list peers with routes waiting for approval")
+	fs.Parse(args)
+
+	c, output, err := opts.resolve()
+	if err != nil {
+		return err
+	}
+
+	query := url.Values{}
+	if *network != "" {
+		query.Set("network", *network)
+	}
+
+	var resp proto.PeersResponse
+	if err := c.get("/admin/peers", query, &resp); err != nil {
+		return err
+	}
+
+	peers := []proto.PeerInfo{}
+	for _, peer := range resp.Peers {
+		if len(peer.AdvertisedRoutes) == 0 && len(peer.ApprovedRoutes) == 0 {
+			continue
+		}
+		if *pending && len(pendingRoutes(&peer)) == 0 {
+			continue
+		}
+		peers = append(peers, peer)
+	}
+
+	return render(output, proto.PeersResponse{Peers: peers, Count: len(peers)}, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "ID\tNAME\tNETWORK\tADVERTISED\tAPPROVED\tPENDING")
+		for _, peer := range peers {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+				peer.ID, orDash(peer.Name), orDash(peer.Network),
+				orDash(strings.Join(peer.AdvertisedRoutes, ",")),
+				orDash(strings.Join(peer.ApprovedRoutes, ",")),
+				orDash(strings.Join(pendingRoutes(&peer), ",")))
+		}
+	})
+}
+
+// runRoutesApprove approves subnet routes of a peer
+func runRoutesApprove(args []string) error {
+	return updateApprovedRoutes("approve", args, func(approved, routes []string) []string {
+		for _, route := range routes {
+			if !containsRoute(approved, route) {
+				approved = append(approved, route)
+			}
+		}
+		return approved
+	})
+}
+
+// runRoutesUnapprove withdraws approval for subnet routes of a peer
+func runRoutesUnapprove(args []string) error {
+	return updateApprovedRoutes("unapprove", args, func(approved, routes []string) []string {
+		var kept []string
+		for _, route := range approved {
+			if !containsRoute(routes, route) {
+				kept = append(kept, route)
+			}
+		}
+		return kept
+	})
+}
+
+// updateApprovedRoutes reads a peer, applies update to its approved routes
+// with the routes given on the command line and stores the result
+func updateApprovedRoutes(name string, args []string, update func(approved, routes []string) []string) error {
+	fs, opts := newFlagSet("routes " + name)
+	routesFlag := fs.String("routes", "", "Routes, comma-separated CIDRs")
+	all := fs.Bool("all", false, "All routes the peer advertises (approve) or has approved (unapprove)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: shadownetctl routes %s <peer id> (--routes <cidr,...> | --all) [flags]\n", name)
+		fs.PrintDefaults()
+	}
+	id := parseWithArg(fs, args)
+
+	if (*routesFlag == "") == !*all {
+		return fmt.Errorf("pass either --routes or --all")
+	}
+
+	c, output, err := opts.resolve()
+	if err != nil {
+		return err
+	}
+
+	path := "/admin/peers/" + url.PathEscape(id)
+	var peer proto.PeerInfo
+	if err := c.get(path, nil, &peer); err != nil {
+		return err
+	}
+
+	routes := splitList(*routesFlag)
+	if *all {
+		routes = peer.AdvertisedRoutes
+		if name == "unapprove" {
+			routes = peer.ApprovedRoutes
+		}
+	}
+
+	req := proto.ApproveRoutesRequest{ApprovedRoutes: update(peer.ApprovedRoutes, routes)}
+	if req.ApprovedRoutes == nil {
+		req.ApprovedRoutes = []string{}
+	}
+
+	var updated proto.PeerInfo
+	if err := c.do("PUT", path+"/routes", req, &updated); err != nil {
+		return err
+	}
+
+	return render(output, updated, func(w *tabwriter.Writer) {
+		fmt.Fprintf(w, "Approved routes of %s:\t%s\n", id, orDash(strings.Join(updated.ApprovedRoutes, ", ")))
+		if pending := pendingRoutes(&updated); len(pending) > 0 {
+			fmt.Fprintf(w, "Still pending:\t%s\n", strings.Join(pending, ", "))
+		}
+	})
+}
+
+// pendingRoutes returns the advertised routes that are not approved
+func pendingRoutes(peer *proto.PeerInfo) []string {
+	var pending []string
+	for _, route := range peer.AdvertisedRoutes {
+		if !containsRoute(peer.ApprovedRoutes, route) {
+			pending = append(pending, route)
+		}
+	}
+	return pending
+}
+
+// containsRoute reports whether routes contains route
+func containsRoute(routes []string, route string) bool {
+	for _, r := range routes {
+		if r == route {
+			return true
+		}
+	}
+	return false
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
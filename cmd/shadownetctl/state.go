@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/proto"
+)
+
+// runExport writes the control plane state as JSON to stdout or a file
+func runExport(args []string) error {
+	fs, opts := newFlagSet("export")
+	file := fs.String("f", "", "Write the export to this file instead of stdout")
+	fs.Parse(args)
+
+	c, _, err := opts.resolve()
+	if err != nil {
+		return err
+	}
+
+	var state proto.State
+	if err := c.get("/admin/export", nil, &state); err != nil {
+		return err
+	}
+
+	if *file == "" {
+		return printJSON(state)
+	}
+
+	out, err := os.OpenFile(*file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", *file, err)
+	}
+	defer out.Close()
+
+	enc := newJSONEncoder(out)
+	if err := enc.Encode(state); err != nil {
+		return fmt.Errorf("failed to write %s: %w", *file, err)
+	}
+
+	fmt.Printf("Exported %d networks, %d peers and %d join tokens to %s\n",
+		len(state.Networks), len(state.Peers), len(state.Tokens), *file)
+	return nil
+}
+
+// runImport merges a state export into the control plane
+func runImport(args []string) error {
+	fs, opts := newFlagSet("import")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: shadownetctl import <file|-> [flags]")
+		fs.PrintDefaults()
+	}
+	path := parseWithArg(fs, args)
+
+	var state proto.State
+	if err := readJSONFile(path, &state); err != nil {
+		return err
+	}
+
+	c, output, err := opts.resolve()
+	if err != nil {
+		return err
+	}
+
+	var resp proto.ImportResponse
+	if err := c.do("POST", "/admin/import", state, &resp); err != nil {
+		return err
+	}
+
+	return render(output, resp, func(w *tabwriter.Writer) {
+		fmt.Fprintf(w, "Imported %d networks, %d peers and %d join tokens\n", resp.Networks, resp.Peers, resp.Tokens)
+	})
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/proto"
+)
+
+// runTokensList lists join tokens
+func runTokensList(args []string) error {
+	fs, opts := newFlagSet("tokens list")
+	fs.Parse(args)
+
+	c, output, err := opts.resolve()
+	if err != nil {
+		return err
+	}
+
+	var resp proto.TokensResponse
+	if err := c.get("/admin/tokens", nil, &resp); err != nil {
+		return err
+	}
+
+	return render(output, resp, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "ID\tNETWORK\tSTATE\tREUSABLE\tUSES\tEXPIRES\tDESCRIPTION")
+		for _, token := range resp.Tokens {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%t\t%d\t%s\t%s\n",
+				token.ID, token.Network, tokenState(&token), token.Reusable, token.Uses,
+				orDash(token.ExpiresAt), orDash(token.Description))
+		}
+	})
+}
+
+// runTokensCreate creates a join token and prints its secret
+func runTokensCreate(args []string) error {
+	fs, opts := newFlagSet("tokens create")
+	network := fs.String("network", proto.DefaultNetwork, "Network the token admits peers to")
+	description := fs.String("description", "", "Description")
+	reusable := fs.Bool("reusable", false, "Allow the token to admit any number of peers")
+	ttl := fs.Duration("ttl", 24*time.Hour, "How long the token is valid (0 never expires)")
+	fs.Parse(args)
+
+	c, output, err := opts.resolve()
+	if err != nil {
+		return err
+	}
+
+	req := proto.CreateTokenRequest{
+		Network:     *network,
+		Description: *description,
+		Reusable:    *reusable,
+		TTL:         int(ttl.Seconds()),
+	}
+
+	var token proto.JoinToken
+	if err := c.do("POST", "/admin/tokens", req, &token); err != nil {
+		return err
+	}
+
+	return render(output, token, func(w *tabwriter.Writer) {
+		fmt.Fprintf(w, "ID:\t%s\n", token.ID)
+		fmt.Fprintf(w, "Network:\t%s\n", token.Network)
+		fmt.Fprintf(w, "Reusable:\t%t\n", token.Reusable)
+		fmt.Fprintf(w, "Expires:\t%s\n", firstNonEmpty(token.ExpiresAt, "never"))
+		fmt.Fprintf(w, "Secret:\t%s\n", token.Secret)
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "The secret is shown only once. Start nodes with --join-token <secret>.")
+	})
+}
+
+// runTokensRevoke revokes a join token
+func runTokensRevoke(args []string) error {
+	fs, opts := newFlagSet("tokens revoke")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: shadownetctl tokens revoke <id> [flags]")
+		fs.PrintDefaults()
+	}
+	id := parseWithArg(fs, args)
+
+	c, output, err := opts.resolve()
+	if err != nil {
+		return err
+	}
+
+	var resp proto.RegisterResponse
+	if err := c.do("DELETE", "/admin/tokens/"+url.PathEscape(id), nil, &resp); err != nil {
+		return err
+	}
+
+	return render(output, resp, func(w *tabwriter.Writer) {
+		fmt.Fprintf(w, "Revoked join token %s\n", id)
+	})
+}
+
+// tokenState summarizes whether a token can still be used
+func tokenState(token *proto.JoinToken) string {
+	expiresAt, err := time.Parse(time.RFC3339, token.ExpiresAt)
+	switch {
+	case token.Revoked:
+		return "revoked"
+	case err == nil && time.Now().After(expiresAt):
+		return "expired"
+	case !token.Reusable && token.Uses > 0:
+		return "used"
+	default:
+		return "valid"
+	}
+}
@@ -0,0 +1,34 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/controlplane/service"
+)
+
+// maxAdminBody bounds admin request bodies, including state imports
+const maxAdminBody = 16 << 20
+
+// decodeAdminBody decodes a JSON request body, writing an error response
+// and returning false if it is invalid
+func decodeAdminBody(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAdminBody)).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return false
+	}
+	return true
+}
+
+// writeServiceError maps a service error to a response: missing resources
+// are 404s, everything else is rejected as a bad request
+func writeServiceError(w http.ResponseWriter, err error) {
+	if errors.Is(err, service.ErrNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	log.Printf("Admin request failed: %v", err)
+	writeError(w, http.StatusBadRequest, err.Error())
+}
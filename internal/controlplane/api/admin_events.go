@@ -0,0 +1,53 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/controlplane/service"
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/proto"
+)
+
+// AdminEventsHandler handles the event log
+type AdminEventsHandler struct {
+	eventService *service.EventService
+}
+
+// NewAdminEventsHandler creates a new admin events handler
+func NewAdminEventsHandler(eventService *service.EventService) *AdminEventsHandler {
+	return &AdminEventsHandler{
+		eventService: eventService,
+	}
+}
+
+// ServeHTTP handles GET /admin/events?since=<id>&limit=<n>
+func (h *AdminEventsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var since int64
+	var limit int
+	var err error
+	if v := r.URL.Query().Get("since"); v != "" {
+		if since, err = strconv.ParseInt(v, 10, 64); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid since parameter")
+			return
+		}
+	}
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid limit parameter")
+			return
+		}
+	}
+
+	events, err := h.eventService.List(since, limit)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, proto.EventsResponse{Events: events, Count: len(events)})
+}
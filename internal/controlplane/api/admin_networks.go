@@ -0,0 +1,107 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/controlplane/service"
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/proto"
+)
+
+// AdminNetworksHandler handles network administration
+type AdminNetworksHandler struct {
+	networkService *service.NetworkService
+}
+
+// NewAdminNetworksHandler creates a new admin networks handler
+func NewAdminNetworksHandler(networkService *service.NetworkService) *AdminNetworksHandler {
+	return &AdminNetworksHandler{
+		networkService: networkService,
+	}
+}
+
+// ServeHTTP handles GET/POST /admin/networks and GET/DELETE
+// /admin/networks/{name}
+func (h *AdminNetworksHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	switch {
+	case name == "" && r.Method == http.MethodGet:
+		networks, err := h.networkService.List()
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, proto.NetworksResponse{Networks: networks, Count: len(networks)})
+
+	case name == "" && r.Method == http.MethodPost:
+		var req proto.Network
+		if !decodeAdminBody(w, r, &req) {
+			return
+		}
+		network, err := h.networkService.Create(&req)
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, network)
+
+	case name != "" && r.Method == http.MethodGet:
+		network, err := h.networkService.Get(name)
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, network)
+
+	case name != "" && r.Method == http.MethodDelete:
+		if err := h.networkService.Delete(name); err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, proto.RegisterResponse{Success: true, Message: "network deleted"})
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// AdminACLHandler handles network ACL policies
+type AdminACLHandler struct {
+	networkService *service.NetworkService
+}
+
+// NewAdminACLHandler creates a new admin ACL handler
+func NewAdminACLHandler(networkService *service.NetworkService) *AdminACLHandler {
+	return &AdminACLHandler{
+		networkService: networkService,
+	}
+}
+
+// ServeHTTP handles GET/PUT /admin/networks/{name}/acl
+func (h *AdminACLHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	switch r.Method {
+	case http.MethodGet:
+		policy, err := h.networkService.GetACL(name)
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, policy)
+
+	case http.MethodPut:
+		var policy proto.ACLPolicy
+		if !decodeAdminBody(w, r, &policy) {
+			return
+		}
+		if err := h.networkService.SetACL(name, &policy); err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, policy)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
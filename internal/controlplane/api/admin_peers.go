@@ -0,0 +1,117 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/controlplane/service"
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/proto"
+)
+
+// AdminPeersHandler handles peer administration
+type AdminPeersHandler struct {
+	peerService *service.PeerService
+}
+
+// NewAdminPeersHandler creates a new admin peers handler
+func NewAdminPeersHandler(peerService *service.PeerService) *AdminPeersHandler {
+	return &AdminPeersHandler{
+		peerService: peerService,
+	}
+}
+
+// ServeHTTP handles GET /admin/peers and GET/DELETE /admin/peers/{id}
+func (h *AdminPeersHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		filter, err := parsePeerFilter(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		peers, err := h.peerService.ListPeers(filter)
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, proto.PeersResponse{Peers: peers, Count: len(peers)})
+
+	case id != "" && r.Method == http.MethodGet:
+		peer, err := h.peerService.GetPeerByID(id)
+		if err != nil {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, peer)
+
+	case id != "" && r.Method == http.MethodDelete:
+		if err := h.peerService.DeletePeer(id); err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, proto.RegisterResponse{Success: true, Message: "peer deleted"})
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// AdminRoutesHandler handles subnet route approval
+type AdminRoutesHandler struct {
+	peerService *service.PeerService
+}
+
+// NewAdminRoutesHandler creates a new admin routes handler
+func NewAdminRoutesHandler(peerService *service.PeerService) *AdminRoutesHandler {
+	return &AdminRoutesHandler{
+		peerService: peerService,
+	}
+}
+
+// ServeHTTP handles PUT /admin/peers/{id}/routes
+func (h *AdminRoutesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req proto.ApproveRoutesRequest
+	if !decodeAdminBody(w, r, &req) {
+		return
+	}
+
+	peer, err := h.peerService.ApproveRoutes(r.PathValue("id"), req.ApprovedRoutes)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, peer)
+}
+
+// AdminKeysHandler handles the key history of peers
+type AdminKeysHandler struct {
+	peerService *service.PeerService
+}
+
+// NewAdminKeysHandler creates a new admin keys handler
+func NewAdminKeysHandler(peerService *service.PeerService) *AdminKeysHandler {
+	return &AdminKeysHandler{
+		peerService: peerService,
+	}
+}
+
+// ServeHTTP handles GET /admin/peers/{id}/keys
+func (h *AdminKeysHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	keys, err := h.peerService.PeerKeys(r.PathValue("id"))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, proto.PeerKeysResponse{Keys: keys, Count: len(keys)})
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/controlplane/service"
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/proto"
+)
+
+// AdminStateHandler handles state export and import
+type AdminStateHandler struct {
+	stateService *service.StateService
+}
+
+// NewAdminStateHandler creates a new admin state handler
+func NewAdminStateHandler(stateService *service.StateService) *AdminStateHandler {
+	return &AdminStateHandler{
+		stateService: stateService,
+	}
+}
+
+// ServeHTTP handles GET /admin/export and POST /admin/import
+func (h *AdminStateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/admin/export" && r.Method == http.MethodGet:
+		state, err := h.stateService.Export()
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, state)
+
+	case r.URL.Path == "/admin/import" && r.Method == http.MethodPost:
+		var state proto.State
+		if !decodeAdminBody(w, r, &state) {
+			return
+		}
+		result, err := h.stateService.Import(&state)
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, result)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
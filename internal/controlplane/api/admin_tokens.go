@@ -0,0 +1,57 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/controlplane/service"
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/proto"
+)
+
+// AdminTokensHandler handles join token administration
+type AdminTokensHandler struct {
+	tokenService *service.TokenService
+}
+
+// NewAdminTokensHandler creates a new admin tokens handler
+func NewAdminTokensHandler(tokenService *service.TokenService) *AdminTokensHandler {
+	return &AdminTokensHandler{
+		tokenService: tokenService,
+	}
+}
+
+// ServeHTTP handles GET/POST /admin/tokens and DELETE /admin/tokens/{id}
+func (h *AdminTokensHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		tokens, err := h.tokenService.List()
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, proto.TokensResponse{Tokens: tokens, Count: len(tokens)})
+
+	case id == "" && r.Method == http.MethodPost:
+		var req proto.CreateTokenRequest
+		if !decodeAdminBody(w, r, &req) {
+			return
+		}
+		token, err := h.tokenService.Create(&req)
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, token)
+
+	case id != "" && r.Method == http.MethodDelete:
+		if err := h.tokenService.Revoke(id); err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, proto.RegisterResponse{Success: true, Message: "join token revoked"})
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
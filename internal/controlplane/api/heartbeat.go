@@ -2,6 +2,7 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 
@@ -12,12 +13,14 @@ import (
 // HeartbeatHandler handles peer heartbeats
 type HeartbeatHandler struct {
 	peerService *service.PeerService
+	pskService  *service.PSKService
 }
 
 // NewHeartbeatHandler creates a new heartbeat handler
-func NewHeartbeatHandler(peerService *service.PeerService) *HeartbeatHandler {
+func NewHeartbeatHandler(peerService *service.PeerService, pskService *service.PSKService) *HeartbeatHandler {
 	return &HeartbeatHandler{
 		peerService: peerService,
+		pskService:  pskService,
 	}
 }
 
@@ -35,15 +38,31 @@ func (h *HeartbeatHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Update heartbeat
-	if err := h.peerService.UpdateHeartbeat(req.ID); err != nil {
+	if err := h.peerService.UpdateHeartbeat(req.ID, req.Tunnels); err != nil {
 		log.Printf("Failed to update heartbeat for %s: %v", req.ID, err)
+		if errors.Is(err, service.ErrNotFound) {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
 		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
 	// Send success response
+	// Without a revision nodes just don't learn about peer changes early
+	revision, err := h.peerService.PeersRevision()
+	if err != nil {
+		log.Printf("Failed to read peers revision: %v", err)
+	}
+	pskRevision, err := h.pskService.Revision(req.ID)
+	if err != nil {
+		log.Printf("Failed to read preshared key revision: %v", err)
+	}
+
 	writeJSON(w, http.StatusOK, proto.HeartbeatResponse{
-		Success: true,
-		Message: "heartbeat received",
+		Success:       true,
+		Message:       "heartbeat received",
+		PeersRevision: revision,
+		PSKRevision:   pskRevision,
 	})
 }
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/controlplane/service"
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/proto"
+)
+
+// KeyChallengeHandler hands out key rotation challenges
+type KeyChallengeHandler struct {
+	peerService *service.PeerService
+}
+
+// NewKeyChallengeHandler creates a new key challenge handler
+func NewKeyChallengeHandler(peerService *service.PeerService) *KeyChallengeHandler {
+	return &KeyChallengeHandler{
+		peerService: peerService,
+	}
+}
+
+// ServeHTTP handles POST /keys/challenge
+func (h *KeyChallengeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req proto.KeyChallengeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	challenge, err := h.peerService.KeyChallenge(req.ID)
+	if err != nil {
+		writeKeyError(w, req.ID, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, challenge)
+}
+
+// KeyRotationHandler handles key rotations of peers
+type KeyRotationHandler struct {
+	peerService *service.PeerService
+}
+
+// NewKeyRotationHandler creates a new key rotation handler
+func NewKeyRotationHandler(peerService *service.PeerService) *KeyRotationHandler {
+	return &KeyRotationHandler{
+		peerService: peerService,
+	}
+}
+
+// ServeHTTP handles POST /keys/rotate
+func (h *KeyRotationHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req proto.KeyRotationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	switchAt, err := h.peerService.RotateKey(&req)
+	if err != nil {
+		writeKeyError(w, req.ID, err)
+		return
+	}
+
+	log.Printf("Peer %s is rotating its key, switching at %s", req.ID, switchAt.Format(time.RFC3339))
+
+	writeJSON(w, http.StatusOK, proto.KeyRotationResponse{
+		Success:  true,
+		Message:  "key rotation scheduled",
+		SwitchAt: switchAt.Format(time.RFC3339),
+	})
+}
+
+// writeKeyError maps a key rotation error to a response
+func writeKeyError(w http.ResponseWriter, id string, err error) {
+	log.Printf("Key rotation of peer %s failed: %v", id, err)
+	status := http.StatusBadRequest
+	switch {
+	case errors.Is(err, service.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, service.ErrForbidden):
+		status = http.StatusForbidden
+	}
+	writeError(w, status, err.Error())
+}
@@ -1,8 +1,10 @@
 package api
 
 import (
+	"fmt"
 	"log"
 	"net/http"
+	"strings"
 
 	"github.com/Vaibhav2154/ShadowNet/internal/controlplane/service"
 	"github.com/Vaibhav2154/ShadowNet/internal/shared/proto"
@@ -30,8 +32,14 @@ func (h *PeersHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// Get optional exclude parameter
 	excludeID := r.URL.Query().Get("exclude")
 
+	filter, err := parsePeerFilter(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	// Get active peers
-	peers, err := h.peerService.GetActivePeers(excludeID)
+	peers, err := h.peerService.GetActivePeers(excludeID, filter)
 	if err != nil {
 		log.Printf("Failed to get peers: %v", err)
 		writeError(w, http.StatusInternalServerError, "failed to get peers")
@@ -56,3 +64,26 @@ func (h *PeersHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	writeJSON(w, http.StatusOK, response)
 }
+
+// parsePeerFilter reads the network, tag and label query parameters. Tags
+// and labels may repeat; labels are given as key=value.
+func parsePeerFilter(r *http.Request) (service.PeerFilter, error) {
+	query := r.URL.Query()
+	filter := service.PeerFilter{
+		Network: query.Get("network"),
+		Tags:    query["tag"],
+	}
+
+	for _, label := range query["label"] {
+		key, value, ok := strings.Cut(label, "=")
+		if !ok || key == "" {
+			return filter, fmt.Errorf("invalid label filter %q: expected key=value", label)
+		}
+		if filter.Labels == nil {
+			filter.Labels = make(map[string]string)
+		}
+		filter.Labels[key] = value
+	}
+
+	return filter, nil
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/controlplane/service"
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/proto"
+)
+
+// PSKHandler relays preshared key offers between peers
+type PSKHandler struct {
+	pskService *service.PSKService
+}
+
+// NewPSKHandler creates a new preshared key handler
+func NewPSKHandler(pskService *service.PSKService) *PSKHandler {
+	return &PSKHandler{
+		pskService: pskService,
+	}
+}
+
+// ServeHTTP handles GET /psk?id=<id> and POST /psk
+func (h *PSKHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.list(w, r)
+	case http.MethodPost:
+		h.offer(w, r)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// list returns the offers to or from a peer
+func (h *PSKHandler) list(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		writeError(w, http.StatusBadRequest, "missing id parameter")
+		return
+	}
+
+	resp, err := h.pskService.Offers(id)
+	if err != nil {
+		log.Printf("Failed to get preshared key offers for %s: %v", id, err)
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// offer stores new offers from a peer
+func (h *PSKHandler) offer(w http.ResponseWriter, r *http.Request) {
+	var req proto.PSKOffersRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if err := h.pskService.Offer(&req); err != nil {
+		log.Printf("Failed to store preshared key offers from %s: %v", req.ID, err)
+		if errors.Is(err, service.ErrForbidden) {
+			writeError(w, http.StatusForbidden, err.Error())
+			return
+		}
+		writeServiceError(w, err)
+		return
+	}
+
+	revision, err := h.pskService.Revision(req.ID)
+	if err != nil {
+		log.Printf("Failed to read preshared key revision: %v", err)
+	}
+	writeJSON(w, http.StatusOK, proto.PSKOffersResponse{Offers: []proto.PSKOffer{}, Revision: revision})
+}
+
+// PSKAckHandler schedules the use of offers their recipient acknowledged
+type PSKAckHandler struct {
+	pskService *service.PSKService
+}
+
+// NewPSKAckHandler creates a new preshared key acknowledgement handler
+func NewPSKAckHandler(pskService *service.PSKService) *PSKAckHandler {
+	return &PSKAckHandler{
+		pskService: pskService,
+	}
+}
+
+// ServeHTTP handles POST /psk/ack
+func (h *PSKAckHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req proto.PSKAcksRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	resp, err := h.pskService.Acknowledge(&req)
+	if err != nil {
+		log.Printf("Failed to acknowledge preshared key offers to %s: %v", req.ID, err)
+		if errors.Is(err, service.ErrForbidden) {
+			writeError(w, http.StatusForbidden, err.Error())
+			return
+		}
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
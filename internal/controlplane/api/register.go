@@ -2,6 +2,7 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 
@@ -36,25 +37,37 @@ func (h *RegisterHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	// Convert to PeerInfo
 	peerInfo := &proto.PeerInfo{
-		ID:           req.ID,
-		WGPublicKey:  req.WGPublicKey,
-		EndpointIP:   req.EndpointIP,
-		EndpointPort: req.EndpointPort,
+		ID:               req.ID,
+		WGPublicKey:      req.WGPublicKey,
+		EndpointIP:       req.EndpointIP,
+		EndpointPort:     req.EndpointPort,
+		EndpointIPv6:     req.EndpointIPv6,
+		EndpointPortV6:   req.EndpointPortV6,
+		NAT:              req.NAT,
+		PeerMetadata:     req.PeerMetadata,
+		AdvertisedRoutes: req.AdvertisedRoutes,
 	}
 
 	// Register peer
-	if err := h.peerService.RegisterPeer(peerInfo); err != nil {
+	registered, err := h.peerService.RegisterPeer(peerInfo, req.JoinToken)
+	if err != nil {
 		log.Printf("Failed to register peer %s: %v", req.ID, err)
-		writeError(w, http.StatusBadRequest, err.Error())
+		status := http.StatusBadRequest
+		if errors.Is(err, service.ErrForbidden) {
+			status = http.StatusForbidden
+		}
+		writeError(w, status, err.Error())
 		return
 	}
 
-	log.Printf("Registered peer: %s (%s:%d)", req.ID, req.EndpointIP, req.EndpointPort)
+	log.Printf("Registered peer: %s as %s (%s:%d)", req.ID, registered.Name, req.EndpointIP, req.EndpointPort)
 
 	// Send success response
 	writeJSON(w, http.StatusOK, proto.RegisterResponse{
 		Success: true,
 		Message: "peer registered successfully",
+		Network: registered.Network,
+		Name:    registered.Name,
 	})
 }
 
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/proto"
+)
+
+// STUNHandler advertises the built-in STUN server to nodes
+type STUNHandler struct {
+	advertiseHost string
+	port          int
+	changeRequest bool
+}
+
+// NewSTUNHandler creates a new STUN discovery handler. A port of 0 means
+// the STUN server is disabled.
+func NewSTUNHandler(advertiseHost string, port int, changeRequest bool) *STUNHandler {
+	return &STUNHandler{
+		advertiseHost: advertiseHost,
+		port:          port,
+		changeRequest: changeRequest,
+	}
+}
+
+// ServeHTTP handles GET /stun
+func (h *STUNHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	response := proto.STUNResponse{
+		Servers:       []string{},
+		ChangeRequest: h.changeRequest,
+	}
+
+	if h.port != 0 {
+		// Without an explicit host, advertise the one the node used to reach us
+		host := h.advertiseHost
+		if host == "" {
+			host = r.Host
+			if hostname, _, err := net.SplitHostPort(r.Host); err == nil {
+				host = hostname
+			}
+		}
+		response.Servers = append(response.Servers, net.JoinHostPort(host, strconv.Itoa(h.port)))
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,48 @@
+package model
+
+import (
+	"time"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/proto"
+)
+
+// Event types recorded by the control plane
+const (
+	EventPeerJoined     = "peer.joined"
+	EventPeerEndpoint   = "peer.endpoint"
+	EventPeerKey        = "peer.key"
+	EventPeerDeleted    = "peer.deleted"
+	EventPeerRoutes     = "peer.routes"
+	EventPeerFeatures   = "peer.features"
+	EventPeerActive     = "peer.active"
+	EventPeerInactive   = "peer.inactive"
+	EventRoutesApproved = "routes.approved"
+	EventTokenCreated   = "token.created"
+	EventTokenRevoked   = "token.revoked"
+	EventNetworkCreated = "network.created"
+	EventNetworkDeleted = "network.deleted"
+	EventACLUpdated     = "acl.updated"
+	EventStateImported  = "state.imported"
+	EventRegisterDenied = "register.denied"
+	EventKeyDenied      = "key.denied"
+)
+
+// Event represents an event log entry in the database
+type Event struct {
+	ID      int64
+	Time    time.Time
+	Type    string
+	PeerID  string
+	Message string
+}
+
+// ToProto converts database model to API proto
+func (e *Event) ToProto() proto.Event {
+	return proto.Event{
+		ID:      e.ID,
+		Time:    e.Time.Format(time.RFC3339),
+		Type:    e.Type,
+		PeerID:  e.PeerID,
+		Message: e.Message,
+	}
+}
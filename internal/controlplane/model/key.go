@@ -0,0 +1,33 @@
+package model
+
+import (
+	"time"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/proto"
+)
+
+// PeerKey is a WireGuard key a peer has used. Retired keys are never
+// accepted again, from any peer.
+type PeerKey struct {
+	PublicKey string
+	PeerID    string
+	AddedAt   time.Time
+	RetiredAt time.Time // zero while in use
+}
+
+// Retired reports whether the key was replaced
+func (k *PeerKey) Retired() bool {
+	return !k.RetiredAt.IsZero()
+}
+
+// ToProto converts database model to API proto
+func (k *PeerKey) ToProto() proto.PeerKey {
+	key := proto.PeerKey{
+		PublicKey: k.PublicKey,
+		AddedAt:   k.AddedAt.Format(time.RFC3339),
+	}
+	if k.Retired() {
+		key.RetiredAt = k.RetiredAt.Format(time.RFC3339)
+	}
+	return key
+}
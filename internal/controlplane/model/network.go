@@ -0,0 +1,40 @@
+package model
+
+import (
+	"time"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/proto"
+)
+
+// Network represents a network in the database
+type Network struct {
+	Name        string
+	Description string
+	ACL         *proto.ACLPolicy
+	CreatedAt   time.Time
+}
+
+// ToProto converts database model to API proto
+func (n *Network) ToProto() proto.Network {
+	return proto.Network{
+		Name:        n.Name,
+		Description: n.Description,
+		ACL:         n.ACL,
+		CreatedAt:   n.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+// NetworkFromProto creates a Network from API proto
+func NetworkFromProto(network *proto.Network) *Network {
+	createdAt := time.Now()
+	if t, err := time.Parse(time.RFC3339, network.CreatedAt); err == nil {
+		createdAt = t
+	}
+
+	return &Network{
+		Name:        network.Name,
+		Description: network.Description,
+		ACL:         network.ACL,
+		CreatedAt:   createdAt,
+	}
+}
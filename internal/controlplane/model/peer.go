@@ -13,17 +13,93 @@ type Peer struct {
 	EndpointIP   string
 	EndpointPort int
 	LastSeen     time.Time
+	Network      string
+
+	// IPv6 endpoint, if the peer has a global IPv6 address
+	EndpointIPv6   string
+	EndpointPortV6 int
+
+	// Name is the peer's DNS label, unique within its network
+	Name string
+
+	// Metadata reported by the node
+	Hostname string
+	OS       string
+	Arch     string
+	Version  string
+	Tags     []string
+	Labels   map[string]string
+	Features []string
+
+	// Subnet routes the peer advertises and those an admin approved
+	AdvertisedRoutes []string
+	ApprovedRoutes   []string
+
+	// NAT behaviour reported by the node
+	NATType            string
+	NATMapping         string
+	NATFiltering       string
+	NATHairpinning     bool
+	NATMappingLifetime int
+
+	// Tunnel stats from the peer's last heartbeat
+	Tunnels []proto.TunnelStats
+
+	// While the peer rotates its key, NextWGPublicKey replaces
+	// WGPublicKey at KeySwitchAt (zero otherwise)
+	NextWGPublicKey string
+	KeySwitchAt     time.Time
+}
+
+// KeySwitchDue reports whether a pending key rotation should have taken
+// effect by now
+func (p *Peer) KeySwitchDue(now time.Time) bool {
+	return p.NextWGPublicKey != "" && !now.Before(p.KeySwitchAt)
 }
 
 // ToProto converts database model to API proto
 func (p *Peer) ToProto() proto.PeerInfo {
-	return proto.PeerInfo{
+	info := proto.PeerInfo{
 		ID:           p.ID,
 		WGPublicKey:  p.WGPublicKey,
 		EndpointIP:   p.EndpointIP,
 		EndpointPort: p.EndpointPort,
 		LastSeen:     p.LastSeen.Format(time.RFC3339),
+		Network:      p.Network,
+		Name:         p.Name,
+
+		EndpointIPv6:   p.EndpointIPv6,
+		EndpointPortV6: p.EndpointPortV6,
+		PeerMetadata: proto.PeerMetadata{
+			Hostname: p.Hostname,
+			OS:       p.OS,
+			Arch:     p.Arch,
+			Version:  p.Version,
+			Tags:     p.Tags,
+			Labels:   p.Labels,
+			Features: p.Features,
+		},
+		AdvertisedRoutes: p.AdvertisedRoutes,
+		ApprovedRoutes:   p.ApprovedRoutes,
+		Tunnels:          p.Tunnels,
+	}
+
+	if p.NextWGPublicKey != "" {
+		info.NextWGPublicKey = p.NextWGPublicKey
+		info.KeySwitchAt = p.KeySwitchAt.Format(time.RFC3339)
 	}
+
+	if p.NATType != "" {
+		info.NAT = &proto.NATInfo{
+			Type:            p.NATType,
+			Mapping:         p.NATMapping,
+			Filtering:       p.NATFiltering,
+			Hairpinning:     p.NATHairpinning,
+			MappingLifetime: p.NATMappingLifetime,
+		}
+	}
+
+	return info
 }
 
 // FromProto creates a Peer from API proto
@@ -35,11 +111,45 @@ func FromProto(info *proto.PeerInfo) *Peer {
 		}
 	}
 	
-	return &Peer{
-		ID:           info.ID,
-		WGPublicKey:  info.WGPublicKey,
-		EndpointIP:   info.EndpointIP,
-		EndpointPort: info.EndpointPort,
-		LastSeen:     lastSeen,
+	peer := &Peer{
+		ID:               info.ID,
+		WGPublicKey:      info.WGPublicKey,
+		EndpointIP:       info.EndpointIP,
+		EndpointPort:     info.EndpointPort,
+		LastSeen:         lastSeen,
+		Network:          info.Network,
+		EndpointIPv6:     info.EndpointIPv6,
+		EndpointPortV6:   info.EndpointPortV6,
+		Name:             info.Name,
+		Hostname:         info.Hostname,
+		OS:               info.OS,
+		Arch:             info.Arch,
+		Version:          info.Version,
+		Tags:             info.Tags,
+		Labels:           info.Labels,
+		Features:         info.Features,
+		AdvertisedRoutes: info.AdvertisedRoutes,
+		ApprovedRoutes:   info.ApprovedRoutes,
+	}
+
+	if peer.Network == "" {
+		peer.Network = proto.DefaultNetwork
 	}
+
+	if info.NextWGPublicKey != "" {
+		if t, err := time.Parse(time.RFC3339, info.KeySwitchAt); err == nil {
+			peer.NextWGPublicKey = info.NextWGPublicKey
+			peer.KeySwitchAt = t
+		}
+	}
+
+	if info.NAT != nil {
+		peer.NATType = info.NAT.Type
+		peer.NATMapping = info.NAT.Mapping
+		peer.NATFiltering = info.NAT.Filtering
+		peer.NATHairpinning = info.NAT.Hairpinning
+		peer.NATMappingLifetime = info.NAT.MappingLifetime
+	}
+
+	return peer
 }
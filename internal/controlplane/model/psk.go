@@ -0,0 +1,42 @@
+package model
+
+import (
+	"time"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/proto"
+)
+
+// PSKOffer is the latest preshared key one peer offered another, sealed so
+// the control plane can't read it
+type PSKOffer struct {
+	FromID    string
+	ToID      string
+	Epoch     int64
+	FromKey   string
+	ToKey     string
+	SealedPSK []byte
+	CreatedAt time.Time
+
+	// ActivateAt is zero until the recipient fetched the offer
+	ActivateAt time.Time
+
+	// Revision increases with every change to the offer
+	Revision int64
+}
+
+// ToProto converts database model to API proto
+func (o *PSKOffer) ToProto() proto.PSKOffer {
+	offer := proto.PSKOffer{
+		FromID:    o.FromID,
+		ToID:      o.ToID,
+		Epoch:     o.Epoch,
+		FromKey:   o.FromKey,
+		ToKey:     o.ToKey,
+		SealedPSK: o.SealedPSK,
+		CreatedAt: o.CreatedAt.Format(time.RFC3339),
+	}
+	if !o.ActivateAt.IsZero() {
+		offer.ActivateAt = o.ActivateAt.Format(time.RFC3339)
+	}
+	return offer
+}
@@ -0,0 +1,70 @@
+package model
+
+import (
+	"time"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/proto"
+)
+
+// JoinToken represents a join token in the database. Only the SHA-256 hash
+// of the secret is stored.
+type JoinToken struct {
+	ID          string
+	SecretHash  string
+	Network     string
+	Description string
+	Reusable    bool
+	Uses        int
+	ExpiresAt   time.Time // zero if it never expires
+	CreatedAt   time.Time
+	Revoked     bool
+}
+
+// Usable reports whether the token can still admit a peer
+func (t *JoinToken) Usable(now time.Time) bool {
+	if t.Revoked {
+		return false
+	}
+	if !t.ExpiresAt.IsZero() && now.After(t.ExpiresAt) {
+		return false
+	}
+	return t.Reusable || t.Uses == 0
+}
+
+// ToProto converts database model to API proto
+func (t *JoinToken) ToProto() proto.JoinToken {
+	token := proto.JoinToken{
+		ID:          t.ID,
+		Network:     t.Network,
+		Description: t.Description,
+		Reusable:    t.Reusable,
+		Uses:        t.Uses,
+		CreatedAt:   t.CreatedAt.Format(time.RFC3339),
+		Revoked:     t.Revoked,
+	}
+	if !t.ExpiresAt.IsZero() {
+		token.ExpiresAt = t.ExpiresAt.Format(time.RFC3339)
+	}
+	return token
+}
+
+// TokenFromExport creates a JoinToken from an exported token
+func TokenFromExport(exported *proto.ExportedToken) *JoinToken {
+	token := &JoinToken{
+		ID:          exported.ID,
+		SecretHash:  exported.SecretHash,
+		Network:     exported.Network,
+		Description: exported.Description,
+		Reusable:    exported.Reusable,
+		Uses:        exported.Uses,
+		CreatedAt:   time.Now(),
+		Revoked:     exported.Revoked,
+	}
+	if t, err := time.Parse(time.RFC3339, exported.ExpiresAt); err == nil {
+		token.ExpiresAt = t
+	}
+	if t, err := time.Parse(time.RFC3339, exported.CreatedAt); err == nil {
+		token.CreatedAt = t
+	}
+	return token
+}
@@ -2,14 +2,19 @@ package controlplane
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/Vaibhav2154/ShadowNet/internal/controlplane/api"
 	"github.com/Vaibhav2154/ShadowNet/internal/controlplane/service"
 	"github.com/Vaibhav2154/ShadowNet/internal/controlplane/store"
+	"github.com/Vaibhav2154/ShadowNet/internal/controlplane/stun"
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/proto"
 )
 
 // Config holds server configuration
@@ -18,6 +23,20 @@ type Config struct {
 	DBPath        string
 	ActiveTimeout time.Duration
 	APIKey        string
+
+	// RequireJoinToken rejects new peers that don't present a join token
+	RequireJoinToken bool
+
+	// KeySwitchDelay is how long after a key rotation, or the delivery of
+	// a preshared key, peers switch to the new key; long enough for every
+	// node to learn it
+	KeySwitchDelay time.Duration
+
+	// Built-in STUN server (disabled when STUNListenAddr is empty)
+	STUNListenAddr    string
+	STUNAltPort       int
+	STUNAltIP         string
+	STUNAdvertiseHost string
 }
 
 // Server represents the control plane HTTP server
@@ -26,7 +45,15 @@ type Server struct {
 	httpServer  *http.Server
 	repo        store.PeerRepository
 	peerService *service.PeerService
+	pskService  *service.PSKService
 	authService *service.AuthService
+	stunServer  *stun.Server
+
+	// Admin API services
+	tokenService   *service.TokenService
+	networkService *service.NetworkService
+	eventService   *service.EventService
+	stateService   *service.StateService
 }
 
 // NewServer creates a new control plane server
@@ -38,15 +65,43 @@ func NewServer(config *Config) (*Server, error) {
 	}
 
 	// Initialize services
-	peerService := service.NewPeerService(repo, config.ActiveTimeout)
+	eventService := service.NewEventService(repo)
+	tokenService := service.NewTokenService(repo, repo, eventService)
+	networkService := service.NewNetworkService(repo, repo, eventService)
+	peerService := service.NewPeerService(repo, repo, repo, tokenService, eventService, config.ActiveTimeout, config.KeySwitchDelay, config.RequireJoinToken)
 	authService := service.NewAuthService(config.APIKey)
 
 	// Create server
 	server := &Server{
-		config:      config,
-		repo:        repo,
-		peerService: peerService,
-		authService: authService,
+		config:         config,
+		repo:           repo,
+		peerService:    peerService,
+		pskService:     service.NewPSKService(repo, repo, peerService, config.KeySwitchDelay),
+		authService:    authService,
+		tokenService:   tokenService,
+		networkService: networkService,
+		eventService:   eventService,
+		stateService:   service.NewStateService(repo, repo, repo, repo, repo, eventService),
+	}
+
+	// Initialize optional STUN server
+	if config.STUNListenAddr != "" {
+		otherIP, err := stunOtherIP(config)
+		if err != nil {
+			repo.Close()
+			return nil, err
+		}
+		stunServer, err := stun.NewServer(&stun.Config{
+			ListenAddr: config.STUNListenAddr,
+			AltPort:    config.STUNAltPort,
+			AltIP:      config.STUNAltIP,
+			OtherIP:    otherIP,
+		})
+		if err != nil {
+			repo.Close()
+			return nil, fmt.Errorf("failed to create STUN server: %w", err)
+		}
+		server.stunServer = stunServer
 	}
 
 	// Setup HTTP server
@@ -64,20 +119,71 @@ func NewServer(config *Config) (*Server, error) {
 	return server, nil
 }
 
+// stunOtherIP returns the IP the STUN server advertises as its other
+// address when it only has an alternate port: the advertised host,
+// resolved once here if it is a name
+func stunOtherIP(config *Config) (string, error) {
+	host := config.STUNAdvertiseHost
+	if host == "" || config.STUNAltPort == 0 || config.STUNAltIP != "" || net.ParseIP(host) != nil {
+		return host, nil
+	}
+
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve STUN advertise host %s: %w", host, err)
+	}
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			return ip.String(), nil
+		}
+	}
+	return "", fmt.Errorf("STUN advertise host %s has no IPv4 address", host)
+}
+
 // setupRoutes registers all API routes
 func (s *Server) setupRoutes(mux *http.ServeMux) {
 	// API handlers
 	registerHandler := api.NewRegisterHandler(s.peerService)
 	peersHandler := api.NewPeersHandler(s.peerService)
-	heartbeatHandler := api.NewHeartbeatHandler(s.peerService)
+	heartbeatHandler := api.NewHeartbeatHandler(s.peerService, s.pskService)
 	metricsHandler := api.NewMetricsHandler(s.peerService)
 
+	stunPort, changeRequest := 0, false
+	if s.stunServer != nil {
+		stunPort, changeRequest = s.stunServer.Port(), s.stunServer.SupportsChangeRequest()
+	}
+	stunHandler := api.NewSTUNHandler(s.config.STUNAdvertiseHost, stunPort, changeRequest)
+
 	// Register routes
 	mux.Handle("/register", registerHandler)
 	mux.Handle("/peers", peersHandler)
 	mux.Handle("/heartbeat", heartbeatHandler)
 	mux.Handle("/metrics", metricsHandler)
+	mux.Handle("/stun", stunHandler)
+	mux.Handle("/keys/challenge", api.NewKeyChallengeHandler(s.peerService))
+	mux.Handle("/keys/rotate", api.NewKeyRotationHandler(s.peerService))
+	mux.Handle("/psk", api.NewPSKHandler(s.pskService))
+	mux.Handle("/psk/ack", api.NewPSKAckHandler(s.pskService))
 	
+	// Admin API
+	adminPeersHandler := s.adminMiddleware(api.NewAdminPeersHandler(s.peerService))
+	adminTokensHandler := s.adminMiddleware(api.NewAdminTokensHandler(s.tokenService))
+	adminNetworksHandler := s.adminMiddleware(api.NewAdminNetworksHandler(s.networkService))
+	adminStateHandler := s.adminMiddleware(api.NewAdminStateHandler(s.stateService))
+
+	mux.Handle("/admin/peers", adminPeersHandler)
+	mux.Handle("/admin/peers/{id}", adminPeersHandler)
+	mux.Handle("/admin/peers/{id}/routes", s.adminMiddleware(api.NewAdminRoutesHandler(s.peerService)))
+	mux.Handle("/admin/peers/{id}/keys", s.adminMiddleware(api.NewAdminKeysHandler(s.peerService)))
+	mux.Handle("/admin/tokens", adminTokensHandler)
+	mux.Handle("/admin/tokens/{id}", adminTokensHandler)
+	mux.Handle("/admin/networks", adminNetworksHandler)
+	mux.Handle("/admin/networks/{name}", adminNetworksHandler)
+	mux.Handle("/admin/networks/{name}/acl", s.adminMiddleware(api.NewAdminACLHandler(s.networkService)))
+	mux.Handle("/admin/events", s.adminMiddleware(api.NewAdminEventsHandler(s.eventService)))
+	mux.Handle("/admin/export", adminStateHandler)
+	mux.Handle("/admin/import", adminStateHandler)
+
 	// Health check
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
@@ -94,9 +200,44 @@ func (s *Server) loggingMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-// corsMiddleware adds CORS headers for dashboard
+// adminMiddleware requires the API key, sent as a bearer token, for admin
+// requests. Without a configured key the admin API is disabled.
+func (s *Server) adminMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.authService.Enabled() {
+			writeAdminError(w, http.StatusForbidden, "admin API disabled: no API key configured")
+			return
+		}
+
+		key := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !s.authService.ValidateAPIKey(key) {
+			writeAdminError(w, http.StatusUnauthorized, "invalid or missing API key")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeAdminError writes an error response for a rejected admin request
+func writeAdminError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(proto.ErrorResponse{
+		Error:   http.StatusText(status),
+		Message: message,
+	})
+}
+
+// corsMiddleware adds CORS headers for dashboard. The admin API is left
+// out, so web pages can't call it from a browser.
 func (s *Server) corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/admin" || strings.HasPrefix(r.URL.Path, "/admin/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
@@ -115,6 +256,16 @@ func (s *Server) Start() error {
 	log.Printf("Starting control plane server on %s", s.config.ListenAddr)
 	log.Printf("Database: %s", s.config.DBPath)
 	log.Printf("Active timeout: %s", s.config.ActiveTimeout)
+	if s.config.APIKey == "" {
+		log.Printf("WARNING: no API key configured, the admin API is disabled")
+	}
+	if s.config.RequireJoinToken {
+		log.Printf("Join tokens required for new peers")
+	}
+
+	if s.stunServer != nil {
+		s.stunServer.Start()
+	}
 	
 	if err := s.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		return fmt.Errorf("server error: %w", err)
@@ -132,6 +283,11 @@ func (s *Server) Shutdown(ctx context.Context) error {
 		return fmt.Errorf("failed to shutdown HTTP server: %w", err)
 	}
 	
+	// Stop STUN server
+	if s.stunServer != nil {
+		s.stunServer.Close()
+	}
+
 	// Close repository
 	if err := s.repo.Close(); err != nil {
 		return fmt.Errorf("failed to close repository: %w", err)
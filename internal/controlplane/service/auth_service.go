@@ -1,5 +1,7 @@
 package service
 
+import "crypto/subtle"
+
 // AuthService handles authentication (placeholder for future expansion)
 type AuthService struct {
 	apiKey string
@@ -12,11 +14,17 @@ func NewAuthService(apiKey string) *AuthService {
 	}
 }
 
-// ValidateAPIKey validates an API key (optional for MVP)
+// Enabled reports whether an API key is configured; without one the admin
+// API is disabled
+func (s *AuthService) Enabled() bool {
+	return s.apiKey != ""
+}
+
+// ValidateAPIKey validates an API key in constant time. Nothing is valid
+// when no key is configured.
 func (s *AuthService) ValidateAPIKey(key string) bool {
-	// If no API key is configured, allow all requests
 	if s.apiKey == "" {
-		return true
+		return false
 	}
-	return key == s.apiKey
+	return subtle.ConstantTimeCompare([]byte(key), []byte(s.apiKey)) == 1
 }
@@ -0,0 +1,12 @@
+package service
+
+import "errors"
+
+var (
+	// ErrNotFound is wrapped by errors for missing peers, networks and tokens
+	ErrNotFound = errors.New("not found")
+
+	// ErrForbidden is wrapped by errors for registrations without a valid
+	// join token
+	ErrForbidden = errors.New("forbidden")
+)
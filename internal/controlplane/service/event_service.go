@@ -0,0 +1,74 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/controlplane/model"
+	"github.com/Vaibhav2154/ShadowNet/internal/controlplane/store"
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/proto"
+)
+
+// maxEventsPerRequest bounds how many events a single request returns
+const maxEventsPerRequest = 1000
+
+// EventService records and lists control plane events
+type EventService struct {
+	repo store.EventRepository
+}
+
+// NewEventService creates a new event service
+func NewEventService(repo store.EventRepository) *EventService {
+	return &EventService{
+		repo: repo,
+	}
+}
+
+// Record logs an event and appends it to the event log. Failing to store
+// an event never fails the operation that caused it.
+func (s *EventService) Record(eventType, peerID, format string, args ...interface{}) {
+	event := &model.Event{
+		Time:    time.Now(),
+		Type:    eventType,
+		PeerID:  peerID,
+		Message: fmt.Sprintf(format, args...),
+	}
+
+	log.Printf("Event %s: %s", event.Type, event.Message)
+	if err := s.repo.AddEvent(event); err != nil {
+		log.Printf("Failed to record event: %v", err)
+	}
+}
+
+// LatestID returns the ID of the newest event, 0 if there is none
+func (s *EventService) LatestID() (int64, error) {
+	events, err := s.repo.GetEvents(0, 1)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get latest event: %w", err)
+	}
+	if len(events) == 0 {
+		return 0, nil
+	}
+	return events[0].ID, nil
+}
+
+// List returns up to limit events after sinceID, oldest first. A zero
+// sinceID returns the latest events.
+func (s *EventService) List(sinceID int64, limit int) ([]proto.Event, error) {
+	if limit <= 0 || limit > maxEventsPerRequest {
+		limit = maxEventsPerRequest
+	}
+
+	events, err := s.repo.GetEvents(sinceID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get events: %w", err)
+	}
+
+	result := []proto.Event{}
+	for _, event := range events {
+		result = append(result, event.ToProto())
+	}
+
+	return result, nil
+}
@@ -0,0 +1,213 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/controlplane/model"
+	"github.com/Vaibhav2154/ShadowNet/internal/controlplane/store"
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/proto"
+)
+
+// networkNamePattern restricts network names to DNS-label characters
+var networkNamePattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// NetworkService manages networks and their ACL policies
+type NetworkService struct {
+	repo   store.NetworkRepository
+	peers  store.PeerRepository
+	events *EventService
+}
+
+// NewNetworkService creates a new network service
+func NewNetworkService(repo store.NetworkRepository, peers store.PeerRepository, events *EventService) *NetworkService {
+	return &NetworkService{
+		repo:   repo,
+		peers:  peers,
+		events: events,
+	}
+}
+
+// List returns all networks
+func (s *NetworkService) List() ([]proto.Network, error) {
+	networks, err := s.repo.GetAllNetworks()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get networks: %w", err)
+	}
+
+	result := []proto.Network{}
+	for _, network := range networks {
+		result = append(result, network.ToProto())
+	}
+
+	return result, nil
+}
+
+// Get returns a network by name
+func (s *NetworkService) Get(name string) (*proto.Network, error) {
+	network, err := s.get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	result := network.ToProto()
+	return &result, nil
+}
+
+// get loads a network, failing with ErrNotFound if it doesn't exist
+func (s *NetworkService) get(name string) (*model.Network, error) {
+	network, err := s.repo.GetNetwork(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get network: %w", err)
+	}
+	if network == nil {
+		return nil, fmt.Errorf("network %s: %w", name, ErrNotFound)
+	}
+	return network, nil
+}
+
+// Create creates a network
+func (s *NetworkService) Create(network *proto.Network) (*proto.Network, error) {
+	if !networkNamePattern.MatchString(network.Name) {
+		return nil, fmt.Errorf("invalid network name %q: use lowercase letters, digits and dashes", network.Name)
+	}
+
+	existing, err := s.repo.GetNetwork(network.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get network: %w", err)
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("network %s already exists", network.Name)
+	}
+
+	if err := validateACL(network.ACL); err != nil {
+		return nil, err
+	}
+
+	created := &model.Network{
+		Name:        network.Name,
+		Description: network.Description,
+		ACL:         network.ACL,
+		CreatedAt:   time.Now(),
+	}
+	if err := s.repo.CreateOrUpdateNetwork(created); err != nil {
+		return nil, fmt.Errorf("failed to store network: %w", err)
+	}
+
+	s.events.Record(model.EventNetworkCreated, "", "network %s created", created.Name)
+
+	result := created.ToProto()
+	return &result, nil
+}
+
+// Delete deletes an empty network. The default network can't be deleted.
+func (s *NetworkService) Delete(name string) error {
+	if name == proto.DefaultNetwork {
+		return fmt.Errorf("the %s network can't be deleted", proto.DefaultNetwork)
+	}
+
+	if _, err := s.get(name); err != nil {
+		return err
+	}
+
+	peers, err := s.peers.GetAll()
+	if err != nil {
+		return fmt.Errorf("failed to get peers: %w", err)
+	}
+	members := 0
+	for _, peer := range peers {
+		if peer.Network == name {
+			members++
+		}
+	}
+	if members > 0 {
+		return fmt.Errorf("network %s still has %d peers", name, members)
+	}
+
+	if err := s.repo.DeleteNetwork(name); err != nil {
+		return err
+	}
+
+	s.events.Record(model.EventNetworkDeleted, "", "network %s deleted", name)
+	return nil
+}
+
+// GetACL returns a network's ACL policy; an empty policy allows everything
+func (s *NetworkService) GetACL(name string) (*proto.ACLPolicy, error) {
+	network, err := s.get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if network.ACL == nil {
+		return &proto.ACLPolicy{Rules: []proto.ACLRule{}}, nil
+	}
+	return network.ACL, nil
+}
+
+// SetACL replaces a network's ACL policy
+func (s *NetworkService) SetACL(name string, policy *proto.ACLPolicy) error {
+	network, err := s.get(name)
+	if err != nil {
+		return err
+	}
+
+	if err := validateACL(policy); err != nil {
+		return err
+	}
+
+	network.ACL = policy
+	if err := s.repo.CreateOrUpdateNetwork(network); err != nil {
+		return fmt.Errorf("failed to store ACL policy: %w", err)
+	}
+
+	s.events.Record(model.EventACLUpdated, "", "ACL policy of network %s updated (%d rules)", name, len(policy.Rules))
+	return nil
+}
+
+// validateACL checks that every rule has sources and destinations
+func validateACL(policy *proto.ACLPolicy) error {
+	if policy == nil {
+		return nil
+	}
+
+	for i, rule := range policy.Rules {
+		if len(rule.Sources) == 0 || len(rule.Destinations) == 0 {
+			return fmt.Errorf("ACL rule %d needs at least one src and one dst", i+1)
+		}
+	}
+
+	return nil
+}
+
+// aclAllows reports whether the policy allows src to reach dst
+func aclAllows(policy *proto.ACLPolicy, src, dst string) bool {
+	if policy == nil || len(policy.Rules) == 0 {
+		return true
+	}
+
+	for _, rule := range policy.Rules {
+		if aclMatches(rule.Sources, src) && aclMatches(rule.Destinations, dst) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// aclMatches reports whether a rule entry list matches a peer
+func aclMatches(entries []string, peerID string) bool {
+	for _, entry := range entries {
+		if entry == "*" || entry == peerID {
+			return true
+		}
+	}
+	return false
+}
+
+// canPeer reports whether two peers may set up a tunnel. WireGuard tunnels
+// are bidirectional, so either direction being allowed is enough.
+func canPeer(policy *proto.ACLPolicy, a, b string) bool {
+	return aclAllows(policy, a, b) || aclAllows(policy, b, a)
+}
@@ -0,0 +1,308 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/controlplane/model"
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/crypto"
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/proto"
+	"golang.org/x/crypto/curve25519"
+)
+
+// keyChallengeTTL is how long a peer has to answer a key challenge
+const keyChallengeTTL = time.Minute
+
+// maxKeyChallenges is how many challenges a peer may have outstanding.
+// Anyone may ask for one, so a new challenge beyond that replaces the
+// oldest rather than being refused.
+const maxKeyChallenges = 8
+
+// keyChallenge is an ephemeral X25519 key pair a peer proves possession of
+// its keys against. It stays valid until it expires so that a retried
+// rotation request gets the same answer, but only for one new key.
+type keyChallenge struct {
+	id         string
+	peerID     string
+	privateKey []byte
+	expiresAt  time.Time
+	usedFor    string
+}
+
+// KeyChallenge hands out a challenge a peer proves possession of its keys
+// against, for a key rotation or preshared key offers
+func (s *PeerService) KeyChallenge(id string) (*proto.KeyChallengeResponse, error) {
+	peer, err := s.repo.GetByID(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get peer: %w", err)
+	}
+	if peer == nil {
+		return nil, fmt.Errorf("peer %s: %w", id, ErrNotFound)
+	}
+
+	privateKey := make([]byte, curve25519.ScalarSize)
+	challengeID := make([]byte, 16)
+	if _, err := rand.Read(privateKey); err != nil {
+		return nil, fmt.Errorf("failed to generate challenge: %w", err)
+	}
+	if _, err := rand.Read(challengeID); err != nil {
+		return nil, fmt.Errorf("failed to generate challenge: %w", err)
+	}
+	publicKey, err := curve25519.X25519(privateKey, curve25519.Basepoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate challenge: %w", err)
+	}
+
+	challenge := &keyChallenge{
+		id:         base64.RawURLEncoding.EncodeToString(challengeID),
+		peerID:     id,
+		privateKey: privateKey,
+		expiresAt:  time.Now().Add(keyChallengeTTL),
+	}
+
+	s.challengeMu.Lock()
+	now := time.Now()
+	var oldest *keyChallenge
+	outstanding := 0
+	for challengeID, c := range s.challenges {
+		switch {
+		case now.After(c.expiresAt):
+			delete(s.challenges, challengeID)
+		case c.peerID == id:
+			outstanding++
+			if oldest == nil || c.expiresAt.Before(oldest.expiresAt) {
+				oldest = c
+			}
+		}
+	}
+	if outstanding >= maxKeyChallenges {
+		delete(s.challenges, oldest.id)
+	}
+	s.challenges[challenge.id] = challenge
+	s.challengeMu.Unlock()
+
+	return &proto.KeyChallengeResponse{
+		ChallengeID: challenge.id,
+		PublicKey:   crypto.EncodeKey(publicKey),
+		ExpiresAt:   challenge.expiresAt.Format(time.RFC3339),
+	}, nil
+}
+
+// RotateKey schedules the switch of a peer to a new key once it proved
+// possession of both its current and the new key. Peers learn the new key
+// with their next peer refresh and everyone, the peer included, switches
+// at the returned time, so tunnels are down for at most a handshake.
+func (s *PeerService) RotateKey(req *proto.KeyRotationRequest) (time.Time, error) {
+	if err := crypto.ValidatePublicKey(req.NewPublicKey); err != nil {
+		return time.Time{}, fmt.Errorf("invalid new public key: %w", err)
+	}
+	if req.NewPublicKey == req.OldPublicKey {
+		return time.Time{}, fmt.Errorf("new key is the same as the old one")
+	}
+
+	s.registerMu.Lock()
+	defer s.registerMu.Unlock()
+
+	now := time.Now()
+	peer, err := s.repo.GetByID(req.ID)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get peer: %w", err)
+	}
+	if peer == nil {
+		return time.Time{}, fmt.Errorf("peer %s: %w", req.ID, ErrNotFound)
+	}
+	if peer.KeySwitchDue(now) {
+		if err := s.completeRotation(peer, now); err != nil {
+			return time.Time{}, err
+		}
+	}
+
+	if err := s.verifyRotation(peer, req, now); err != nil {
+		s.events.Record(model.EventKeyDenied, req.ID, "key rotation of peer %s denied: %v", req.ID, err)
+		return time.Time{}, fmt.Errorf("%w: %v", ErrForbidden, err)
+	}
+
+	// A retried request for the rotation already scheduled
+	if peer.NextWGPublicKey == req.NewPublicKey {
+		return peer.KeySwitchAt, nil
+	}
+
+	// A new rotation replaces one still pending, whose key is abandoned
+	if peer.NextWGPublicKey != "" {
+		if err := s.keys.RetireKey(peer.NextWGPublicKey, now); err != nil {
+			return time.Time{}, err
+		}
+	}
+
+	if err := s.keys.AddKey(&model.PeerKey{PublicKey: peer.WGPublicKey, PeerID: peer.ID, AddedAt: now}); err != nil {
+		return time.Time{}, err
+	}
+	if err := s.keys.AddKey(&model.PeerKey{PublicKey: req.NewPublicKey, PeerID: peer.ID, AddedAt: now}); err != nil {
+		return time.Time{}, err
+	}
+
+	peer.NextWGPublicKey = req.NewPublicKey
+	peer.KeySwitchAt = now.Add(s.keySwitchDelay).Truncate(time.Second)
+	if err := s.repo.CreateOrUpdate(peer); err != nil {
+		return time.Time{}, fmt.Errorf("failed to store peer: %w", err)
+	}
+
+	s.events.Record(model.EventPeerKey, peer.ID, "peer %s is rotating its key to %s, switching at %s",
+		peer.ID, shortKey(req.NewPublicKey), peer.KeySwitchAt.Format(time.RFC3339))
+	return peer.KeySwitchAt, nil
+}
+
+// verifyRotation checks a rotation request's challenge, keys and proofs
+func (s *PeerService) verifyRotation(peer *model.Peer, req *proto.KeyRotationRequest, now time.Time) error {
+	s.challengeMu.Lock()
+	defer s.challengeMu.Unlock()
+
+	challenge := s.challenges[req.ChallengeID]
+	if challenge == nil || challenge.peerID != req.ID || now.After(challenge.expiresAt) {
+		return fmt.Errorf("unknown or expired challenge")
+	}
+	if challenge.usedFor != "" && challenge.usedFor != req.NewPublicKey {
+		return fmt.Errorf("challenge already used")
+	}
+	if req.OldPublicKey != peer.WGPublicKey {
+		return fmt.Errorf("old key is not the peer's current key")
+	}
+
+	// Keys are never reused, except by a retry of this rotation
+	if peer.NextWGPublicKey != req.NewPublicKey {
+		known, err := s.keys.GetKey(req.NewPublicKey)
+		if err != nil {
+			return err
+		}
+		if known != nil {
+			return fmt.Errorf("new key %s has been used before", shortKey(req.NewPublicKey))
+		}
+	}
+
+	oldKey, _ := crypto.DecodeKey(req.OldPublicKey)
+	newKey, _ := crypto.DecodeKey(req.NewPublicKey)
+	transcript := crypto.RotationTranscript(req.ID, req.ChallengeID, req.OldPublicKey, req.NewPublicKey)
+	if !crypto.VerifyKeyProof(challenge.privateKey, oldKey, transcript, req.OldProof) {
+		return fmt.Errorf("invalid proof of the old key")
+	}
+	if !crypto.VerifyKeyProof(challenge.privateKey, newKey, transcript, req.NewProof) {
+		return fmt.Errorf("invalid proof of the new key")
+	}
+
+	challenge.usedFor = req.NewPublicKey
+	return nil
+}
+
+// VerifyKeyPossession checks a proof that the peer holds its current or
+// pending key, made with crypto.KeyProof against one of its challenges,
+// and uses the challenge up
+func (s *PeerService) VerifyKeyPossession(peer *model.Peer, challengeID string, transcript, proof []byte) error {
+	s.challengeMu.Lock()
+	defer s.challengeMu.Unlock()
+
+	challenge := s.challenges[challengeID]
+	if challenge == nil || challenge.peerID != peer.ID || time.Now().After(challenge.expiresAt) || challenge.usedFor != "" {
+		return fmt.Errorf("unknown or expired challenge")
+	}
+
+	for _, key := range []string{peer.WGPublicKey, peer.NextWGPublicKey} {
+		publicKey, err := crypto.DecodeKey(key)
+		if key == "" || err != nil {
+			continue
+		}
+		if crypto.VerifyKeyProof(challenge.privateKey, publicKey, transcript, proof) {
+			delete(s.challenges, challengeID)
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid proof of the peer's key")
+}
+
+// completeRotation makes a peer's pending key its key and retires the old
+// one. Callers hold registerMu.
+func (s *PeerService) completeRotation(peer *model.Peer, now time.Time) error {
+	old := peer.WGPublicKey
+	peer.WGPublicKey = peer.NextWGPublicKey
+	peer.NextWGPublicKey = ""
+	peer.KeySwitchAt = time.Time{}
+
+	if err := s.repo.CreateOrUpdate(peer); err != nil {
+		return fmt.Errorf("failed to store peer: %w", err)
+	}
+	if err := s.keys.RetireKey(old, now); err != nil {
+		return err
+	}
+
+	s.events.Record(model.EventPeerKey, peer.ID, "peer %s switched to its new key %s", peer.ID, shortKey(peer.WGPublicKey))
+	return nil
+}
+
+// completeDueRotation completes the peer's rotation if its switch time
+// has passed
+func (s *PeerService) completeDueRotation(id string) error {
+	s.registerMu.Lock()
+	defer s.registerMu.Unlock()
+
+	now := time.Now()
+	peer, err := s.repo.GetByID(id)
+	if err != nil {
+		return fmt.Errorf("failed to get peer: %w", err)
+	}
+	if peer == nil || !peer.KeySwitchDue(now) {
+		return nil
+	}
+	return s.completeRotation(peer, now)
+}
+
+// recordKeyChange adds a registered peer's key to the key history and
+// retires the keys it replaced
+func (s *PeerService) recordKeyChange(existing, peer *model.Peer, now time.Time) error {
+	if err := s.keys.AddKey(&model.PeerKey{PublicKey: peer.WGPublicKey, PeerID: peer.ID, AddedAt: now}); err != nil {
+		return err
+	}
+	if existing == nil {
+		return nil
+	}
+
+	for _, replaced := range []string{existing.WGPublicKey, existing.NextWGPublicKey} {
+		if replaced == "" || replaced == peer.WGPublicKey || replaced == peer.NextWGPublicKey {
+			continue
+		}
+		if err := s.keys.RetireKey(replaced, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PeerKeys returns a peer's key history, oldest first
+func (s *PeerService) PeerKeys(id string) ([]proto.PeerKey, error) {
+	keys, err := s.keys.GetKeys(id)
+	if err != nil {
+		return nil, err
+	}
+
+	peer, err := s.repo.GetByID(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get peer: %w", err)
+	}
+	if peer == nil && len(keys) == 0 {
+		return nil, fmt.Errorf("peer %s: %w", id, ErrNotFound)
+	}
+
+	result := []proto.PeerKey{}
+	for _, key := range keys {
+		result = append(result, key.ToProto())
+	}
+	return result, nil
+}
+
+// shortKey abbreviates a public key for event messages
+func shortKey(key string) string {
+	if len(key) > 12 {
+		return key[:12] + "..."
+	}
+	return key
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/controlplane/model"
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/proto"
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/utils"
+)
+
+const (
+	maxHostnameLength = 253
+	maxTags           = 32
+	maxLabels         = 32
+	maxLabelKeyLength = 63
+	maxLabelLength    = 255
+	maxFeatures       = 16
+)
+
+// PeerFilter selects peers by network, tags and labels. Empty fields match
+// every peer; a peer must carry all listed tags and labels.
+type PeerFilter struct {
+	Network string
+	Tags    []string
+	Labels  map[string]string
+}
+
+// Matches reports whether the peer passes the filter
+func (f PeerFilter) Matches(peer *model.Peer) bool {
+	if f.Network != "" && peer.Network != f.Network {
+		return false
+	}
+
+	for _, tag := range f.Tags {
+		found := false
+		for _, t := range peer.Tags {
+			if t == tag {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	for key, value := range f.Labels {
+		if v, ok := peer.Labels[key]; !ok || v != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// validateMetadata checks the metadata a node reports about itself
+func validateMetadata(meta *proto.PeerMetadata) error {
+	if len(meta.Hostname) > maxHostnameLength {
+		return fmt.Errorf("hostname longer than %d characters", maxHostnameLength)
+	}
+
+	if len(meta.Tags) > maxTags {
+		return fmt.Errorf("more than %d tags", maxTags)
+	}
+	for _, tag := range meta.Tags {
+		if !utils.IsDNSLabel(tag) {
+			return fmt.Errorf("invalid tag %q: must be lowercase letters, digits and dashes", tag)
+		}
+	}
+
+	if len(meta.Labels) > maxLabels {
+		return fmt.Errorf("more than %d labels", maxLabels)
+	}
+	for key, value := range meta.Labels {
+		if key == "" || len(key) > maxLabelKeyLength || strings.ContainsAny(key, "=,") {
+			return fmt.Errorf("invalid label key %q", key)
+		}
+		if len(value) > maxLabelLength {
+			return fmt.Errorf("label %q longer than %d characters", key, maxLabelLength)
+		}
+	}
+
+	if len(meta.Features) > maxFeatures {
+		return fmt.Errorf("more than %d features", maxFeatures)
+	}
+	for _, feature := range meta.Features {
+		if !utils.IsDNSLabel(feature) {
+			return fmt.Errorf("invalid feature %q", feature)
+		}
+	}
+
+	return nil
+}
+
+// baseName derives a peer's preferred DNS name from its hostname, falling
+// back to its ID
+func baseName(peer *model.Peer) string {
+	host, _, _ := strings.Cut(peer.Hostname, ".")
+	if name := utils.DNSLabel(host); name != "" {
+		return name
+	}
+	if name := utils.DNSLabel(peer.ID); name != "" {
+		return name
+	}
+	return "peer"
+}
+
+// uniqueName returns base, or base with the lowest free "-N" suffix, so
+// that it is not used by any of the other peers
+func uniqueName(base string, others []*model.Peer) string {
+	taken := make(map[string]bool, len(others))
+	for _, other := range others {
+		taken[other.Name] = true
+	}
+
+	if !taken[base] {
+		return base
+	}
+	for i := 2; ; i++ {
+		suffix := fmt.Sprintf("-%d", i)
+		name := base
+		if len(name)+len(suffix) > 63 {
+			name = strings.TrimRight(name[:63-len(suffix)], "-")
+		}
+		if name += suffix; !taken[name] {
+			return name
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/controlplane/model"
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/proto"
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/utils"
+)
+
+const maxRoutes = 64
+
+// ApproveRoutes replaces the subnet routes a peer may serve. Routes the
+// peer does not (yet) advertise may be approved ahead of time; other peers
+// only use routes that are both advertised and approved.
+func (s *PeerService) ApproveRoutes(id string, routes []string) (*proto.PeerInfo, error) {
+	routes, err := normalizeRoutes(routes)
+	if err != nil {
+		return nil, err
+	}
+
+	s.registerMu.Lock()
+	defer s.registerMu.Unlock()
+
+	peer, err := s.repo.GetByID(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get peer: %w", err)
+	}
+	if peer == nil {
+		return nil, fmt.Errorf("peer %s: %w", id, ErrNotFound)
+	}
+
+	peer.ApprovedRoutes = routes
+	if err := s.repo.CreateOrUpdate(peer); err != nil {
+		return nil, fmt.Errorf("failed to store peer: %w", err)
+	}
+
+	s.events.Record(model.EventRoutesApproved, id, "routes approved for peer %s: %s", id, formatRoutes(routes))
+
+	info := peer.ToProto()
+	return &info, nil
+}
+
+// normalizeRoutes validates subnet and exit routes and returns them sorted
+// without duplicates
+func normalizeRoutes(routes []string) ([]string, error) {
+	if len(routes) > maxRoutes {
+		return nil, fmt.Errorf("more than %d routes", maxRoutes)
+	}
+
+	seen := make(map[string]bool, len(routes))
+	var normalized []string
+	for _, route := range routes {
+		if !utils.IsExitRoute(route) {
+			if err := utils.ValidateRoute(route); err != nil {
+				return nil, err
+			}
+		}
+		if !seen[route] {
+			seen[route] = true
+			normalized = append(normalized, route)
+		}
+	}
+
+	sort.Strings(normalized)
+	return normalized, nil
+}
+
+// sameRoutes reports whether two normalized route lists are equal
+func sameRoutes(a, b []string) bool {
+	return strings.Join(a, ",") == strings.Join(b, ",")
+}
+
+// formatRoutes renders routes for event messages
+func formatRoutes(routes []string) string {
+	if len(routes) == 0 {
+		return "none"
+	}
+	return strings.Join(routes, ", ")
+}
@@ -1,7 +1,11 @@
 package service
 
 import (
+	"cmp"
 	"fmt"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/Vaibhav2154/ShadowNet/internal/controlplane/model"
@@ -14,79 +18,331 @@ import (
 // PeerService handles peer business logic
 type PeerService struct {
 	repo           store.PeerRepository
+	networks       store.NetworkRepository
+	tokens         *TokenService
+	events         *EventService
 	activeTimeout  time.Duration
 	startTime      time.Time
+
+	// registerMu serializes registrations so name assignment sees a
+	// consistent view of the network
+	registerMu sync.Mutex
+
+	// requireJoinToken rejects new peers without a valid join token
+	requireJoinToken bool
+
+	// keys is the history of peers' WireGuard keys; keySwitchDelay is how
+	// long after a key rotation everyone switches to the new key
+	keys           store.KeyRepository
+	keySwitchDelay time.Duration
+
+	// challenges are the outstanding key rotation challenges by ID
+	challengeMu sync.Mutex
+	challenges  map[string]*keyChallenge
+
+	// expiredUntil is when peers were last checked for going inactive
+	expiryMu     sync.Mutex
+	expiredUntil time.Time
 }
 
 // NewPeerService creates a new peer service
-func NewPeerService(repo store.PeerRepository, activeTimeout time.Duration) *PeerService {
+func NewPeerService(repo store.PeerRepository, networks store.NetworkRepository, keys store.KeyRepository, tokens *TokenService, events *EventService, activeTimeout, keySwitchDelay time.Duration, requireJoinToken bool) *PeerService {
 	return &PeerService{
-		repo:          repo,
-		activeTimeout: activeTimeout,
-		startTime:     time.Now(),
+		repo:             repo,
+		networks:         networks,
+		keys:             keys,
+		tokens:           tokens,
+		events:           events,
+		activeTimeout:    activeTimeout,
+		keySwitchDelay:   keySwitchDelay,
+		startTime:        time.Now(),
+		expiredUntil:     time.Now(),
+		requireJoinToken: requireJoinToken,
+		challenges:       make(map[string]*keyChallenge),
 	}
 }
 
-// RegisterPeer validates and registers a new peer
-func (s *PeerService) RegisterPeer(info *proto.PeerInfo) error {
+// RegisterPeer validates and registers a new peer. New peers need a join
+// token when tokens are required; a valid token also places the peer in
+// the token's network. Known peers must present their key, or the new key
+// of a rotation, and retired keys are rejected. Each peer gets a DNS name derived from its hostname that is
+// unique within its network. It returns the peer as stored.
+func (s *PeerService) RegisterPeer(info *proto.PeerInfo, joinToken string) (*proto.PeerInfo, error) {
 	// Validate peer info
 	if info.ID == "" {
-		return fmt.Errorf("peer ID is required")
+		return nil, fmt.Errorf("peer ID is required")
 	}
 	
 	if err := crypto.ValidatePublicKey(info.WGPublicKey); err != nil {
-		return fmt.Errorf("invalid public key: %w", err)
+		return nil, fmt.Errorf("invalid public key: %w", err)
 	}
 	
 	if err := utils.ValidateIP(info.EndpointIP); err != nil {
-		return fmt.Errorf("invalid endpoint IP: %w", err)
+		return nil, fmt.Errorf("invalid endpoint IP: %w", err)
 	}
 	
 	if err := utils.ValidatePort(info.EndpointPort); err != nil {
-		return fmt.Errorf("invalid endpoint port: %w", err)
+		return nil, fmt.Errorf("invalid endpoint port: %w", err)
+	}
+	
+	if info.EndpointIPv6 != "" {
+		if err := utils.ValidateIPv6(info.EndpointIPv6); err != nil {
+			return nil, fmt.Errorf("invalid IPv6 endpoint: %w", err)
+		}
+		if err := utils.ValidatePort(info.EndpointPortV6); err != nil {
+			return nil, fmt.Errorf("invalid IPv6 endpoint port: %w", err)
+		}
+	} else {
+		info.EndpointPortV6 = 0
+	}
+	
+	if err := validateMetadata(&info.PeerMetadata); err != nil {
+		return nil, fmt.Errorf("invalid metadata: %w", err)
+	}
+	
+	advertised, err := normalizeRoutes(info.AdvertisedRoutes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid advertised routes: %w", err)
+	}
+	
+	s.registerMu.Lock()
+	defer s.registerMu.Unlock()
+	
+	existing, err := s.repo.GetByID(info.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get peer: %w", err)
+	}
+
+	now := time.Now()
+	if existing != nil && existing.KeySwitchDue(now) {
+		if err := s.completeRotation(existing, now); err != nil {
+			return nil, err
+		}
+	}
+
+	// Retired keys are never accepted again. Registering with the pending
+	// key of a rotation completes it early, e.g. after a restart.
+	known, err := s.keys.GetKey(info.WGPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	if known != nil && known.Retired() {
+		s.events.Record(model.EventRegisterDenied, info.ID, "peer %s denied: key %s was retired", info.ID, shortKey(info.WGPublicKey))
+		return nil, fmt.Errorf("%w: key was retired, generate a new one", ErrForbidden)
+	}
+	rotated := existing != nil && existing.NextWGPublicKey != "" && info.WGPublicKey == existing.NextWGPublicKey
+
+	// A peer keeps its key until it proves a rotation; otherwise anyone
+	// knowing its ID could take over its name and address
+	if existing != nil && info.WGPublicKey != existing.WGPublicKey && !rotated {
+		s.events.Record(model.EventRegisterDenied, info.ID, "peer %s denied: key %s is not the peer's key", info.ID, shortKey(info.WGPublicKey))
+		return nil, fmt.Errorf("%w: peer %s is registered with another key; rotate keys through /keys/rotate or have an admin remove the peer", ErrForbidden, info.ID)
 	}
 	
 	// Create peer model
 	peer := model.FromProto(info)
 	peer.LastSeen = time.Now()
+	peer.Network = proto.DefaultNetwork
+	peer.AdvertisedRoutes = advertised
+	peer.ApprovedRoutes = nil
+	if existing != nil {
+		peer.Network = existing.Network
+		peer.ApprovedRoutes = existing.ApprovedRoutes
+		if info.WGPublicKey == existing.WGPublicKey {
+			peer.NextWGPublicKey = existing.NextWGPublicKey
+			peer.KeySwitchAt = existing.KeySwitchAt
+		}
+	}
+	
+	// Admit the peer
+	needsToken := existing == nil
+	if needsToken && joinToken != "" {
+		token, err := s.tokens.Redeem(joinToken)
+		if err != nil {
+			s.events.Record(model.EventRegisterDenied, info.ID, "peer %s denied: %v", info.ID, err)
+			return nil, fmt.Errorf("%w: %v", ErrForbidden, err)
+		}
+		peer.Network = token.Network
+	} else if needsToken && s.requireJoinToken {
+		s.events.Record(model.EventRegisterDenied, info.ID, "peer %s denied: no join token", info.ID)
+		return nil, fmt.Errorf("%w: join token required", ErrForbidden)
+	}
+	
+	// Name the peer, keeping its name while its hostname and network stay
+	// the same
+	if existing != nil && existing.Name != "" && existing.Hostname == peer.Hostname && existing.Network == peer.Network {
+		peer.Name = existing.Name
+	} else if peer.Name, err = s.assignName(peer); err != nil {
+		return nil, err
+	}
 	
 	// Store peer
 	if err := s.repo.CreateOrUpdate(peer); err != nil {
-		return fmt.Errorf("failed to store peer: %w", err)
+		return nil, fmt.Errorf("failed to store peer: %w", err)
+	}
+	if err := s.recordKeyChange(existing, peer, now); err != nil {
+		return nil, err
 	}
 	
-	return nil
+	endpoint := utils.FormatEndpoint(peer.EndpointIP, peer.EndpointPort)
+	if peer.EndpointIPv6 != "" {
+		endpoint += " and " + utils.FormatEndpoint(peer.EndpointIPv6, peer.EndpointPortV6)
+	}
+	switch {
+	case existing == nil:
+		s.events.Record(model.EventPeerJoined, peer.ID, "peer %s (%s) joined network %s from %s", peer.ID, peer.Name, peer.Network, endpoint)
+	case rotated:
+		s.events.Record(model.EventPeerKey, peer.ID, "peer %s switched to its new key %s", peer.ID, shortKey(peer.WGPublicKey))
+	case existing.EndpointIP != peer.EndpointIP || existing.EndpointPort != peer.EndpointPort ||
+		existing.EndpointIPv6 != peer.EndpointIPv6 || existing.EndpointPortV6 != peer.EndpointPortV6:
+		s.events.Record(model.EventPeerEndpoint, peer.ID, "peer %s moved to %s", peer.ID, endpoint)
+	case now.Sub(existing.LastSeen) > s.activeTimeout:
+		s.events.Record(model.EventPeerActive, peer.ID, "peer %s is active again", peer.ID)
+	}
+	if (existing == nil && len(advertised) > 0) || (existing != nil && !sameRoutes(existing.AdvertisedRoutes, advertised)) {
+		s.events.Record(model.EventPeerRoutes, peer.ID, "peer %s advertises routes: %s", peer.ID, formatRoutes(advertised))
+	}
+	if existing != nil && !slices.Equal(existing.Features, peer.Features) {
+		s.events.Record(model.EventPeerFeatures, peer.ID, "peer %s uses features: %s", peer.ID, cmp.Or(strings.Join(peer.Features, ", "), "none"))
+	}
+	
+	registered := peer.ToProto()
+	return &registered, nil
 }
 
-// GetActivePeers returns all active peers, optionally excluding one
-func (s *PeerService) GetActivePeers(excludeID string) ([]*proto.PeerInfo, error) {
+// assignName picks a name for the peer that no other peer of its network
+// uses
+func (s *PeerService) assignName(peer *model.Peer) (string, error) {
+	peers, err := s.repo.GetAll()
+	if err != nil {
+		return "", fmt.Errorf("failed to get peers: %w", err)
+	}
+
+	var others []*model.Peer
+	for _, other := range peers {
+		if other.ID != peer.ID && other.Network == peer.Network {
+			others = append(others, other)
+		}
+	}
+
+	return uniqueName(baseName(peer), others), nil
+}
+
+// GetActivePeers returns all active peers matching the filter, optionally
+// excluding one. When the excluded peer is the requester, only peers of its
+// network that the network's ACL policy lets it reach are returned.
+func (s *PeerService) GetActivePeers(excludeID string, filter PeerFilter) ([]*proto.PeerInfo, error) {
 	peers, err := s.repo.GetAllActive(s.activeTimeout)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get active peers: %w", err)
 	}
 	
+	var requester *model.Peer
+	var policy *proto.ACLPolicy
+	if excludeID != "" {
+		if requester, err = s.repo.GetByID(excludeID); err != nil {
+			return nil, fmt.Errorf("failed to get peer: %w", err)
+		}
+	}
+	if requester != nil {
+		network, err := s.networks.GetNetwork(requester.Network)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get network: %w", err)
+		}
+		if network != nil {
+			policy = network.ACL
+		}
+	}
+	
 	var result []*proto.PeerInfo
 	for _, peer := range peers {
 		if excludeID != "" && peer.ID == excludeID {
 			continue
 		}
+		if requester != nil && (peer.Network != requester.Network || !canPeer(policy, requester.ID, peer.ID)) {
+			continue
+		}
+		if !filter.Matches(peer) {
+			continue
+		}
 		info := peer.ToProto()
+		info.Tunnels = nil // a peer's traffic and endpoints are for admins only
 		result = append(result, &info)
 	}
 	
 	return result, nil
 }
 
-// UpdateHeartbeat updates the last seen timestamp for a peer
-func (s *PeerService) UpdateHeartbeat(id string) error {
+// UpdateHeartbeat updates the last seen timestamp for a peer and stores its
+// tunnel stats when the heartbeat carries them
+func (s *PeerService) UpdateHeartbeat(id string, tunnels []proto.TunnelStats) error {
 	if id == "" {
 		return fmt.Errorf("peer ID is required")
 	}
+
+	// Nodes register again when told they are unknown
+	peer, err := s.repo.GetByID(id)
+	if err != nil {
+		return fmt.Errorf("failed to update heartbeat: %w", err)
+	}
+	if peer == nil {
+		return fmt.Errorf("peer %s: %w", id, ErrNotFound)
+	}
+
+	// The rotating peer heartbeats, so its switch is recorded soon after
+	// it happens
+	if peer.KeySwitchDue(time.Now()) {
+		if err := s.completeDueRotation(id); err != nil {
+			return fmt.Errorf("failed to update heartbeat: %w", err)
+		}
+	}
 	
 	if err := s.repo.UpdateLastSeen(id); err != nil {
 		return fmt.Errorf("failed to update heartbeat: %w", err)
 	}
+	if time.Since(peer.LastSeen) > s.activeTimeout {
+		s.events.Record(model.EventPeerActive, id, "peer %s is active again", id)
+	}
 	
+	if tunnels != nil {
+		if err := s.repo.UpdateTunnels(id, tunnels); err != nil {
+			return fmt.Errorf("failed to update heartbeat: %w", err)
+		}
+	}
+	
+	return nil
+}
+
+// PeersRevision identifies the current state of the peer maps: every
+// change to peers, networks or ACLs records an event, so it is the ID of
+// the latest event. Peers going inactive record no event by themselves, so
+// the ones that timed out since the last call are recorded first.
+func (s *PeerService) PeersRevision() (int64, error) {
+	if err := s.recordExpired(); err != nil {
+		return 0, err
+	}
+	return s.events.LatestID()
+}
+
+// recordExpired records an event for every peer that went inactive since
+// it last ran
+func (s *PeerService) recordExpired() error {
+	s.expiryMu.Lock()
+	defer s.expiryMu.Unlock()
+
+	peers, err := s.repo.GetAll()
+	if err != nil {
+		return fmt.Errorf("failed to get peers: %w", err)
+	}
+
+	now := time.Now()
+	for _, peer := range peers {
+		expiry := peer.LastSeen.Add(s.activeTimeout)
+		if expiry.After(s.expiredUntil) && !expiry.After(now) {
+			s.events.Record(model.EventPeerInactive, peer.ID, "peer %s is inactive", peer.ID)
+		}
+	}
+	s.expiredUntil = now
 	return nil
 }
 
@@ -126,3 +382,40 @@ func (s *PeerService) GetPeerByID(id string) (*proto.PeerInfo, error) {
 	info := peer.ToProto()
 	return &info, nil
 }
+
+// ListPeers returns all peers, active or not, that match the filter
+func (s *PeerService) ListPeers(filter PeerFilter) ([]proto.PeerInfo, error) {
+	peers, err := s.repo.GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get peers: %w", err)
+	}
+
+	result := []proto.PeerInfo{}
+	for _, peer := range peers {
+		if filter.Matches(peer) {
+			result = append(result, peer.ToProto())
+		}
+	}
+
+	return result, nil
+}
+
+// DeletePeer removes a peer. It is dropped from other peers' configuration
+// on their next sync and has to register again, with a join token when
+// tokens are required.
+func (s *PeerService) DeletePeer(id string) error {
+	peer, err := s.repo.GetByID(id)
+	if err != nil {
+		return fmt.Errorf("failed to get peer: %w", err)
+	}
+	if peer == nil {
+		return fmt.Errorf("peer %s: %w", id, ErrNotFound)
+	}
+
+	if err := s.repo.Delete(id); err != nil {
+		return err
+	}
+
+	s.events.Record(model.EventPeerDeleted, id, "peer %s deleted", id)
+	return nil
+}
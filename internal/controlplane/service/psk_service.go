@@ -0,0 +1,196 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/controlplane/model"
+	"github.com/Vaibhav2154/ShadowNet/internal/controlplane/store"
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/crypto"
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/proto"
+)
+
+// maxSealedPSKLength bounds a sealed preshared key: nonce, key and tag
+// take 72 bytes
+const maxSealedPSKLength = 128
+
+// PSKService relays preshared key offers between the peers of a pair. The
+// keys are sealed between the peers' static keys, so it never learns them.
+type PSKService struct {
+	repo  store.PSKRepository
+	peers store.PeerRepository
+
+	// keys checks that offers come from the holder of the sender's key
+	keys *PeerService
+
+	// switchDelay is how long after the recipient acknowledged an offer
+	// both peers install the key
+	switchDelay time.Duration
+}
+
+// NewPSKService creates a new preshared key service
+func NewPSKService(repo store.PSKRepository, peers store.PeerRepository, keys *PeerService, switchDelay time.Duration) *PSKService {
+	return &PSKService{
+		repo:        repo,
+		peers:       peers,
+		keys:        keys,
+		switchDelay: switchDelay,
+	}
+}
+
+// Offer stores new preshared key offers from a peer, replacing the
+// previous offers to the same peers. The sender proves it holds its key
+// over all offers, and all are checked before any is stored.
+func (s *PSKService) Offer(req *proto.PSKOffersRequest) error {
+	sender, err := s.peers.GetByID(req.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get peer: %w", err)
+	}
+	if sender == nil {
+		return fmt.Errorf("peer %s: %w", req.ID, ErrNotFound)
+	}
+
+	offers := req.Offers
+	contexts := make([][]byte, len(offers))
+	sealed := make([][]byte, len(offers))
+	for i, offer := range offers {
+		contexts[i] = crypto.PSKContext(offer.FromID, offer.ToID, offer.Epoch, offer.FromKey, offer.ToKey)
+		sealed[i] = offer.SealedPSK
+	}
+	transcript := crypto.PSKOffersTranscript(req.ID, req.ChallengeID, contexts, sealed)
+	if err := s.keys.VerifyKeyPossession(sender, req.ChallengeID, transcript, req.Proof); err != nil {
+		return fmt.Errorf("%w: %v", ErrForbidden, err)
+	}
+
+	for i := range offers {
+		if err := s.validateOffer(sender, &offers[i]); err != nil {
+			return fmt.Errorf("invalid offer to %s: %w", offers[i].ToID, err)
+		}
+	}
+
+	now := time.Now()
+	for _, offer := range offers {
+		err := s.repo.SaveOffer(&model.PSKOffer{
+			FromID:    offer.FromID,
+			ToID:      offer.ToID,
+			Epoch:     offer.Epoch,
+			FromKey:   offer.FromKey,
+			ToKey:     offer.ToKey,
+			SealedPSK: offer.SealedPSK,
+			CreatedAt: now,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateOffer checks that an offer comes from the peer with the lower ID
+// of the pair, is sealed between both peers' keys, current or pending, and
+// has a higher epoch than the pair's last offer
+func (s *PSKService) validateOffer(sender *model.Peer, offer *proto.PSKOffer) error {
+	if offer.FromID != sender.ID {
+		return fmt.Errorf("offer from %s sent by %s", offer.FromID, sender.ID)
+	}
+	if offer.ToID <= sender.ID {
+		return fmt.Errorf("offers are made by the peer with the lower ID")
+	}
+	if len(offer.SealedPSK) == 0 || len(offer.SealedPSK) > maxSealedPSKLength {
+		return fmt.Errorf("invalid sealed preshared key")
+	}
+	if offer.FromKey != sender.WGPublicKey && offer.FromKey != sender.NextWGPublicKey {
+		return fmt.Errorf("not sealed with the sender's key")
+	}
+
+	recipient, err := s.peers.GetByID(offer.ToID)
+	if err != nil {
+		return fmt.Errorf("failed to get peer: %w", err)
+	}
+	if recipient == nil {
+		return fmt.Errorf("peer %s: %w", offer.ToID, ErrNotFound)
+	}
+	if offer.ToKey != recipient.WGPublicKey && offer.ToKey != recipient.NextWGPublicKey {
+		return fmt.Errorf("not sealed to the recipient's key")
+	}
+
+	previous, err := s.repo.GetOffer(offer.FromID, offer.ToID)
+	if err != nil {
+		return err
+	}
+	if previous != nil && offer.Epoch <= previous.Epoch {
+		return fmt.Errorf("epoch %d is not above the last one, %d", offer.Epoch, previous.Epoch)
+	}
+	if offer.Epoch < 1 {
+		return fmt.Errorf("invalid epoch %d", offer.Epoch)
+	}
+
+	return nil
+}
+
+// Acknowledge schedules the use of offers their recipient received, once
+// it proves it holds its key: both peers of a pair install the key after
+// the switch delay, so that the sender learns about it first.
+// Acknowledgements of offers already scheduled or since replaced are
+// ignored.
+func (s *PSKService) Acknowledge(req *proto.PSKAcksRequest) (*proto.PSKOffersResponse, error) {
+	peer, err := s.peers.GetByID(req.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get peer: %w", err)
+	}
+	if peer == nil {
+		return nil, fmt.Errorf("peer %s: %w", req.ID, ErrNotFound)
+	}
+
+	fromIDs := make([]string, len(req.Acks))
+	epochs := make([]int64, len(req.Acks))
+	for i, ack := range req.Acks {
+		fromIDs[i], epochs[i] = ack.FromID, ack.Epoch
+	}
+	transcript := crypto.PSKAcksTranscript(req.ID, req.ChallengeID, fromIDs, epochs)
+	if err := s.keys.VerifyKeyPossession(peer, req.ChallengeID, transcript, req.Proof); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrForbidden, err)
+	}
+
+	activateAt := time.Now().Add(s.switchDelay).Truncate(time.Second)
+	for _, ack := range req.Acks {
+		if err := s.repo.ActivateOffer(ack.FromID, req.ID, ack.Epoch, activateAt); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.Offers(req.ID)
+}
+
+// Offers returns the latest offer of each pair the peer is in. Offers the
+// recipient hasn't acknowledged yet have no activation time.
+func (s *PSKService) Offers(id string) (*proto.PSKOffersResponse, error) {
+	peer, err := s.peers.GetByID(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get peer: %w", err)
+	}
+	if peer == nil {
+		return nil, fmt.Errorf("peer %s: %w", id, ErrNotFound)
+	}
+
+	offers, err := s.repo.GetOffers(id)
+	if err != nil {
+		return nil, err
+	}
+	revision, err := s.repo.PSKRevision(id)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &proto.PSKOffersResponse{Offers: []proto.PSKOffer{}, Revision: revision}
+	for _, offer := range offers {
+		resp.Offers = append(resp.Offers, offer.ToProto())
+	}
+	return resp, nil
+}
+
+// Revision returns the revision of the offers to or from a peer
+func (s *PSKService) Revision(id string) (int64, error) {
+	return s.repo.PSKRevision(id)
+}
@@ -0,0 +1,168 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/controlplane/model"
+	"github.com/Vaibhav2154/ShadowNet/internal/controlplane/store"
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/crypto"
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/proto"
+)
+
+// StateService exports and imports the control plane's configuration
+type StateService struct {
+	peers    store.PeerRepository
+	networks store.NetworkRepository
+	tokens   store.TokenRepository
+	keys     store.KeyRepository
+	state    store.StateRepository
+	events   *EventService
+}
+
+// NewStateService creates a new state service
+func NewStateService(peers store.PeerRepository, networks store.NetworkRepository, tokens store.TokenRepository, keys store.KeyRepository, state store.StateRepository, events *EventService) *StateService {
+	return &StateService{
+		peers:    peers,
+		networks: networks,
+		tokens:   tokens,
+		keys:     keys,
+		state:    state,
+		events:   events,
+	}
+}
+
+// Export returns all networks, peers and join tokens. Tokens are exported
+// with their secret hashes, never their secrets.
+func (s *StateService) Export() (*proto.State, error) {
+	state := &proto.State{
+		ExportedAt: time.Now().Format(time.RFC3339),
+		Networks:   []proto.Network{},
+		Peers:      []proto.PeerInfo{},
+		Tokens:     []proto.ExportedToken{},
+	}
+
+	networks, err := s.networks.GetAllNetworks()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get networks: %w", err)
+	}
+	for _, network := range networks {
+		state.Networks = append(state.Networks, network.ToProto())
+	}
+
+	peers, err := s.peers.GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get peers: %w", err)
+	}
+	for _, peer := range peers {
+		info := peer.ToProto()
+		info.Tunnels = nil // runtime stats, not configuration
+		state.Peers = append(state.Peers, info)
+	}
+
+	tokens, err := s.tokens.GetAllTokens()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get join tokens: %w", err)
+	}
+	for _, token := range tokens {
+		state.Tokens = append(state.Tokens, proto.ExportedToken{
+			JoinToken:  token.ToProto(),
+			SecretHash: token.SecretHash,
+		})
+	}
+
+	return state, nil
+}
+
+// Import merges an exported state into the store. Existing networks, peers
+// and tokens with the same name or ID are overwritten; nothing is deleted.
+// Peers' keys join the key history, and retired keys are refused like on
+// registration. Everything is validated first and written in one
+// transaction, so a bad entry or a failed write doesn't leave a half import.
+func (s *StateService) Import(state *proto.State) (*proto.ImportResponse, error) {
+	known := map[string]bool{}
+	existing, err := s.networks.GetAllNetworks()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get networks: %w", err)
+	}
+	for _, network := range existing {
+		known[network.Name] = true
+	}
+
+	for _, network := range state.Networks {
+		if !networkNamePattern.MatchString(network.Name) {
+			return nil, fmt.Errorf("invalid network name %q", network.Name)
+		}
+		if err := validateACL(network.ACL); err != nil {
+			return nil, fmt.Errorf("network %s: %w", network.Name, err)
+		}
+		known[network.Name] = true
+	}
+	for _, peer := range state.Peers {
+		if peer.ID == "" {
+			return nil, fmt.Errorf("peer without ID")
+		}
+		if err := crypto.ValidatePublicKey(peer.WGPublicKey); err != nil {
+			return nil, fmt.Errorf("peer %s: invalid public key: %w", peer.ID, err)
+		}
+		if peer.Network != "" && !known[peer.Network] {
+			return nil, fmt.Errorf("peer %s: unknown network %s", peer.ID, peer.Network)
+		}
+		if _, err := normalizeRoutes(peer.ApprovedRoutes); err != nil {
+			return nil, fmt.Errorf("peer %s: invalid approved routes: %w", peer.ID, err)
+		}
+		for _, key := range []string{peer.WGPublicKey, peer.NextWGPublicKey} {
+			if key == "" {
+				continue
+			}
+			known, err := s.keys.GetKey(key)
+			if err != nil {
+				return nil, err
+			}
+			if known != nil && known.Retired() {
+				return nil, fmt.Errorf("peer %s: key %s was retired", peer.ID, shortKey(key))
+			}
+		}
+	}
+	for _, token := range state.Tokens {
+		if token.ID == "" || token.SecretHash == "" {
+			return nil, fmt.Errorf("join token without ID or secret hash")
+		}
+		if !known[token.Network] {
+			return nil, fmt.Errorf("join token %s: unknown network %s", token.ID, token.Network)
+		}
+	}
+
+	networks := make([]*model.Network, 0, len(state.Networks))
+	for i := range state.Networks {
+		networks = append(networks, model.NetworkFromProto(&state.Networks[i]))
+	}
+	now := time.Now()
+	peers := make([]*model.Peer, 0, len(state.Peers))
+	var keys []*model.PeerKey
+	for i := range state.Peers {
+		peer := model.FromProto(&state.Peers[i])
+		peers = append(peers, peer)
+		keys = append(keys, &model.PeerKey{PublicKey: peer.WGPublicKey, PeerID: peer.ID, AddedAt: now})
+		if peer.NextWGPublicKey != "" {
+			keys = append(keys, &model.PeerKey{PublicKey: peer.NextWGPublicKey, PeerID: peer.ID, AddedAt: now})
+		}
+	}
+	tokens := make([]*model.JoinToken, 0, len(state.Tokens))
+	for i := range state.Tokens {
+		tokens = append(tokens, model.TokenFromExport(&state.Tokens[i]))
+	}
+
+	if err := s.state.ImportState(networks, peers, tokens, keys); err != nil {
+		return nil, err
+	}
+	result := &proto.ImportResponse{
+		Networks: len(networks),
+		Peers:    len(peers),
+		Tokens:   len(tokens),
+	}
+
+	s.events.Record(model.EventStateImported, "", "imported %d networks, %d peers and %d join tokens",
+		result.Networks, result.Peers, result.Tokens)
+	return result, nil
+}
@@ -0,0 +1,159 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/controlplane/model"
+	"github.com/Vaibhav2154/ShadowNet/internal/controlplane/store"
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/proto"
+)
+
+// tokenPrefix marks join token secrets so they are recognizable in configs
+const tokenPrefix = "snjt_"
+
+// TokenService manages join tokens
+type TokenService struct {
+	repo     store.TokenRepository
+	networks store.NetworkRepository
+	events   *EventService
+}
+
+// NewTokenService creates a new token service
+func NewTokenService(repo store.TokenRepository, networks store.NetworkRepository, events *EventService) *TokenService {
+	return &TokenService{
+		repo:     repo,
+		networks: networks,
+		events:   events,
+	}
+}
+
+// Create creates a join token. The returned token carries the secret,
+// which is not stored and cannot be retrieved later.
+func (s *TokenService) Create(req *proto.CreateTokenRequest) (*proto.JoinToken, error) {
+	if req.Network == "" {
+		req.Network = proto.DefaultNetwork
+	}
+
+	network, err := s.networks.GetNetwork(req.Network)
+	if err != nil {
+		return nil, err
+	}
+	if network == nil {
+		return nil, fmt.Errorf("network %s: %w", req.Network, ErrNotFound)
+	}
+
+	if req.TTL < 0 {
+		return nil, fmt.Errorf("invalid TTL: %d", req.TTL)
+	}
+
+	id, err := randomString(6, hex.EncodeToString)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := randomString(32, base64.RawURLEncoding.EncodeToString)
+	if err != nil {
+		return nil, err
+	}
+	secret = tokenPrefix + secret
+
+	token := &model.JoinToken{
+		ID:          id,
+		SecretHash:  hashSecret(secret),
+		Network:     req.Network,
+		Description: req.Description,
+		Reusable:    req.Reusable,
+		CreatedAt:   time.Now(),
+	}
+	if req.TTL > 0 {
+		token.ExpiresAt = token.CreatedAt.Add(time.Duration(req.TTL) * time.Second)
+	}
+
+	if err := s.repo.CreateOrUpdateToken(token); err != nil {
+		return nil, fmt.Errorf("failed to store join token: %w", err)
+	}
+
+	s.events.Record(model.EventTokenCreated, "", "join token %s created for network %s", token.ID, token.Network)
+
+	result := token.ToProto()
+	result.Secret = secret
+	return &result, nil
+}
+
+// List returns all join tokens without their secrets
+func (s *TokenService) List() ([]proto.JoinToken, error) {
+	tokens, err := s.repo.GetAllTokens()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get join tokens: %w", err)
+	}
+
+	result := []proto.JoinToken{}
+	for _, token := range tokens {
+		result = append(result, token.ToProto())
+	}
+
+	return result, nil
+}
+
+// Revoke revokes a join token. Peers that already joined with it stay.
+func (s *TokenService) Revoke(id string) error {
+	tokens, err := s.repo.GetAllTokens()
+	if err != nil {
+		return fmt.Errorf("failed to get join tokens: %w", err)
+	}
+
+	found := false
+	for _, token := range tokens {
+		found = found || token.ID == id
+	}
+	if !found {
+		return fmt.Errorf("join token %s: %w", id, ErrNotFound)
+	}
+
+	if err := s.repo.RevokeToken(id); err != nil {
+		return fmt.Errorf("failed to revoke join token: %w", err)
+	}
+
+	s.events.Record(model.EventTokenRevoked, "", "join token %s revoked", id)
+	return nil
+}
+
+// Redeem validates a join token secret and counts a use of it
+func (s *TokenService) Redeem(secret string) (*model.JoinToken, error) {
+	token, err := s.repo.GetTokenByHash(hashSecret(secret))
+	if err != nil {
+		return nil, err
+	}
+	if token == nil {
+		return nil, fmt.Errorf("invalid join token")
+	}
+
+	if !token.Usable(time.Now()) {
+		return nil, fmt.Errorf("join token %s is revoked, expired or already used", token.ID)
+	}
+
+	if err := s.repo.UseToken(token.ID); err != nil {
+		return nil, fmt.Errorf("join token %s is revoked, expired or already used", token.ID)
+	}
+
+	return token, nil
+}
+
+// hashSecret returns the hex SHA-256 of a join token secret
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// randomString returns n random bytes in the given encoding
+func randomString(n int, encode func([]byte) string) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate random bytes: %w", err)
+	}
+	return encode(buf), nil
+}
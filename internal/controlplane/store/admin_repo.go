@@ -0,0 +1,96 @@
+package store
+
+import (
+	"time"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/controlplane/model"
+)
+
+// NetworkRepository defines the interface for network storage operations
+type NetworkRepository interface {
+	// CreateOrUpdateNetwork creates a new network or updates existing one
+	CreateOrUpdateNetwork(network *model.Network) error
+
+	// GetNetwork retrieves a network by name
+	GetNetwork(name string) (*model.Network, error)
+
+	// GetAllNetworks retrieves all networks
+	GetAllNetworks() ([]*model.Network, error)
+
+	// DeleteNetwork removes a network from storage
+	DeleteNetwork(name string) error
+}
+
+// TokenRepository defines the interface for join token storage operations
+type TokenRepository interface {
+	// CreateOrUpdateToken creates a new join token or updates existing one
+	CreateOrUpdateToken(token *model.JoinToken) error
+
+	// GetTokenByHash retrieves a join token by its secret hash
+	GetTokenByHash(secretHash string) (*model.JoinToken, error)
+
+	// GetAllTokens retrieves all join tokens
+	GetAllTokens() ([]*model.JoinToken, error)
+
+	// UseToken increments a join token's use count unless it is no longer
+	// usable
+	UseToken(id string) error
+
+	// RevokeToken marks a join token as revoked
+	RevokeToken(id string) error
+}
+
+// EventRepository defines the interface for event log storage operations
+type EventRepository interface {
+	// AddEvent appends an event to the log
+	AddEvent(event *model.Event) error
+
+	// GetEvents retrieves up to limit events with an ID above sinceID,
+	// oldest first. A zero sinceID returns the latest events.
+	GetEvents(sinceID int64, limit int) ([]*model.Event, error)
+}
+
+// KeyRepository defines the interface for peer key history storage
+// operations
+type KeyRepository interface {
+	// AddKey records a key as the given peer's unless it is retired
+	AddKey(key *model.PeerKey) error
+
+	// GetKey retrieves a key by its public key, nil if unknown
+	GetKey(publicKey string) (*model.PeerKey, error)
+
+	// GetKeys retrieves a peer's keys, oldest first
+	GetKeys(peerID string) ([]*model.PeerKey, error)
+
+	// RetireKey marks a key as retired
+	RetireKey(publicKey string, at time.Time) error
+}
+
+// PSKRepository defines the interface for preshared key offer storage
+// operations. Only the latest offer of each pair is kept.
+type PSKRepository interface {
+	// SaveOffer stores an offer, replacing the pair's previous one
+	SaveOffer(offer *model.PSKOffer) error
+
+	// GetOffer retrieves the offer from one peer to another, nil if none
+	GetOffer(fromID, toID string) (*model.PSKOffer, error)
+
+	// GetOffers retrieves the offers to or from a peer
+	GetOffers(peerID string) ([]*model.PSKOffer, error)
+
+	// ActivateOffer sets the activation time of an offer that doesn't
+	// have one yet, if the pair's offer is still the one of that epoch
+	ActivateOffer(fromID, toID string, epoch int64, at time.Time) error
+
+	// PSKRevision returns the latest revision of the offers to or from a
+	// peer, 0 if there are none
+	PSKRevision(peerID string) (int64, error)
+}
+
+// StateRepository defines the interface for importing a whole state
+type StateRepository interface {
+	// ImportState creates or updates networks, peers and join tokens and
+	// adds peer keys to the key history in one transaction, so a failure
+	// leaves nothing written
+	ImportState(networks []*model.Network, peers []*model.Peer, tokens []*model.JoinToken, keys []*model.PeerKey) error
+}
@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/Vaibhav2154/ShadowNet/internal/controlplane/model"
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/proto"
 )
 
 // PeerRepository defines the interface for peer storage operations
@@ -16,9 +17,15 @@ type PeerRepository interface {
 	
 	// GetAllActive retrieves all peers active within the timeout duration
 	GetAllActive(timeout time.Duration) ([]*model.Peer, error)
+
+	// GetAll retrieves all peers, active or not
+	GetAll() ([]*model.Peer, error)
 	
 	// UpdateLastSeen updates the last seen timestamp for a peer
 	UpdateLastSeen(id string) error
+
+	// UpdateTunnels stores the tunnel stats reported by a peer
+	UpdateTunnels(id string, tunnels []proto.TunnelStats) error
 	
 	// Delete removes a peer from storage
 	Delete(id string) error
@@ -2,10 +2,12 @@ package store
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"time"
 
 	"github.com/Vaibhav2154/ShadowNet/internal/controlplane/model"
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/proto"
 	_ "github.com/mattn/go-sqlite3"
 )
 
@@ -37,6 +39,96 @@ func NewSQLiteRepository(dbPath string) (*SQLiteRepository, error) {
 	return repo, nil
 }
 
+// peerColumns lists the peers columns in the order scanPeer expects
+const peerColumns = `id, wg_public_key, endpoint_ip, endpoint_port, last_seen,
+	nat_type, nat_mapping, nat_filtering, nat_hairpinning, nat_mapping_lifetime,
+	tunnels, network, name, hostname, os, arch, version, tags, labels,
+	advertised_routes, approved_routes, endpoint_ipv6, endpoint_port_v6,
+	next_wg_public_key, key_switch_at, features`
+
+// execer is implemented by *sql.DB and *sql.Tx, so writes can run inside a
+// transaction
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanPeer scans a row selected with peerColumns
+func scanPeer(row rowScanner) (*model.Peer, error) {
+	var peer model.Peer
+	var tunnels, tags, labels, features, advertised, approved string
+	var keySwitchAt sql.NullTime
+	err := row.Scan(
+		&peer.ID,
+		&peer.WGPublicKey,
+		&peer.EndpointIP,
+		&peer.EndpointPort,
+		&peer.LastSeen,
+		&peer.NATType,
+		&peer.NATMapping,
+		&peer.NATFiltering,
+		&peer.NATHairpinning,
+		&peer.NATMappingLifetime,
+		&tunnels,
+		&peer.Network,
+		&peer.Name,
+		&peer.Hostname,
+		&peer.OS,
+		&peer.Arch,
+		&peer.Version,
+		&tags,
+		&labels,
+		&advertised,
+		&approved,
+		&peer.EndpointIPv6,
+		&peer.EndpointPortV6,
+		&peer.NextWGPublicKey,
+		&keySwitchAt,
+		&features,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if keySwitchAt.Valid {
+		peer.KeySwitchAt = keySwitchAt.Time
+	}
+	if tags != "" {
+		if err := json.Unmarshal([]byte(tags), &peer.Tags); err != nil {
+			return nil, fmt.Errorf("failed to decode tags: %w", err)
+		}
+	}
+	if labels != "" {
+		if err := json.Unmarshal([]byte(labels), &peer.Labels); err != nil {
+			return nil, fmt.Errorf("failed to decode labels: %w", err)
+		}
+	}
+	if features != "" {
+		if err := json.Unmarshal([]byte(features), &peer.Features); err != nil {
+			return nil, fmt.Errorf("failed to decode features: %w", err)
+		}
+	}
+	if advertised != "" {
+		if err := json.Unmarshal([]byte(advertised), &peer.AdvertisedRoutes); err != nil {
+			return nil, fmt.Errorf("failed to decode advertised routes: %w", err)
+		}
+	}
+	if approved != "" {
+		if err := json.Unmarshal([]byte(approved), &peer.ApprovedRoutes); err != nil {
+			return nil, fmt.Errorf("failed to decode approved routes: %w", err)
+		}
+	}
+	if tunnels != "" {
+		if err := json.Unmarshal([]byte(tunnels), &peer.Tunnels); err != nil {
+			return nil, fmt.Errorf("failed to decode tunnel stats: %w", err)
+		}
+	}
+	return &peer, nil
+}
+
 // initSchema creates the peers table if it doesn't exist
 func (r *SQLiteRepository) initSchema() error {
 	query := `
@@ -48,30 +140,241 @@ func (r *SQLiteRepository) initSchema() error {
 		last_seen DATETIME NOT NULL
 	);
 	CREATE INDEX IF NOT EXISTS idx_last_seen ON peers(last_seen);
+
+	CREATE TABLE IF NOT EXISTS networks (
+		name TEXT PRIMARY KEY,
+		description TEXT NOT NULL DEFAULT '',
+		acl TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS join_tokens (
+		id TEXT PRIMARY KEY,
+		secret_hash TEXT NOT NULL UNIQUE,
+		network TEXT NOT NULL,
+		description TEXT NOT NULL DEFAULT '',
+		reusable BOOLEAN NOT NULL DEFAULT 0,
+		uses INTEGER NOT NULL DEFAULT 0,
+		expires_at DATETIME,
+		created_at DATETIME NOT NULL,
+		revoked BOOLEAN NOT NULL DEFAULT 0
+	);
+
+	CREATE TABLE IF NOT EXISTS events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		time DATETIME NOT NULL,
+		type TEXT NOT NULL,
+		peer_id TEXT NOT NULL DEFAULT '',
+		message TEXT NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS peer_keys (
+		public_key TEXT PRIMARY KEY,
+		peer_id TEXT NOT NULL,
+		added_at DATETIME NOT NULL,
+		retired_at DATETIME
+	);
+	CREATE INDEX IF NOT EXISTS idx_peer_keys_peer ON peer_keys(peer_id);
+
+	CREATE TABLE IF NOT EXISTS psk_offers (
+		from_id TEXT NOT NULL,
+		to_id TEXT NOT NULL,
+		epoch INTEGER NOT NULL,
+		from_key TEXT NOT NULL,
+		to_key TEXT NOT NULL,
+		sealed_psk BLOB NOT NULL,
+		created_at DATETIME NOT NULL,
+		activate_at DATETIME,
+		revision INTEGER NOT NULL,
+		PRIMARY KEY (from_id, to_id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_psk_offers_to ON psk_offers(to_id);
 	`
 
-	_, err := r.db.Exec(query)
-	return err
+	if _, err := r.db.Exec(query); err != nil {
+		return err
+	}
+
+	if err := r.migrate(); err != nil {
+		return err
+	}
+
+	// Every peer belongs to a network; make sure the default one exists
+	_, err := r.db.Exec(`INSERT OR IGNORE INTO networks (name, created_at) VALUES (?, ?)`,
+		proto.DefaultNetwork, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to create default network: %w", err)
+	}
+
+	return nil
+}
+
+// migrate adds columns introduced after the initial schema
+func (r *SQLiteRepository) migrate() error {
+	columns := []struct {
+		table, name, definition string
+	}{
+		{"peers", "nat_type", "TEXT NOT NULL DEFAULT ''"},
+		{"peers", "nat_mapping", "TEXT NOT NULL DEFAULT ''"},
+		{"peers", "nat_filtering", "TEXT NOT NULL DEFAULT ''"},
+		{"peers", "nat_hairpinning", "BOOLEAN NOT NULL DEFAULT 0"},
+		{"peers", "nat_mapping_lifetime", "INTEGER NOT NULL DEFAULT 0"},
+		{"peers", "tunnels", "TEXT NOT NULL DEFAULT ''"},
+		{"peers", "network", "TEXT NOT NULL DEFAULT '" + proto.DefaultNetwork + "'"},
+		{"peers", "name", "TEXT NOT NULL DEFAULT ''"},
+		{"peers", "hostname", "TEXT NOT NULL DEFAULT ''"},
+		{"peers", "os", "TEXT NOT NULL DEFAULT ''"},
+		{"peers", "arch", "TEXT NOT NULL DEFAULT ''"},
+		{"peers", "version", "TEXT NOT NULL DEFAULT ''"},
+		{"peers", "tags", "TEXT NOT NULL DEFAULT ''"},
+		{"peers", "labels", "TEXT NOT NULL DEFAULT ''"},
+		{"peers", "advertised_routes", "TEXT NOT NULL DEFAULT ''"},
+		{"peers", "approved_routes", "TEXT NOT NULL DEFAULT ''"},
+		{"peers", "endpoint_ipv6", "TEXT NOT NULL DEFAULT ''"},
+		{"peers", "endpoint_port_v6", "INTEGER NOT NULL DEFAULT 0"},
+		{"peers", "next_wg_public_key", "TEXT NOT NULL DEFAULT ''"},
+		{"peers", "key_switch_at", "DATETIME"},
+		{"peers", "features", "TEXT NOT NULL DEFAULT ''"},
+	}
+
+	for _, c := range columns {
+		if err := r.addColumnIfMissing(c.table, c.name, c.definition); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addColumnIfMissing adds a column to an existing table
+func (r *SQLiteRepository) addColumnIfMissing(table, column, definition string) error {
+	rows, err := r.db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return fmt.Errorf("failed to inspect table %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid        int
+			name, typ  string
+			notNull    bool
+			defaultVal sql.NullString
+			pk         int
+		)
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &defaultVal, &pk); err != nil {
+			return fmt.Errorf("failed to scan table info: %w", err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating table info: %w", err)
+	}
+
+	query := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)
+	if _, err := r.db.Exec(query); err != nil {
+		return fmt.Errorf("failed to add column %s.%s: %w", table, column, err)
+	}
+
+	return nil
 }
 
-// CreateOrUpdate creates a new peer or updates existing one
+// CreateOrUpdate creates a new peer or updates existing one; tunnel stats
+// are only written for new peers and otherwise updated by heartbeats
 func (r *SQLiteRepository) CreateOrUpdate(peer *model.Peer) error {
+	return createOrUpdatePeer(r.db, peer)
+}
+
+// createOrUpdatePeer implements CreateOrUpdate on a database or transaction
+func createOrUpdatePeer(db execer, peer *model.Peer) error {
+	tunnels, err := encodeTunnels(peer.Tunnels)
+	if err != nil {
+		return err
+	}
+	tags, err := encodeJSON(peer.Tags, len(peer.Tags) == 0)
+	if err != nil {
+		return fmt.Errorf("failed to encode tags: %w", err)
+	}
+	labels, err := encodeJSON(peer.Labels, len(peer.Labels) == 0)
+	if err != nil {
+		return fmt.Errorf("failed to encode labels: %w", err)
+	}
+	features, err := encodeJSON(peer.Features, len(peer.Features) == 0)
+	if err != nil {
+		return fmt.Errorf("failed to encode features: %w", err)
+	}
+	advertised, err := encodeJSON(peer.AdvertisedRoutes, len(peer.AdvertisedRoutes) == 0)
+	if err != nil {
+		return fmt.Errorf("failed to encode advertised routes: %w", err)
+	}
+	approved, err := encodeJSON(peer.ApprovedRoutes, len(peer.ApprovedRoutes) == 0)
+	if err != nil {
+		return fmt.Errorf("failed to encode approved routes: %w", err)
+	}
+	var keySwitchAt sql.NullTime
+	if peer.NextWGPublicKey != "" {
+		keySwitchAt = sql.NullTime{Time: peer.KeySwitchAt, Valid: true}
+	}
+
 	query := `
-	INSERT INTO peers (id, wg_public_key, endpoint_ip, endpoint_port, last_seen)
-	VALUES (?, ?, ?, ?, ?)
+	INSERT INTO peers (` + peerColumns + `)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	ON CONFLICT(id) DO UPDATE SET
 		wg_public_key = excluded.wg_public_key,
 		endpoint_ip = excluded.endpoint_ip,
 		endpoint_port = excluded.endpoint_port,
-		last_seen = excluded.last_seen
+		last_seen = excluded.last_seen,
+		nat_type = excluded.nat_type,
+		nat_mapping = excluded.nat_mapping,
+		nat_filtering = excluded.nat_filtering,
+		nat_hairpinning = excluded.nat_hairpinning,
+		nat_mapping_lifetime = excluded.nat_mapping_lifetime,
+		network = excluded.network,
+		name = excluded.name,
+		hostname = excluded.hostname,
+		os = excluded.os,
+		arch = excluded.arch,
+		version = excluded.version,
+		tags = excluded.tags,
+		labels = excluded.labels,
+		advertised_routes = excluded.advertised_routes,
+		approved_routes = excluded.approved_routes,
+		endpoint_ipv6 = excluded.endpoint_ipv6,
+		endpoint_port_v6 = excluded.endpoint_port_v6,
+		next_wg_public_key = excluded.next_wg_public_key,
+		key_switch_at = excluded.key_switch_at,
+		features = excluded.features
 	`
 
-	_, err := r.db.Exec(query,
+	_, err = db.Exec(query,
 		peer.ID,
 		peer.WGPublicKey,
 		peer.EndpointIP,
 		peer.EndpointPort,
 		peer.LastSeen,
+		peer.NATType,
+		peer.NATMapping,
+		peer.NATFiltering,
+		peer.NATHairpinning,
+		peer.NATMappingLifetime,
+		tunnels,
+		peer.Network,
+		peer.Name,
+		peer.Hostname,
+		peer.OS,
+		peer.Arch,
+		peer.Version,
+		tags,
+		labels,
+		advertised,
+		approved,
+		peer.EndpointIPv6,
+		peer.EndpointPortV6,
+		peer.NextWGPublicKey,
+		keySwitchAt,
+		features,
 	)
 
 	if err != nil {
@@ -84,20 +387,12 @@ func (r *SQLiteRepository) CreateOrUpdate(peer *model.Peer) error {
 // GetByID retrieves a peer by ID
 func (r *SQLiteRepository) GetByID(id string) (*model.Peer, error) {
 	query := `
-	SELECT id, wg_public_key, endpoint_ip, endpoint_port, last_seen
+	SELECT ` + peerColumns + `
 	FROM peers
 	WHERE id = ?
 	`
 
-	var peer model.Peer
-	err := r.db.QueryRow(query, id).Scan(
-		&peer.ID,
-		&peer.WGPublicKey,
-		&peer.EndpointIP,
-		&peer.EndpointPort,
-		&peer.LastSeen,
-	)
-
+	peer, err := scanPeer(r.db.QueryRow(query, id))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -105,7 +400,7 @@ func (r *SQLiteRepository) GetByID(id string) (*model.Peer, error) {
 		return nil, fmt.Errorf("failed to get peer: %w", err)
 	}
 
-	return &peer, nil
+	return peer, nil
 }
 
 // GetAllActive retrieves all peers active within the timeout duration
@@ -113,7 +408,7 @@ func (r *SQLiteRepository) GetAllActive(timeout time.Duration) ([]*model.Peer, e
 	cutoff := time.Now().Add(-timeout)
 
 	query := `
-	SELECT id, wg_public_key, endpoint_ip, endpoint_port, last_seen
+	SELECT ` + peerColumns + `
 	FROM peers
 	WHERE last_seen > ?
 	ORDER BY last_seen DESC
@@ -125,20 +420,35 @@ func (r *SQLiteRepository) GetAllActive(timeout time.Duration) ([]*model.Peer, e
 	}
 	defer rows.Close()
 
+	return scanPeers(rows)
+}
+
+// GetAll retrieves all peers, active or not, ordered by ID
+func (r *SQLiteRepository) GetAll() ([]*model.Peer, error) {
+	query := `
+	SELECT ` + peerColumns + `
+	FROM peers
+	ORDER BY id
+	`
+
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query peers: %w", err)
+	}
+	defer rows.Close()
+
+	return scanPeers(rows)
+}
+
+// scanPeers scans all rows selected with peerColumns
+func scanPeers(rows *sql.Rows) ([]*model.Peer, error) {
 	var peers []*model.Peer
 	for rows.Next() {
-		var peer model.Peer
-		err := rows.Scan(
-			&peer.ID,
-			&peer.WGPublicKey,
-			&peer.EndpointIP,
-			&peer.EndpointPort,
-			&peer.LastSeen,
-		)
+		peer, err := scanPeer(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan peer: %w", err)
 		}
-		peers = append(peers, &peer)
+		peers = append(peers, peer)
 	}
 
 	if err := rows.Err(); err != nil {
@@ -173,6 +483,43 @@ func (r *SQLiteRepository) UpdateLastSeen(id string) error {
 	return nil
 }
 
+// UpdateTunnels stores the tunnel stats reported by a peer
+func (r *SQLiteRepository) UpdateTunnels(id string, tunnels []proto.TunnelStats) error {
+	encoded, err := encodeTunnels(tunnels)
+	if err != nil {
+		return err
+	}
+
+	if _, err := r.db.Exec(`UPDATE peers SET tunnels = ? WHERE id = ?`, encoded, id); err != nil {
+		return fmt.Errorf("failed to update tunnel stats: %w", err)
+	}
+
+	return nil
+}
+
+// encodeTunnels serializes tunnel stats for the tunnels column
+func encodeTunnels(tunnels []proto.TunnelStats) (string, error) {
+	encoded, err := encodeJSON(tunnels, len(tunnels) == 0)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode tunnel stats: %w", err)
+	}
+	return encoded, nil
+}
+
+// encodeJSON serializes a value for a JSON text column, storing empty
+// values as ""
+func encodeJSON(v interface{}, empty bool) (string, error) {
+	if empty {
+		return "", nil
+	}
+
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
+
 // Delete removes a peer from storage
 func (r *SQLiteRepository) Delete(id string) error {
 	query := `DELETE FROM peers WHERE id = ?`
@@ -182,6 +529,11 @@ func (r *SQLiteRepository) Delete(id string) error {
 		return fmt.Errorf("failed to delete peer: %w", err)
 	}
 
+	// Preshared keys are sealed to the peer's key, so they die with it
+	if _, err := r.db.Exec(`DELETE FROM psk_offers WHERE from_id = ? OR to_id = ?`, id, id); err != nil {
+		return fmt.Errorf("failed to delete preshared key offers: %w", err)
+	}
+
 	return nil
 }
 
@@ -0,0 +1,323 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/controlplane/model"
+)
+
+// maxEvents bounds the event log; older events are pruned on insert
+const maxEvents = 10000
+
+// CreateOrUpdateNetwork creates a new network or updates existing one
+func (r *SQLiteRepository) CreateOrUpdateNetwork(network *model.Network) error {
+	return createOrUpdateNetwork(r.db, network)
+}
+
+// createOrUpdateNetwork implements CreateOrUpdateNetwork on a database or
+// transaction
+func createOrUpdateNetwork(db execer, network *model.Network) error {
+	acl := ""
+	if network.ACL != nil {
+		encoded, err := json.Marshal(network.ACL)
+		if err != nil {
+			return fmt.Errorf("failed to encode ACL policy: %w", err)
+		}
+		acl = string(encoded)
+	}
+
+	query := `
+	INSERT INTO networks (name, description, acl, created_at)
+	VALUES (?, ?, ?, ?)
+	ON CONFLICT(name) DO UPDATE SET
+		description = excluded.description,
+		acl = excluded.acl
+	`
+
+	if _, err := db.Exec(query, network.Name, network.Description, acl, network.CreatedAt); err != nil {
+		return fmt.Errorf("failed to create/update network: %w", err)
+	}
+
+	return nil
+}
+
+// scanNetwork scans a row selected by the network queries
+func scanNetwork(row rowScanner) (*model.Network, error) {
+	var network model.Network
+	var acl string
+	if err := row.Scan(&network.Name, &network.Description, &acl, &network.CreatedAt); err != nil {
+		return nil, err
+	}
+	if acl != "" {
+		if err := json.Unmarshal([]byte(acl), &network.ACL); err != nil {
+			return nil, fmt.Errorf("failed to decode ACL policy: %w", err)
+		}
+	}
+	return &network, nil
+}
+
+// GetNetwork retrieves a network by name
+func (r *SQLiteRepository) GetNetwork(name string) (*model.Network, error) {
+	row := r.db.QueryRow(`SELECT name, description, acl, created_at FROM networks WHERE name = ?`, name)
+
+	network, err := scanNetwork(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get network: %w", err)
+	}
+
+	return network, nil
+}
+
+// GetAllNetworks retrieves all networks ordered by name
+func (r *SQLiteRepository) GetAllNetworks() ([]*model.Network, error) {
+	rows, err := r.db.Query(`SELECT name, description, acl, created_at FROM networks ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query networks: %w", err)
+	}
+	defer rows.Close()
+
+	var networks []*model.Network
+	for rows.Next() {
+		network, err := scanNetwork(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan network: %w", err)
+		}
+		networks = append(networks, network)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating networks: %w", err)
+	}
+
+	return networks, nil
+}
+
+// DeleteNetwork removes a network from storage
+func (r *SQLiteRepository) DeleteNetwork(name string) error {
+	if _, err := r.db.Exec(`DELETE FROM networks WHERE name = ?`, name); err != nil {
+		return fmt.Errorf("failed to delete network: %w", err)
+	}
+
+	return nil
+}
+
+// tokenColumns lists the join_tokens columns in the order scanToken expects
+const tokenColumns = `id, secret_hash, network, description, reusable, uses,
+	expires_at, created_at, revoked`
+
+// scanToken scans a row selected with tokenColumns
+func scanToken(row rowScanner) (*model.JoinToken, error) {
+	var token model.JoinToken
+	var expiresAt sql.NullTime
+	err := row.Scan(
+		&token.ID,
+		&token.SecretHash,
+		&token.Network,
+		&token.Description,
+		&token.Reusable,
+		&token.Uses,
+		&expiresAt,
+		&token.CreatedAt,
+		&token.Revoked,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if expiresAt.Valid {
+		token.ExpiresAt = expiresAt.Time
+	}
+	return &token, nil
+}
+
+// CreateOrUpdateToken creates a new join token or updates existing one
+func (r *SQLiteRepository) CreateOrUpdateToken(token *model.JoinToken) error {
+	return createOrUpdateToken(r.db, token)
+}
+
+// createOrUpdateToken implements CreateOrUpdateToken on a database or
+// transaction
+func createOrUpdateToken(db execer, token *model.JoinToken) error {
+	var expiresAt sql.NullTime
+	if !token.ExpiresAt.IsZero() {
+		expiresAt = sql.NullTime{Time: token.ExpiresAt, Valid: true}
+	}
+
+	query := `
+	INSERT INTO join_tokens (` + tokenColumns + `)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT(id) DO UPDATE SET
+		secret_hash = excluded.secret_hash,
+		network = excluded.network,
+		description = excluded.description,
+		reusable = excluded.reusable,
+		uses = excluded.uses,
+		expires_at = excluded.expires_at,
+		revoked = excluded.revoked
+	`
+
+	_, err := db.Exec(query,
+		token.ID,
+		token.SecretHash,
+		token.Network,
+		token.Description,
+		token.Reusable,
+		token.Uses,
+		expiresAt,
+		token.CreatedAt,
+		token.Revoked,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create/update join token: %w", err)
+	}
+
+	return nil
+}
+
+// GetTokenByHash retrieves a join token by its secret hash
+func (r *SQLiteRepository) GetTokenByHash(secretHash string) (*model.JoinToken, error) {
+	row := r.db.QueryRow(`SELECT `+tokenColumns+` FROM join_tokens WHERE secret_hash = ?`, secretHash)
+
+	token, err := scanToken(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get join token: %w", err)
+	}
+
+	return token, nil
+}
+
+// GetAllTokens retrieves all join tokens, newest first
+func (r *SQLiteRepository) GetAllTokens() ([]*model.JoinToken, error) {
+	rows, err := r.db.Query(`SELECT ` + tokenColumns + ` FROM join_tokens ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query join tokens: %w", err)
+	}
+	defer rows.Close()
+
+	var tokens []*model.JoinToken
+	for rows.Next() {
+		token, err := scanToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan join token: %w", err)
+		}
+		tokens = append(tokens, token)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating join tokens: %w", err)
+	}
+
+	return tokens, nil
+}
+
+// UseToken increments a join token's use count. It fails if the token was
+// revoked or is single-use and already used, so concurrent registrations
+// cannot both redeem a single-use token.
+func (r *SQLiteRepository) UseToken(id string) error {
+	query := `
+	UPDATE join_tokens
+	SET uses = uses + 1
+	WHERE id = ? AND revoked = 0 AND (reusable = 1 OR uses = 0)
+	`
+	return r.updateToken(query, id, "join token not usable")
+}
+
+// RevokeToken marks a join token as revoked
+func (r *SQLiteRepository) RevokeToken(id string) error {
+	return r.updateToken(`UPDATE join_tokens SET revoked = 1 WHERE id = ?`, id, "join token not found")
+}
+
+// updateToken runs an update against a single join token, failing with
+// notFound if no token matched
+func (r *SQLiteRepository) updateToken(query, id, notFound string) error {
+	result, err := r.db.Exec(query, id)
+	if err != nil {
+		return fmt.Errorf("failed to update join token: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rows == 0 {
+		return fmt.Errorf("%s: %s", notFound, id)
+	}
+
+	return nil
+}
+
+// AddEvent appends an event to the log, pruning the oldest events beyond
+// maxEvents
+func (r *SQLiteRepository) AddEvent(event *model.Event) error {
+	result, err := r.db.Exec(`INSERT INTO events (time, type, peer_id, message) VALUES (?, ?, ?, ?)`,
+		event.Time, event.Type, event.PeerID, event.Message)
+	if err != nil {
+		return fmt.Errorf("failed to add event: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get event ID: %w", err)
+	}
+	event.ID = id
+
+	if id%100 == 0 {
+		if _, err := r.db.Exec(`DELETE FROM events WHERE id <= ?`, id-maxEvents); err != nil {
+			return fmt.Errorf("failed to prune events: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// GetEvents retrieves up to limit events with an ID above sinceID, oldest
+// first. A zero sinceID returns the latest events.
+func (r *SQLiteRepository) GetEvents(sinceID int64, limit int) ([]*model.Event, error) {
+	query := `
+	SELECT id, time, type, peer_id, message FROM (
+		SELECT id, time, type, peer_id, message
+		FROM events
+		WHERE id > ?
+		ORDER BY id DESC
+		LIMIT ?
+	) ORDER BY id
+	`
+	if sinceID > 0 {
+		query = `
+		SELECT id, time, type, peer_id, message
+		FROM events
+		WHERE id > ?
+		ORDER BY id
+		LIMIT ?
+		`
+	}
+
+	rows, err := r.db.Query(query, sinceID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []*model.Event
+	for rows.Next() {
+		var event model.Event
+		if err := rows.Scan(&event.ID, &event.Time, &event.Type, &event.PeerID, &event.Message); err != nil {
+			return nil, fmt.Errorf("failed to scan event: %w", err)
+		}
+		events = append(events, &event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating events: %w", err)
+	}
+
+	return events, nil
+}
@@ -0,0 +1,95 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/controlplane/model"
+)
+
+// scanKey scans a row selected as public_key, peer_id, added_at, retired_at
+func scanKey(row rowScanner) (*model.PeerKey, error) {
+	var key model.PeerKey
+	var retiredAt sql.NullTime
+	if err := row.Scan(&key.PublicKey, &key.PeerID, &key.AddedAt, &retiredAt); err != nil {
+		return nil, err
+	}
+	if retiredAt.Valid {
+		key.RetiredAt = retiredAt.Time
+	}
+	return &key, nil
+}
+
+// AddKey records a key as the given peer's unless it is retired. A key
+// that is still in use moves to the peer, e.g. one re-registered under a
+// new ID after its peer was deleted.
+func (r *SQLiteRepository) AddKey(key *model.PeerKey) error {
+	return addKey(r.db, key)
+}
+
+// addKey implements AddKey on the database or a transaction
+func addKey(db execer, key *model.PeerKey) error {
+	query := `
+	INSERT INTO peer_keys (public_key, peer_id, added_at)
+	VALUES (?, ?, ?)
+	ON CONFLICT(public_key) DO UPDATE SET
+		peer_id = excluded.peer_id
+	WHERE retired_at IS NULL
+	`
+
+	if _, err := db.Exec(query, key.PublicKey, key.PeerID, key.AddedAt); err != nil {
+		return fmt.Errorf("failed to add key: %w", err)
+	}
+
+	return nil
+}
+
+// GetKey retrieves a key by its public key, nil if unknown
+func (r *SQLiteRepository) GetKey(publicKey string) (*model.PeerKey, error) {
+	row := r.db.QueryRow(`SELECT public_key, peer_id, added_at, retired_at FROM peer_keys WHERE public_key = ?`, publicKey)
+
+	key, err := scanKey(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get key: %w", err)
+	}
+
+	return key, nil
+}
+
+// GetKeys retrieves a peer's keys, oldest first
+func (r *SQLiteRepository) GetKeys(peerID string) ([]*model.PeerKey, error) {
+	rows, err := r.db.Query(`SELECT public_key, peer_id, added_at, retired_at FROM peer_keys WHERE peer_id = ? ORDER BY added_at`, peerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []*model.PeerKey
+	for rows.Next() {
+		key, err := scanKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating keys: %w", err)
+	}
+
+	return keys, nil
+}
+
+// RetireKey marks a key as retired
+func (r *SQLiteRepository) RetireKey(publicKey string, at time.Time) error {
+	_, err := r.db.Exec(`UPDATE peer_keys SET retired_at = ? WHERE public_key = ? AND retired_at IS NULL`, at, publicKey)
+	if err != nil {
+		return fmt.Errorf("failed to retire key: %w", err)
+	}
+
+	return nil
+}
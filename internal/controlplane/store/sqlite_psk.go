@@ -0,0 +1,119 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/controlplane/model"
+)
+
+// pskColumns lists the psk_offers columns in the order scanOffer expects
+const pskColumns = `from_id, to_id, epoch, from_key, to_key, sealed_psk, created_at, activate_at, revision`
+
+// nextRevision is an offer revision higher than all others, including
+// those of offers since deleted
+const nextRevision = `MAX(?, (SELECT COALESCE(MAX(revision), 0) + 1 FROM psk_offers))`
+
+// scanOffer scans a row selected with pskColumns
+func scanOffer(row rowScanner) (*model.PSKOffer, error) {
+	var offer model.PSKOffer
+	var activateAt sql.NullTime
+	err := row.Scan(&offer.FromID, &offer.ToID, &offer.Epoch, &offer.FromKey, &offer.ToKey,
+		&offer.SealedPSK, &offer.CreatedAt, &activateAt, &offer.Revision)
+	if err != nil {
+		return nil, err
+	}
+	if activateAt.Valid {
+		offer.ActivateAt = activateAt.Time
+	}
+	return &offer, nil
+}
+
+// SaveOffer stores an offer, replacing the pair's previous one
+func (r *SQLiteRepository) SaveOffer(offer *model.PSKOffer) error {
+	query := `
+	INSERT INTO psk_offers (` + pskColumns + `)
+	VALUES (?, ?, ?, ?, ?, ?, ?, NULL, ` + nextRevision + `)
+	ON CONFLICT(from_id, to_id) DO UPDATE SET
+		epoch = excluded.epoch,
+		from_key = excluded.from_key,
+		to_key = excluded.to_key,
+		sealed_psk = excluded.sealed_psk,
+		created_at = excluded.created_at,
+		activate_at = NULL,
+		revision = excluded.revision
+	`
+
+	_, err := r.db.Exec(query, offer.FromID, offer.ToID, offer.Epoch, offer.FromKey, offer.ToKey,
+		offer.SealedPSK, offer.CreatedAt, time.Now().UnixNano())
+	if err != nil {
+		return fmt.Errorf("failed to save preshared key offer: %w", err)
+	}
+
+	return nil
+}
+
+// GetOffer retrieves the offer from one peer to another, nil if none
+func (r *SQLiteRepository) GetOffer(fromID, toID string) (*model.PSKOffer, error) {
+	row := r.db.QueryRow(`SELECT `+pskColumns+` FROM psk_offers WHERE from_id = ? AND to_id = ?`, fromID, toID)
+
+	offer, err := scanOffer(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get preshared key offer: %w", err)
+	}
+
+	return offer, nil
+}
+
+// GetOffers retrieves the offers to or from a peer
+func (r *SQLiteRepository) GetOffers(peerID string) ([]*model.PSKOffer, error) {
+	rows, err := r.db.Query(`SELECT `+pskColumns+` FROM psk_offers WHERE from_id = ? OR to_id = ? ORDER BY from_id, to_id`, peerID, peerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query preshared key offers: %w", err)
+	}
+	defer rows.Close()
+
+	var offers []*model.PSKOffer
+	for rows.Next() {
+		offer, err := scanOffer(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan preshared key offer: %w", err)
+		}
+		offers = append(offers, offer)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating preshared key offers: %w", err)
+	}
+
+	return offers, nil
+}
+
+// ActivateOffer sets the activation time of an offer that doesn't have
+// one yet, if the pair's offer is still the one of that epoch
+func (r *SQLiteRepository) ActivateOffer(fromID, toID string, epoch int64, at time.Time) error {
+	query := `UPDATE psk_offers SET activate_at = ?, revision = ` + nextRevision + `
+	WHERE from_id = ? AND to_id = ? AND epoch = ? AND activate_at IS NULL`
+
+	if _, err := r.db.Exec(query, at, time.Now().UnixNano(), fromID, toID, epoch); err != nil {
+		return fmt.Errorf("failed to activate preshared key offer: %w", err)
+	}
+
+	return nil
+}
+
+// PSKRevision returns the latest revision of the offers to or from a peer,
+// 0 if there are none
+func (r *SQLiteRepository) PSKRevision(peerID string) (int64, error) {
+	var revision int64
+	err := r.db.QueryRow(`SELECT COALESCE(MAX(revision), 0) FROM psk_offers WHERE from_id = ? OR to_id = ?`, peerID, peerID).Scan(&revision)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read preshared key revision: %w", err)
+	}
+
+	return revision, nil
+}
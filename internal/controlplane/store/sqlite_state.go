@@ -0,0 +1,44 @@
+package store
+
+import (
+	"fmt"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/controlplane/model"
+)
+
+// ImportState creates or updates networks, peers and join tokens and adds
+// peer keys to the key history in one transaction, so a failure leaves
+// nothing written
+func (r *SQLiteRepository) ImportState(networks []*model.Network, peers []*model.Peer, tokens []*model.JoinToken, keys []*model.PeerKey) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin import: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, network := range networks {
+		if err := createOrUpdateNetwork(tx, network); err != nil {
+			return err
+		}
+	}
+	for _, peer := range peers {
+		if err := createOrUpdatePeer(tx, peer); err != nil {
+			return err
+		}
+	}
+	for _, token := range tokens {
+		if err := createOrUpdateToken(tx, token); err != nil {
+			return err
+		}
+	}
+	for _, key := range keys {
+		if err := addKey(tx, key); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit import: %w", err)
+	}
+	return nil
+}
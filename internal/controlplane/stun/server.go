@@ -0,0 +1,306 @@
+package stun
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+
+	"github.com/pion/stun"
+	"golang.org/x/net/ipv4"
+)
+
+// Config holds STUN server configuration
+type Config struct {
+	// ListenAddr is the primary "ip:port" to listen on (ip may be empty)
+	ListenAddr string
+
+	// AltPort enables CHANGE-REQUEST port changes when non-zero
+	AltPort int
+
+	// AltIP enables CHANGE-REQUEST address changes; requires an explicit
+	// IP in ListenAddr
+	AltIP string
+
+	// OtherIP overrides the IP advertised in OTHER-ADDRESS when AltIP is
+	// empty, e.g. the public IP of a server behind port forwarding. It
+	// must be an IPv4 address.
+	OtherIP string
+}
+
+// socket is one of the up to four (ip, port) combinations the server binds
+type socket struct {
+	conn *net.UDPConn
+	pc   *ipv4.PacketConn
+}
+
+// Server answers STUN binding requests (RFC 5389) and supports the
+// CHANGE-REQUEST attribute used for NAT behaviour discovery (RFC 5780)
+type Server struct {
+	config  *Config
+	ips     [2]net.IP
+	otherIP net.IP
+	ports   [2]int
+	sockets [2][2]*socket // indexed by [ip][port]
+	wg      sync.WaitGroup
+}
+
+// NewServer creates a STUN server and binds its sockets
+func NewServer(config *Config) (*Server, error) {
+	host, portStr, err := net.SplitHostPort(config.ListenAddr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid STUN listen address: %w", err)
+	}
+
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid STUN port: %w", err)
+	}
+
+	s := &Server{config: config}
+	s.ips[0] = net.IPv4zero
+	if host != "" {
+		if s.ips[0] = net.ParseIP(host); s.ips[0] == nil {
+			return nil, fmt.Errorf("invalid STUN listen IP: %s", host)
+		}
+	}
+	s.ports[0] = port
+	s.ports[1] = config.AltPort
+
+	if config.AltIP != "" {
+		if s.ips[0].IsUnspecified() {
+			return nil, fmt.Errorf("an explicit listen IP is required with an alternate STUN IP")
+		}
+		if s.ips[1] = net.ParseIP(config.AltIP); s.ips[1] == nil {
+			return nil, fmt.Errorf("invalid alternate STUN IP: %s", config.AltIP)
+		}
+	}
+
+	if config.OtherIP != "" {
+		if s.otherIP = net.ParseIP(config.OtherIP).To4(); s.otherIP == nil {
+			return nil, fmt.Errorf("invalid STUN other IP %q: must be an IPv4 address", config.OtherIP)
+		}
+	}
+
+	for i, ip := range s.ips {
+		if ip == nil {
+			continue
+		}
+		for j, p := range s.ports {
+			if p == 0 {
+				continue
+			}
+			sock, err := listen(ip, p)
+			if err != nil {
+				s.Close()
+				return nil, err
+			}
+			s.sockets[i][j] = sock
+		}
+	}
+
+	return s, nil
+}
+
+// listen binds a UDP socket that reports the destination address of
+// incoming packets
+func listen(ip net.IP, port int) (*socket, error) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: ip, Port: port})
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", net.JoinHostPort(ip.String(), strconv.Itoa(port)), err)
+	}
+
+	pc := ipv4.NewPacketConn(conn)
+	if err := pc.SetControlMessage(ipv4.FlagDst, true); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to enable destination address reporting: %w", err)
+	}
+
+	return &socket{conn: conn, pc: pc}, nil
+}
+
+// Start starts serving binding requests on all sockets
+func (s *Server) Start() {
+	for i := range s.sockets {
+		for j := range s.sockets[i] {
+			if sock := s.sockets[i][j]; sock != nil {
+				log.Printf("STUN server listening on %s", sock.conn.LocalAddr())
+				s.wg.Add(1)
+				go s.serve(i, j)
+			}
+		}
+	}
+}
+
+// Close stops the server and waits for the serving goroutines
+func (s *Server) Close() error {
+	for i := range s.sockets {
+		for j := range s.sockets[i] {
+			if sock := s.sockets[i][j]; sock != nil {
+				sock.conn.Close()
+			}
+		}
+	}
+	s.wg.Wait()
+	return nil
+}
+
+// Port returns the primary STUN port
+func (s *Server) Port() int {
+	return s.ports[0]
+}
+
+// SupportsChangeRequest reports whether the server can answer from an
+// alternate port
+func (s *Server) SupportsChangeRequest() bool {
+	return s.ports[1] != 0
+}
+
+// serve reads binding requests from one socket
+func (s *Server) serve(ipIdx, portIdx int) {
+	defer s.wg.Done()
+
+	sock := s.sockets[ipIdx][portIdx]
+	buf := make([]byte, 1500)
+	for {
+		n, cm, from, err := sock.pc.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Printf("STUN read error: %v", err)
+			continue
+		}
+
+		udpFrom, ok := from.(*net.UDPAddr)
+		if !ok {
+			continue
+		}
+
+		var dst net.IP
+		if cm != nil {
+			dst = cm.Dst
+		}
+
+		if err := s.handle(buf[:n], udpFrom, dst, ipIdx, portIdx); err != nil {
+			log.Printf("STUN request from %s failed: %v", udpFrom, err)
+		}
+	}
+}
+
+// handle answers a single binding request
+func (s *Server) handle(packet []byte, from *net.UDPAddr, dst net.IP, ipIdx, portIdx int) error {
+	if !stun.IsMessage(packet) {
+		return nil
+	}
+
+	var request stun.Message
+	request.Raw = append([]byte(nil), packet...)
+	if err := request.Decode(); err != nil {
+		return fmt.Errorf("failed to decode request: %w", err)
+	}
+	if request.Type != stun.BindingRequest {
+		return nil
+	}
+
+	changeIP, changePort, err := parseChangeRequest(&request)
+	if err != nil {
+		return s.replyError(&request, from, dst, ipIdx, portIdx, stun.CodeBadRequest)
+	}
+
+	// Pick the socket the response must come from
+	replyIP, replyPort := ipIdx, portIdx
+	if changeIP {
+		if s.ips[1] == nil {
+			return s.replyError(&request, from, dst, ipIdx, portIdx, stun.CodeUnknownAttribute)
+		}
+		replyIP = 1 - ipIdx
+	}
+	if changePort {
+		if s.ports[1] == 0 {
+			return s.replyError(&request, from, dst, ipIdx, portIdx, stun.CodeUnknownAttribute)
+		}
+		replyPort = 1 - portIdx
+	}
+
+	localIP := s.localIP(ipIdx, dst)
+	originIP := s.localIP(replyIP, dst)
+
+	setters := []stun.Setter{
+		&request,
+		stun.BindingSuccess,
+		&stun.XORMappedAddress{IP: from.IP, Port: from.Port},
+		&stun.MappedAddress{IP: from.IP, Port: from.Port},
+		&stun.ResponseOrigin{IP: originIP, Port: s.ports[replyPort]},
+	}
+
+	if s.ports[1] != 0 {
+		otherIP := localIP
+		if s.ips[1] != nil {
+			otherIP = s.ips[1-ipIdx]
+		} else if s.otherIP != nil {
+			otherIP = s.otherIP
+		}
+		setters = append(setters, &stun.OtherAddress{IP: otherIP, Port: s.ports[1-portIdx]})
+	}
+
+	setters = append(setters, stun.NewSoftware("shadownet"), stun.Fingerprint)
+
+	response, err := stun.Build(setters...)
+	if err != nil {
+		return fmt.Errorf("failed to build response: %w", err)
+	}
+
+	return s.write(response.Raw, from, dst, replyIP, replyPort)
+}
+
+// replyError sends an error response from the receiving socket
+func (s *Server) replyError(request *stun.Message, from *net.UDPAddr, dst net.IP, ipIdx, portIdx int, code stun.ErrorCode) error {
+	response, err := stun.Build(request, stun.BindingError, code, stun.Fingerprint)
+	if err != nil {
+		return fmt.Errorf("failed to build error response: %w", err)
+	}
+	return s.write(response.Raw, from, dst, ipIdx, portIdx)
+}
+
+// write sends a packet from the given socket, keeping the source IP equal
+// to the request's destination IP on wildcard sockets
+func (s *Server) write(packet []byte, to *net.UDPAddr, dst net.IP, ipIdx, portIdx int) error {
+	sock := s.sockets[ipIdx][portIdx]
+
+	var cm *ipv4.ControlMessage
+	if s.ips[ipIdx].IsUnspecified() && dst != nil {
+		cm = &ipv4.ControlMessage{Src: dst}
+	}
+
+	_, err := sock.pc.WriteTo(packet, cm, to)
+	return err
+}
+
+// localIP returns the IP a socket answers from
+func (s *Server) localIP(ipIdx int, dst net.IP) net.IP {
+	if !s.ips[ipIdx].IsUnspecified() {
+		return s.ips[ipIdx]
+	}
+	if dst != nil {
+		return dst
+	}
+	return s.ips[ipIdx]
+}
+
+// parseChangeRequest decodes the optional CHANGE-REQUEST attribute
+func parseChangeRequest(m *stun.Message) (changeIP, changePort bool, err error) {
+	v, err := m.Get(stun.AttrChangeRequest)
+	if errors.Is(err, stun.ErrAttributeNotFound) {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+	if len(v) != 4 {
+		return false, false, fmt.Errorf("invalid CHANGE-REQUEST length: %d", len(v))
+	}
+	return v[3]&0x04 != 0, v[3]&0x02 != 0, nil
+}
@@ -0,0 +1,271 @@
+package node
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/node/config"
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/utils"
+)
+
+// SetConfigLoader sets where ReloadConfig reads the configuration from
+func (n *Node) SetConfigLoader(loader config.Loader) {
+	n.configLoader = loader
+}
+
+// Reregister registers with the control plane again and refreshes peers
+func (n *Node) Reregister() error {
+	n.actionMu.Lock()
+	defer n.actionMu.Unlock()
+
+	if err := n.registerWithControlPlane(); err != nil {
+		return fmt.Errorf("failed to register with control plane: %w", err)
+	}
+	n.event(EventRegistered, "Re-registered with control plane")
+
+	if err := n.configurePeers(); err != nil {
+		return fmt.Errorf("failed to configure peers: %w", err)
+	}
+	n.markOnline()
+	return nil
+}
+
+// ReSTUN rediscovers the public endpoint and re-registers if it changed
+func (n *Node) ReSTUN() error {
+	n.actionMu.Lock()
+	defer n.actionMu.Unlock()
+
+	return n.restun()
+}
+
+// restun implements ReSTUN; callers hold n.actionMu
+func (n *Node) restun() error {
+	n.mu.Lock()
+	oldIP, oldPort := n.publicIP, n.publicPort
+	oldIPv6, oldPortV6 := n.publicIPv6, n.publicPortV6
+	n.mu.Unlock()
+
+	if err := n.discoverEndpoint(); err != nil {
+		return fmt.Errorf("failed to discover endpoint: %w", err)
+	}
+
+	n.mu.Lock()
+	newIP, newPort := n.publicIP, n.publicPort
+	newIPv6, newPortV6 := n.publicIPv6, n.publicPortV6
+	n.mu.Unlock()
+
+	v6Changed := newIPv6 != oldIPv6 || newPortV6 != oldPortV6
+	if newIP == oldIP && newPort == oldPort && !v6Changed {
+		n.event(EventEndpoint, "Public endpoint unchanged: %s:%d", newIP, newPort)
+		return nil
+	}
+
+	if newIP != oldIP || newPort != oldPort {
+		n.event(EventEndpoint, "Public endpoint changed from %s:%d to %s:%d", oldIP, oldPort, newIP, newPort)
+	}
+	if v6Changed && newIPv6 == "" {
+		n.event(EventEndpoint, "IPv6 endpoint no longer available")
+	} else if v6Changed {
+		n.event(EventEndpoint, "IPv6 endpoint changed to %s", utils.FormatEndpoint(newIPv6, newPortV6))
+	}
+	if err := n.registerWithControlPlane(); err != nil {
+		return fmt.Errorf("failed to register new endpoint: %w", err)
+	}
+	n.event(EventRegistered, "Registered new endpoint with control plane")
+	return nil
+}
+
+// reloadable are the configuration file keys ReloadConfig applies at
+// runtime; changes to the others take effect on restart
+var reloadable = map[string]bool{
+	"controlplane_url":           true,
+	"controlplane_fallback_urls": true,
+	"join_token":                 true,
+	"hostname":                   true,
+	"tags":                       true,
+	"labels":                     true,
+	"stun_servers":               true,
+	"stun_timeout":               true,
+	"stun_retries":               true,
+	"controlplane_stun":          true,
+	"punch_interval":             true,
+	"heartbeat_interval":         true,
+	"split_include":              true,
+	"split_exclude":              true,
+	"exit_node":                  true,
+}
+
+// ReloadConfig reloads the configuration and applies the settings that can
+// change at runtime without touching the tunnel; the others need a restart
+func (n *Node) ReloadConfig() error {
+	n.actionMu.Lock()
+	defer n.actionMu.Unlock()
+
+	if n.configLoader == nil {
+		return fmt.Errorf("no configuration source to reload from")
+	}
+
+	loaded, err := n.configLoader()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	if err := loaded.Validate(); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	old := n.cfg()
+
+	changed := old.Changed(loaded)
+	if len(changed) == 0 {
+		n.event(EventConfig, "Reloaded configuration, nothing changed")
+		return nil
+	}
+	if loaded.ExitNode != "" && old.AdvertiseExitNode {
+		return fmt.Errorf("invalid configuration: exit_node: an exit node can't use another exit node")
+	}
+
+	updated := *old
+	updated.ControlPlaneURL = loaded.ControlPlaneURL
+	updated.ControlPlaneFallbacks = loaded.ControlPlaneFallbacks
+	updated.JoinToken = loaded.JoinToken
+	updated.Hostname = loaded.Hostname
+	updated.Tags = loaded.Tags
+	updated.Labels = loaded.Labels
+	updated.STUNServers = loaded.STUNServers
+	updated.STUNTimeout = loaded.STUNTimeout
+	updated.STUNRetries = loaded.STUNRetries
+	updated.ControlPlaneSTUN = loaded.ControlPlaneSTUN
+	updated.PunchInterval = loaded.PunchInterval
+	updated.HeartbeatInterval = loaded.HeartbeatInterval
+	updated.SplitInclude = loaded.SplitInclude
+	updated.SplitExclude = loaded.SplitExclude
+	updated.ExitNode = loaded.ExitNode
+	n.config.Store(&updated)
+
+	var applied, restart []string
+	for _, key := range changed {
+		if reloadable[key] {
+			applied = append(applied, key)
+		} else {
+			restart = append(restart, key)
+		}
+	}
+	if len(applied) > 0 {
+		n.event(EventConfig, "Reloaded configuration, applying %s", strings.Join(applied, ", "))
+	}
+	if len(restart) > 0 {
+		n.event(EventConfig, "Changes to %s take effect after a restart", strings.Join(restart, ", "))
+	}
+
+	controlPlaneChanged := updated.ControlPlaneURL != old.ControlPlaneURL ||
+		!slices.Equal(updated.ControlPlaneFallbacks, old.ControlPlaneFallbacks)
+	if controlPlaneChanged {
+		n.controlClient.Store(newControlClient(&updated))
+		n.saveIdentity()
+	}
+
+	// While offline the reconnect loop picks up the new control plane and
+	// metadata and starts heartbeats once it answers
+	offline := n.isOffline()
+	if !offline && (controlPlaneChanged || updated.HeartbeatInterval != old.HeartbeatInterval) {
+		n.stopHeartbeat()
+		n.startHeartbeat()
+	}
+
+	// Hostname, tags and labels reach the control plane by registering
+	metadataChanged := updated.Hostname != old.Hostname ||
+		!slices.Equal(updated.Tags, old.Tags) || !maps.Equal(updated.Labels, old.Labels)
+	if (controlPlaneChanged || metadataChanged) && !offline {
+		if err := n.registerWithControlPlane(); err != nil {
+			return fmt.Errorf("failed to register with control plane: %w", err)
+		}
+		n.event(EventRegistered, "Registered with control plane %s", updated.ControlPlaneURL)
+	}
+
+	splitChanged := !slices.Equal(updated.SplitInclude, old.SplitInclude) || !slices.Equal(updated.SplitExclude, old.SplitExclude)
+	if splitChanged && n.router != nil {
+		if err := n.router.SetSplitTunnel(updated.SplitInclude, updated.SplitExclude); err != nil {
+			return fmt.Errorf("failed to apply split tunnel: %w", err)
+		}
+		n.event(EventConfig, "Split tunnel: include %v, exclude %v", updated.SplitInclude, updated.SplitExclude)
+	}
+
+	if updated.ExitNode != old.ExitNode {
+		if err := n.refreshPeers(); err != nil {
+			return fmt.Errorf("failed to configure peers: %w", err)
+		}
+		n.mu.Lock()
+		inUse := n.exitNode
+		n.mu.Unlock()
+		switch {
+		case updated.ExitNode == "":
+			n.event(EventConfig, "Stopped using an exit node")
+		case inUse == "":
+			n.event(EventConfig, "Exit node %s is not available; internet traffic uses the physical network", updated.ExitNode)
+		default:
+			n.event(EventConfig, "Using exit node %s", inUse)
+		}
+	}
+
+	if !slices.Equal(updated.STUNServers, old.STUNServers) {
+		n.event(EventConfig, "New STUN servers apply from the next endpoint discovery")
+	}
+	return nil
+}
+
+// SetExitNode routes internet traffic through the peer with the given name
+// or ID, or back through the physical network when peer is empty
+func (n *Node) SetExitNode(peer string) error {
+	n.actionMu.Lock()
+	defer n.actionMu.Unlock()
+
+	if peer != "" && n.cfg().AdvertiseExitNode {
+		return fmt.Errorf("an exit node can't use another exit node")
+	}
+	updated := *n.cfg()
+	updated.ExitNode = peer
+	n.config.Store(&updated)
+
+	if err := n.refreshPeers(); err != nil {
+		return fmt.Errorf("failed to configure peers: %w", err)
+	}
+
+	n.mu.Lock()
+	inUse := n.exitNode
+	n.mu.Unlock()
+
+	if peer == "" {
+		n.event(EventConfig, "Stopped using an exit node")
+		return nil
+	}
+	if inUse == "" {
+		return fmt.Errorf("exit node %s is not available; internet traffic uses the physical network", peer)
+	}
+	n.event(EventConfig, "Using exit node %s", inUse)
+	return nil
+}
+
+// RotateKey rotates the WireGuard key through the control plane. The node
+// and its peers switch to the new key at the time the control plane sets.
+func (n *Node) RotateKey() error {
+	n.actionMu.Lock()
+	defer n.actionMu.Unlock()
+
+	return n.rotateKey()
+}
+
+// Shutdown asks the process running the node to stop it
+func (n *Node) Shutdown() error {
+	n.shutdownOnce.Do(func() {
+		n.event(EventStopped, "Shutdown requested via local API")
+		close(n.shutdown)
+	})
+	return nil
+}
+
+// ShutdownRequested is closed when a shutdown was requested via Shutdown
+func (n *Node) ShutdownRequested() <-chan struct{} {
+	return n.shutdown
+}
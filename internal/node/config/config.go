@@ -2,75 +2,314 @@ package config
 
 import (
 	"fmt"
+	"net/url"
 	"time"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/node/dns"
+	"github.com/Vaibhav2154/ShadowNet/internal/node/localapi"
+	"github.com/Vaibhav2154/ShadowNet/internal/node/state"
+	"github.com/Vaibhav2154/ShadowNet/internal/node/transport"
+	"github.com/Vaibhav2154/ShadowNet/internal/node/wireguard"
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/utils"
 )
 
 // Config holds node configuration
 type Config struct {
 	// Peer identification
-	ID string
+	ID string `yaml:"id"`
 	
-	// Control plane
-	ControlPlaneURL string
+	// Control plane, and URLs to fail over to in order when it is down
+	ControlPlaneURL       string   `yaml:"controlplane_url"`
+	ControlPlaneFallbacks []string `yaml:"controlplane_fallback_urls"`
+
+	// JoinToken admits this node when the control plane requires tokens
+	JoinToken string `yaml:"join_token"`
+
+	// Hostname, tags and labels are reported to the control plane; the
+	// node's DNS name is derived from the hostname
+	Hostname string            `yaml:"hostname"`
+	Tags     []string          `yaml:"tags"`
+	Labels   map[string]string `yaml:"labels"`
 	
 	// WireGuard
-	PrivateKeyPath string
-	ListenPort     int
+	PrivateKeyPath string `yaml:"private_key_path"`
+	ListenPort     int    `yaml:"listen_port"`
+	WGBackend      string `yaml:"wg_backend"`
+
+	// KeyEncryption encrypts the private key file at rest (none,
+	// passphrase, keyring or credential); KeySecret locates the secret
+	KeyEncryption string `yaml:"key_encryption"`
+	KeySecret     string `yaml:"key_secret"`
+
+	// KeyRotationInterval rotates the WireGuard key once it is this old
+	// (0 rotates only on demand)
+	KeyRotationInterval time.Duration `yaml:"key_rotation_interval"`
+
+	// PresharedKeys adds a preshared key to the tunnels with peers that
+	// support them, replaced every PSKRotationInterval
+	PresharedKeys       bool          `yaml:"preshared_keys"`
+	PSKRotationInterval time.Duration `yaml:"psk_rotation_interval"`
+
+	// PostQuantum derives preshared keys from ML-KEM exchanges with peers
+	// that support them; tunnels to or from nodes with one of
+	// PQRequireTags are held back until they have one
+	PostQuantum   bool     `yaml:"post_quantum"`
+	PQRequireTags []string `yaml:"pq_require_tags"`
 	
 	// Network
-	STUNServer     string
-	PunchInterval  time.Duration
+	STUNServers    []string      `yaml:"stun_servers"`
+	STUNTimeout    time.Duration `yaml:"stun_timeout"`
+	STUNRetries    int           `yaml:"stun_retries"`
+	PunchInterval  time.Duration `yaml:"punch_interval"`
+
+	// ControlPlaneSTUN prefers the control plane's built-in STUN server
+	ControlPlaneSTUN bool `yaml:"controlplane_stun"`
+
+	// MappingLifetimeProbe bounds NAT mapping lifetime probing (0 disables)
+	MappingLifetimeProbe time.Duration `yaml:"nat_lifetime_probe"`
+	
+	// AdvertiseRoutes are subnets behind this node offered to the overlay;
+	// they are used once an admin approves them. SNATRoutes masquerades
+	// forwarded traffic so the subnets need no route back.
+	AdvertiseRoutes []string `yaml:"advertise_routes"`
+	SNATRoutes      bool     `yaml:"snat_subnet_routes"`
+
+	// AdvertiseExitNode offers this node as internet egress (used once an
+	// admin approves its default route). ExitNode is the peer, by ID or
+	// name, this node sends its internet traffic through.
+	AdvertiseExitNode bool   `yaml:"advertise_exit_node"`
+	ExitNode          string `yaml:"exit_node"`
+
+	// RouteTable and RouteMetric place overlay routes in the kernel.
+	// SplitInclude limits the overlay to destinations within it and
+	// SplitExclude keeps destinations within it off the overlay.
+	RouteTable   int      `yaml:"route_table"`
+	RouteMetric  int      `yaml:"route_metric"`
+	SplitInclude []string `yaml:"split_include"`
+	SplitExclude []string `yaml:"split_exclude"`
 	
 	// TUN device
-	TUNDeviceName  string
-	VirtualIP      string
-	VirtualNetmask string
+	TUNDeviceName  string `yaml:"tun_device"`
+	VirtualIP      string `yaml:"virtual_ip"`
+	VirtualNetmask string `yaml:"virtual_netmask"`
+
+	// IPv6 enables the IPv6 overlay address (VirtualIPv6, a ULA derived
+	// from the ID unless set) and IPv6 endpoints on the underlay
+	IPv6        bool   `yaml:"ipv6"`
+	VirtualIPv6 string `yaml:"virtual_ipv6"`
 	
 	// Heartbeat
-	HeartbeatInterval time.Duration
+	HeartbeatInterval time.Duration `yaml:"heartbeat_interval"`
+
+	// EndpointCheckInterval is how often the public endpoint is checked
+	// with STUN to notice NAT mapping changes (0 disables); network changes
+	// trigger a check regardless
+	EndpointCheckInterval time.Duration `yaml:"endpoint_check_interval"`
+
+	// StateDir keeps the node's identity, key and peer cache across
+	// restarts (empty disables it)
+	StateDir string `yaml:"state_dir"`
+
+	// ControlSocket is the local API's Unix socket path (empty disables it)
+	ControlSocket string `yaml:"control_socket"`
+
+	// MagicDNS serves <peer>.<network>.<DNSDomain> on the virtual IP and
+	// forwards other queries to DNSUpstreams (default: resolv.conf)
+	MagicDNS     bool     `yaml:"dns"`
+	DNSDomain    string   `yaml:"dns_domain"`
+	DNSUpstreams []string `yaml:"dns_upstreams"`
+
+	// DNSConfigureSystem points the system resolver at MagicDNS while the
+	// node runs
+	DNSConfigureSystem bool `yaml:"dns_configure_system"`
 }
 
-// Validate validates the configuration
+// Loader produces a fresh configuration, e.g. for reloading at runtime
+type Loader func() (*Config, error)
+
+// FieldError is an invalid setting, named by its configuration file key
+// (the flag of the same name uses dashes)
+type FieldError struct {
+	Field string
+	Err   error
+}
+
+func (e *FieldError) Error() string {
+	return e.Field + ": " + e.Err.Error()
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// invalid returns a FieldError for field
+func invalid(field, format string, args ...interface{}) error {
+	return &FieldError{Field: field, Err: fmt.Errorf(format, args...)}
+}
+
+// validURL reports whether u is an http(s) URL with a host
+func validURL(u string) bool {
+	parsed, err := url.Parse(u)
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
+
+// Validate validates the configuration; errors are FieldErrors
 func (c *Config) Validate() error {
 	if c.ID == "" {
-		return fmt.Errorf("peer ID is required")
+		return invalid("id", "peer ID is required")
 	}
 	
 	if c.ControlPlaneURL == "" {
-		return fmt.Errorf("control plane URL is required")
+		return invalid("controlplane_url", "control plane URL is required")
+	}
+
+	if !validURL(c.ControlPlaneURL) {
+		return invalid("controlplane_url", "invalid control plane URL %q: expected http(s)://host[:port]", c.ControlPlaneURL)
+	}
+	for _, u := range c.ControlPlaneFallbacks {
+		if !validURL(u) {
+			return invalid("controlplane_fallback_urls", "invalid control plane URL %q: expected http(s)://host[:port]", u)
+		}
 	}
 	
 	if c.PrivateKeyPath == "" {
-		return fmt.Errorf("private key path is required")
+		return invalid("private_key_path", "private key path is required")
 	}
 	
 	if c.ListenPort < 1 || c.ListenPort > 65535 {
-		return fmt.Errorf("invalid listen port: %d", c.ListenPort)
+		return invalid("listen_port", "invalid listen port: %d", c.ListenPort)
+	}
+	
+	if err := wireguard.ValidateBackend(c.WGBackend); err != nil {
+		return invalid("wg_backend", "%w", err)
+	}
+	if err := c.KeyFile().Encryption.Validate(); err != nil {
+		return invalid("key_encryption", "%w", err)
+	}
+
+	if len(c.STUNServers) == 0 {
+		return invalid("stun_servers", "at least one STUN server is required")
+	}
+
+	if c.STUNTimeout <= 0 {
+		return invalid("stun_timeout", "invalid STUN timeout: %s", c.STUNTimeout)
+	}
+
+	if c.STUNRetries < 0 {
+		return invalid("stun_retries", "invalid STUN retries: %d", c.STUNRetries)
+	}
+	
+	if c.EndpointCheckInterval < 0 {
+		return invalid("endpoint_check_interval", "invalid endpoint check interval: %s", c.EndpointCheckInterval)
 	}
 	
-	if c.STUNServer == "" {
-		return fmt.Errorf("STUN server is required")
+	if c.KeyRotationInterval < 0 {
+		return invalid("key_rotation_interval", "invalid key rotation interval: %s", c.KeyRotationInterval)
+	}
+	
+	if c.PresharedKeys && c.PSKRotationInterval < time.Minute {
+		return invalid("psk_rotation_interval", "preshared key rotation interval must be at least 1m: %s", c.PSKRotationInterval)
+	}
+	
+	if len(c.PQRequireTags) > 0 && !c.PostQuantum {
+		return invalid("pq_require_tags", "requiring post-quantum protection needs post_quantum")
 	}
 	
 	if c.TUNDeviceName == "" {
-		return fmt.Errorf("TUN device name is required")
+		return invalid("tun_device", "TUN device name is required")
 	}
 	
 	if c.VirtualIP == "" {
-		return fmt.Errorf("virtual IP is required")
+		return invalid("virtual_ip", "virtual IP is required")
+	}
+
+	if c.VirtualIPv6 != "" {
+		if !c.IPv6 {
+			return invalid("virtual_ipv6", "a virtual IPv6 address needs IPv6 enabled")
+		}
+		if err := utils.ValidateIPv6(c.VirtualIPv6); err != nil {
+			return invalid("virtual_ipv6", "invalid virtual IPv6: %w", err)
+		}
+	}
+
+	for _, tag := range c.Tags {
+		if !utils.IsDNSLabel(tag) {
+			return invalid("tags", "invalid tag %q: use lowercase letters, digits and dashes", tag)
+		}
+	}
+
+	for _, route := range c.AdvertiseRoutes {
+		if err := utils.ValidateRoute(route); err != nil {
+			return invalid("advertise_routes", "%w", err)
+		}
+	}
+
+	if c.AdvertiseExitNode && c.ExitNode != "" {
+		return invalid("exit_node", "an exit node can't use another exit node")
+	}
+
+	// 253-255 are the kernel's default, main and local tables
+	if c.RouteTable <= 0 || (c.RouteTable >= 253 && c.RouteTable <= 255) {
+		return invalid("route_table", "invalid route table %d", c.RouteTable)
+	}
+	if c.RouteMetric < 0 {
+		return invalid("route_metric", "invalid route metric %d", c.RouteMetric)
+	}
+
+	for _, route := range c.SplitInclude {
+		if err := utils.ValidateRoute(route); err != nil {
+			return invalid("split_include", "%w", err)
+		}
+	}
+	for _, route := range c.SplitExclude {
+		if err := utils.ValidateRoute(route); err != nil {
+			return invalid("split_exclude", "%w", err)
+		}
+	}
+
+	if c.MagicDNS && !utils.IsDNSLabel(c.DNSDomain) {
+		return invalid("dns_domain", "invalid DNS domain %q: use a single DNS label", c.DNSDomain)
 	}
 	
 	return nil
 }
 
+// KeyFile returns the private key file with its encryption settings
+func (c *Config) KeyFile() *wireguard.KeyFile {
+	return &wireguard.KeyFile{
+		Path: c.PrivateKeyPath,
+		Encryption: wireguard.KeyEncryption{
+			Mode:   c.KeyEncryption,
+			Secret: c.KeySecret,
+		},
+	}
+}
+
 // DefaultConfig returns a configuration with default values
 func DefaultConfig() *Config {
 	return &Config{
 		ListenPort:        51820,
-		STUNServer:        "stun.l.google.com:19302",
+		WGBackend:         wireguard.BackendAuto,
+		KeyEncryption:     wireguard.KeyEncryptionNone,
+		STUNServers:       []string{"stun.l.google.com:19302", "stun1.l.google.com:19302"},
+		STUNTimeout:       2 * time.Second,
+		STUNRetries:       2,
 		PunchInterval:     500 * time.Millisecond,
+		ControlPlaneSTUN:  true,
+		SNATRoutes:        true,
+		RouteTable:        transport.DefaultRouteTable,
 		TUNDeviceName:     "tun0",
+		IPv6:              true,
 		VirtualNetmask:    "24",
 		HeartbeatInterval: 30 * time.Second,
+
+		EndpointCheckInterval: time.Minute,
+		PSKRotationInterval:   time.Hour,
+		ControlSocket:     localapi.DefaultSocketPath,
+		StateDir:          state.DefaultDir,
+
+		MagicDNS:           true,
+		DNSDomain:          dns.DefaultDomain,
+		DNSConfigureSystem: true,
 	}
 }
@@ -0,0 +1,31 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Changed returns the configuration file keys of the settings that differ
+// between c and other, in field order. Empty and unset lists are equal.
+func (c *Config) Changed(other *Config) []string {
+	a := reflect.ValueOf(c).Elem()
+	b := reflect.ValueOf(other).Elem()
+
+	var changed []string
+	for i := 0; i < a.NumField(); i++ {
+		x, y := a.Field(i), b.Field(i)
+		switch x.Kind() {
+		case reflect.Slice, reflect.Map:
+			if x.Len() == 0 && y.Len() == 0 {
+				continue
+			}
+		}
+		if reflect.DeepEqual(x.Interface(), y.Interface()) {
+			continue
+		}
+
+		key, _, _ := strings.Cut(a.Type().Field(i).Tag.Get("yaml"), ",")
+		changed = append(changed, key)
+	}
+	return changed
+}
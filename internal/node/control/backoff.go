@@ -0,0 +1,35 @@
+package control
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// Backoff computes exponentially growing retry delays with jitter, so
+// nodes that lost the control plane together don't retry in lockstep
+type Backoff struct {
+	Min time.Duration
+	Max time.Duration
+
+	attempt int
+}
+
+// Next returns the delay before the next attempt: Min doubled for every
+// attempt so far, capped at Max, of which a random half is dropped
+func (b *Backoff) Next() time.Duration {
+	delay := b.Max
+	if b.attempt < 32 {
+		if d := b.Min << b.attempt; d > 0 && d < b.Max {
+			delay = d
+		}
+	}
+	b.attempt++
+
+	half := delay / 2
+	return half + rand.N(half+1)
+}
+
+// Reset starts the delays over from Min
+func (b *Backoff) Reset() {
+	b.attempt = 0
+}
@@ -0,0 +1,41 @@
+package control
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffBounds(t *testing.T) {
+	b := Backoff{Min: time.Second, Max: 30 * time.Second}
+
+	// Each delay is between half and all of Min doubled per attempt,
+	// capped at Max, including long after the shift would overflow
+	for attempt := 0; attempt < 100; attempt++ {
+		ceiling := b.Max
+		if attempt < 5 {
+			ceiling = b.Min << attempt
+		}
+		delay := b.Next()
+		if delay < ceiling/2 || delay > ceiling {
+			t.Fatalf("attempt %d: delay %v outside [%v, %v]", attempt, delay, ceiling/2, ceiling)
+		}
+	}
+
+	// Reset starts over from Min
+	b.Reset()
+	if delay := b.Next(); delay < b.Min/2 || delay > b.Min {
+		t.Fatalf("delay %v after Reset outside [%v, %v]", delay, b.Min/2, b.Min)
+	}
+}
+
+func TestBackoffJitter(t *testing.T) {
+	// Nodes starting together spread out their retries
+	delays := make(map[time.Duration]bool)
+	for i := 0; i < 20; i++ {
+		b := Backoff{Min: time.Second, Max: 30 * time.Second}
+		delays[b.Next()] = true
+	}
+	if len(delays) < 2 {
+		t.Fatal("every backoff returned the same delay")
+	}
+}
@@ -0,0 +1,49 @@
+package control
+
+import "time"
+
+// Circuit breaker settings: after breakerThreshold consecutive failures a
+// URL gets no requests for breakerCooldown, then a single probe
+const (
+	breakerThreshold = 5
+	breakerCooldown  = 30 * time.Second
+)
+
+// breaker is the circuit breaker for one control plane URL. It stops a
+// node from hammering a control plane that is down and lets requests fail
+// fast (or go to another URL) instead of waiting for timeouts.
+type breaker struct {
+	failures  int
+	openUntil time.Time
+}
+
+// allow reports whether a request may be sent. Once the cooldown is over
+// one request is let through as a probe and the breaker stays open for
+// the others until it completes.
+func (b *breaker) allow(now time.Time) bool {
+	if b.failures < breakerThreshold {
+		return true
+	}
+	if now.Before(b.openUntil) {
+		return false
+	}
+	b.openUntil = now.Add(breakerCooldown)
+	return true
+}
+
+// success closes the breaker
+func (b *breaker) success() {
+	b.failures = 0
+	b.openUntil = time.Time{}
+}
+
+// failure records a failed request and reports whether the breaker opened
+// because of it
+func (b *breaker) failure(now time.Time) bool {
+	b.failures++
+	if b.failures < breakerThreshold {
+		return false
+	}
+	b.openUntil = now.Add(breakerCooldown)
+	return b.failures == breakerThreshold
+}
@@ -0,0 +1,60 @@
+package control
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	var b breaker
+	now := time.Now()
+
+	// Failures below the threshold leave it closed
+	for i := 1; i < breakerThreshold; i++ {
+		if b.failure(now) {
+			t.Fatalf("opened after %d failures", i)
+		}
+		if !b.allow(now) {
+			t.Fatalf("refused a request after %d failures", i)
+		}
+	}
+	if !b.failure(now) {
+		t.Fatalf("didn't open after %d failures", breakerThreshold)
+	}
+
+	// Open: requests are refused until the cooldown is over
+	if b.allow(now) || b.allow(now.Add(breakerCooldown-time.Second)) {
+		t.Fatal("allowed a request while open")
+	}
+
+	// Half open: one probe is let through, the others wait for it
+	probe := now.Add(breakerCooldown)
+	if !b.allow(probe) {
+		t.Fatal("refused the probe after the cooldown")
+	}
+	if b.allow(probe) || b.allow(probe.Add(time.Second)) {
+		t.Fatal("allowed a second request while probing")
+	}
+
+	// A failed probe opens it for another cooldown, without reporting it
+	// opened again
+	if b.failure(probe) {
+		t.Fatal("a failed probe reported the breaker opening again")
+	}
+	if b.allow(probe.Add(breakerCooldown - time.Second)) {
+		t.Fatal("allowed a request after a failed probe")
+	}
+	probe = probe.Add(breakerCooldown)
+	if !b.allow(probe) {
+		t.Fatal("refused the next probe")
+	}
+
+	// A successful probe closes it
+	b.success()
+	if !b.allow(probe) || !b.allow(probe) {
+		t.Fatal("refused requests after a successful probe")
+	}
+	if b.failure(probe) {
+		t.Fatal("opened on the first failure after closing")
+	}
+}
@@ -2,73 +2,143 @@ package control
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
+	"net"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/Vaibhav2154/ShadowNet/internal/node/transport"
 	"github.com/Vaibhav2154/ShadowNet/internal/shared/proto"
 )
 
-// Client is a control plane API client
+// Request timeouts and retries. Each attempt gets requestTimeout; failed
+// attempts are retried with backoff, failing over to the next URL.
+const (
+	requestTimeout = 10 * time.Second
+	maxAttempts    = 4
+	retryMinDelay  = 500 * time.Millisecond
+	retryMaxDelay  = 8 * time.Second
+)
+
+// ErrCircuitOpen is returned without a request when every control plane
+// URL failed repeatedly and is cooling down
+var ErrCircuitOpen = errors.New("control plane unavailable (circuit breaker open)")
+
+// APIError is a control plane response other than 200 OK
+type APIError struct {
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s - %s", e.Status, strings.TrimSpace(e.Body))
+}
+
+// IsPeerNotFound reports whether err means the control plane doesn't know
+// this peer, e.g. after its database was reset, so it has to register again
+func IsPeerNotFound(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	// Older control planes answer 400 with the store's error message
+	return apiErr.StatusCode == http.StatusNotFound || strings.Contains(apiErr.Body, "peer not found")
+}
+
+// endpoint is a control plane URL with its circuit breaker
+type endpoint struct {
+	url     string
+	breaker breaker
+}
+
+// Client is a control plane API client. Requests go to the first of its
+// URLs that works, retrying with backoff and failing over to the next URL.
 type Client struct {
-	baseURL    string
 	httpClient *http.Client
+
+	mu        sync.Mutex
+	endpoints []*endpoint
+	active    int
+}
+
+// NewClient creates a new control plane client for baseURL, failing over
+// to the fallback URLs in order
+func NewClient(baseURL string, fallbacks ...string) *Client {
+	c := &Client{httpClient: &http.Client{}}
+	for _, u := range append([]string{baseURL}, fallbacks...) {
+		c.endpoints = append(c.endpoints, &endpoint{url: strings.TrimRight(u, "/")})
+	}
+	return c
 }
 
-// NewClient creates a new control plane client
-func NewClient(baseURL string) *Client {
-	return &Client{
-		baseURL: baseURL,
-		httpClient: &http.Client{
-			Timeout: 10 * time.Second,
-		},
+// SetFirewallMark marks the client's connections so they keep using the
+// physical network while an exit node carries the default route
+func (c *Client) SetFirewallMark(mark uint32) {
+	dialer := &net.Dialer{
+		Timeout:   5 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   transport.MarkControl(mark),
 	}
+
+	httpTransport := http.DefaultTransport.(*http.Transport).Clone()
+	httpTransport.DialContext = dialer.DialContext
+	c.httpClient.Transport = httpTransport
 }
 
-// Register registers this node with the control plane
-func (c *Client) Register(info *proto.PeerInfo) error {
+// URL returns the control plane URL requests currently go to
+func (c *Client) URL() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.endpoints[c.active].url
+}
+
+// Register registers this node with the control plane. joinToken may be
+// empty unless the control plane requires join tokens.
+func (c *Client) Register(ctx context.Context, info *proto.PeerInfo, joinToken string) (*proto.RegisterResponse, error) {
 	req := proto.RegisterRequest{
-		ID:           info.ID,
-		WGPublicKey:  info.WGPublicKey,
-		EndpointIP:   info.EndpointIP,
-		EndpointPort: info.EndpointPort,
+		ID:               info.ID,
+		WGPublicKey:      info.WGPublicKey,
+		EndpointIP:       info.EndpointIP,
+		EndpointPort:     info.EndpointPort,
+		EndpointIPv6:     info.EndpointIPv6,
+		EndpointPortV6:   info.EndpointPortV6,
+		NAT:              info.NAT,
+		PeerMetadata:     info.PeerMetadata,
+		AdvertisedRoutes: info.AdvertisedRoutes,
+		JoinToken:        joinToken,
 	}
 
 	var resp proto.RegisterResponse
-	if err := c.post("/register", req, &resp); err != nil {
-		return fmt.Errorf("registration failed: %w", err)
+	if err := c.do(ctx, http.MethodPost, "/register", req, &resp, maxAttempts); err != nil {
+		return nil, fmt.Errorf("registration failed: %w", err)
 	}
 
 	if !resp.Success {
-		return fmt.Errorf("registration failed: %s", resp.Message)
+		return nil, fmt.Errorf("registration failed: %s", resp.Message)
 	}
 
-	return nil
+	return &resp, nil
 }
 
 // GetPeers retrieves the list of active peers
-func (c *Client) GetPeers(excludeID string) ([]*proto.PeerInfo, error) {
-	url := c.baseURL + "/peers"
+func (c *Client) GetPeers(ctx context.Context, excludeID string) ([]*proto.PeerInfo, error) {
+	path := "/peers"
 	if excludeID != "" {
-		url += "?exclude=" + excludeID
-	}
-
-	resp, err := c.httpClient.Get(url)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get peers: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("get peers failed: %s - %s", resp.Status, string(body))
+		path += "?exclude=" + url.QueryEscape(excludeID)
 	}
 
 	var peersResp proto.PeersResponse
-	if err := json.NewDecoder(resp.Body).Decode(&peersResp); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	if err := c.do(ctx, http.MethodGet, path, nil, &peersResp, maxAttempts); err != nil {
+		return nil, fmt.Errorf("failed to get peers: %w", err)
 	}
 
 	// Convert to pointer slice
@@ -81,68 +151,242 @@ func (c *Client) GetPeers(excludeID string) ([]*proto.PeerInfo, error) {
 }
 
 // SendHeartbeat sends a heartbeat to the control plane
-func (c *Client) SendHeartbeat(id string) error {
+func (c *Client) SendHeartbeat(ctx context.Context, id string, tunnels []proto.TunnelStats) (*proto.HeartbeatResponse, error) {
 	req := proto.HeartbeatRequest{
-		ID: id,
+		ID:      id,
+		Tunnels: tunnels,
 	}
 
 	var resp proto.HeartbeatResponse
-	if err := c.post("/heartbeat", req, &resp); err != nil {
-		return fmt.Errorf("heartbeat failed: %w", err)
+	if err := c.do(ctx, http.MethodPost, "/heartbeat", req, &resp, maxAttempts); err != nil {
+		return nil, fmt.Errorf("heartbeat failed: %w", err)
 	}
 
 	if !resp.Success {
-		return fmt.Errorf("heartbeat failed: %s", resp.Message)
+		return nil, fmt.Errorf("heartbeat failed: %s", resp.Message)
+	}
+
+	return &resp, nil
+}
+
+// KeyChallenge returns a challenge to prove this node's keys against, for a
+// key rotation or preshared key offers
+func (c *Client) KeyChallenge(ctx context.Context, id string) (*proto.KeyChallengeResponse, error) {
+	var resp proto.KeyChallengeResponse
+	if err := c.do(ctx, http.MethodPost, "/keys/challenge", proto.KeyChallengeRequest{ID: id}, &resp, maxAttempts); err != nil {
+		return nil, fmt.Errorf("key challenge failed: %w", err)
+	}
+
+	return &resp, nil
+}
+
+// RotateKey asks the control plane to switch this node to a new key. A
+// retry of the same request is answered with the same switch time.
+func (c *Client) RotateKey(ctx context.Context, req *proto.KeyRotationRequest) (*proto.KeyRotationResponse, error) {
+	var resp proto.KeyRotationResponse
+	if err := c.do(ctx, http.MethodPost, "/keys/rotate", req, &resp, maxAttempts); err != nil {
+		return nil, fmt.Errorf("key rotation failed: %w", err)
+	}
+
+	if !resp.Success {
+		return nil, fmt.Errorf("key rotation failed: %s", resp.Message)
+	}
+
+	return &resp, nil
+}
+
+// GetPSKOffers retrieves the preshared key offers of this node's pairs
+func (c *Client) GetPSKOffers(ctx context.Context, id string) (*proto.PSKOffersResponse, error) {
+	var resp proto.PSKOffersResponse
+	if err := c.do(ctx, http.MethodGet, "/psk?id="+url.QueryEscape(id), nil, &resp, maxAttempts); err != nil {
+		return nil, fmt.Errorf("failed to get preshared key offers: %w", err)
+	}
+
+	return &resp, nil
+}
+
+// SendPSKOffers sends new preshared key offers to the control plane
+func (c *Client) SendPSKOffers(ctx context.Context, req *proto.PSKOffersRequest) error {
+	if err := c.do(ctx, http.MethodPost, "/psk", req, nil, maxAttempts); err != nil {
+		return fmt.Errorf("failed to send preshared key offers: %w", err)
 	}
 
 	return nil
 }
 
+// AckPSKOffers acknowledges offers made to this node, which schedules
+// their use, and returns the offers of its pairs
+func (c *Client) AckPSKOffers(ctx context.Context, req *proto.PSKAcksRequest) (*proto.PSKOffersResponse, error) {
+	var resp proto.PSKOffersResponse
+	if err := c.do(ctx, http.MethodPost, "/psk/ack", req, &resp, maxAttempts); err != nil {
+		return nil, fmt.Errorf("failed to acknowledge preshared key offers: %w", err)
+	}
+
+	return &resp, nil
+}
+
 // GetMetrics retrieves control plane metrics
-func (c *Client) GetMetrics() (*proto.MetricsResponse, error) {
-	resp, err := c.httpClient.Get(c.baseURL + "/metrics")
-	if err != nil {
+func (c *Client) GetMetrics(ctx context.Context) (*proto.MetricsResponse, error) {
+	var metrics proto.MetricsResponse
+	if err := c.do(ctx, http.MethodGet, "/metrics", nil, &metrics, maxAttempts); err != nil {
 		return nil, fmt.Errorf("failed to get metrics: %w", err)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("get metrics failed: %s", resp.Status)
+	return &metrics, nil
+}
+
+// GetSTUNServers retrieves the STUN servers run by the control plane
+func (c *Client) GetSTUNServers(ctx context.Context) (*proto.STUNResponse, error) {
+	var stunResp proto.STUNResponse
+	if err := c.do(ctx, http.MethodGet, "/stun", nil, &stunResp, maxAttempts); err != nil {
+		return nil, fmt.Errorf("failed to get STUN servers: %w", err)
 	}
 
-	var metrics proto.MetricsResponse
-	if err := json.NewDecoder(resp.Body).Decode(&metrics); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	return &stunResp, nil
+}
+
+// CheckHealth checks that the control plane is up. It makes a single
+// attempt so the caller sees the control plane's actual state.
+func (c *Client) CheckHealth(ctx context.Context) error {
+	if err := c.do(ctx, http.MethodGet, "/health", nil, nil, 1); err != nil {
+		return fmt.Errorf("health check failed: %w", err)
 	}
 
-	return &metrics, nil
+	return nil
 }
 
-// post sends a POST request and decodes the response
-func (c *Client) post(path string, request, response interface{}) error {
-	body, err := json.Marshal(request)
+// do sends a request, making up to attempts attempts, and decodes the
+// response into response unless it is nil. Only network errors, 5xx and
+// 429 responses are retried.
+func (c *Client) do(ctx context.Context, method, path string, request, response interface{}, attempts int) error {
+	var body []byte
+	if request != nil {
+		var err error
+		if body, err = json.Marshal(request); err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+	}
+
+	backoff := Backoff{Min: retryMinDelay, Max: retryMaxDelay}
+	var lastErr error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("%w (last error: %v)", ctx.Err(), lastErr)
+			case <-time.After(backoff.Next()):
+			}
+		}
+
+		ep := c.pick()
+		if ep == nil {
+			return ErrCircuitOpen
+		}
+
+		err := c.send(ctx, ep.url, method, path, body, response)
+		if err == nil || !retryable(err) {
+			// The control plane answered, so it is healthy even if it
+			// rejected the request
+			c.succeeded(ep)
+			return err
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+
+		c.failed(ep, err)
+		lastErr = err
+	}
+	return lastErr
+}
+
+// send makes a single request to one control plane URL
+func (c *Client) send(ctx context.Context, baseURL, method, path string, body []byte, response interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, baseURL+path, reader)
 	if err != nil {
-		return fmt.Errorf("failed to marshal request: %w", err)
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
 	}
 
-	resp, err := c.httpClient.Post(
-		c.baseURL+path,
-		"application/json",
-		bytes.NewReader(body),
-	)
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return fmt.Errorf("request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("request failed: %s - %s", resp.Status, string(body))
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		return &APIError{StatusCode: resp.StatusCode, Status: resp.Status, Body: string(body)}
 	}
 
+	if response == nil {
+		return nil
+	}
 	if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
 		return fmt.Errorf("failed to decode response: %w", err)
 	}
 
 	return nil
 }
+
+// retryable reports whether a failed request may succeed when retried
+func retryable(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode >= 500 || apiErr.StatusCode == http.StatusTooManyRequests
+	}
+	return true
+}
+
+// pick returns the endpoint to send the next request to: the active one,
+// or the next whose circuit breaker lets requests through. It returns nil
+// if all breakers are open.
+func (c *Client) pick() *endpoint {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for i := range c.endpoints {
+		index := (c.active + i) % len(c.endpoints)
+		if c.endpoints[index].breaker.allow(now) {
+			if index != c.active {
+				log.Printf("Failing over to control plane %s", c.endpoints[index].url)
+				c.active = index
+			}
+			return c.endpoints[index]
+		}
+	}
+	return nil
+}
+
+// succeeded records a response from an endpoint
+func (c *Client) succeeded(ep *endpoint) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ep.breaker.success()
+}
+
+// failed records a failed request to an endpoint and moves on to the next
+// URL, if there is one
+func (c *Client) failed(ep *endpoint, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if ep.breaker.failure(time.Now()) {
+		log.Printf("Control plane %s failed %d times in a row (%v), pausing requests to it for %s",
+			ep.url, breakerThreshold, err, breakerCooldown)
+	}
+	if len(c.endpoints) > 1 && c.endpoints[c.active] == ep {
+		c.active = (c.active + 1) % len(c.endpoints)
+		log.Printf("Control plane %s failed (%v), failing over to %s", ep.url, err, c.endpoints[c.active].url)
+	}
+}
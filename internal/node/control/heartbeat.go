@@ -2,8 +2,12 @@ package control
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"sync"
 	"time"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/proto"
 )
 
 // HeartbeatSender sends periodic heartbeats to the control plane
@@ -11,23 +15,57 @@ type HeartbeatSender struct {
 	client   *Client
 	peerID   string
 	interval time.Duration
+	tunnels  func() []proto.TunnelStats
 	ctx      context.Context
 	cancel   context.CancelFunc
+
+	// onPeerNotFound re-registers when the control plane forgot this peer
+	// and onPeersRevision and onPSKRevision learn about changes to the
+	// peer list and preshared key offers
+	onPeerNotFound  func() error
+	onPeersRevision func(revision int64)
+	onPSKRevision   func(revision int64)
+
+	// Outcome of the most recent heartbeats
+	mu          sync.Mutex
+	lastSuccess time.Time
+	lastErr     error
 }
 
-// NewHeartbeatSender creates a new heartbeat sender
-func NewHeartbeatSender(client *Client, peerID string, interval time.Duration) *HeartbeatSender {
+// NewHeartbeatSender creates a new heartbeat sender; tunnels, if not nil,
+// provides the tunnel statistics sent with each heartbeat
+func NewHeartbeatSender(client *Client, peerID string, interval time.Duration, tunnels func() []proto.TunnelStats) *HeartbeatSender {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	return &HeartbeatSender{
 		client:   client,
 		peerID:   peerID,
 		interval: interval,
+		tunnels:  tunnels,
 		ctx:      ctx,
 		cancel:   cancel,
 	}
 }
 
+// OnPeerNotFound sets fn to be called when a heartbeat is rejected because
+// the control plane doesn't know this peer, e.g. after its database was
+// reset; fn is expected to register again
+func (h *HeartbeatSender) OnPeerNotFound(fn func() error) {
+	h.onPeerNotFound = fn
+}
+
+// OnPeersRevision sets fn to be called with the peers revision of every
+// heartbeat response that has one
+func (h *HeartbeatSender) OnPeersRevision(fn func(revision int64)) {
+	h.onPeersRevision = fn
+}
+
+// OnPSKRevision sets fn to be called with the preshared key revision of
+// every heartbeat response that has one
+func (h *HeartbeatSender) OnPSKRevision(fn func(revision int64)) {
+	h.onPSKRevision = fn
+}
+
 // Start begins sending heartbeats
 func (h *HeartbeatSender) Start() {
 	go h.run()
@@ -58,9 +96,46 @@ func (h *HeartbeatSender) run() {
 
 // sendHeartbeat sends a single heartbeat
 func (h *HeartbeatSender) sendHeartbeat() {
-	if err := h.client.SendHeartbeat(h.peerID); err != nil {
+	var tunnels []proto.TunnelStats
+	if h.tunnels != nil {
+		tunnels = h.tunnels()
+	}
+
+	resp, err := h.client.SendHeartbeat(h.ctx, h.peerID, tunnels)
+	if IsPeerNotFound(err) && h.onPeerNotFound != nil && h.ctx.Err() == nil {
+		log.Printf("Control plane doesn't know this peer, registering again")
+		if regErr := h.onPeerNotFound(); regErr != nil {
+			err = fmt.Errorf("%w; registering again failed: %v", err, regErr)
+		} else {
+			resp, err = h.client.SendHeartbeat(h.ctx, h.peerID, tunnels)
+		}
+	}
+
+	h.mu.Lock()
+	h.lastErr = err
+	if err == nil {
+		h.lastSuccess = time.Now()
+	}
+	h.mu.Unlock()
+
+	if err != nil {
 		log.Printf("Failed to send heartbeat: %v", err)
-	} else {
-		log.Printf("Heartbeat sent successfully")
+		return
 	}
+	log.Printf("Heartbeat sent successfully")
+
+	if resp.PeersRevision != 0 && h.onPeersRevision != nil {
+		h.onPeersRevision(resp.PeersRevision)
+	}
+	if resp.PSKRevision != 0 && h.onPSKRevision != nil {
+		h.onPSKRevision(resp.PSKRevision)
+	}
+}
+
+// LastResult returns the time of the last successful heartbeat (zero if
+// none) and the error of the most recent one
+func (h *HeartbeatSender) LastResult() (time.Time, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.lastSuccess, h.lastErr
 }
@@ -0,0 +1,39 @@
+package dns
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/utils"
+)
+
+// resolvConfPath is the system resolver configuration
+const resolvConfPath = "/etc/resolv.conf"
+
+// FQDN returns the overlay name of a peer, <name>.<network>.<domain>
+func FQDN(name, network, domain string) string {
+	return utils.DNSLabel(name) + "." + utils.DNSLabel(network) + "." + domain
+}
+
+// SystemUpstreams returns the nameservers in /etc/resolv.conf as host:port,
+// skipping exclude (the overlay resolver itself)
+func SystemUpstreams(exclude string) []string {
+	f, err := os.Open(resolvConfPath)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var upstreams []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "nameserver" || fields[1] == exclude {
+			continue
+		}
+		upstreams = append(upstreams, net.JoinHostPort(fields[1], "53"))
+	}
+	return upstreams
+}
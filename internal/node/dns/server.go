@@ -0,0 +1,306 @@
+package dns
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// DefaultDomain is the suffix overlay names are served under
+const DefaultDomain = "shadownet"
+
+const (
+	// recordTTL is short because peers come and go with the peer map
+	recordTTL = 60
+
+	// upstreamTimeout bounds each forwarded query
+	upstreamTimeout = 3 * time.Second
+
+	// maxMessageSize is the largest DNS message handled over TCP
+	maxMessageSize = 65535
+)
+
+// Server answers A and AAAA queries for overlay peers under its domain
+// from an in-memory record set and forwards all other queries upstream
+type Server struct {
+	domain    string
+	upstreams []string
+	udp       net.PacketConn
+	tcp       net.Listener
+
+	mu      sync.RWMutex
+	records map[string][]netip.Addr
+
+	wg sync.WaitGroup
+}
+
+// NewServer listens on addr over UDP and TCP. domain is the suffix served
+// locally, e.g. "shadownet"; upstreams are host:port resolvers for
+// everything else.
+func NewServer(addr, domain string, upstreams []string) (*Server, error) {
+	udp, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s/udp: %w", addr, err)
+	}
+
+	tcp, err := net.Listen("tcp", addr)
+	if err != nil {
+		udp.Close()
+		return nil, fmt.Errorf("failed to listen on %s/tcp: %w", addr, err)
+	}
+
+	return &Server{
+		domain:    strings.ToLower(strings.Trim(domain, ".")),
+		upstreams: upstreams,
+		udp:       udp,
+		tcp:       tcp,
+		records:   make(map[string][]netip.Addr),
+	}, nil
+}
+
+// Domain returns the suffix served locally
+func (s *Server) Domain() string {
+	return s.domain
+}
+
+// SetRecords replaces the served names. Names are fully qualified without
+// the trailing dot, e.g. "laptop.default.shadownet".
+func (s *Server) SetRecords(records map[string][]netip.Addr) {
+	normalized := make(map[string][]netip.Addr, len(records))
+	for name, addrs := range records {
+		normalized[strings.ToLower(strings.TrimSuffix(name, "."))] = addrs
+	}
+
+	s.mu.Lock()
+	s.records = normalized
+	s.mu.Unlock()
+}
+
+// Start serves queries in the background
+func (s *Server) Start() {
+	s.wg.Add(2)
+	go s.serveUDP()
+	go s.serveTCP()
+}
+
+// Close stops serving and waits for the listeners to exit
+func (s *Server) Close() error {
+	err := errors.Join(s.udp.Close(), s.tcp.Close())
+	s.wg.Wait()
+	return err
+}
+
+// serveUDP answers UDP queries, one goroutine per query so slow upstreams
+// don't block local answers
+func (s *Server) serveUDP() {
+	defer s.wg.Done()
+
+	buf := make([]byte, 1500)
+	for {
+		n, from, err := s.udp.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Printf("DNS: UDP read failed: %v", err)
+			}
+			return
+		}
+
+		query := append([]byte(nil), buf[:n]...)
+		go func() {
+			if resp := s.handle(query, "udp"); resp != nil {
+				s.udp.WriteTo(resp, from)
+			}
+		}()
+	}
+}
+
+// serveTCP answers length-prefixed queries on TCP connections
+func (s *Server) serveTCP() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.tcp.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Printf("DNS: TCP accept failed: %v", err)
+			}
+			return
+		}
+
+		go func() {
+			defer conn.Close()
+			for {
+				conn.SetDeadline(time.Now().Add(10 * time.Second))
+				query, err := readTCPMessage(conn)
+				if err != nil {
+					return
+				}
+				resp := s.handle(query, "tcp")
+				if resp == nil || writeTCPMessage(conn, resp) != nil {
+					return
+				}
+			}
+		}()
+	}
+}
+
+// handle answers one query, returning nil for messages that can't be
+// answered at all
+func (s *Server) handle(query []byte, network string) []byte {
+	var parser dnsmessage.Parser
+	header, err := parser.Start(query)
+	if err != nil || header.Response {
+		return nil
+	}
+
+	question, err := parser.Question()
+	if err != nil {
+		return reply(header, nil, dnsmessage.RCodeFormatError, nil)
+	}
+
+	name := strings.ToLower(strings.TrimSuffix(question.Name.String(), "."))
+	if name == s.domain || strings.HasSuffix(name, "."+s.domain) {
+		return s.answer(header, question, name)
+	}
+
+	resp, err := s.forward(query, network)
+	if err != nil {
+		log.Printf("DNS: failed to forward %s: %v", name, err)
+		return reply(header, &question, dnsmessage.RCodeServerFailure, nil)
+	}
+	return resp
+}
+
+// answer resolves a name under the local domain from the record set
+func (s *Server) answer(header dnsmessage.Header, question dnsmessage.Question, name string) []byte {
+	s.mu.RLock()
+	addrs, ok := s.records[name]
+	s.mu.RUnlock()
+
+	if !ok {
+		return reply(header, &question, dnsmessage.RCodeNameError, nil)
+	}
+
+	var answers []dnsmessage.Resource
+	for _, addr := range addrs {
+		rh := dnsmessage.ResourceHeader{Name: question.Name, Class: dnsmessage.ClassINET, TTL: recordTTL}
+		switch {
+		case question.Type == dnsmessage.TypeA && addr.Is4():
+			rh.Type = dnsmessage.TypeA
+			answers = append(answers, dnsmessage.Resource{Header: rh, Body: &dnsmessage.AResource{A: addr.As4()}})
+		case question.Type == dnsmessage.TypeAAAA && addr.Is6():
+			rh.Type = dnsmessage.TypeAAAA
+			answers = append(answers, dnsmessage.Resource{Header: rh, Body: &dnsmessage.AAAAResource{AAAA: addr.As16()}})
+		}
+	}
+
+	// Known names without a record of the queried type are NODATA
+	return reply(header, &question, dnsmessage.RCodeSuccess, answers)
+}
+
+// forward relays a query to the upstream resolvers in order, over the same
+// transport it arrived on
+func (s *Server) forward(query []byte, network string) ([]byte, error) {
+	if len(s.upstreams) == 0 {
+		return nil, fmt.Errorf("no upstream resolvers")
+	}
+
+	var errs []error
+	for _, upstream := range s.upstreams {
+		resp, err := exchange(query, network, upstream)
+		if err == nil {
+			return resp, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", upstream, err))
+	}
+	return nil, errors.Join(errs...)
+}
+
+// exchange sends a query to one upstream and reads its answer
+func exchange(query []byte, network, upstream string) ([]byte, error) {
+	conn, err := net.DialTimeout(network, upstream, upstreamTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(upstreamTimeout))
+
+	if network == "tcp" {
+		if err := writeTCPMessage(conn, query); err != nil {
+			return nil, err
+		}
+		return readTCPMessage(conn)
+	}
+
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, maxMessageSize)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		// Ignore stray datagrams that don't answer this query
+		if n >= 2 && buf[0] == query[0] && buf[1] == query[1] {
+			return buf[:n], nil
+		}
+	}
+}
+
+// reply builds a response to header with the given code and answers
+func reply(header dnsmessage.Header, question *dnsmessage.Question, rcode dnsmessage.RCode, answers []dnsmessage.Resource) []byte {
+	msg := dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:                 header.ID,
+			Response:           true,
+			OpCode:             header.OpCode,
+			Authoritative:      question != nil && rcode != dnsmessage.RCodeServerFailure,
+			RecursionDesired:   header.RecursionDesired,
+			RecursionAvailable: true,
+			RCode:              rcode,
+		},
+		Answers: answers,
+	}
+	if question != nil {
+		msg.Questions = []dnsmessage.Question{*question}
+	}
+
+	resp, err := msg.Pack()
+	if err != nil {
+		log.Printf("DNS: failed to pack response: %v", err)
+		return nil
+	}
+	return resp
+}
+
+// readTCPMessage reads one length-prefixed DNS message
+func readTCPMessage(r io.Reader) ([]byte, error) {
+	var length uint16
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return nil, err
+	}
+	msg := make([]byte, length)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// writeTCPMessage writes one length-prefixed DNS message
+func writeTCPMessage(w io.Writer, msg []byte) error {
+	buf := make([]byte, 2+len(msg))
+	binary.BigEndian.PutUint16(buf, uint16(len(msg)))
+	copy(buf[2:], msg)
+	_, err := w.Write(buf)
+	return err
+}
@@ -0,0 +1,139 @@
+//go:build linux
+
+package dns
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+const (
+	// resolvConfBackup holds the original resolv.conf while it is replaced
+	resolvConfBackup = "/etc/resolv.conf.shadownet-backup"
+
+	// resolvedRuntimeDir exists while systemd-resolved is running
+	resolvedRuntimeDir = "/run/systemd/resolve"
+)
+
+// SystemConfig is a change to the system resolver that Restore undoes
+type SystemConfig struct {
+	iface    string
+	resolved bool
+	original []byte
+}
+
+// ConfigureSystem points the system resolver at server for queries under
+// domain. With systemd-resolved only the domain is routed to the
+// interface (split DNS); otherwise resolv.conf is replaced, with the
+// original kept in a backup file until Restore. searchDomain, if set, lets
+// short peer names resolve.
+func ConfigureSystem(iface string, server netip.Addr, domain, searchDomain string) (*SystemConfig, error) {
+	if resolvectl, err := exec.LookPath("resolvectl"); err == nil {
+		if _, err := os.Stat(resolvedRuntimeDir); err == nil {
+			return configureResolved(resolvectl, iface, server, domain, searchDomain)
+		}
+	}
+
+	return configureResolvConf(server, searchDomain)
+}
+
+// configureResolved sets per-link DNS and a routing domain in systemd-resolved
+func configureResolved(resolvectl, iface string, server netip.Addr, domain, searchDomain string) (*SystemConfig, error) {
+	domains := []string{"domain", iface, "~" + domain}
+	if searchDomain != "" {
+		domains = append(domains, searchDomain)
+	}
+
+	for _, args := range [][]string{{"dns", iface, server.String()}, domains} {
+		if out, err := exec.Command(resolvectl, args...).CombinedOutput(); err != nil {
+			exec.Command(resolvectl, "revert", iface).Run()
+			return nil, fmt.Errorf("resolvectl %s failed: %w: %s", strings.Join(args, " "), err, bytes.TrimSpace(out))
+		}
+	}
+
+	return &SystemConfig{iface: iface, resolved: true}, nil
+}
+
+// configureResolvConf replaces resolv.conf with one using server, keeping
+// the original search domains and options
+func configureResolvConf(server netip.Addr, searchDomain string) (*SystemConfig, error) {
+	original, err := os.ReadFile(resolvConfPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read %s: %w", resolvConfPath, err)
+	}
+
+	// Keep the backup on disk so a crashed node can be cleaned up by the
+	// next start
+	if err := os.WriteFile(resolvConfBackup, original, 0644); err != nil {
+		return nil, fmt.Errorf("failed to back up %s: %w", resolvConfPath, err)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Generated by ShadowNet while it is running; the original is restored\n")
+	fmt.Fprintf(&b, "# on shutdown (backup: %s)\n", resolvConfBackup)
+	fmt.Fprintf(&b, "nameserver %s\n", server)
+
+	search := []string{}
+	if searchDomain != "" {
+		search = append(search, searchDomain)
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(original))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "search", "domain":
+			search = append(search, fields[1:]...)
+		case "options":
+			fmt.Fprintln(&b, scanner.Text())
+		}
+	}
+	if len(search) > 0 {
+		fmt.Fprintf(&b, "search %s\n", strings.Join(search, " "))
+	}
+
+	if err := os.WriteFile(resolvConfPath, []byte(b.String()), 0644); err != nil {
+		os.Remove(resolvConfBackup)
+		return nil, fmt.Errorf("failed to write %s: %w", resolvConfPath, err)
+	}
+
+	return &SystemConfig{original: original}, nil
+}
+
+// Restore undoes ConfigureSystem
+func (c *SystemConfig) Restore() error {
+	if c.resolved {
+		if out, err := exec.Command("resolvectl", "revert", c.iface).CombinedOutput(); err != nil {
+			return fmt.Errorf("resolvectl revert failed: %w: %s", err, bytes.TrimSpace(out))
+		}
+		return nil
+	}
+
+	if err := os.WriteFile(resolvConfPath, c.original, 0644); err != nil {
+		return fmt.Errorf("failed to restore %s: %w", resolvConfPath, err)
+	}
+	os.Remove(resolvConfBackup)
+	return nil
+}
+
+// RestoreStale restores resolv.conf from a backup left behind by a node
+// that didn't shut down cleanly
+func RestoreStale() error {
+	original, err := os.ReadFile(resolvConfBackup)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", resolvConfBackup, err)
+	}
+
+	return (&SystemConfig{original: original}).Restore()
+}
@@ -0,0 +1,28 @@
+//go:build !linux
+
+package dns
+
+import (
+	"fmt"
+	"net/netip"
+	"runtime"
+)
+
+// SystemConfig is a change to the system resolver that Restore undoes
+type SystemConfig struct{}
+
+// ConfigureSystem is only implemented on Linux
+func ConfigureSystem(iface string, server netip.Addr, domain, searchDomain string) (*SystemConfig, error) {
+	return nil, fmt.Errorf("configuring the system resolver is not supported on %s", runtime.GOOS)
+}
+
+// Restore undoes ConfigureSystem
+func (c *SystemConfig) Restore() error {
+	return nil
+}
+
+// RestoreStale restores a resolver configuration left behind by a node
+// that didn't shut down cleanly
+func RestoreStale() error {
+	return nil
+}
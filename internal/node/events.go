@@ -0,0 +1,67 @@
+package node
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/proto"
+)
+
+// maxEvents is how many recent events the node keeps for the local API
+const maxEvents = 200
+
+// Event types recorded by the node
+const (
+	EventStarted    = "started"
+	EventEndpoint   = "endpoint"
+	EventRegistered = "registered"
+	EventOffline    = "offline"
+	EventOnline     = "online"
+	EventPeers      = "peers"
+	EventConfig     = "config"
+	EventKey        = "key"
+	EventError      = "error"
+	EventStopped    = "stopped"
+)
+
+// eventLog is a bounded log of recent events
+type eventLog struct {
+	mu     sync.Mutex
+	events []proto.NodeEvent
+}
+
+// add appends an event, dropping the oldest when full
+func (l *eventLog) add(eventType, message string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.events) == maxEvents {
+		l.events = append(l.events[:0], l.events[1:]...)
+	}
+	l.events = append(l.events, proto.NodeEvent{
+		Time:    time.Now().UTC().Format(time.RFC3339),
+		Type:    eventType,
+		Message: message,
+	})
+}
+
+// list returns a copy of the events, oldest first
+func (l *eventLog) list() []proto.NodeEvent {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]proto.NodeEvent(nil), l.events...)
+}
+
+// event logs a message and records it for the local API
+func (n *Node) event(eventType, format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	log.Println(message)
+	n.events.add(eventType, message)
+}
+
+// Events returns recent events, oldest first
+func (n *Node) Events() []proto.NodeEvent {
+	return n.events.list()
+}
@@ -0,0 +1,109 @@
+package gateway
+
+import (
+	"net/netip"
+	"strconv"
+)
+
+// filterChain is the chain PortFilter owns; it is jumped to from the
+// chains local and forwarded traffic passes through
+const filterChain = "SHADOWNET-PORTFILTER"
+
+var filterParents = []string{"INPUT", "OUTPUT", "FORWARD"}
+
+// PortFilter limits the traffic to and from overlay addresses to one UDP
+// port, for tunnels that may carry nothing else yet. Only IPv4 addresses
+// are filtered.
+type PortFilter struct {
+	port  string
+	addrs map[netip.Addr]bool
+}
+
+// NewPortFilter installs an empty filter letting through the UDP port.
+// Rules left behind by a crashed run are removed first.
+func NewPortFilter(port int) (*PortFilter, error) {
+	removeFilterChain()
+
+	if err := iptables(ipv4, "filter", "-N", filterChain); err != nil {
+		return nil, err
+	}
+	for _, parent := range filterParents {
+		if err := iptables(ipv4, "filter", "-I", parent, "1", "-j", filterChain); err != nil {
+			removeFilterChain()
+			return nil, err
+		}
+	}
+	return &PortFilter{port: strconv.Itoa(port), addrs: make(map[netip.Addr]bool)}, nil
+}
+
+// Add starts filtering the addresses, keeping the ones already filtered
+func (f *PortFilter) Add(addrs []netip.Addr) error {
+	for _, addr := range addrs {
+		if f.addrs[addr] {
+			continue
+		}
+		for _, rule := range f.rules(addr) {
+			if err := iptables(ipv4, "filter", append([]string{"-A", filterChain}, rule...)...); err != nil {
+				return err
+			}
+		}
+		f.addrs[addr] = true
+	}
+	return nil
+}
+
+// Set filters exactly the addresses. New ones are filtered before the
+// others are let through.
+func (f *PortFilter) Set(addrs []netip.Addr) error {
+	if err := f.Add(addrs); err != nil {
+		return err
+	}
+
+	wanted := make(map[netip.Addr]bool, len(addrs))
+	for _, addr := range addrs {
+		wanted[addr] = true
+	}
+	for addr := range f.addrs {
+		if wanted[addr] {
+			continue
+		}
+		for _, rule := range f.rules(addr) {
+			if err := iptables(ipv4, "filter", append([]string{"-D", filterChain}, rule...)...); err != nil {
+				return err
+			}
+		}
+		delete(f.addrs, addr)
+	}
+	return nil
+}
+
+// rules returns the rules filtering one address: the port is returned to
+// the parent chain, everything else dropped
+func (f *PortFilter) rules(addr netip.Addr) [][]string {
+	var rules [][]string
+	for _, match := range []string{"-s", "-d"} {
+		rules = append(rules,
+			[]string{match, addr.String(), "-p", "udp", "--sport", f.port, "--dport", f.port, "-j", "RETURN"},
+			[]string{match, addr.String(), "-j", "DROP"},
+		)
+	}
+	return rules
+}
+
+// Close removes the filter, letting all traffic through
+func (f *PortFilter) Close() error {
+	removeFilterChain()
+	f.addrs = make(map[netip.Addr]bool)
+	return nil
+}
+
+// removeFilterChain removes the jumps to the filter chain and the chain
+// itself, ignoring errors for rules that don't exist
+func removeFilterChain() {
+	for _, parent := range filterParents {
+		for iptables(ipv4, "filter", "-D", parent, "-j", filterChain) == nil {
+		}
+	}
+	iptables(ipv4, "filter", "-F", filterChain)
+	iptables(ipv4, "filter", "-X", filterChain)
+}
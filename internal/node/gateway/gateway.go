@@ -0,0 +1,26 @@
+// Package gateway lets a node forward overlay traffic to networks behind
+// it, for subnet routers and exit nodes, and filters what tunnels carry
+package gateway
+
+import "net/netip"
+
+// Config describes what a gateway forwards
+type Config struct {
+	// Interface is the WireGuard interface overlay traffic arrives on
+	Interface string
+
+	// Overlays are the overlay networks, one per address family, that
+	// forwarded traffic comes from
+	Overlays []netip.Prefix
+
+	// Routes are the destinations overlay peers may reach through this node
+	Routes []netip.Prefix
+
+	// SNAT masquerades forwarded traffic behind this node's address, so
+	// hosts on the routed networks need no route back to the overlay
+	SNAT bool
+
+	// ExitNode forwards overlay traffic to any destination outside the
+	// overlay, always masqueraded
+	ExitNode bool
+}
@@ -0,0 +1,205 @@
+package gateway
+
+import (
+	"fmt"
+	"log"
+	"net/netip"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Chains the gateway owns; jumps to them are added to the built-in chains
+const (
+	forwardChain = "SHADOWNET-FORWARD"
+	natChain     = "SHADOWNET-POSTROUTING"
+)
+
+// family is an address family's firewall tool and forwarding sysctl
+type family struct {
+	iptables string
+	sysctl   string
+}
+
+var (
+	ipv4 = family{iptables: "iptables", sysctl: "/proc/sys/net/ipv4/ip_forward"}
+	ipv6 = family{iptables: "ip6tables", sysctl: "/proc/sys/net/ipv6/conf/all/forwarding"}
+)
+
+// Gateway forwards overlay traffic to routed networks while enabled
+type Gateway struct {
+	families []family
+
+	// exitIPv6 reports whether exit node traffic is forwarded over IPv6
+	exitIPv6 bool
+
+	// sysctls maps forwarding sysctls to the values they had before
+	sysctls map[string]string
+}
+
+// Enable turns on IP forwarding and installs firewall rules that accept,
+// and optionally masquerade, overlay traffic to the configured routes.
+// Rules left behind by a crashed run are removed first.
+func Enable(cfg Config) (*Gateway, error) {
+	if err := RestoreStale(); err != nil {
+		log.Printf("Warning: failed to remove stale forwarding rules: %v", err)
+	}
+
+	g := &Gateway{sysctls: make(map[string]string)}
+
+	routes := append([]netip.Prefix{}, cfg.Routes...)
+	if cfg.ExitNode {
+		routes = append(routes, netip.MustParsePrefix("0.0.0.0/0"))
+		if g.exitIPv6 = canExitIPv6(cfg.Overlays); g.exitIPv6 {
+			routes = append(routes, netip.MustParsePrefix("::/0"))
+		}
+	}
+
+	for _, fam := range []family{ipv4, ipv6} {
+		var rules, natRules [][]string
+		for _, route := range routes {
+			if route.Addr().Is4() != (fam == ipv4) {
+				continue
+			}
+
+			dst := route.String()
+			rules = append(rules,
+				[]string{"-i", cfg.Interface, "-d", dst, "-j", "ACCEPT"},
+				[]string{"-o", cfg.Interface, "-s", dst, "-m", "conntrack", "--ctstate", "RELATED,ESTABLISHED", "-j", "ACCEPT"},
+			)
+			if cfg.SNAT || route.Bits() == 0 {
+				rule := []string{"!", "-o", cfg.Interface, "-d", dst}
+				for _, overlay := range cfg.Overlays {
+					if overlay.Addr().Is4() == (fam == ipv4) {
+						rule = append(rule, "-s", overlay.String())
+						break
+					}
+				}
+				natRules = append(natRules, append(rule, "-j", "MASQUERADE"))
+			}
+		}
+		if len(rules) == 0 {
+			continue
+		}
+
+		g.families = append(g.families, fam)
+		if err := g.enableFamily(fam, rules, natRules); err != nil {
+			g.Close()
+			return nil, err
+		}
+	}
+
+	return g, nil
+}
+
+// canExitIPv6 reports whether an exit node can forward IPv6: it needs an
+// IPv6 overlay to masquerade and ip6tables
+func canExitIPv6(overlays []netip.Prefix) bool {
+	hasOverlay := false
+	for _, overlay := range overlays {
+		if overlay.Addr().Is6() {
+			hasOverlay = true
+		}
+	}
+	if !hasOverlay {
+		log.Printf("Warning: no IPv6 overlay, the exit node only forwards IPv4")
+		return false
+	}
+	if _, err := exec.LookPath(ipv6.iptables); err != nil {
+		log.Printf("Warning: %s not found, the exit node only forwards IPv4", ipv6.iptables)
+		return false
+	}
+	return true
+}
+
+// ExitIPv6 reports whether exit node traffic is forwarded over IPv6 as well
+// as IPv4
+func (g *Gateway) ExitIPv6() bool {
+	return g.exitIPv6
+}
+
+// enableFamily turns on forwarding and installs one family's rules
+func (g *Gateway) enableFamily(fam family, rules, natRules [][]string) error {
+	previous, err := os.ReadFile(fam.sysctl)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", fam.sysctl, err)
+	}
+	if value := strings.TrimSpace(string(previous)); value != "1" {
+		if err := os.WriteFile(fam.sysctl, []byte("1"), 0644); err != nil {
+			return fmt.Errorf("failed to enable forwarding: %w", err)
+		}
+		g.sysctls[fam.sysctl] = value
+	}
+
+	if err := installChain(fam, "filter", forwardChain, "FORWARD", rules); err != nil {
+		return err
+	}
+	if len(natRules) > 0 {
+		if err := installChain(fam, "nat", natChain, "POSTROUTING", natRules); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close removes the firewall rules and restores the forwarding sysctls
+func (g *Gateway) Close() error {
+	var firstErr error
+	for _, fam := range g.families {
+		removeChain(fam, "filter", forwardChain, "FORWARD")
+		removeChain(fam, "nat", natChain, "POSTROUTING")
+	}
+
+	for path, value := range g.sysctls {
+		if err := os.WriteFile(path, []byte(value), 0644); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to restore %s: %w", path, err)
+		}
+	}
+	g.sysctls = nil
+	return firstErr
+}
+
+// RestoreStale removes rules a previous run failed to clean up. Forwarding
+// sysctls can't be restored since their previous values are unknown.
+func RestoreStale() error {
+	for _, fam := range []family{ipv4, ipv6} {
+		if _, err := exec.LookPath(fam.iptables); err != nil {
+			continue
+		}
+		removeChain(fam, "filter", forwardChain, "FORWARD")
+		removeChain(fam, "nat", natChain, "POSTROUTING")
+	}
+	return nil
+}
+
+// installChain creates a chain with the rules and jumps to it from the
+// built-in chain
+func installChain(fam family, table, chain, parent string, rules [][]string) error {
+	if err := iptables(fam, table, "-N", chain); err != nil {
+		return err
+	}
+	for _, rule := range rules {
+		if err := iptables(fam, table, append([]string{"-A", chain}, rule...)...); err != nil {
+			return err
+		}
+	}
+	return iptables(fam, table, "-I", parent, "1", "-j", chain)
+}
+
+// removeChain removes the jump to a chain and the chain itself, ignoring
+// errors for rules that don't exist
+func removeChain(fam family, table, chain, parent string) {
+	for iptables(fam, table, "-D", parent, "-j", chain) == nil {
+	}
+	iptables(fam, table, "-F", chain)
+	iptables(fam, table, "-X", chain)
+}
+
+// iptables runs one iptables command, waiting for the xtables lock
+func iptables(fam family, table string, args ...string) error {
+	args = append([]string{"-w", "-t", table}, args...)
+	if out, err := exec.Command(fam.iptables, args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("%s %s failed: %v: %s", fam.iptables, strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
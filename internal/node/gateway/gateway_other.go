@@ -0,0 +1,54 @@
+//go:build !linux
+
+package gateway
+
+import (
+	"fmt"
+	"net/netip"
+)
+
+// Gateway is unsupported on this platform
+type Gateway struct{}
+
+// Enable is unsupported on this platform
+func Enable(cfg Config) (*Gateway, error) {
+	return nil, fmt.Errorf("forwarding is not supported on this platform")
+}
+
+// ExitIPv6 reports false
+func (g *Gateway) ExitIPv6() bool {
+	return false
+}
+
+// Close does nothing
+func (g *Gateway) Close() error {
+	return nil
+}
+
+// RestoreStale does nothing
+func RestoreStale() error {
+	return nil
+}
+
+// PortFilter is unsupported on this platform
+type PortFilter struct{}
+
+// NewPortFilter is unsupported on this platform
+func NewPortFilter(port int) (*PortFilter, error) {
+	return nil, fmt.Errorf("port filtering is not supported on this platform")
+}
+
+// Add does nothing
+func (f *PortFilter) Add(addrs []netip.Addr) error {
+	return nil
+}
+
+// Set does nothing
+func (f *PortFilter) Set(addrs []netip.Addr) error {
+	return nil
+}
+
+// Close does nothing
+func (f *PortFilter) Close() error {
+	return nil
+}
@@ -0,0 +1,153 @@
+package localapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/proto"
+)
+
+// ErrNotRunning is returned when no node is listening on the socket
+var ErrNotRunning = errors.New("node is not running")
+
+// Client talks to a running node over its local API socket
+type Client struct {
+	socketPath string
+	httpClient *http.Client
+}
+
+// NewClient creates a new local API client
+func NewClient(socketPath string) *Client {
+	return &Client{
+		socketPath: socketPath,
+		httpClient: &http.Client{
+			Timeout: 60 * time.Second,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", socketPath)
+				},
+			},
+		},
+	}
+}
+
+// Status retrieves the node status
+func (c *Client) Status() (*proto.NodeStatus, error) {
+	var status proto.NodeStatus
+	if err := c.do(http.MethodGet, "/v1/status", nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Peers retrieves the node's peers with their tunnel state
+func (c *Client) Peers() (*proto.NodePeersResponse, error) {
+	var peers proto.NodePeersResponse
+	if err := c.do(http.MethodGet, "/v1/peers", nil, &peers); err != nil {
+		return nil, err
+	}
+	return &peers, nil
+}
+
+// Events retrieves up to limit recent events (0 for all)
+func (c *Client) Events(limit int) (*proto.NodeEventsResponse, error) {
+	path := "/v1/events"
+	if limit > 0 {
+		path = fmt.Sprintf("%s?limit=%d", path, limit)
+	}
+
+	var events proto.NodeEventsResponse
+	if err := c.do(http.MethodGet, path, nil, &events); err != nil {
+		return nil, err
+	}
+	return &events, nil
+}
+
+// Netcheck runs a network check on the node's WireGuard socket, querying
+// the given STUN servers or, if none, the node's own
+func (c *Client) Netcheck(servers []string) (*proto.NetcheckReport, error) {
+	path := "/v1/netcheck"
+	if len(servers) > 0 {
+		path += "?" + url.Values{"stun": servers}.Encode()
+	}
+
+	var report proto.NetcheckReport
+	if err := c.do(http.MethodGet, path, nil, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// Action runs a node action such as "reregister", "restun", "reload",
+// "rotate-key" or "shutdown"
+func (c *Client) Action(name string) (*proto.ActionResponse, error) {
+	var resp proto.ActionResponse
+	if err := c.do(http.MethodPost, "/v1/"+name, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// SetExitNode routes internet traffic through the peer with the given name
+// or ID; an empty peer turns exit node use off
+func (c *Client) SetExitNode(peer string) (*proto.ActionResponse, error) {
+	var resp proto.ActionResponse
+	if err := c.do(http.MethodPost, "/v1/exit-node", &proto.SetExitNodeRequest{Peer: peer}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// do sends a request with an optional JSON body and decodes the response,
+// turning API errors into their messages
+func (c *Client) do(method, path string, body, response interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, "http://local"+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		var opErr *net.OpError
+		if errors.As(err, &opErr) && opErr.Op == "dial" {
+			return fmt.Errorf("%w (no socket at %s)", ErrNotRunning, c.socketPath)
+		}
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp proto.ErrorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&errResp); err == nil && errResp.Message != "" {
+			return fmt.Errorf("%s", errResp.Message)
+		}
+		return fmt.Errorf("request failed: %s", resp.Status)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,211 @@
+package localapi
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/proto"
+)
+
+// StatusHandler serves the node status
+type StatusHandler struct {
+	node Node
+}
+
+// NewStatusHandler creates a new status handler
+func NewStatusHandler(node Node) *StatusHandler {
+	return &StatusHandler{node: node}
+}
+
+// ServeHTTP handles GET /v1/status
+func (h *StatusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	status, err := h.node.Status()
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, status)
+}
+
+// PeersHandler serves the node's peers with their tunnel state
+type PeersHandler struct {
+	node Node
+}
+
+// NewPeersHandler creates a new peers handler
+func NewPeersHandler(node Node) *PeersHandler {
+	return &PeersHandler{node: node}
+}
+
+// ServeHTTP handles GET /v1/peers
+func (h *PeersHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	status, err := h.node.Status()
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, proto.NodePeersResponse{
+		Peers: status.Peers,
+		Count: len(status.Peers),
+	})
+}
+
+// EventsHandler serves recent node events
+type EventsHandler struct {
+	node Node
+}
+
+// NewEventsHandler creates a new events handler
+func NewEventsHandler(node Node) *EventsHandler {
+	return &EventsHandler{node: node}
+}
+
+// ServeHTTP handles GET /v1/events?limit=N
+func (h *EventsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	events := h.node.Events()
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit < 0 {
+			writeError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		if limit < len(events) {
+			events = events[len(events)-limit:]
+		}
+	}
+
+	writeJSON(w, http.StatusOK, proto.NodeEventsResponse{Events: events})
+}
+
+// NetcheckHandler runs a network check on the node's socket
+type NetcheckHandler struct {
+	node Node
+}
+
+// NewNetcheckHandler creates a new netcheck handler
+func NewNetcheckHandler(node Node) *NetcheckHandler {
+	return &NetcheckHandler{node: node}
+}
+
+// ServeHTTP handles GET /v1/netcheck?stun=host:port (repeatable)
+func (h *NetcheckHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	report, err := h.node.Netcheck(r.URL.Query()["stun"])
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, report)
+}
+
+// ExitNodeHandler chooses the exit node
+type ExitNodeHandler struct {
+	node Node
+}
+
+// NewExitNodeHandler creates a new exit node handler
+func NewExitNodeHandler(node Node) *ExitNodeHandler {
+	return &ExitNodeHandler{node: node}
+}
+
+// ServeHTTP handles POST /v1/exit-node
+func (h *ExitNodeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req proto.SetExitNodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if err := h.node.SetExitNode(req.Peer); err != nil {
+		log.Printf("Local API action %s failed: %v", r.URL.Path, err)
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	message := "exit node disabled"
+	if req.Peer != "" {
+		message = "using exit node " + req.Peer
+	}
+	writeJSON(w, http.StatusOK, proto.ActionResponse{
+		Success: true,
+		Message: message,
+	})
+}
+
+// ActionHandler runs a node action
+type ActionHandler struct {
+	message string
+	action  func() error
+}
+
+// NewActionHandler creates a handler that runs action and reports message
+// on success
+func NewActionHandler(message string, action func() error) *ActionHandler {
+	return &ActionHandler{
+		message: message,
+		action:  action,
+	}
+}
+
+// ServeHTTP handles POST requests for the action
+func (h *ActionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	if err := h.action(); err != nil {
+		log.Printf("Local API action %s failed: %v", r.URL.Path, err)
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, proto.ActionResponse{
+		Success: true,
+		Message: h.message,
+	})
+}
+
+// writeJSON writes a JSON response
+func writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
+// writeError writes an error response
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, proto.ErrorResponse{
+		Error:   http.StatusText(status),
+		Message: message,
+	})
+}
@@ -0,0 +1,16 @@
+//go:build !windows
+
+package localapi
+
+import (
+	"net"
+	"syscall"
+)
+
+// listen creates the socket with mode 0600 from the start, so no other
+// user can connect before its permissions are restricted
+func listen(path string) (net.Listener, error) {
+	mask := syscall.Umask(0077)
+	defer syscall.Umask(mask)
+	return net.Listen("unix", path)
+}
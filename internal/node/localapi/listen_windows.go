@@ -0,0 +1,11 @@
+//go:build windows
+
+package localapi
+
+import "net"
+
+// listen creates the socket; Windows has no umask, so its permissions are
+// only restricted afterwards
+func listen(path string) (net.Listener, error) {
+	return net.Listen("unix", path)
+}
@@ -0,0 +1,121 @@
+package localapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/proto"
+)
+
+// DefaultSocketPath is where the node serves its local API by default
+const DefaultSocketPath = "/var/run/shadownet/shadownet.sock"
+
+// Node is the node runtime as seen by the local API
+type Node interface {
+	// Status returns the node's runtime status
+	Status() (*proto.NodeStatus, error)
+
+	// Events returns recent events, oldest first
+	Events() []proto.NodeEvent
+
+	// Reregister registers with the control plane again and refreshes peers
+	Reregister() error
+
+	// ReSTUN rediscovers the public endpoint and re-registers if it changed
+	ReSTUN() error
+
+	// ReloadConfig reloads the configuration and applies reloadable settings
+	ReloadConfig() error
+
+	// SetExitNode routes internet traffic through a peer, or stops when
+	// peer is empty
+	SetExitNode(peer string) error
+
+	// RotateKey starts a WireGuard key rotation through the control plane
+	RotateKey() error
+
+	// Shutdown asks the node process to stop
+	Shutdown() error
+
+	// Netcheck probes the network from the node's WireGuard socket; empty
+	// servers means the node's own
+	Netcheck(servers []string) (*proto.NetcheckReport, error)
+}
+
+// Server serves the local node API over a Unix socket that only the
+// node's user can connect to
+type Server struct {
+	path       string
+	listener   net.Listener
+	httpServer *http.Server
+}
+
+// NewServer creates the socket and the API routes
+func NewServer(path string, node Node) (*Server, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create socket directory: %w", err)
+	}
+
+	// A socket left behind by a crashed run would make Listen fail
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to remove stale socket: %w", err)
+	}
+
+	listener, err := listen(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to restrict socket permissions: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/v1/status", NewStatusHandler(node))
+	mux.Handle("/v1/peers", NewPeersHandler(node))
+	mux.Handle("/v1/events", NewEventsHandler(node))
+	mux.Handle("/v1/netcheck", NewNetcheckHandler(node))
+	mux.Handle("/v1/reregister", NewActionHandler("re-registered", node.Reregister))
+	mux.Handle("/v1/restun", NewActionHandler("endpoint rediscovered", node.ReSTUN))
+	mux.Handle("/v1/reload", NewActionHandler("configuration reloaded", node.ReloadConfig))
+	mux.Handle("/v1/exit-node", NewExitNodeHandler(node))
+	mux.Handle("/v1/rotate-key", NewActionHandler("key rotation started", node.RotateKey))
+	mux.Handle("/v1/shutdown", NewActionHandler("shutting down", node.Shutdown))
+
+	return &Server{
+		path:     path,
+		listener: listener,
+		httpServer: &http.Server{
+			Handler:      mux,
+			ReadTimeout:  10 * time.Second,
+			WriteTimeout: 60 * time.Second,
+		},
+	}, nil
+}
+
+// Start starts serving requests
+func (s *Server) Start() {
+	go func() {
+		if err := s.httpServer.Serve(s.listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Local API server error: %v", err)
+		}
+	}()
+}
+
+// Close stops the server and removes the socket
+func (s *Server) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := s.httpServer.Shutdown(ctx)
+	os.Remove(s.path)
+	return err
+}
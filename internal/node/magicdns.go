@@ -0,0 +1,167 @@
+package node
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/node/dns"
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/proto"
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/utils"
+)
+
+// startDNS serves overlay names on the virtual IP and, if configured,
+// points the system resolver at it
+func (n *Node) startDNS() error {
+	addr, err := netip.ParseAddr(n.cfg().VirtualIP)
+	if err != nil {
+		return fmt.Errorf("invalid virtual IP: %w", err)
+	}
+
+	// A node that crashed may have left its resolv.conf in place, which
+	// would make it its own upstream
+	if err := dns.RestoreStale(); err != nil {
+		log.Printf("Warning: failed to restore stale resolver configuration: %v", err)
+	}
+
+	upstreams := n.cfg().DNSUpstreams
+	if len(upstreams) == 0 {
+		upstreams = dns.SystemUpstreams(addr.String())
+	}
+
+	server, err := dns.NewServer(net.JoinHostPort(addr.String(), "53"), n.cfg().DNSDomain, upstreams)
+	if err != nil {
+		return err
+	}
+	server.Start()
+
+	n.mu.Lock()
+	n.dnsServer = server
+	network := n.network
+	n.mu.Unlock()
+	log.Printf("MagicDNS serving *.%s on %s (upstreams: %v)", n.cfg().DNSDomain, addr, upstreams)
+
+	if n.cfg().DNSConfigureSystem {
+		search := utils.DNSLabel(network) + "." + server.Domain()
+		system, err := dns.ConfigureSystem(n.cfg().TUNDeviceName, addr, server.Domain(), search)
+		if err != nil {
+			log.Printf("Warning: failed to configure system resolver: %v", err)
+		} else {
+			n.dnsSystem = system
+			log.Printf("System resolver configured for *.%s", server.Domain())
+		}
+	}
+
+	return nil
+}
+
+// updateDNS replaces the served names with this node and its peers. Peers
+// are named by the name the control plane assigned them; their IDs stay
+// resolvable as aliases where they don't clash with a name.
+func (n *Node) updateDNS(peers []*proto.PeerInfo) {
+	n.mu.Lock()
+	server := n.dnsServer
+	network := n.network
+	name := n.name
+	n.mu.Unlock()
+
+	if server == nil {
+		return
+	}
+
+	records := make(map[string][]netip.Addr)
+	add := func(label, network string, addrs []netip.Addr, alias bool) {
+		if len(addrs) == 0 {
+			return
+		}
+		name := dns.FQDN(label, networkOrDefault(network), server.Domain())
+		if _, taken := records[name]; taken {
+			if !alias {
+				log.Printf("Warning: DNS name %s is ambiguous, keeping the first peer", name)
+			}
+			return
+		}
+		records[name] = addrs
+	}
+
+	// Peers only get AAAA records when this node has an IPv6 overlay
+	// address to reach them from
+	self := overlayAddrs(n.cfg().VirtualIP, n.cfg().VirtualIPv6)
+	peerAddrs := func(peer *proto.PeerInfo) []netip.Addr {
+		if n.cfg().VirtualIPv6 == "" {
+			return overlayAddrs(virtualIPFor(peer.ID), "")
+		}
+		return overlayAddrs(virtualIPFor(peer.ID), utils.OverlayIPv6(peer.ID))
+	}
+
+	add(nameOrID(name, n.cfg().ID), network, self, false)
+	for _, peer := range peers {
+		add(nameOrID(peer.Name, peer.ID), peer.Network, peerAddrs(peer), false)
+	}
+
+	add(n.cfg().ID, network, self, true)
+	for _, peer := range peers {
+		add(peer.ID, peer.Network, peerAddrs(peer), true)
+	}
+
+	server.SetRecords(records)
+}
+
+// overlayAddrs parses a node's overlay addresses, skipping empty or invalid
+// ones
+func overlayAddrs(ips ...string) []netip.Addr {
+	addrs := make([]netip.Addr, 0, len(ips))
+	for _, ip := range ips {
+		if addr, err := netip.ParseAddr(ip); err == nil {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+// stopDNS restores the system resolver and stops serving names
+func (n *Node) stopDNS() {
+	if n.dnsSystem != nil {
+		if err := n.dnsSystem.Restore(); err != nil {
+			log.Printf("Warning: failed to restore system resolver: %v", err)
+		}
+		n.dnsSystem = nil
+	}
+
+	n.mu.Lock()
+	server := n.dnsServer
+	n.dnsServer = nil
+	n.mu.Unlock()
+
+	if server != nil {
+		server.Close()
+	}
+}
+
+// dnsName returns this node's overlay name, or "" without MagicDNS;
+// callers hold n.mu
+func (n *Node) dnsName() string {
+	if n.dnsServer == nil {
+		return ""
+	}
+	return dns.FQDN(nameOrID(n.name, n.cfg().ID), networkOrDefault(n.network), n.dnsServer.Domain())
+}
+
+// nameOrID returns the assigned name, or the ID for control planes that
+// don't assign names
+func nameOrID(name, id string) string {
+	if name == "" {
+		return id
+	}
+	return name
+}
+
+// networkOrDefault returns the network, or the default network for control
+// planes that don't report one
+func networkOrDefault(network string) string {
+	if network == "" {
+		return proto.DefaultNetwork
+	}
+	return network
+}
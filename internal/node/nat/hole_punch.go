@@ -4,12 +4,21 @@ import (
 	"context"
 	"log"
 	"net"
+	"sync"
 	"time"
 )
 
+// maxPunchDuration bounds how long a peer is punched without an answer
+const maxPunchDuration = 30 * time.Second
+
+// Sender writes datagrams from the socket WireGuard listens on
+type Sender interface {
+	WriteTo(p []byte, addr *net.UDPAddr) (int, error)
+}
+
 // HolePuncher manages NAT hole punching for a peer
 type HolePuncher struct {
-	conn     *net.UDPConn
+	conn     Sender
 	endpoint *net.UDPAddr
 	interval time.Duration
 	ctx      context.Context
@@ -17,13 +26,13 @@ type HolePuncher struct {
 }
 
 // NewHolePuncher creates a new hole puncher
-func NewHolePuncher(conn *net.UDPConn, remoteEndpoint string, interval time.Duration) (*HolePuncher, error) {
-	addr, err := net.ResolveUDPAddr("udp4", remoteEndpoint)
+func NewHolePuncher(conn Sender, remoteEndpoint string, interval time.Duration) (*HolePuncher, error) {
+	addr, err := net.ResolveUDPAddr("udp", remoteEndpoint)
 	if err != nil {
 		return nil, err
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithTimeout(context.Background(), maxPunchDuration)
 
 	return &HolePuncher{
 		conn:     conn,
@@ -65,7 +74,7 @@ func (h *HolePuncher) punch() {
 // sendPacket sends a single hole punching packet
 func (h *HolePuncher) sendPacket() {
 	// Send empty packet (or small marker)
-	_, err := h.conn.WriteToUDP([]byte{0x00}, h.endpoint)
+	_, err := h.conn.WriteTo([]byte{0x00}, h.endpoint)
 	if err != nil {
 		log.Printf("Hole punch failed to %s: %v", h.endpoint, err)
 	}
@@ -73,6 +82,7 @@ func (h *HolePuncher) sendPacket() {
 
 // PunchManager manages multiple hole punchers
 type PunchManager struct {
+	mu       sync.Mutex
 	punchers map[string]*HolePuncher
 }
 
@@ -84,12 +94,18 @@ func NewPunchManager() *PunchManager {
 }
 
 // AddPeer adds a peer to punch
-func (m *PunchManager) AddPeer(peerID string, conn *net.UDPConn, endpoint string, interval time.Duration) error {
+func (m *PunchManager) AddPeer(peerID string, conn Sender, endpoint string, interval time.Duration) error {
 	puncher, err := NewHolePuncher(conn, endpoint, interval)
 	if err != nil {
 		return err
 	}
 
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if existing, ok := m.punchers[peerID]; ok {
+		existing.Stop()
+	}
 	m.punchers[peerID] = puncher
 	puncher.Start()
 
@@ -99,6 +115,9 @@ func (m *PunchManager) AddPeer(peerID string, conn *net.UDPConn, endpoint string
 
 // RemovePeer removes a peer from punching
 func (m *PunchManager) RemovePeer(peerID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	if puncher, ok := m.punchers[peerID]; ok {
 		puncher.Stop()
 		delete(m.punchers, peerID)
@@ -106,8 +125,26 @@ func (m *PunchManager) RemovePeer(peerID string) {
 	}
 }
 
+// Confirm stops punching towards an endpoint once a punch from it arrived,
+// since the mapping is open in both directions
+func (m *PunchManager) Confirm(from *net.UDPAddr) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for peerID, puncher := range m.punchers {
+		if puncher.endpoint.IP.Equal(from.IP) && puncher.endpoint.Port == from.Port {
+			puncher.Stop()
+			delete(m.punchers, peerID)
+			log.Printf("Hole punch confirmed for peer %s from %s", peerID, from)
+		}
+	}
+}
+
 // StopAll stops all hole punchers
 func (m *PunchManager) StopAll() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	for peerID, puncher := range m.punchers {
 		puncher.Stop()
 		delete(m.punchers, peerID)
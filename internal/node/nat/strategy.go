@@ -0,0 +1,59 @@
+package nat
+
+import (
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/proto"
+)
+
+// Strategy is the way a node tries to reach a peer
+type Strategy string
+
+const (
+	// StrategyDirect means at least one side is reachable without traversal
+	StrategyDirect Strategy = "direct"
+
+	// StrategyPunch means both sides must send simultaneously to open mappings
+	StrategyPunch Strategy = "punch"
+
+	// StrategyUnreachable means hole punching is not expected to succeed
+	// and, with no relay to fall back on, the pair has no path
+	StrategyUnreachable Strategy = "unreachable"
+)
+
+// NAT type names as reported in proto.NATInfo.Type
+const (
+	typeOpen               = "open"
+	typePortRestrictedCone = "port-restricted-cone"
+	typeSymmetric          = "symmetric"
+)
+
+// ChooseStrategy picks a connection strategy from both sides' NAT behaviour
+func ChooseStrategy(local, remote *proto.NATInfo) Strategy {
+	localType, remoteType := natType(local), natType(remote)
+
+	// A side without NAT can always be reached first
+	if localType == typeOpen || remoteType == typeOpen {
+		return StrategyDirect
+	}
+
+	// Two symmetric NATs never agree on the mapping to punch towards
+	if localType == typeSymmetric && remoteType == typeSymmetric {
+		return StrategyUnreachable
+	}
+
+	// A symmetric NAT opens a fresh port for every destination, which a
+	// port-restricted peer drops because it never sent to that port
+	if (localType == typeSymmetric && remoteType == typePortRestrictedCone) ||
+		(remoteType == typeSymmetric && localType == typePortRestrictedCone) {
+		return StrategyUnreachable
+	}
+
+	return StrategyPunch
+}
+
+// natType returns the NAT type or an empty string when unknown
+func natType(info *proto.NATInfo) string {
+	if info == nil {
+		return ""
+	}
+	return info.Type
+}
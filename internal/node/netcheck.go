@@ -0,0 +1,53 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/node/stun"
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/proto"
+)
+
+// Netcheck probes the network the way the node sees it: control plane
+// latency and the STUN mappings of its WireGuard socket, over IPv4 and,
+// when enabled, IPv6. Empty servers means the node's own.
+func (n *Node) Netcheck(servers []string) (*proto.NetcheckReport, error) {
+	n.actionMu.Lock()
+	defer n.actionMu.Unlock()
+
+	report := &proto.NetcheckReport{
+		Socket:       fmt.Sprintf("WireGuard socket (port %d)", n.cfg().ListenPort),
+		ControlPlane: n.client().URL(),
+	}
+
+	ctx, cancel := context.WithTimeout(n.ctx, 10*time.Second)
+	defer cancel()
+	start := time.Now()
+	if err := n.client().CheckHealth(ctx); err != nil {
+		report.ControlPlaneError = err.Error()
+	} else {
+		report.ControlPlaneLatency = time.Since(start).Round(time.Millisecond).String()
+	}
+
+	if len(servers) == 0 {
+		servers = n.stunServers()
+	}
+
+	conn, release, err := n.stunConn()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	if n.bind == nil {
+		report.Socket = fmt.Sprintf("new socket %s (the kernel backend owns the WireGuard port)", conn.LocalAddr())
+	}
+
+	opts := stun.QueryOptions{Timeout: n.cfg().STUNTimeout, Retries: n.cfg().STUNRetries}
+	report.IPv4 = stun.Check(conn, servers, opts)
+	if n.cfg().IPv6 {
+		opts.Network = "udp6"
+		report.IPv6 = stun.Check(conn, servers, opts)
+	}
+	return report, nil
+}
@@ -0,0 +1,16 @@
+// Package netmon reports changes to the host's network configuration, such
+// as a laptop moving from Wi-Fi to LTE
+package netmon
+
+import (
+	"errors"
+	"time"
+)
+
+// settleDelay is how long the network must be quiet before a change is
+// reported; interfaces going down and up come as bursts of updates
+const settleDelay = 2 * time.Second
+
+// ErrUnsupported is returned by Watch on platforms without change
+// notifications
+var ErrUnsupported = errors.New("network change notifications are not supported on this platform")
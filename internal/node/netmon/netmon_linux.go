@@ -0,0 +1,68 @@
+package netmon
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/vishvananda/netlink"
+)
+
+// Watch calls onChange whenever links or addresses change, except on the
+// ignored interface (the overlay's own) and link-local addresses, until
+// ctx is done. Bursts of updates are reported once they settle.
+func Watch(ctx context.Context, ignore string, onChange func()) error {
+	done := make(chan struct{})
+	addrs := make(chan netlink.AddrUpdate, 16)
+	links := make(chan netlink.LinkUpdate, 16)
+
+	if err := netlink.AddrSubscribe(addrs, done); err != nil {
+		close(done)
+		return fmt.Errorf("failed to subscribe to address changes: %w", err)
+	}
+	if err := netlink.LinkSubscribe(links, done); err != nil {
+		close(done)
+		return fmt.Errorf("failed to subscribe to link changes: %w", err)
+	}
+
+	go func() {
+		defer close(done)
+
+		var settled <-chan time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case update, ok := <-addrs:
+				if !ok {
+					return
+				}
+				ip := update.LinkAddress.IP
+				if ip.IsLinkLocalUnicast() || ip.IsLoopback() || isIgnored(update.LinkIndex, ignore) {
+					continue
+				}
+				settled = time.After(settleDelay)
+			case update, ok := <-links:
+				if !ok {
+					return
+				}
+				if update.Link.Attrs().Name == ignore {
+					continue
+				}
+				settled = time.After(settleDelay)
+			case <-settled:
+				settled = nil
+				onChange()
+			}
+		}
+	}()
+
+	return nil
+}
+
+// isIgnored reports whether the link with the given index is the ignored
+// interface
+func isIgnored(index int, ignore string) bool {
+	link, err := netlink.LinkByIndex(index)
+	return err == nil && link.Attrs().Name == ignore
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package netmon
+
+import "context"
+
+// Watch returns ErrUnsupported; nodes on these platforms rely on periodic
+// endpoint checks
+func Watch(ctx context.Context, ignore string, onChange func()) error {
+	return ErrUnsupported
+}
@@ -1,33 +1,119 @@
 package node
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net"
+	"net/netip"
 	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/Vaibhav2154/ShadowNet/internal/node/config"
 	"github.com/Vaibhav2154/ShadowNet/internal/node/control"
+	"github.com/Vaibhav2154/ShadowNet/internal/node/dns"
+	"github.com/Vaibhav2154/ShadowNet/internal/node/gateway"
+	"github.com/Vaibhav2154/ShadowNet/internal/node/localapi"
 	"github.com/Vaibhav2154/ShadowNet/internal/node/nat"
+	"github.com/Vaibhav2154/ShadowNet/internal/node/state"
 	"github.com/Vaibhav2154/ShadowNet/internal/node/stun"
 	"github.com/Vaibhav2154/ShadowNet/internal/node/transport"
 	"github.com/Vaibhav2154/ShadowNet/internal/node/wireguard"
 	"github.com/Vaibhav2154/ShadowNet/internal/shared/proto"
 	"github.com/Vaibhav2154/ShadowNet/internal/shared/utils"
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/version"
 )
 
 // Node represents a ShadowNet node
 type Node struct {
-	config          *config.Config
 	privateKey      *wireguard.PrivateKey
 	publicKey       *wireguard.PublicKey
-	wgDevice        *wireguard.Device
-	udpTransport    *transport.UDPTransport
-	controlClient   *control.Client
+	wgDevice        wireguard.Backend
+	bind            *transport.MuxBind
 	heartbeatSender *control.HeartbeatSender
 	punchManager    *nat.PunchManager
 	publicIP        string
 	publicPort      int
+	publicIPv6      string
+	publicPortV6    int
+	stunServer      string
+	localAPI        *localapi.Server
+	dnsServer       *dns.Server
+	dnsSystem       *dns.SystemConfig
+	router          *transport.Router
+	gateway         *gateway.Gateway
+	configLoader    config.Loader
+	stateDir        *state.Dir
+	events          eventLog
+
+	// config and controlClient are replaced, never modified, by
+	// ReloadConfig and SetExitNode; read them through cfg and client
+	config        atomic.Pointer[config.Config]
+	controlClient atomic.Pointer[control.Client]
+
+	// actionMu serializes local API actions
+	actionMu sync.Mutex
+
+	// shutdown is closed when a shutdown is requested over the local API
+	shutdown     chan struct{}
+	shutdownOnce sync.Once
+
+	// ctx is canceled by Stop to end control plane requests and other
+	// background work
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// NAT behaviour, the network and name the control plane gave this
+	// node, the exit node in use and those available, the strategy chosen
+	// for each peer and peer IDs and names by WireGuard public key
+	mu             sync.Mutex
+	natInfo        *proto.NATInfo
+	network        string
+	name           string
+	exitNode       string
+	exitNodes      []string
+	peerStrategies map[string]nat.Strategy
+	peerIDs        map[string]string
+	peerNames      map[string]string
+	peersRevision  int64
+
+	// While the control plane is unreachable the node runs from its cached
+	// peer map: since when, the last registration error and when the
+	// cache was saved
+	offlineSince  time.Time
+	reconnectErr  error
+	cachedPeersAt time.Time
+
+	// A key rotation in progress: the new key, when to switch to it and
+	// the timer that does; and the timer switching peers to their rotated
+	// keys
+	nextKey        *wireguard.PrivateKey
+	keySwitchAt    time.Time
+	keySwitchTimer *time.Timer
+	peerKeyTimer   *time.Timer
+
+	// Preshared keys by peer ID, the peers that take them, the offers and
+	// revision last fetched and the timer installing the next key
+	psks        map[string]*pairPSK
+	pskPeers    map[string]*proto.PeerInfo
+	pskOffers   []proto.PSKOffer
+	pskRevision int64
+	pskTimer    *time.Timer
+
+	// Post-quantum key exchanges: state by peer ID, the peers that run
+	// them by ID and virtual IP, those left out for lack of support, the
+	// peer map last applied, the exchange socket and the filter holding
+	// tunnels that wait for a key to the exchange (used under actionMu)
+	pqPeers      map[string]*pqPeer
+	pqInfo       map[string]*proto.PeerInfo
+	pqAddrs      map[string]string
+	pqBlocked    []string
+	appliedPeers []*proto.PeerInfo
+	pqConn       *net.UDPConn
+	pqFilter     *gateway.PortFilter
 }
 
 // NewNode creates a new node
@@ -36,10 +122,37 @@ func NewNode(cfg *config.Config) (*Node, error) {
 		return nil, fmt.Errorf("invalid configuration: %w", err)
 	}
 
-	return &Node{
-		config:       cfg,
-		punchManager: nat.NewPunchManager(),
-	}, nil
+	ctx, cancel := context.WithCancel(context.Background())
+	n := &Node{
+		punchManager:   nat.NewPunchManager(),
+		peerStrategies: make(map[string]nat.Strategy),
+		peerIDs:        make(map[string]string),
+		peerNames:      make(map[string]string),
+		shutdown:       make(chan struct{}),
+		ctx:            ctx,
+		cancel:         cancel,
+	}
+	n.config.Store(cfg)
+	n.controlClient.Store(newControlClient(cfg))
+	return n, nil
+}
+
+// cfg returns the current configuration, which must not be modified
+func (n *Node) cfg() *config.Config {
+	return n.config.Load()
+}
+
+// client returns the current control plane client
+func (n *Node) client() *control.Client {
+	return n.controlClient.Load()
+}
+
+// newControlClient creates a control plane client for the configured URLs
+// whose connections bypass an exit node
+func newControlClient(cfg *config.Config) *control.Client {
+	client := control.NewClient(cfg.ControlPlaneURL, cfg.ControlPlaneFallbacks...)
+	client.SetFirewallMark(transport.FirewallMark)
+	return client
 }
 
 // Start starts the node runtime
@@ -51,41 +164,106 @@ func (n *Node) Start() error {
 		return fmt.Errorf("failed to load keys: %w", err)
 	}
 	log.Printf("Loaded WireGuard keys (public: %s...)", n.publicKey.String()[:16])
+	n.saveIdentity()
+
+	// Step 2: Open the UDP socket shared by STUN, hole punching and WireGuard
+	if err := n.openSocket(); err != nil {
+		return fmt.Errorf("failed to open UDP socket: %w", err)
+	}
 
-	// Step 2: Discover public endpoint via STUN (temporary UDP socket)
+	// Step 3: Discover public endpoint via STUN on the shared socket
 	if err := n.discoverEndpoint(); err != nil {
 		return fmt.Errorf("failed to discover endpoint: %w", err)
 	}
-	log.Printf("Discovered public endpoint: %s:%d", n.publicIP, n.publicPort)
+	n.event(EventEndpoint, "Discovered public endpoint: %s:%d", n.publicIP, n.publicPort)
 
-	// Step 3: Initialize WireGuard device (creates TUN and manages UDP automatically)
+	// Step 4: Initialize WireGuard device (creates TUN and takes over the socket)
 	if err := n.createWireGuard(); err != nil {
 		return fmt.Errorf("failed to create WireGuard device: %w", err)
 	}
-	log.Printf("Initialized WireGuard device with IP %s", n.config.VirtualIP)
+	log.Printf("Initialized %s WireGuard device with IP %s", n.wgDevice.Name(), n.cfg().VirtualIP)
+
+	// The IPv6 overlay address is best effort; hosts with IPv6 disabled
+	// keep working over IPv4
+	if n.cfg().VirtualIPv6 != "" {
+		if err := n.wgDevice.AddAddress(n.cfg().VirtualIPv6 + "/64"); err != nil {
+			log.Printf("Warning: failed to add IPv6 overlay address: %v", err)
+		} else {
+			log.Printf("Added IPv6 overlay address %s", n.cfg().VirtualIPv6)
+		}
+	}
 
-	// Step 6: Register with control plane
+	// Step 5: Set up routing for peers' subnets and forwarding for ours
+	if err := n.startRouting(); err != nil {
+		return fmt.Errorf("failed to set up routing: %w", err)
+	}
+
+	// Step 6: Register with control plane. When it is unreachable, start
+	// from the cached peer map and keep retrying in the background.
+	var cache *state.PeerCache
 	if err := n.registerWithControlPlane(); err != nil {
-		return fmt.Errorf("failed to register with control plane: %w", err)
+		if cache = n.startOffline(err); cache == nil {
+			return fmt.Errorf("failed to register with control plane: %w", err)
+		}
+	} else {
+		n.event(EventRegistered, "Registered with control plane")
+	}
+
+	// Step 7: Serve overlay names (best effort; peers stay reachable by IP)
+	if n.cfg().MagicDNS {
+		if err := n.startDNS(); err != nil {
+			log.Printf("Warning: failed to start MagicDNS: %v", err)
+		}
 	}
-	log.Println("Registered with control plane")
 
-	// Step 7: Fetch and configure peers
-	if err := n.configurePeers(); err != nil {
+	// Step 8: Fetch and configure peers
+	if cache != nil {
+		if err := n.applyPeers(cache.Peers); err != nil {
+			return fmt.Errorf("failed to configure cached peers: %w", err)
+		}
+	} else if err := n.configurePeers(); err != nil {
 		return fmt.Errorf("failed to configure peers: %w", err)
 	}
+	n.startPSKs()
+
+	// Post-quantum key exchanges run over the tunnels just configured
+	if err := n.startPQ(); err != nil {
+		return err
+	}
 
-	// Step 8: Start heartbeat
-	n.startHeartbeat()
-	log.Println("Started heartbeat sender")
+	// Step 9: Start heartbeat, once registered
+	if cache != nil {
+		go n.reconnect()
+	} else {
+		n.startHeartbeat()
+		log.Println("Started heartbeat sender")
+	}
+
+	// Step 10: Serve the local API (best effort; the node works without it)
+	if n.cfg().ControlSocket != "" {
+		if err := n.startLocalAPI(); err != nil {
+			log.Printf("Warning: failed to start local API: %v", err)
+		}
+	}
+
+	// Step 11: Follow the node across networks and NAT mapping changes
+	n.startRoaming()
+
+	// Step 12: Rotate the WireGuard key on schedule
+	n.startKeyRotation()
 
-	log.Println("ShadowNet node started successfully")
+	// Mapping lifetime probing takes minutes, so it runs in the background
+	if n.cfg().MappingLifetimeProbe > 0 && n.natInfo != nil {
+		go n.probeMappingLifetime()
+	}
+
+	n.event(EventStarted, "ShadowNet node started successfully")
 	return nil
 }
 
 // loadKeys loads or generates WireGuard keys
 func (n *Node) loadKeys() error {
-	privateKey, err := wireguard.LoadOrGeneratePrivateKey(n.config.PrivateKeyPath)
+	privateKey, err := n.cfg().KeyFile().LoadOrGenerate()
 	if err != nil {
 		return err
 	}
@@ -95,18 +273,20 @@ func (n *Node) loadKeys() error {
 	return nil
 }
 
-// createTransport creates the UDP transport
-func (n *Node) createTransport() error {
-	transport, err := transport.NewUDPTransport(n.config.ListenPort)
+// openSocket binds the shared UDP socket on the WireGuard port
+func (n *Node) openSocket() error {
+	bind, err := transport.NewMuxBind(n.cfg().ListenPort, n.cfg().IPv6)
 	if err != nil {
 		return err
 	}
 
-	n.udpTransport = transport
+	bind.OnPunch(n.punchManager.Confirm)
+	n.bind = bind
 	return nil
 }
 
-// discoverEndpoint discovers the public endpoint using STUN with a temporary socket
+// discoverEndpoint discovers the public endpoint using STUN, on the shared
+// socket with the userspace backend
 func (n *Node) discoverEndpoint() error {
 	// Check if we should use Docker internal IP instead of STUN
 	if os.Getenv("USE_DOCKER_IP") == "true" {
@@ -120,8 +300,10 @@ func (n *Node) discoverEndpoint() error {
 			if ipnet, ok := addr.(*net.IPNet); ok && !ipnet.IP.IsLoopback() {
 				if ipnet.IP.To4() != nil {
 					// Use first non-loopback IPv4 address (Docker internal IP)
+					n.mu.Lock()
 					n.publicIP = ipnet.IP.String()
-					n.publicPort = n.config.ListenPort
+					n.publicPort = n.cfg().ListenPort
+					n.mu.Unlock()
 					log.Printf("Using Docker internal IP: %s:%d", n.publicIP, n.publicPort)
 					return nil
 				}
@@ -129,33 +311,230 @@ func (n *Node) discoverEndpoint() error {
 		}
 	}
 
-	// Create temporary UDP socket for STUN discovery
-	tempTransport, err := transport.NewUDPTransport(n.config.ListenPort)
+	conn, release, err := n.stunConn()
 	if err != nil {
 		return err
 	}
-	defer tempTransport.Close() // Close immediately after STUN
+	defer release()
 
-	ip, port, err := stun.DiscoverEndpointWithConn(
-		tempTransport.Conn(),
-		n.config.STUNServer,
-	)
+	// Query all STUN servers in parallel; one answer is enough to start
+	consensus, err := n.queryEndpoint(conn, "")
 	if err != nil {
 		return err
 	}
 
-	n.publicIP = ip
-	n.publicPort = port
+	for _, result := range consensus.Results {
+		if result.Err != nil {
+			log.Printf("STUN server %s failed: %v", result.Server, result.Err)
+		}
+	}
+	if consensus.Inconsistent {
+		log.Printf("Warning: STUN servers reported different mappings (symmetric NAT likely); using %s:%d reported by %d of %d servers",
+			consensus.IP, consensus.Port, consensus.Agreeing, consensus.Answered())
+	}
+
+	n.mu.Lock()
+	n.publicIP = consensus.IP
+	n.publicPort = consensus.Port
+	n.stunServer = consensus.Server
+	n.mu.Unlock()
+
+	// NAT behaviour discovery is best effort; peers fall back to punching
+	n.discoverNATBehavior(conn, consensus)
+
+	if n.cfg().IPv6 {
+		n.discoverIPv6Endpoint(conn)
+	}
 	return nil
 }
 
-// createWireGuard initializes the WireGuard device using kernel module
+// discoverIPv6Endpoint finds this node's IPv6 endpoint: the address STUN
+// servers see over IPv6, or else a global address of an interface. Hosts
+// without a global IPv6 address only use IPv4 endpoints.
+func (n *Node) discoverIPv6Endpoint(conn net.PacketConn) {
+	local, ok := globalIPv6()
+	if !ok {
+		n.mu.Lock()
+		n.publicIPv6, n.publicPortV6 = "", 0
+		n.mu.Unlock()
+		log.Printf("No global IPv6 address, using IPv4 endpoints only")
+		return
+	}
+
+	ip, port := local.String(), n.cfg().ListenPort
+	consensus, err := n.queryEndpoint(conn, "udp6")
+	if err != nil {
+		log.Printf("IPv6 STUN failed (%v), using interface address %s", err, ip)
+	} else if addr, err := netip.ParseAddr(consensus.IP); err == nil && isGlobalIPv6(addr) {
+		ip, port = consensus.IP, consensus.Port
+	}
+
+	n.mu.Lock()
+	n.publicIPv6, n.publicPortV6 = ip, port
+	n.mu.Unlock()
+	n.event(EventEndpoint, "Discovered IPv6 endpoint: %s", utils.FormatEndpoint(ip, port))
+}
+
+// globalIPv6 returns the first global unicast IPv6 address of the host's
+// interfaces; unique local addresses, including the overlay's, don't count
+func globalIPv6() (netip.Addr, bool) {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return netip.Addr{}, false
+	}
+
+	for _, addr := range addrs {
+		ipnet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		if ip, ok := netip.AddrFromSlice(ipnet.IP); ok && isGlobalIPv6(ip) {
+			return ip, true
+		}
+	}
+	return netip.Addr{}, false
+}
+
+// isGlobalIPv6 reports whether addr is a globally routable IPv6 address
+func isGlobalIPv6(addr netip.Addr) bool {
+	return addr.Is6() && !addr.Is4In6() && addr.IsGlobalUnicast() && !addr.IsPrivate()
+}
+
+// stunServers returns the STUN servers to query, preferring the control
+// plane's built-in server when it advertises one
+func (n *Node) stunServers() []string {
+	servers := n.cfg().STUNServers
+	if !n.cfg().ControlPlaneSTUN {
+		return servers
+	}
+
+	resp, err := n.client().GetSTUNServers(n.ctx)
+	if err != nil {
+		log.Printf("Warning: failed to get STUN servers from control plane: %v", err)
+		return servers
+	}
+	if len(resp.Servers) > 0 {
+		log.Printf("Using control plane STUN servers: %v", resp.Servers)
+	}
+
+	return append(resp.Servers, servers...)
+}
+
+// discoverNATBehavior classifies the NAT in front of this node using the
+// servers that answered endpoint discovery, consensus server first
+func (n *Node) discoverNATBehavior(conn net.PacketConn, consensus *stun.Consensus) {
+	servers := []string{consensus.Server}
+	for _, result := range consensus.Results {
+		if result.Err == nil && result.Server != consensus.Server {
+			servers = append(servers, result.Server)
+		}
+	}
+
+	behavior, err := stun.DiscoverNATBehavior(conn, stun.NATDiscoveryOptions{
+		Servers: servers,
+		Timeout: n.cfg().STUNTimeout,
+	})
+	if err != nil {
+		log.Printf("Warning: NAT behaviour discovery failed: %v", err)
+		behavior = &stun.NATBehavior{
+			Type:      stun.NATTypeUnknown,
+			Mapping:   stun.MappingUnknown,
+			Filtering: stun.FilteringUnknown,
+		}
+	}
+
+	// Inconsistent mappings across servers prove the NAT is symmetric even
+	// when the individual tests were inconclusive
+	if consensus.Inconsistent && !behavior.Symmetric() {
+		behavior.Mapping = stun.MappingAddressAndPortDependent
+		behavior.Type = stun.NATTypeSymmetric
+	}
+
+	n.natInfo = &proto.NATInfo{
+		Type:        string(behavior.Type),
+		Mapping:     string(behavior.Mapping),
+		Filtering:   string(behavior.Filtering),
+		Hairpinning: behavior.Hairpinning,
+	}
+	log.Printf("NAT type: %s (mapping: %s, filtering: %s, hairpinning: %t)",
+		behavior.Type, behavior.Mapping, behavior.Filtering, behavior.Hairpinning)
+}
+
+// probeMappingLifetime measures the NAT mapping lifetime and re-registers
+// so the control plane learns about it
+func (n *Node) probeMappingLifetime() {
+	lifetime, err := stun.ProbeMappingLifetime(n.stunServer, n.cfg().MappingLifetimeProbe, n.cfg().STUNTimeout)
+	if err != nil {
+		log.Printf("Warning: NAT mapping lifetime probe failed: %v", err)
+		return
+	}
+	log.Printf("NAT mapping lifetime: at least %s", lifetime)
+
+	n.mu.Lock()
+	natInfo := *n.natInfo
+	natInfo.MappingLifetime = int(lifetime.Seconds())
+	n.natInfo = &natInfo
+	n.mu.Unlock()
+
+	if err := n.registerWithControlPlane(); err != nil {
+		log.Printf("Warning: failed to report NAT mapping lifetime: %v", err)
+	}
+}
+
+// createWireGuard initializes the WireGuard backend. The userspace device
+// takes over the shared socket; the kernel module needs the port itself,
+// so the socket is released first and reopened if the kernel fails in auto
+// mode. Without the shared socket STUN and hole punching can't run on the
+// WireGuard port, so auto mode only picks the kernel when there is no NAT
+// to traverse.
 func (n *Node) createWireGuard() error {
-	wgDev, err := wireguard.NewDevice(
-		n.config.TUNDeviceName,
+	backend := n.cfg().WGBackend
+	if backend == wireguard.BackendAuto {
+		backend = wireguard.BackendKernel
+		if err := wireguard.KernelAvailable(); err != nil {
+			log.Printf("Kernel WireGuard unavailable (%v), using userspace backend", err)
+			backend = wireguard.BackendUserspace
+		} else if !n.publicAddress() {
+			log.Printf("Behind NAT, using userspace backend to keep NAT traversal on the WireGuard socket")
+			backend = wireguard.BackendUserspace
+		}
+	}
+	if backend == wireguard.BackendKernel && !n.publicAddress() {
+		log.Printf("Warning: the kernel backend owns the WireGuard port; behind NAT, STUN refresh and hole punching from it are unavailable and tunnels rely on keepalives")
+	}
+
+	if backend == wireguard.BackendKernel {
+		n.bind.Release()
+		n.bind = nil
+
+		wgDev, err := wireguard.NewKernelDevice(
+			n.cfg().TUNDeviceName,
+			n.privateKey,
+			n.cfg().VirtualIP,
+			n.cfg().VirtualNetmask,
+			n.cfg().ListenPort,
+		)
+		if err == nil {
+			n.wgDevice = wgDev
+			return nil
+		}
+		if n.cfg().WGBackend != wireguard.BackendAuto {
+			return err
+		}
+
+		log.Printf("Kernel WireGuard failed (%v), falling back to userspace backend", err)
+		if err := n.openSocket(); err != nil {
+			return fmt.Errorf("failed to reopen UDP socket: %w", err)
+		}
+	}
+
+	wgDev, err := wireguard.NewUserspaceDevice(
+		n.cfg().TUNDeviceName,
 		n.privateKey,
-		n.config.VirtualIP,
-		n.config.ListenPort,
+		n.cfg().VirtualIP,
+		n.cfg().VirtualNetmask,
+		n.cfg().ListenPort,
+		n.bind,
 	)
 	if err != nil {
 		return err
@@ -167,90 +546,315 @@ func (n *Node) createWireGuard() error {
 
 // registerWithControlPlane registers this node with the control plane
 func (n *Node) registerWithControlPlane() error {
-	n.controlClient = control.NewClient(n.config.ControlPlaneURL)
-
+	n.mu.Lock()
 	peerInfo := &proto.PeerInfo{
-		ID:           n.config.ID,
+		ID:           n.cfg().ID,
 		WGPublicKey:  n.publicKey.String(),
 		EndpointIP:   n.publicIP,
 		EndpointPort: n.publicPort,
+		NAT:          n.natInfo,
+
+		EndpointIPv6:   n.publicIPv6,
+		EndpointPortV6: n.publicPortV6,
+
+		PeerMetadata: proto.PeerMetadata{
+			Hostname: n.cfg().Hostname,
+			OS:       runtime.GOOS,
+			Arch:     runtime.GOARCH,
+			Version:  version.Version,
+			Tags:     n.cfg().Tags,
+			Labels:   n.cfg().Labels,
+			Features: n.features(),
+		},
+		AdvertisedRoutes: n.advertisedRoutes(),
 	}
+	joinToken := n.cfg().JoinToken
+	n.mu.Unlock()
 
-	return n.controlClient.Register(peerInfo)
+	resp, err := n.client().Register(n.ctx, peerInfo, joinToken)
+	if err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	n.network = resp.Network
+	n.name = resp.Name
+	n.mu.Unlock()
+	return nil
 }
 
-// configurePeers fetches peers and configures WireGuard
+// features returns the optional features this node supports
+func (n *Node) features() []string {
+	var features []string
+	if n.cfg().PresharedKeys {
+		features = append(features, proto.FeaturePSK)
+	}
+	if n.cfg().PostQuantum {
+		features = append(features, proto.FeaturePQ)
+	}
+	return features
+}
+
+// configurePeers fetches peers, applies them to WireGuard as one batch and
+// caches them for starting offline
 func (n *Node) configurePeers() error {
 	// Fetch peers from control plane
-	peers, err := n.controlClient.GetPeers(n.config.ID)
+	peers, err := n.client().GetPeers(n.ctx, n.cfg().ID)
 	if err != nil {
 		return err
 	}
 
 	log.Printf("Found %d active peers", len(peers))
+	if err := n.applyPeers(peers); err != nil {
+		return err
+	}
+	n.savePeers(peers)
+	return nil
+}
 
-	// Configure each peer
+// applyPeers applies a peer map to WireGuard, routes, DNS and hole punching
+func (n *Node) applyPeers(peers []*proto.PeerInfo) error {
+	n.mu.Lock()
+	n.appliedPeers = peers
+	n.mu.Unlock()
+	n.setPSKPeers(peers)
+	n.setPQPeers(peers)
+
+	// Build the complete peer set; peers with bad data, or without the
+	// post-quantum support their tunnel requires, are skipped
+	routes := n.peerRoutes(peers)
+	configs := make([]wireguard.PeerConfig, 0, len(peers))
+	punch := make(map[string]string)
+	var waiting []netip.Addr
 	for _, peer := range peers {
-		if err := n.addPeer(peer); err != nil {
-			log.Printf("Warning: failed to add peer %s: %v", peer.ID, err)
+		if n.pqBlockedPeer(peer.ID) {
 			continue
 		}
-		log.Printf("Added peer: %s (%s:%d)", peer.ID, peer.EndpointIP, peer.EndpointPort)
+		if addr, ok := n.pqWaiting(peer); ok {
+			if !n.startPQFilter() {
+				continue
+			}
+			waiting = append(waiting, addr)
+		}
+		peerConfig, strategy, err := n.peerConfig(peer, routes[peer.ID])
+		if err != nil {
+			log.Printf("Warning: failed to configure peer %s: %v", peer.ID, err)
+			continue
+		}
+		configs = append(configs, *peerConfig)
+		if strategy != nat.StrategyDirect {
+			punch[peer.ID] = peerConfig.Endpoint
+		}
+	}
+
+	// Tunnels waiting for their post-quantum key are filtered before
+	// they are configured, and let through once their key is installed
+	if n.pqFilter != nil {
+		if err := n.pqFilter.Add(waiting); err != nil {
+			return fmt.Errorf("failed to filter tunnels waiting for post-quantum keys: %w", err)
+		}
+	}
+
+	// Sync the device's peers in one operation (syncconf semantics): only
+	// peers that left are removed, the rest keep their sessions
+	if err := n.wgDevice.SyncPeers(configs); err != nil {
+		return fmt.Errorf("failed to apply peers to WireGuard: %w", err)
+	}
+	if n.pqFilter != nil {
+		if err := n.pqFilter.Set(waiting); err != nil {
+			log.Printf("Warning: failed to lift the filter from post-quantum protected tunnels: %v", err)
+		}
+	}
+	n.event(EventPeers, "Applied %d peers to WireGuard", len(configs))
+	n.syncRoutes(routes)
+	n.updateDNS(peers)
+	n.schedulePeerKeySwitch(peers)
+
+	// Punch from the WireGuard socket so the mapping opened is the one
+	// WireGuard uses; the kernel backend owns its socket and relies on
+	// keepalives instead
+	if n.bind != nil {
+		for peerID, endpoint := range punch {
+			if err := n.punchManager.AddPeer(peerID, n.bind, endpoint, n.cfg().PunchInterval); err != nil {
+				log.Printf("Warning: failed to start hole punching for peer %s: %v", peerID, err)
+			}
+		}
 	}
 
 	return nil
 }
 
-// addPeer adds a peer to WireGuard
-func (n *Node) addPeer(peer *proto.PeerInfo) error {
-	// Parse public key
-	publicKey, err := wireguard.ParsePublicKey(peer.WGPublicKey)
+// peerConfig builds the WireGuard configuration for a peer, allowing its
+// virtual IP and the subnet routes assigned to it, and picks its connection
+// strategy
+func (n *Node) peerConfig(peer *proto.PeerInfo, routes []string) (*wireguard.PeerConfig, nat.Strategy, error) {
+	// Parse public key, the new one once a rotating peer switched to it
+	publicKey, err := wireguard.ParsePublicKey(peer.PublicKeyAt(time.Now()))
 	if err != nil {
-		return fmt.Errorf("invalid public key: %w", err)
+		return nil, "", fmt.Errorf("invalid public key: %w", err)
 	}
 
-	// Use the peer's registered endpoint (works for both Docker and real deployments)
+	// Use the peer's registered endpoint (works for both Docker and real
+	// deployments), preferring IPv6 when both sides have a global address
 	endpoint := utils.FormatEndpoint(peer.EndpointIP, peer.EndpointPort)
-
-	// Calculate peer's virtual IP using same hash function as main.go
-	hash := 0
-	for _, c := range peer.ID {
-		hash = (hash*31 + int(c)) % 254
+	n.mu.Lock()
+	useIPv6 := n.publicIPv6 != "" && peer.EndpointIPv6 != ""
+	n.mu.Unlock()
+	if useIPv6 {
+		endpoint = utils.FormatEndpoint(peer.EndpointIPv6, peer.EndpointPortV6)
 	}
-	peerVirtualIP := fmt.Sprintf("10.10.0.%d", hash+1)
 
-	// Determine allowed IPs (peer's virtual IP)
+	// Calculate peer's virtual IP using same hash function as main.go
+	peerVirtualIP := virtualIPFor(peer.ID)
 	allowedIPs := []string{fmt.Sprintf("%s/32", peerVirtualIP)}
+	if n.cfg().VirtualIPv6 != "" {
+		allowedIPs = append(allowedIPs, utils.OverlayIPv6(peer.ID)+"/128")
+	}
 
-	log.Printf("Adding peer %s with virtual IP %s, endpoint %s", peer.ID, peerVirtualIP, endpoint)
+	// A tunnel waiting for its post-quantum key only carries the exchange:
+	// the virtual IPv4 address, which the filter limits to its port
+	n.mu.Lock()
+	if n.pqRestricted(peer) {
+		allowedIPs, routes = allowedIPs[:1], nil
+	}
+	n.mu.Unlock()
+
+	// Pick a connection strategy from both sides' NAT behaviour. IPv6 has
+	// no NAT, but stateful firewalls still drop unsolicited packets, so
+	// both sides send.
+	n.mu.Lock()
+	strategy := nat.ChooseStrategy(n.natInfo, peer.NAT)
+	if useIPv6 {
+		strategy = nat.StrategyPunch
+	}
+	n.peerStrategies[peer.ID] = strategy
+	n.peerIDs[publicKey.String()] = peer.ID
+	n.peerNames[publicKey.String()] = peer.Name
+	n.mu.Unlock()
 
-	// Add peer to WireGuard (persistent keepalive handles NAT traversal)
-	if err := n.wgDevice.AddPeer(publicKey, endpoint, allowedIPs); err != nil {
-		return fmt.Errorf("failed to add peer to WireGuard: %w", err)
+	if strategy == nat.StrategyUnreachable {
+		log.Printf("Warning: peer %s is unreachable: the NAT combination doesn't allow a direct path and there is no relay", peer.ID)
 	}
 
-	return nil
+	log.Printf("Peer %s with virtual IP %s, endpoint %s (strategy: %s)", peer.ID, peerVirtualIP, endpoint, strategy)
+
+	return &wireguard.PeerConfig{
+		PublicKey:  publicKey,
+		Endpoint:   endpoint,
+		AllowedIPs: append(allowedIPs, routes...),
+		Keepalive:  n.keepaliveFor(strategy),
+
+		PresharedKey: n.tunnelPSK(peer.ID),
+	}, strategy, nil
+}
+
+// publicAddress reports whether NAT discovery found this node directly
+// reachable, with no NAT mapping to discover or keep open
+func (n *Node) publicAddress() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.natInfo != nil && n.natInfo.Type == string(stun.NATTypeOpen)
+}
+
+// keepaliveFor returns the persistent keepalive interval for a strategy.
+// Nodes without NAT have no mapping to keep open, so they leave keepalives
+// to the peer behind NAT.
+func (n *Node) keepaliveFor(strategy nat.Strategy) int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if strategy == nat.StrategyDirect && n.natInfo != nil && n.natInfo.Type == string(stun.NATTypeOpen) {
+		return 0
+	}
+	return 25
 }
 
 // startHeartbeat starts the heartbeat sender
 func (n *Node) startHeartbeat() {
-	n.heartbeatSender = control.NewHeartbeatSender(
-		n.controlClient,
-		n.config.ID,
-		n.config.HeartbeatInterval,
+	sender := control.NewHeartbeatSender(
+		n.client(),
+		n.cfg().ID,
+		n.cfg().HeartbeatInterval,
+		n.tunnelStats,
 	)
-	n.heartbeatSender.Start()
+	sender.OnPeerNotFound(n.Reregister)
+	sender.OnPeersRevision(n.peersRevisionChanged)
+	sender.OnPSKRevision(n.pskRevisionChanged)
+
+	n.mu.Lock()
+	n.heartbeatSender = sender
+	n.mu.Unlock()
+
+	sender.Start()
+}
+
+// peersRevisionChanged refetches peers when a heartbeat reports that the
+// control plane's peer maps changed, e.g. because a peer roamed. The first
+// heartbeat always refetches, since the revision of the initial peer map
+// isn't known.
+func (n *Node) peersRevisionChanged(revision int64) {
+	n.mu.Lock()
+	changed := revision != n.peersRevision
+	n.peersRevision = revision
+	n.mu.Unlock()
+	if !changed {
+		return
+	}
+
+	n.actionMu.Lock()
+	defer n.actionMu.Unlock()
+	if err := n.refreshPeers(); err != nil {
+		log.Printf("Warning: failed to refresh peers: %v", err)
+	}
+}
+
+// stopHeartbeat stops the heartbeat sender if it is running
+func (n *Node) stopHeartbeat() {
+	n.mu.Lock()
+	sender := n.heartbeatSender
+	n.heartbeatSender = nil
+	n.mu.Unlock()
+
+	if sender != nil {
+		sender.Stop()
+	}
+}
+
+// startLocalAPI serves the local API on the control socket
+func (n *Node) startLocalAPI() error {
+	server, err := localapi.NewServer(n.cfg().ControlSocket, n)
+	if err != nil {
+		return err
+	}
+
+	server.Start()
+	n.localAPI = server
+	log.Printf("Local API listening on %s", n.cfg().ControlSocket)
+	return nil
 }
 
 // Stop stops the node
 func (n *Node) Stop() error {
 	log.Println("Stopping ShadowNet node...")
 
-	// Stop heartbeat
-	if n.heartbeatSender != nil {
-		n.heartbeatSender.Stop()
+	// Stop the local API first so no action races the shutdown
+	if n.localAPI != nil {
+		n.localAPI.Close()
 	}
 
+	// Stop heartbeat and reconnect attempts
+	n.cancel()
+	n.stopHeartbeat()
+
+	// Restore the system resolver while the interface still exists
+	n.stopDNS()
+
+	// Remove subnet routes and forwarding rules
+	n.stopRouting()
+
+	// Stop key exchanges
+	n.stopPQ()
+
 	// Stop hole punching
 	if n.punchManager != nil {
 		n.punchManager.StopAll()
@@ -261,7 +865,12 @@ func (n *Node) Stop() error {
 		n.wgDevice.Close()
 	}
 
-	log.Println("ShadowNet node stopped")
+	// Release the shared socket once WireGuard no longer uses it
+	if n.bind != nil {
+		n.bind.Release()
+	}
+
+	n.event(EventStopped, "ShadowNet node stopped")
 	return nil
 }
 
@@ -272,6 +881,11 @@ func (n *Node) Wait() {
 	}
 }
 
+// virtualIPFor returns the virtual IP assigned to a peer ID
+func virtualIPFor(id string) string {
+	return fmt.Sprintf("10.10.0.%d", hashPeerID(id))
+}
+
 // hashPeerID creates a simple hash of peer ID for IP assignment
 func hashPeerID(id string) int {
 	hash := 0
@@ -0,0 +1,137 @@
+package node
+
+import (
+	"log"
+	"time"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/node/control"
+	"github.com/Vaibhav2154/ShadowNet/internal/node/state"
+)
+
+// Retry delays for reaching the control plane while running offline
+const (
+	reconnectMinDelay = 2 * time.Second
+	reconnectMaxDelay = 2 * time.Minute
+)
+
+// startOffline switches to the cached peer map so tunnels to known peers
+// come up while the control plane is unreachable. It returns nil if there
+// is no cache to start from.
+func (n *Node) startOffline(registerErr error) *state.PeerCache {
+	if n.stateDir == nil {
+		return nil
+	}
+
+	cache, err := n.stateDir.LoadPeers()
+	if err != nil {
+		log.Printf("Warning: failed to load cached peers: %v", err)
+		return nil
+	}
+	if cache == nil {
+		return nil
+	}
+
+	n.mu.Lock()
+	n.network = cache.Network
+	n.name = cache.Name
+	n.offlineSince = time.Now()
+	n.reconnectErr = registerErr
+	n.cachedPeersAt = cache.UpdatedAt
+	n.mu.Unlock()
+
+	n.event(EventOffline, "Control plane unreachable (%v), starting from %d peers cached %s",
+		registerErr, len(cache.Peers), cache.UpdatedAt.Local().Format(time.RFC3339))
+	return cache
+}
+
+// refreshPeers reapplies the peer map: fetched from the control plane, or
+// from the cache while offline
+func (n *Node) refreshPeers() error {
+	if !n.isOffline() {
+		return n.configurePeers()
+	}
+
+	cache, err := n.stateDir.LoadPeers()
+	if err != nil {
+		return err
+	}
+	if cache == nil {
+		cache = &state.PeerCache{}
+	}
+	return n.applyPeers(cache.Peers)
+}
+
+// isOffline reports whether the node runs from its cached peer map
+func (n *Node) isOffline() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return !n.offlineSince.IsZero()
+}
+
+// reconnect retries registration with backoff until the control plane
+// answers, then fetches fresh peers and starts heartbeats
+func (n *Node) reconnect() {
+	backoff := control.Backoff{Min: reconnectMinDelay, Max: reconnectMaxDelay}
+	for {
+		delay := backoff.Next()
+		select {
+		case <-n.ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+
+		if !n.isOffline() {
+			// A local API action got through first
+			return
+		}
+
+		err := n.tryReconnect()
+		if err == nil {
+			return
+		}
+
+		n.mu.Lock()
+		n.reconnectErr = err
+		n.mu.Unlock()
+		log.Printf("Control plane still unreachable, retrying in up to %s: %v", backoff.Max, err)
+	}
+}
+
+// tryReconnect makes one attempt to leave offline mode
+func (n *Node) tryReconnect() error {
+	n.actionMu.Lock()
+	defer n.actionMu.Unlock()
+
+	if n.ctx.Err() != nil {
+		return nil
+	}
+
+	if err := n.registerWithControlPlane(); err != nil {
+		return err
+	}
+	n.event(EventRegistered, "Registered with control plane")
+
+	if err := n.configurePeers(); err != nil {
+		return err
+	}
+	n.markOnline()
+	return nil
+}
+
+// markOnline leaves offline mode once the control plane answered and the
+// peer map is fresh, and starts heartbeats; callers hold n.actionMu
+func (n *Node) markOnline() {
+	n.mu.Lock()
+	offlineSince := n.offlineSince
+	n.offlineSince = time.Time{}
+	n.reconnectErr = nil
+	n.cachedPeersAt = time.Time{}
+	n.mu.Unlock()
+
+	if offlineSince.IsZero() {
+		return
+	}
+
+	n.startHeartbeat()
+	n.event(EventOnline, "Reconnected to control plane after %s offline", time.Since(offlineSince).Round(time.Second))
+}
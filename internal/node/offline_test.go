@@ -0,0 +1,163 @@
+package node
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/node/config"
+	"github.com/Vaibhav2154/ShadowNet/internal/node/state"
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/proto"
+)
+
+// newOfflineTestNode returns a node with a state directory whose control
+// plane answers heartbeats, counting them
+func newOfflineTestNode(t *testing.T) (*Node, *atomic.Int32) {
+	t.Helper()
+	var heartbeats atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		heartbeats.Add(1)
+		w.Write([]byte(`{"success": true}`))
+	}))
+	t.Cleanup(server.Close)
+
+	cfg := config.DefaultConfig()
+	cfg.ID = "node-1"
+	cfg.ControlPlaneURL = server.URL
+	cfg.VirtualIP = "10.0.0.1"
+	cfg.PrivateKeyPath = "unused"
+	cfg.HeartbeatInterval = time.Hour
+	n, err := NewNode(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		n.cancel()
+		if n.heartbeatSender != nil {
+			n.heartbeatSender.Stop()
+		}
+	})
+
+	if n.stateDir, err = state.Open(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { n.stateDir.Close() })
+	return n, &heartbeats
+}
+
+// countEvents returns how many events of the type the node recorded
+func countEvents(n *Node, eventType string) int {
+	count := 0
+	for _, event := range n.Events() {
+		if event.Type == eventType {
+			count++
+		}
+	}
+	return count
+}
+
+func TestStartOfflineWithoutCache(t *testing.T) {
+	n, _ := newOfflineTestNode(t)
+
+	if cache := n.startOffline(errors.New("connection refused")); cache != nil {
+		t.Fatal("started offline without a cached peer map")
+	}
+	if n.isOffline() {
+		t.Fatal("offline without a cached peer map")
+	}
+}
+
+func TestOfflineOnline(t *testing.T) {
+	n, heartbeats := newOfflineTestNode(t)
+	cachedAt := time.Now().Add(-time.Hour).Truncate(time.Second)
+	err := n.stateDir.SavePeers(&state.PeerCache{
+		UpdatedAt: cachedAt,
+		Network:   "office",
+		Name:      "laptop",
+		Peers:     []*proto.PeerInfo{{ID: "peer-2"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The control plane is unreachable: the node runs from its cache
+	cache := n.startOffline(errors.New("connection refused"))
+	if cache == nil || len(cache.Peers) != 1 {
+		t.Fatalf("started offline from %+v, want the cached peer map", cache)
+	}
+	if !n.isOffline() {
+		t.Fatal("not offline after starting from the cache")
+	}
+	n.mu.Lock()
+	network, name, status := n.network, n.name, n.controlPlaneStatus()
+	n.mu.Unlock()
+	if network != "office" || name != "laptop" {
+		t.Fatalf("offline in network %q as %q, want the cached ones", network, name)
+	}
+	if status.Connected || status.LastError != "connection refused" || status.CachedPeers != cachedAt.UTC().Format(time.RFC3339) {
+		t.Fatalf("control plane status %+v while offline", status)
+	}
+	if countEvents(n, EventOffline) != 1 {
+		t.Fatal("no offline event")
+	}
+
+	// It answered again: back online, with heartbeats
+	n.actionMu.Lock()
+	n.markOnline()
+	n.actionMu.Unlock()
+	if n.isOffline() {
+		t.Fatal("still offline after reconnecting")
+	}
+	if countEvents(n, EventOnline) != 1 {
+		t.Fatal("no online event")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		n.mu.Lock()
+		status = n.controlPlaneStatus()
+		n.mu.Unlock()
+		if status.Connected {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("control plane status %+v after reconnecting", status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if status.CachedPeers != "" {
+		t.Fatal("still reports cached peers after reconnecting")
+	}
+
+	// Marking an online node online again changes nothing
+	sender := n.heartbeatSender
+	n.actionMu.Lock()
+	n.markOnline()
+	n.actionMu.Unlock()
+	if n.heartbeatSender != sender || countEvents(n, EventOnline) != 1 || heartbeats.Load() != 1 {
+		t.Fatal("marking an online node online restarted heartbeats")
+	}
+}
+
+func TestReconnectStops(t *testing.T) {
+	n, heartbeats := newOfflineTestNode(t)
+	n.offlineSince = time.Now()
+
+	// Stopping the node ends the retries without another attempt
+	n.cancel()
+	done := make(chan struct{})
+	go func() {
+		n.reconnect()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("reconnect kept retrying after the node stopped")
+	}
+	if heartbeats.Load() != 0 || !n.isOffline() {
+		t.Fatal("reconnect contacted the control plane after the node stopped")
+	}
+}
@@ -0,0 +1,55 @@
+package node
+
+import (
+	"log"
+	"time"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/node/state"
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/proto"
+)
+
+// SetStateDir sets the state directory the node saves its identity and
+// peer cache in
+func (n *Node) SetStateDir(dir *state.Dir) {
+	n.stateDir = dir
+}
+
+// saveIdentity records the node's identity so a restart resumes it
+func (n *Node) saveIdentity() {
+	if n.stateDir == nil {
+		return
+	}
+
+	n.mu.Lock()
+	identity := &state.Identity{
+		ID:              n.cfg().ID,
+		VirtualIP:       n.cfg().VirtualIP,
+		VirtualIPv6:     n.cfg().VirtualIPv6,
+		ControlPlaneURL: n.cfg().ControlPlaneURL,
+	}
+	n.mu.Unlock()
+
+	if err := n.stateDir.SaveIdentity(identity); err != nil {
+		log.Printf("Warning: failed to save identity: %v", err)
+	}
+}
+
+// savePeers caches the peer map the control plane last sent
+func (n *Node) savePeers(peers []*proto.PeerInfo) {
+	if n.stateDir == nil {
+		return
+	}
+
+	n.mu.Lock()
+	cache := &state.PeerCache{
+		UpdatedAt: time.Now().UTC(),
+		Network:   n.network,
+		Name:      n.name,
+		Peers:     peers,
+	}
+	n.mu.Unlock()
+
+	if err := n.stateDir.SavePeers(cache); err != nil {
+		log.Printf("Warning: failed to cache peers: %v", err)
+	}
+}
@@ -0,0 +1,476 @@
+package node
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/node/gateway"
+	"github.com/Vaibhav2154/ShadowNet/internal/node/pq"
+	"github.com/Vaibhav2154/ShadowNet/internal/node/transport"
+	"github.com/Vaibhav2154/ShadowNet/internal/node/wireguard"
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/proto"
+)
+
+// Retransmission of key exchanges: the start message is resent after
+// pqResendDelay, doubling, until pqExchangeTimeout; a failed exchange is
+// retried after pqRetryDelay
+const (
+	pqResendDelay     = time.Second
+	pqExchangeTimeout = 30 * time.Second
+	pqRetryDelay      = 10 * time.Second
+	pqCheckInterval   = time.Second
+
+	// pqClockSkew is how far ahead of the local clock an exchange ID, the
+	// initiator's clock in nanoseconds, may be. A far-future ID would
+	// otherwise make every later exchange look stale.
+	pqClockSkew = 5 * time.Minute
+)
+
+// pqPeer is the post-quantum key exchange state with one peer
+type pqPeer struct {
+	// The key derived by the last exchange, when and by which exchange
+	key         *wireguard.PresharedKey
+	exchangedAt time.Time
+	exchangeID  uint64
+
+	// As initiator: the exchange in flight, when it started and was last
+	// sent, and when to try again after a failure
+	exchange  *pq.Exchange
+	startedAt time.Time
+	sentAt    time.Time
+	resends   int
+	retryAt   time.Time
+	err       string
+
+	// As responder: the answer to the last exchange, resent when the
+	// initiator retransmits
+	response *pq.Message
+}
+
+// setPQPeers records the peers of a peer map that run key exchanges and
+// those left out because their tunnels require it and they can't
+func (n *Node) setPQPeers(peers []*proto.PeerInfo) {
+	if !n.cfg().PostQuantum {
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.pqInfo = make(map[string]*proto.PeerInfo)
+	n.pqAddrs = make(map[string]string)
+	n.pqBlocked = nil
+	for _, peer := range peers {
+		switch {
+		case peer.HasFeature(proto.FeaturePQ):
+			n.pqInfo[peer.ID] = peer
+			n.pqAddrs[virtualIPFor(peer.ID)] = peer.ID
+		case n.pqRequired(peer):
+			n.pqBlocked = append(n.pqBlocked, peer.ID)
+		}
+	}
+	for peerID := range n.pqPeers {
+		if n.pqInfo[peerID] == nil {
+			delete(n.pqPeers, peerID)
+		}
+	}
+
+	if len(n.pqBlocked) > 0 {
+		log.Printf("Warning: leaving out peers without post-quantum support: %v", n.pqBlocked)
+	}
+}
+
+// pqRequired reports whether the tunnel with a peer requires post-quantum
+// protection, because either end has one of the required tags
+func (n *Node) pqRequired(peer *proto.PeerInfo) bool {
+	for _, tag := range n.cfg().PQRequireTags {
+		if slices.Contains(peer.Tags, tag) || slices.Contains(n.cfg().Tags, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// pqBlockedPeer reports whether a peer is left out for lack of
+// post-quantum support
+func (n *Node) pqBlockedPeer(peerID string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return slices.Contains(n.pqBlocked, peerID)
+}
+
+// pqRestricted reports whether the tunnel with a peer waits for a
+// post-quantum key: until then it only carries traffic to and from the
+// peer's virtual IPv4 address, which the exchange runs on. Callers hold
+// n.mu.
+func (n *Node) pqRestricted(peer *proto.PeerInfo) bool {
+	if !n.cfg().PostQuantum || !n.pqRequired(peer) {
+		return false
+	}
+	state := n.pqPeers[peer.ID]
+	return state == nil || state.key == nil
+}
+
+// pqWaiting reports whether the tunnel with a peer waits for its
+// post-quantum key, and the address the exchange runs on
+func (n *Node) pqWaiting(peer *proto.PeerInfo) (netip.Addr, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if !n.pqRestricted(peer) {
+		return netip.Addr{}, false
+	}
+	return netip.MustParseAddr(virtualIPFor(peer.ID)), true
+}
+
+// startPQFilter installs the filter that limits tunnels waiting for their
+// post-quantum key to the exchange, reporting whether it is in place.
+// Without it those tunnels are held back entirely. Callers hold actionMu.
+func (n *Node) startPQFilter() bool {
+	if n.pqFilter != nil {
+		return true
+	}
+	if n.ctx.Err() != nil {
+		return false
+	}
+	filter, err := gateway.NewPortFilter(pq.Port)
+	if err != nil {
+		log.Printf("Warning: holding back tunnels that wait for a post-quantum key, since they can't be limited to the exchange: %v", err)
+		return false
+	}
+	n.pqFilter = filter
+	return true
+}
+
+// tunnelPSK returns the preshared key for the tunnel with a peer: the
+// post-quantum one while it is valid, else the pair's, nil if none
+func (n *Node) tunnelPSK(peerID string) *wireguard.PresharedKey {
+	n.mu.Lock()
+	state := n.pqPeers[peerID]
+	n.mu.Unlock()
+	if state != nil && state.key != nil {
+		return state.key
+	}
+	return n.peerPSK(peerID)
+}
+
+// pqTunnelStats fills in the post-quantum state of a tunnel; callers hold
+// n.mu
+func (n *Node) pqTunnelStats(tunnel *proto.TunnelStats) {
+	peer := n.pqInfo[tunnel.PeerID]
+	if peer == nil {
+		return
+	}
+
+	tunnel.PQState = "pending"
+	tunnel.PQRequired = n.pqRequired(peer)
+	state := n.pqPeers[peer.ID]
+	if state == nil {
+		return
+	}
+	tunnel.PQError = state.err
+	if state.key != nil {
+		tunnel.PQState = "active"
+		tunnel.PQExchangedAt = state.exchangedAt.UTC().Format(time.RFC3339)
+	} else if state.err != "" {
+		tunnel.PQState = "failed"
+	}
+}
+
+// startPQ listens for key exchanges on the virtual IPv4 address and starts
+// the exchanges this node initiates. The socket is bound to the tunnel
+// device, so only packets WireGuard authenticated reach it.
+func (n *Node) startPQ() error {
+	if !n.cfg().PostQuantum {
+		return nil
+	}
+
+	lc := net.ListenConfig{Control: transport.DeviceControl(n.cfg().TUNDeviceName)}
+	addr := net.JoinHostPort(n.cfg().VirtualIP, strconv.Itoa(pq.Port))
+	conn, err := lc.ListenPacket(n.ctx, "udp4", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen for key exchanges: %w", err)
+	}
+	n.pqConn = conn.(*net.UDPConn)
+
+	go n.readPQ()
+	go n.runPQ()
+	log.Printf("Post-quantum key exchange listening on %s", conn.LocalAddr())
+	return nil
+}
+
+// stopPQ stops key exchanges and removes the filter
+func (n *Node) stopPQ() {
+	if n.pqConn != nil {
+		n.pqConn.Close()
+	}
+
+	n.actionMu.Lock()
+	defer n.actionMu.Unlock()
+	if n.pqFilter != nil {
+		n.pqFilter.Close()
+	}
+}
+
+// readPQ handles key exchange messages from peers. They can only arrive
+// through the tunnel, where WireGuard ties source addresses to peers, so
+// the source address identifies the peer.
+func (n *Node) readPQ() {
+	buf := make([]byte, 4096)
+	for {
+		size, from, err := n.pqConn.ReadFromUDP(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Printf("Key exchange read error: %v", err)
+			continue
+		}
+
+		n.mu.Lock()
+		peerID := n.pqAddrs[from.IP.String()]
+		n.mu.Unlock()
+		if peerID == "" {
+			continue
+		}
+
+		msg, err := pq.Parse(buf[:size])
+		if err != nil {
+			log.Printf("Warning: invalid key exchange message from peer %s: %v", peerID, err)
+			continue
+		}
+
+		switch msg.Type {
+		case pq.TypeInit:
+			err = n.respondPQ(peerID, msg)
+		case pq.TypeResponse:
+			err = n.finishPQ(peerID, msg)
+		}
+		if err != nil {
+			log.Printf("Warning: key exchange with peer %s failed: %v", peerID, err)
+		}
+	}
+}
+
+// respondPQ answers an exchange started by a peer with a lower ID and
+// installs the derived key
+func (n *Node) respondPQ(peerID string, msg *pq.Message) error {
+	n.mu.Lock()
+	peer := n.pqInfo[peerID]
+	if peer == nil || peerID >= n.cfg().ID {
+		n.mu.Unlock()
+		return fmt.Errorf("unexpected exchange start")
+	}
+	state := n.pqState(peerID)
+
+	// A retransmission of the exchange already answered
+	if state.response != nil && state.response.ID == msg.ID {
+		response := state.response
+		n.mu.Unlock()
+		return n.sendPQ(peerID, response)
+	}
+	if msg.ID <= state.exchangeID {
+		n.mu.Unlock()
+		return fmt.Errorf("stale exchange %d", msg.ID)
+	}
+	if msg.ID > uint64(time.Now().Add(pqClockSkew).UnixNano()) {
+		n.mu.Unlock()
+		return fmt.Errorf("exchange %d is more than %v ahead of the local clock", msg.ID, pqClockSkew)
+	}
+
+	response, key, err := pq.Respond(msg, pq.Context(peerID, n.cfg().ID))
+	if err != nil {
+		state.err = err.Error()
+		n.mu.Unlock()
+		return err
+	}
+	restricted := n.pqRestricted(peer)
+	state.setKey(key, msg.ID)
+	state.response = response
+	n.mu.Unlock()
+
+	// Answer first: the peer installs the key when the answer arrives
+	err = n.sendPQ(peerID, response)
+	n.installPQKey(peer, restricted)
+	return err
+}
+
+// finishPQ completes an exchange this node started and installs the
+// derived key
+func (n *Node) finishPQ(peerID string, msg *pq.Message) error {
+	n.mu.Lock()
+	peer := n.pqInfo[peerID]
+	state := n.pqPeers[peerID]
+	if peer == nil || state == nil || state.exchange == nil || state.exchange.ID() != msg.ID {
+		// A late answer to a resent or abandoned exchange
+		n.mu.Unlock()
+		return nil
+	}
+
+	key, err := state.exchange.Finish(msg, pq.Context(n.cfg().ID, peerID))
+	state.exchange = nil
+	if err != nil {
+		state.err = err.Error()
+		state.retryAt = time.Now().Add(pqRetryDelay)
+		n.mu.Unlock()
+		return err
+	}
+	restricted := n.pqRestricted(peer)
+	state.setKey(key, msg.ID)
+	n.mu.Unlock()
+
+	n.installPQKey(peer, restricted)
+	return nil
+}
+
+// setKey records a newly derived key
+func (s *pqPeer) setKey(key []byte, exchangeID uint64) {
+	var psk wireguard.PresharedKey
+	copy(psk[:], key)
+	s.key = &psk
+	s.exchangedAt = time.Now()
+	s.exchangeID = exchangeID
+	s.err = ""
+}
+
+// pqState returns the exchange state with a peer, creating it; callers
+// hold n.mu
+func (n *Node) pqState(peerID string) *pqPeer {
+	if n.pqPeers == nil {
+		n.pqPeers = make(map[string]*pqPeer)
+	}
+	state := n.pqPeers[peerID]
+	if state == nil {
+		state = &pqPeer{}
+		n.pqPeers[peerID] = state
+	}
+	return state
+}
+
+// installPQKey puts the tunnel's current preshared key in place. A tunnel
+// that was restricted, or becomes so, is reconfigured with the whole peer
+// map, since its allowed IPs change.
+func (n *Node) installPQKey(peer *proto.PeerInfo, wasRestricted bool) {
+	n.mu.Lock()
+	restricted := n.pqRestricted(peer)
+	n.mu.Unlock()
+
+	if restricted != wasRestricted {
+		n.actionMu.Lock()
+		defer n.actionMu.Unlock()
+
+		n.mu.Lock()
+		peers := n.appliedPeers
+		n.mu.Unlock()
+		if n.ctx.Err() != nil {
+			return
+		}
+		if err := n.applyPeers(peers); err != nil {
+			log.Printf("Warning: failed to reconfigure peer %s for its post-quantum key: %v", peer.ID, err)
+		}
+		return
+	}
+
+	publicKey, err := wireguard.ParsePublicKey(peer.PublicKeyAt(time.Now()))
+	if err != nil {
+		log.Printf("Warning: invalid public key of peer %s: %v", peer.ID, err)
+		return
+	}
+	if err := n.wgDevice.SetPresharedKey(publicKey, n.tunnelPSK(peer.ID)); err != nil {
+		log.Printf("Warning: failed to install post-quantum key for peer %s: %v", peer.ID, err)
+	}
+}
+
+// sendPQ sends a key exchange message to a peer's virtual IPv4 address
+func (n *Node) sendPQ(peerID string, msg *pq.Message) error {
+	addr := &net.UDPAddr{IP: net.ParseIP(virtualIPFor(peerID)), Port: pq.Port}
+	if _, err := n.pqConn.WriteToUDP(msg.Marshal(), addr); err != nil {
+		return fmt.Errorf("failed to send key exchange message: %w", err)
+	}
+	return nil
+}
+
+// runPQ starts, resends and times out the exchanges this node initiates
+// and drops expired keys
+func (n *Node) runPQ() {
+	ticker := time.NewTicker(pqCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-n.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		n.checkPQ()
+	}
+}
+
+// checkPQ runs one round of exchange housekeeping
+func (n *Node) checkPQ() {
+	type send struct {
+		peerID string
+		msg    *pq.Message
+	}
+	type expiry struct {
+		peer          *proto.PeerInfo
+		wasRestricted bool
+	}
+
+	now := time.Now()
+	var sends []send
+	var expired []expiry
+
+	n.mu.Lock()
+	for peerID, peer := range n.pqInfo {
+		state := n.pqState(peerID)
+
+		if state.key != nil && now.Sub(state.exchangedAt) >= pq.KeyLifetime {
+			expired = append(expired, expiry{peer, n.pqRestricted(peer)})
+			state.key = nil
+			state.err = "key expired"
+		}
+		if n.cfg().ID >= peerID {
+			continue
+		}
+
+		switch {
+		case state.exchange != nil && now.Sub(state.startedAt) >= pqExchangeTimeout:
+			state.exchange = nil
+			state.err = "no response from peer"
+			state.retryAt = now.Add(pqRetryDelay)
+		case state.exchange != nil:
+			if now.Sub(state.sentAt) >= pqResendDelay<<state.resends {
+				state.sentAt = now
+				state.resends++
+				sends = append(sends, send{peerID, state.exchange.Init()})
+			}
+		case (state.key == nil || now.Sub(state.exchangedAt) >= pq.RekeyInterval) && !now.Before(state.retryAt):
+			// Increasing IDs across restarts let the peer reject replays
+			exchange, err := pq.NewExchange(uint64(now.UnixNano()))
+			if err != nil {
+				state.err = err.Error()
+				state.retryAt = now.Add(pqRetryDelay)
+				continue
+			}
+			state.exchange, state.startedAt, state.sentAt, state.resends = exchange, now, now, 0
+			sends = append(sends, send{peerID, exchange.Init()})
+		}
+	}
+	n.mu.Unlock()
+
+	for _, e := range expired {
+		log.Printf("Warning: post-quantum key for peer %s expired", e.peer.ID)
+		n.installPQKey(e.peer, e.wasRestricted)
+	}
+	for _, s := range sends {
+		if err := n.sendPQ(s.peerID, s.msg); err != nil {
+			log.Printf("Warning: key exchange with peer %s failed: %v", s.peerID, err)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+// Package pq implements the post-quantum key exchange nodes run with their
+// peers over the overlay. An ML-KEM-768 exchange yields a shared secret a
+// quantum computer can't recover from recorded traffic; the WireGuard
+// preshared key derived from it makes the tunnel a hybrid of X25519 and
+// ML-KEM. The exchange travels inside the tunnel, so WireGuard
+// authenticates both sides and mixes their static keys into the session.
+package pq
+
+import (
+	"bytes"
+	"crypto/hkdf"
+	"crypto/mlkem"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Port is the UDP port nodes exchange keys on, at their virtual IPv4
+const Port = 51821
+
+// Timing of exchanges. The peer with the lower ID starts one every
+// RekeyInterval; a key is dropped once it is KeyLifetime old, so peers that
+// lost touch fall back to the key they had before.
+const (
+	RekeyInterval = 2 * time.Minute
+	KeyLifetime   = 5 * RekeyInterval
+)
+
+// KeyLength is the length of the derived preshared key
+const KeyLength = 32
+
+// Message types
+const (
+	TypeInit     byte = 1 // initiator's encapsulation key
+	TypeResponse byte = 2 // responder's ciphertext
+)
+
+// magic starts every message, followed by the version and type
+var magic = []byte("SNPQ")
+
+const (
+	version    byte = 1
+	headerSize      = 4 + 1 + 1 + 8
+)
+
+// Message is one message of an exchange. ID identifies the exchange; the
+// initiator picks increasing IDs, so old exchanges can't be replayed.
+type Message struct {
+	Type    byte
+	ID      uint64
+	Payload []byte
+}
+
+// Marshal encodes a message for sending
+func (m *Message) Marshal() []byte {
+	b := make([]byte, headerSize, headerSize+len(m.Payload))
+	copy(b, magic)
+	b[4] = version
+	b[5] = m.Type
+	binary.BigEndian.PutUint64(b[6:], m.ID)
+	return append(b, m.Payload...)
+}
+
+// Parse decodes a received message
+func Parse(b []byte) (*Message, error) {
+	if len(b) < headerSize || !bytes.Equal(b[:4], magic) {
+		return nil, fmt.Errorf("not a key exchange message")
+	}
+	if b[4] != version {
+		return nil, fmt.Errorf("unsupported key exchange version %d", b[4])
+	}
+
+	m := &Message{
+		Type:    b[5],
+		ID:      binary.BigEndian.Uint64(b[6:headerSize]),
+		Payload: b[headerSize:],
+	}
+	switch {
+	case m.Type == TypeInit && len(m.Payload) == mlkem.EncapsulationKeySize768:
+	case m.Type == TypeResponse && len(m.Payload) == mlkem.CiphertextSize768:
+	default:
+		return nil, fmt.Errorf("invalid key exchange message type %d of %d bytes", m.Type, len(m.Payload))
+	}
+	return m, nil
+}
+
+// Exchange is an exchange started by the initiator, waiting for the
+// response
+type Exchange struct {
+	id  uint64
+	key *mlkem.DecapsulationKey768
+}
+
+// NewExchange starts an exchange with a fresh ML-KEM key pair
+func NewExchange(id uint64) (*Exchange, error) {
+	key, err := mlkem.GenerateKey768()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate ML-KEM key: %w", err)
+	}
+	return &Exchange{id: id, key: key}, nil
+}
+
+// ID returns the exchange ID
+func (e *Exchange) ID() uint64 {
+	return e.id
+}
+
+// Init returns the message starting the exchange
+func (e *Exchange) Init() *Message {
+	return &Message{Type: TypeInit, ID: e.id, Payload: e.key.EncapsulationKey().Bytes()}
+}
+
+// Finish derives the preshared key from the responder's answer
+func (e *Exchange) Finish(resp *Message, context []byte) ([]byte, error) {
+	if resp.Type != TypeResponse || resp.ID != e.id {
+		return nil, fmt.Errorf("response does not match the exchange")
+	}
+
+	shared, err := e.key.Decapsulate(resp.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decapsulate: %w", err)
+	}
+	return deriveKey(shared, e.id, context)
+}
+
+// Respond answers an initiator's message, returning the response and the
+// preshared key
+func Respond(init *Message, context []byte) (*Message, []byte, error) {
+	if init.Type != TypeInit {
+		return nil, nil, fmt.Errorf("not an exchange start")
+	}
+
+	key, err := mlkem.NewEncapsulationKey768(init.Payload)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid encapsulation key: %w", err)
+	}
+	shared, ciphertext := key.Encapsulate()
+
+	psk, err := deriveKey(shared, init.ID, context)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &Message{Type: TypeResponse, ID: init.ID, Payload: ciphertext}, psk, nil
+}
+
+// Context binds derived keys to the pair of peers, initiator first. The
+// WireGuard keys are left out: the handshake mixes them in anyway, and
+// peers switching keys at slightly different times would derive different
+// preshared keys.
+func Context(initiatorID, responderID string) []byte {
+	return []byte(strings.Join([]string{"shadownet pq v1", initiatorID, responderID}, "\n"))
+}
+
+// deriveKey derives the preshared key from the ML-KEM shared secret
+func deriveKey(shared []byte, id uint64, context []byte) ([]byte, error) {
+	info := string(context) + "\n" + strconv.FormatUint(id, 10)
+	key, err := hkdf.Key(sha256.New, shared, nil, info, KeyLength)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive preshared key: %w", err)
+	}
+	return key, nil
+}
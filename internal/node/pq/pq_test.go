@@ -0,0 +1,136 @@
+package pq
+
+import (
+	"bytes"
+	"testing"
+)
+
+// roundTrip encodes and decodes a message as it would travel between peers
+func roundTrip(t *testing.T, m *Message) *Message {
+	t.Helper()
+	parsed, err := Parse(m.Marshal())
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	return parsed
+}
+
+// newExchange starts an exchange with the given ID
+func newExchange(t *testing.T, id uint64) *Exchange {
+	t.Helper()
+	e, err := NewExchange(id)
+	if err != nil {
+		t.Fatalf("NewExchange: %v", err)
+	}
+	return e
+}
+
+func TestExchange(t *testing.T) {
+	context := Context("peer-1", "peer-2")
+	e := newExchange(t, 42)
+
+	init := roundTrip(t, e.Init())
+	if init.Type != TypeInit || init.ID != 42 {
+		t.Fatalf("init message has type %d and ID %d", init.Type, init.ID)
+	}
+	resp, responderKey, err := Respond(init, context)
+	if err != nil {
+		t.Fatalf("Respond: %v", err)
+	}
+	initiatorKey, err := e.Finish(roundTrip(t, resp), context)
+	if err != nil {
+		t.Fatalf("Finish: %v", err)
+	}
+
+	if len(initiatorKey) != KeyLength {
+		t.Fatalf("derived a %d-byte key, want %d", len(initiatorKey), KeyLength)
+	}
+	if !bytes.Equal(initiatorKey, responderKey) {
+		t.Fatal("initiator and responder derived different keys")
+	}
+}
+
+func TestExchangeMismatchedContext(t *testing.T) {
+	e := newExchange(t, 1)
+	resp, responderKey, err := Respond(e.Init(), Context("peer-1", "peer-2"))
+	if err != nil {
+		t.Fatalf("Respond: %v", err)
+	}
+
+	for _, context := range [][]byte{Context("peer-2", "peer-1"), Context("peer-1", "peer-3")} {
+		initiatorKey, err := e.Finish(resp, context)
+		if err != nil {
+			t.Fatalf("Finish: %v", err)
+		}
+		if bytes.Equal(initiatorKey, responderKey) {
+			t.Fatalf("context %q derived the responder's key", context)
+		}
+	}
+}
+
+func TestExchangeStaleID(t *testing.T) {
+	context := Context("peer-1", "peer-2")
+	old := newExchange(t, 1)
+	current := newExchange(t, 2)
+
+	// A response to an earlier exchange is refused
+	resp, responderKey, err := Respond(old.Init(), context)
+	if err != nil {
+		t.Fatalf("Respond: %v", err)
+	}
+	if _, err := current.Finish(resp, context); err == nil {
+		t.Fatal("Finish accepted a response to another exchange")
+	}
+
+	// Relabeling it with the current ID decapsulates to an unrelated secret
+	resp.ID = current.ID()
+	if key, err := current.Finish(resp, context); err == nil && bytes.Equal(key, responderKey) {
+		t.Fatal("a relabeled response derived the responder's key")
+	}
+}
+
+func TestExchangeWrongType(t *testing.T) {
+	context := Context("peer-1", "peer-2")
+	e := newExchange(t, 1)
+
+	if _, err := e.Finish(e.Init(), context); err == nil {
+		t.Fatal("Finish accepted an init message")
+	}
+
+	resp, _, err := Respond(e.Init(), context)
+	if err != nil {
+		t.Fatalf("Respond: %v", err)
+	}
+	if _, _, err := Respond(resp, context); err == nil {
+		t.Fatal("Respond accepted a response message")
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	e := newExchange(t, 1)
+	valid := e.Init().Marshal()
+
+	edit := func(f func(b []byte) []byte) []byte {
+		return f(bytes.Clone(valid))
+	}
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"short header", valid[:headerSize-1]},
+		{"bad magic", edit(func(b []byte) []byte { b[0] = 'X'; return b })},
+		{"wrong version", edit(func(b []byte) []byte { b[4] = version + 1; return b })},
+		{"unknown type", edit(func(b []byte) []byte { b[5] = 3; return b })},
+		{"init as response", edit(func(b []byte) []byte { b[5] = TypeResponse; return b })},
+		{"truncated payload", valid[:len(valid)-1]},
+		{"trailing data", append(bytes.Clone(valid), 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(tt.data); err == nil {
+				t.Fatal("Parse accepted an invalid message")
+			}
+		})
+	}
+}
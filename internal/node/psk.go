@@ -0,0 +1,562 @@
+package node
+
+import (
+	"crypto/rand"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/node/wireguard"
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/crypto"
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/proto"
+)
+
+// pskCheckInterval is how often the node checks whether preshared keys are
+// due for replacement
+const pskCheckInterval = time.Minute
+
+// pairPSK is the preshared key of the tunnel with one peer: the one
+// installed and the next one, waiting for its activation time
+type pairPSK struct {
+	epoch int64
+	key   *wireguard.PresharedKey
+
+	nextEpoch  int64
+	next       *wireguard.PresharedKey
+	activateAt time.Time
+}
+
+// setPSKPeers records the peers of a peer map that take preshared keys
+// and forgets the keys of those that no longer do
+func (n *Node) setPSKPeers(peers []*proto.PeerInfo) {
+	if !n.cfg().PresharedKeys {
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.pskPeers = make(map[string]*proto.PeerInfo)
+	for _, peer := range peers {
+		if peer.HasFeature(proto.FeaturePSK) {
+			n.pskPeers[peer.ID] = peer
+		}
+	}
+	for peerID := range n.psks {
+		if n.pskPeers[peerID] == nil {
+			delete(n.psks, peerID)
+		}
+	}
+}
+
+// peerPSK returns the preshared key installed for a peer, nil if none
+func (n *Node) peerPSK(peerID string) *wireguard.PresharedKey {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if pair := n.psks[peerID]; pair != nil {
+		return pair.key
+	}
+	return nil
+}
+
+// pskEpoch returns the epoch of the preshared key installed for a peer, 0
+// if none; callers hold n.mu
+func (n *Node) pskEpoch(peerID string) int64 {
+	if pair := n.psks[peerID]; pair != nil && pair.key != nil {
+		return pair.epoch
+	}
+	return 0
+}
+
+// startPSKs installs the preshared keys of this node's pairs, from the
+// cached offers while offline, and keeps replacing them
+func (n *Node) startPSKs() {
+	if !n.cfg().PresharedKeys {
+		return
+	}
+
+	n.actionMu.Lock()
+	if n.isOffline() {
+		n.loadCachedPSKs()
+	} else if err := n.syncPSKs(); err != nil {
+		log.Printf("Warning: failed to sync preshared keys: %v", err)
+	}
+	n.actionMu.Unlock()
+
+	go n.rotatePSKs()
+}
+
+// loadCachedPSKs installs the keys of the cached offers; callers hold
+// actionMu
+func (n *Node) loadCachedPSKs() {
+	if n.stateDir == nil {
+		return
+	}
+
+	offers, err := n.stateDir.LoadPSKOffers()
+	if err != nil {
+		log.Printf("Warning: failed to load cached preshared keys: %v", err)
+		return
+	}
+	n.loadPSKOffers(offers)
+	n.activatePSKs()
+}
+
+// syncPSKs fetches the offers of this node's pairs, acknowledges those it
+// received, installs the keys that are due and makes new offers where
+// this node is the one to. Callers hold actionMu.
+func (n *Node) syncPSKs() error {
+	if !n.cfg().PresharedKeys || n.isOffline() {
+		return nil
+	}
+
+	resp, err := n.client().GetPSKOffers(n.ctx, n.cfg().ID)
+	if err != nil {
+		return err
+	}
+	if acks := n.receivedPSKOffers(resp.Offers); len(acks) > 0 {
+		req, err := n.provePSKAcks(acks)
+		if err != nil {
+			return err
+		}
+		if resp, err = n.client().AckPSKOffers(n.ctx, req); err != nil {
+			return err
+		}
+	}
+	n.loadPSKOffers(resp.Offers)
+
+	offers := n.newPSKOffers(resp.Offers)
+	if len(offers) > 0 {
+		req, err := n.provePSKOffers(offers)
+		if err != nil {
+			return err
+		}
+		if err := n.client().SendPSKOffers(n.ctx, req); err != nil {
+			return err
+		}
+		log.Printf("Offered new preshared keys to %d peers", len(offers))
+
+		// Learn when the new offers were made, so they aren't made again
+		if resp, err = n.client().GetPSKOffers(n.ctx, n.cfg().ID); err != nil {
+			return err
+		}
+	}
+
+	n.mu.Lock()
+	n.pskOffers = resp.Offers
+	n.pskRevision = resp.Revision
+	n.mu.Unlock()
+
+	if n.stateDir != nil {
+		if err := n.stateDir.SavePSKOffers(resp.Offers); err != nil {
+			log.Printf("Warning: failed to cache preshared keys: %v", err)
+		}
+	}
+
+	n.loadPSKOffers(resp.Offers)
+	n.activatePSKs()
+	return nil
+}
+
+// receivedPSKOffers returns acknowledgements of the offers made to this
+// node that aren't scheduled yet and that it can open; the others would
+// have the sender switch to a key this node doesn't have
+func (n *Node) receivedPSKOffers(offers []proto.PSKOffer) []proto.PSKAck {
+	now := time.Now()
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	var acks []proto.PSKAck
+	for i := range offers {
+		offer := &offers[i]
+		peer := n.pskPeers[offer.FromID]
+		if offer.ToID != n.cfg().ID || offer.ActivateAt != "" || peer == nil {
+			continue
+		}
+		if pair := n.psks[peer.ID]; pair != nil && (offer.Epoch <= pair.epoch || offer.Epoch <= pair.nextEpoch) {
+			continue
+		}
+		if _, err := n.openPSKOffer(offer, peer.PublicKeyAt(now)); err != nil {
+			log.Printf("Warning: not acknowledging preshared key from peer %s: %v", peer.ID, err)
+			continue
+		}
+		acks = append(acks, proto.PSKAck{FromID: offer.FromID, Epoch: offer.Epoch})
+	}
+	return acks
+}
+
+// loadPSKOffers opens the acknowledged offers newer than the keys in use and
+// keeps them for their activation time. Offers sealed between keys either
+// peer no longer uses are ignored; the peer with the lower ID replaces
+// them.
+func (n *Node) loadPSKOffers(offers []proto.PSKOffer) {
+	now := time.Now()
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.psks == nil {
+		n.psks = make(map[string]*pairPSK)
+	}
+	for i := range offers {
+		offer := &offers[i]
+		peer := n.pskPeers[offer.PeerID(n.cfg().ID)]
+		if peer == nil {
+			continue
+		}
+
+		pair := n.psks[peer.ID]
+		if pair == nil {
+			pair = &pairPSK{}
+			n.psks[peer.ID] = pair
+		}
+		if offer.Epoch <= pair.epoch || (pair.next != nil && offer.Epoch <= pair.nextEpoch) {
+			continue
+		}
+
+		activateAt, err := time.Parse(time.RFC3339, offer.ActivateAt)
+		if err != nil {
+			// Not acknowledged yet
+			continue
+		}
+
+		psk, err := n.openPSKOffer(offer, peer.PublicKeyAt(now))
+		if err != nil {
+			log.Printf("Warning: failed to open preshared key from peer %s: %v", peer.ID, err)
+			continue
+		}
+		pair.next, pair.nextEpoch, pair.activateAt = psk, offer.Epoch, activateAt
+	}
+}
+
+// openPSKOffer opens an offer sealed between this node's key and the
+// peer's; callers hold n.mu
+func (n *Node) openPSKOffer(offer *proto.PSKOffer, peerKey string) (*wireguard.PresharedKey, error) {
+	ownKey, otherKey := offer.FromKey, offer.ToKey
+	if offer.ToID == n.cfg().ID {
+		ownKey, otherKey = otherKey, ownKey
+	}
+	if ownKey != n.publicKey.String() || otherKey != peerKey {
+		return nil, fmt.Errorf("sealed between keys no longer in use")
+	}
+
+	publicKey, err := crypto.DecodeKey(peerKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	context := crypto.PSKContext(offer.FromID, offer.ToID, offer.Epoch, offer.FromKey, offer.ToKey)
+	raw, err := crypto.OpenPSK(n.privateKey[:], publicKey, context, offer.SealedPSK)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) != wireguard.KeyLength {
+		return nil, fmt.Errorf("invalid preshared key length %d", len(raw))
+	}
+
+	var psk wireguard.PresharedKey
+	copy(psk[:], raw)
+	return &psk, nil
+}
+
+// activatePSKs installs the keys whose activation time has passed and
+// schedules the next one. Callers hold actionMu.
+func (n *Node) activatePSKs() {
+	type install struct {
+		peer  *proto.PeerInfo
+		epoch int64
+	}
+
+	now := time.Now()
+	var installs []install
+	var next time.Time
+
+	n.mu.Lock()
+	for peerID, pair := range n.psks {
+		if pair.next == nil {
+			continue
+		}
+		if pair.activateAt.After(now) {
+			if next.IsZero() || pair.activateAt.Before(next) {
+				next = pair.activateAt
+			}
+			continue
+		}
+
+		pair.key, pair.epoch = pair.next, pair.nextEpoch
+		pair.next, pair.nextEpoch, pair.activateAt = nil, 0, time.Time{}
+		installs = append(installs, install{peer: n.pskPeers[peerID], epoch: pair.epoch})
+	}
+	n.schedulePSKActivation(next)
+	n.mu.Unlock()
+
+	for _, i := range installs {
+		publicKey, err := wireguard.ParsePublicKey(i.peer.PublicKeyAt(now))
+		if err != nil {
+			log.Printf("Warning: invalid public key of peer %s: %v", i.peer.ID, err)
+			continue
+		}
+		// A post-quantum key in use takes precedence
+		if err := n.wgDevice.SetPresharedKey(publicKey, n.tunnelPSK(i.peer.ID)); err != nil {
+			// The next peer map applied carries the key
+			log.Printf("Warning: failed to install preshared key for peer %s: %v", i.peer.ID, err)
+			continue
+		}
+		log.Printf("Installed preshared key epoch %d for peer %s", i.epoch, i.peer.ID)
+	}
+}
+
+// schedulePSKActivation runs activatePSKs at the given time, replacing the
+// previous schedule; a zero time cancels it. Callers hold n.mu.
+func (n *Node) schedulePSKActivation(at time.Time) {
+	if n.pskTimer != nil {
+		n.pskTimer.Stop()
+		n.pskTimer = nil
+	}
+	if at.IsZero() {
+		return
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(time.Until(at), func() {
+		n.actionMu.Lock()
+		defer n.actionMu.Unlock()
+
+		n.mu.Lock()
+		current := n.pskTimer == timer
+		n.mu.Unlock()
+		if !current || n.ctx.Err() != nil {
+			return
+		}
+
+		n.activatePSKs()
+	})
+	n.pskTimer = timer
+}
+
+// newPSKOffers makes new offers to the peers with a higher ID whose key is
+// missing, sealed between keys no longer in use or older than the rotation
+// interval. Nothing is offered while either side of a pair is rotating its
+// key, since the offer would go stale at the switch.
+func (n *Node) newPSKOffers(current []proto.PSKOffer) []proto.PSKOffer {
+	now := time.Now()
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.nextKey != nil {
+		return nil
+	}
+
+	var offers []proto.PSKOffer
+	for peerID, peer := range n.pskPeers {
+		if !n.pskOfferDue(peer, current, now) {
+			continue
+		}
+
+		epoch := int64(1)
+		if last := findPSKOffer(current, n.cfg().ID, peerID); last != nil {
+			epoch = last.Epoch + 1
+		}
+		if pair := n.psks[peerID]; pair != nil {
+			epoch = max(epoch, pair.epoch+1, pair.nextEpoch+1)
+		}
+
+		offer, err := n.sealPSKOffer(peer, epoch)
+		if err != nil {
+			log.Printf("Warning: failed to make preshared key offer to peer %s: %v", peerID, err)
+			continue
+		}
+		offers = append(offers, *offer)
+	}
+	return offers
+}
+
+// pskOfferDue reports whether this node should make a new offer to a peer;
+// callers hold n.mu
+func (n *Node) pskOfferDue(peer *proto.PeerInfo, current []proto.PSKOffer, now time.Time) bool {
+	if n.cfg().ID >= peer.ID || peer.NextWGPublicKey != "" {
+		return false
+	}
+
+	last := findPSKOffer(current, n.cfg().ID, peer.ID)
+	if last == nil || last.FromKey != n.publicKey.String() || last.ToKey != peer.WGPublicKey {
+		return true
+	}
+
+	// An offer isn't replaced before its key is in use: until the peer
+	// acknowledged it, the new one would wait all the same, and after that the
+	// peers might install different keys
+	activateAt, err := time.Parse(time.RFC3339, last.ActivateAt)
+	if err != nil || activateAt.After(now) {
+		return false
+	}
+	createdAt, err := time.Parse(time.RFC3339, last.CreatedAt)
+	return err != nil || now.Sub(createdAt) >= n.cfg().PSKRotationInterval
+}
+
+// sealPSKOffer generates a preshared key for a peer and seals it between
+// both peers' keys; callers hold n.mu
+func (n *Node) sealPSKOffer(peer *proto.PeerInfo, epoch int64) (*proto.PSKOffer, error) {
+	publicKey, err := crypto.DecodeKey(peer.WGPublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+
+	var psk wireguard.PresharedKey
+	if _, err := rand.Read(psk[:]); err != nil {
+		return nil, fmt.Errorf("failed to generate preshared key: %w", err)
+	}
+
+	offer := &proto.PSKOffer{
+		FromID:  n.cfg().ID,
+		ToID:    peer.ID,
+		Epoch:   epoch,
+		FromKey: n.publicKey.String(),
+		ToKey:   peer.WGPublicKey,
+	}
+	context := crypto.PSKContext(offer.FromID, offer.ToID, offer.Epoch, offer.FromKey, offer.ToKey)
+	if offer.SealedPSK, err = crypto.SealPSK(n.privateKey[:], publicKey, context, psk[:]); err != nil {
+		return nil, err
+	}
+	return offer, nil
+}
+
+// provePSKOffers wraps offers in a request with a proof, against a new key
+// challenge, that they come from this node's key. Callers hold actionMu, so
+// the key offers were sealed with stays in use.
+func (n *Node) provePSKOffers(offers []proto.PSKOffer) (*proto.PSKOffersRequest, error) {
+	contexts := make([][]byte, len(offers))
+	sealed := make([][]byte, len(offers))
+	for i, offer := range offers {
+		contexts[i] = crypto.PSKContext(offer.FromID, offer.ToID, offer.Epoch, offer.FromKey, offer.ToKey)
+		sealed[i] = offer.SealedPSK
+	}
+
+	req := &proto.PSKOffersRequest{ID: n.cfg().ID, Offers: offers}
+	var err error
+	req.ChallengeID, req.Proof, err = n.proveKey(func(challengeID string) []byte {
+		return crypto.PSKOffersTranscript(req.ID, challengeID, contexts, sealed)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// provePSKAcks wraps acknowledgements in a request with a proof, against a
+// new key challenge, that they come from this node's key. Callers hold
+// actionMu.
+func (n *Node) provePSKAcks(acks []proto.PSKAck) (*proto.PSKAcksRequest, error) {
+	fromIDs := make([]string, len(acks))
+	epochs := make([]int64, len(acks))
+	for i, ack := range acks {
+		fromIDs[i], epochs[i] = ack.FromID, ack.Epoch
+	}
+
+	req := &proto.PSKAcksRequest{ID: n.cfg().ID, Acks: acks}
+	var err error
+	req.ChallengeID, req.Proof, err = n.proveKey(func(challengeID string) []byte {
+		return crypto.PSKAcksTranscript(req.ID, challengeID, fromIDs, epochs)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// proveKey proves possession of this node's private key over the
+// transcript built for a new key challenge, returning the challenge ID and
+// the proof
+func (n *Node) proveKey(transcript func(challengeID string) []byte) (string, []byte, error) {
+	challenge, err := n.client().KeyChallenge(n.ctx, n.cfg().ID)
+	if err != nil {
+		return "", nil, err
+	}
+	challengeKey, err := crypto.DecodeKey(challenge.PublicKey)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid challenge key: %w", err)
+	}
+
+	n.mu.Lock()
+	privateKey := n.privateKey
+	n.mu.Unlock()
+	proof, err := crypto.KeyProof(privateKey[:], challengeKey, transcript(challenge.ChallengeID))
+	if err != nil {
+		return "", nil, err
+	}
+	return challenge.ChallengeID, proof, nil
+}
+
+// findPSKOffer returns the offer from one peer to another, nil if none
+func findPSKOffer(offers []proto.PSKOffer, fromID, toID string) *proto.PSKOffer {
+	for i := range offers {
+		if offers[i].FromID == fromID && offers[i].ToID == toID {
+			return &offers[i]
+		}
+	}
+	return nil
+}
+
+// rotatePSKs makes new offers whenever one is due: for new peers, peers
+// that rotated their keys and keys older than the rotation interval
+func (n *Node) rotatePSKs() {
+	ticker := time.NewTicker(pskCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-n.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if !n.pskOffersDue() {
+			continue
+		}
+
+		n.actionMu.Lock()
+		err := n.syncPSKs()
+		n.actionMu.Unlock()
+		if err != nil {
+			log.Printf("Warning: failed to rotate preshared keys: %v", err)
+		}
+	}
+}
+
+// pskOffersDue reports whether any new offer is due, going by the offers
+// last fetched
+func (n *Node) pskOffersDue() bool {
+	now := time.Now()
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.nextKey != nil {
+		return false
+	}
+	for _, peer := range n.pskPeers {
+		if n.pskOfferDue(peer, n.pskOffers, now) {
+			return true
+		}
+	}
+	return false
+}
+
+// pskRevisionChanged syncs preshared keys when a heartbeat reports new
+// offers to or from this node
+func (n *Node) pskRevisionChanged(revision int64) {
+	n.mu.Lock()
+	changed := revision != n.pskRevision
+	n.mu.Unlock()
+	if !changed {
+		return
+	}
+
+	n.actionMu.Lock()
+	defer n.actionMu.Unlock()
+	if err := n.syncPSKs(); err != nil {
+		log.Printf("Warning: failed to sync preshared keys: %v", err)
+	}
+}
@@ -0,0 +1,133 @@
+package node
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/node/netmon"
+	"github.com/Vaibhav2154/ShadowNet/internal/node/stun"
+	"github.com/Vaibhav2154/ShadowNet/internal/node/transport"
+)
+
+// startRoaming keeps the registered endpoint current when the node moves
+// between networks or its NAT mapping changes: network changes trigger a
+// full rediscovery and the reflexive address is checked periodically
+func (n *Node) startRoaming() {
+	changes := make(chan struct{}, 1)
+	err := netmon.Watch(n.ctx, n.cfg().TUNDeviceName, func() {
+		select {
+		case changes <- struct{}{}:
+		default:
+		}
+	})
+	switch {
+	case errors.Is(err, netmon.ErrUnsupported):
+		log.Printf("Network change notifications unavailable, checking the endpoint every %s", n.cfg().EndpointCheckInterval)
+	case err != nil:
+		log.Printf("Warning: not watching for network changes: %v", err)
+	}
+
+	go n.roam(changes)
+}
+
+// roam rechecks the endpoint on network changes and periodically
+func (n *Node) roam(changes <-chan struct{}) {
+	var tick <-chan time.Time
+	if n.cfg().EndpointCheckInterval > 0 {
+		ticker := time.NewTicker(n.cfg().EndpointCheckInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-n.ctx.Done():
+			return
+		case <-changes:
+			n.event(EventEndpoint, "Network changed, rediscovering endpoint")
+			n.actionMu.Lock()
+			if err := n.restun(); err != nil {
+				log.Printf("Warning: endpoint rediscovery failed: %v", err)
+			}
+			n.actionMu.Unlock()
+		case <-tick:
+			n.checkEndpoint()
+		}
+	}
+}
+
+// checkEndpoint asks the STUN servers for the reflexive address and runs a
+// full rediscovery, re-registering, if the NAT mapping changed
+func (n *Node) checkEndpoint() {
+	n.actionMu.Lock()
+	defer n.actionMu.Unlock()
+
+	if n.ctx.Err() != nil {
+		return
+	}
+
+	conn, release, err := n.stunConn()
+	if err != nil {
+		log.Printf("Warning: endpoint check failed: %v", err)
+		return
+	}
+	consensus, err := n.queryEndpoint(conn, "")
+	release()
+	if err != nil {
+		log.Printf("Warning: endpoint check failed: %v", err)
+		return
+	}
+
+	// Behind a symmetric NAT every server sees a different port, so only
+	// a new address counts
+	n.mu.Lock()
+	moved := consensus.IP != n.publicIP || (consensus.Port != n.publicPort && !consensus.Inconsistent)
+	n.mu.Unlock()
+	if !moved {
+		return
+	}
+
+	n.event(EventEndpoint, "NAT mapping changed to %s:%d, rediscovering endpoint", consensus.IP, consensus.Port)
+	if err := n.restun(); err != nil {
+		log.Printf("Warning: endpoint rediscovery failed: %v", err)
+	}
+}
+
+// stunConn returns the socket to run STUN on and a func that releases it.
+// With the userspace backend it is the WireGuard socket. The kernel backend
+// owns its port, so a new socket is used, marked to bypass an exit node;
+// only the address it maps to tells something about the WireGuard port.
+func (n *Node) stunConn() (net.PacketConn, func(), error) {
+	if n.bind != nil {
+		return n.bind.STUNConn(), func() {}, nil
+	}
+
+	lc := net.ListenConfig{Control: transport.MarkControl(transport.FirewallMark)}
+	conn, err := lc.ListenPacket(n.ctx, "udp", ":0")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create UDP socket: %w", err)
+	}
+	return conn, func() { conn.Close() }, nil
+}
+
+// queryEndpoint asks the STUN servers for conn's mapping over network ("" for
+// IPv4). Without the shared socket the mapped port is the probe socket's, so
+// the WireGuard port is reported instead, which holds for public addresses
+// and port-preserving NATs.
+func (n *Node) queryEndpoint(conn net.PacketConn, network string) (*stun.Consensus, error) {
+	consensus, err := stun.DiscoverEndpoints(conn, n.stunServers(), stun.QueryOptions{
+		Timeout: n.cfg().STUNTimeout,
+		Retries: n.cfg().STUNRetries,
+		Network: network,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if n.bind == nil {
+		consensus.Port = n.cfg().ListenPort
+	}
+	return consensus, nil
+}
@@ -0,0 +1,248 @@
+package node
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/node/control"
+	"github.com/Vaibhav2154/ShadowNet/internal/node/wireguard"
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/crypto"
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/proto"
+)
+
+// keySwitchRetryDelay is how long to wait before retrying a failed switch
+// to the new key
+const keySwitchRetryDelay = 10 * time.Second
+
+// rotateKey starts a key rotation through the control plane: it proves
+// possession of the current and a new key, and the control plane sets when
+// this node and all its peers switch to the new key. The new key is saved
+// right away so that a node restarting before the switch comes back with
+// it, which completes the rotation early. Callers hold actionMu.
+func (n *Node) rotateKey() error {
+	if n.isOffline() {
+		return fmt.Errorf("keys can only be rotated while the control plane is reachable")
+	}
+
+	n.mu.Lock()
+	pending := n.nextKey != nil
+	oldKey := n.privateKey
+	n.mu.Unlock()
+	if pending {
+		return fmt.Errorf("a key rotation is already in progress")
+	}
+
+	newKey, err := wireguard.GeneratePrivateKey()
+	if err != nil {
+		return err
+	}
+
+	challenge, err := n.client().KeyChallenge(n.ctx, n.cfg().ID)
+	if err != nil {
+		return err
+	}
+	challengeKey, err := crypto.DecodeKey(challenge.PublicKey)
+	if err != nil {
+		return fmt.Errorf("invalid challenge key: %w", err)
+	}
+
+	req := &proto.KeyRotationRequest{
+		ID:           n.cfg().ID,
+		ChallengeID:  challenge.ChallengeID,
+		OldPublicKey: oldKey.PublicKey().String(),
+		NewPublicKey: newKey.PublicKey().String(),
+	}
+	transcript := crypto.RotationTranscript(req.ID, req.ChallengeID, req.OldPublicKey, req.NewPublicKey)
+	if req.OldProof, err = crypto.KeyProof(oldKey[:], challengeKey, transcript); err != nil {
+		return err
+	}
+	if req.NewProof, err = crypto.KeyProof(newKey[:], challengeKey, transcript); err != nil {
+		return err
+	}
+
+	if err := n.cfg().KeyFile().Save(newKey); err != nil {
+		return fmt.Errorf("failed to save key: %w", err)
+	}
+
+	switchAt, err := n.requestRotation(req)
+	if err != nil {
+		// Keep the key file in agreement with the control plane
+		if restoreErr := n.cfg().KeyFile().Save(oldKey); restoreErr != nil {
+			n.event(EventError, "Failed to restore previous key after failed rotation: %v", restoreErr)
+		}
+		return err
+	}
+
+	n.mu.Lock()
+	n.nextKey = newKey
+	n.keySwitchAt = switchAt
+	n.keySwitchTimer = time.AfterFunc(time.Until(switchAt), n.switchKey)
+	n.mu.Unlock()
+
+	n.event(EventKey, "Rotating WireGuard key (new public: %s...), switching at %s", req.NewPublicKey[:16], switchAt.Format(time.RFC3339))
+	return nil
+}
+
+// requestRotation asks the control plane to schedule a rotation and
+// returns the switch time. When the answer is lost, the control plane's
+// peer map tells whether the rotation was scheduled anyway.
+func (n *Node) requestRotation(req *proto.KeyRotationRequest) (time.Time, error) {
+	resp, err := n.client().RotateKey(n.ctx, req)
+	if err == nil {
+		return time.Parse(time.RFC3339, resp.SwitchAt)
+	}
+
+	peers, peersErr := n.client().GetPeers(n.ctx, "")
+	if peersErr != nil {
+		return time.Time{}, err
+	}
+	for _, peer := range peers {
+		if peer.ID == n.cfg().ID && peer.NextWGPublicKey == req.NewPublicKey {
+			if switchAt, parseErr := time.Parse(time.RFC3339, peer.KeySwitchAt); parseErr == nil {
+				return switchAt, nil
+			}
+		}
+	}
+	return time.Time{}, err
+}
+
+// switchKey switches WireGuard to the new key of a rotation at the time
+// the control plane set for it
+func (n *Node) switchKey() {
+	n.actionMu.Lock()
+	defer n.actionMu.Unlock()
+
+	if n.ctx.Err() != nil {
+		return
+	}
+
+	n.mu.Lock()
+	newKey := n.nextKey
+	n.mu.Unlock()
+	if newKey == nil {
+		return
+	}
+
+	if err := n.wgDevice.SetPrivateKey(newKey); err != nil {
+		n.event(EventError, "Failed to switch to the new WireGuard key, retrying in %s: %v", keySwitchRetryDelay, err)
+		n.mu.Lock()
+		n.keySwitchTimer.Reset(keySwitchRetryDelay)
+		n.mu.Unlock()
+		return
+	}
+
+	n.mu.Lock()
+	n.privateKey = newKey
+	n.publicKey = newKey.PublicKey()
+	n.nextKey = nil
+	n.keySwitchAt = time.Time{}
+	n.keySwitchTimer = nil
+	publicKey := n.publicKey.String()
+	n.mu.Unlock()
+
+	n.event(EventKey, "Switched to the new WireGuard key (public: %s...)", publicKey[:16])
+}
+
+// schedulePeerKeySwitch reapplies the peer map when the next peer in it
+// switches to its rotated key, so the tunnel to it is down for at most a
+// handshake. A newer peer map replaces the schedule.
+func (n *Node) schedulePeerKeySwitch(peers []*proto.PeerInfo) {
+	now := time.Now()
+	var next time.Time
+	for _, peer := range peers {
+		if peer.NextWGPublicKey == "" {
+			continue
+		}
+		switchAt, err := time.Parse(time.RFC3339, peer.KeySwitchAt)
+		if err != nil || !switchAt.After(now) {
+			continue
+		}
+		if next.IsZero() || switchAt.Before(next) {
+			next = switchAt
+		}
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.peerKeyTimer != nil {
+		n.peerKeyTimer.Stop()
+		n.peerKeyTimer = nil
+	}
+	if next.IsZero() {
+		return
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(time.Until(next), func() {
+		n.actionMu.Lock()
+		defer n.actionMu.Unlock()
+
+		n.mu.Lock()
+		current := n.peerKeyTimer == timer
+		n.mu.Unlock()
+		if !current || n.ctx.Err() != nil {
+			return
+		}
+
+		if err := n.applyPeers(peers); err != nil {
+			log.Printf("Warning: failed to switch peers to their new keys: %v", err)
+		}
+	})
+	n.peerKeyTimer = timer
+}
+
+// startKeyRotation rotates the key whenever it gets older than the key
+// rotation interval
+func (n *Node) startKeyRotation() {
+	if n.cfg().KeyRotationInterval <= 0 {
+		return
+	}
+	go n.rotateKeys()
+}
+
+// rotateKeys runs scheduled key rotations, retrying failed ones with
+// backoff
+func (n *Node) rotateKeys() {
+	backoff := control.Backoff{Min: time.Minute, Max: time.Hour}
+	delay := n.keyRotationDelay()
+	retrying := false
+	for {
+		select {
+		case <-n.ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+
+		// The key may have been rotated on demand in the meantime
+		if !retrying {
+			if delay = n.keyRotationDelay(); delay > 0 {
+				continue
+			}
+		}
+
+		n.actionMu.Lock()
+		err := n.rotateKey()
+		n.actionMu.Unlock()
+		if err != nil {
+			delay, retrying = backoff.Next(), true
+			log.Printf("Warning: scheduled key rotation failed, retrying in %s: %v", delay, err)
+			continue
+		}
+
+		backoff.Reset()
+		delay, retrying = n.keyRotationDelay(), false
+	}
+}
+
+// keyRotationDelay returns how long until the key is due for rotation,
+// going by when the key file was last written
+func (n *Node) keyRotationDelay() time.Duration {
+	info, err := os.Stat(n.cfg().PrivateKeyPath)
+	if err != nil {
+		return n.cfg().KeyRotationInterval
+	}
+	return max(time.Until(info.ModTime().Add(n.cfg().KeyRotationInterval)), 0)
+}
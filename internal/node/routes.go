@@ -0,0 +1,243 @@
+package node
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/netip"
+	"slices"
+	"sort"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/node/gateway"
+	"github.com/Vaibhav2154/ShadowNet/internal/node/transport"
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/proto"
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/utils"
+)
+
+// startRouting creates the router for peers' subnet routes and exit node
+// and, when this node advertises routes or is an exit node, forwards
+// overlay traffic. WireGuard's own packets are marked so they keep using
+// the physical network under an exit node's default route.
+func (n *Node) startRouting() error {
+	if err := n.wgDevice.SetFirewallMark(transport.FirewallMark); err != nil {
+		log.Printf("Warning: failed to mark WireGuard traffic, exit nodes won't work: %v", err)
+	}
+
+	router, err := transport.NewRouter(transport.RouterConfig{
+		Interface: n.cfg().TUNDeviceName,
+		Table:     n.cfg().RouteTable,
+		Metric:    n.cfg().RouteMetric,
+		Include:   n.cfg().SplitInclude,
+		Exclude:   n.cfg().SplitExclude,
+	})
+	if err != nil {
+		return err
+	}
+	if err := router.Start(); err != nil {
+		if !errors.Is(err, transport.ErrPolicyRoutingUnsupported) {
+			return err
+		}
+		log.Printf("Warning: %v; subnet routes and exit nodes are disabled", err)
+	} else {
+		n.router = router
+	}
+
+	if len(n.cfg().AdvertiseRoutes) == 0 && !n.cfg().AdvertiseExitNode {
+		return nil
+	}
+
+	overlays, err := n.overlayPrefixes()
+	if err != nil {
+		return err
+	}
+
+	routes := make([]netip.Prefix, 0, len(n.cfg().AdvertiseRoutes))
+	for _, route := range n.cfg().AdvertiseRoutes {
+		prefix, err := netip.ParsePrefix(route)
+		if err != nil {
+			return fmt.Errorf("invalid advertised route %q: %w", route, err)
+		}
+		routes = append(routes, prefix)
+	}
+
+	gw, err := gateway.Enable(gateway.Config{
+		Interface: n.cfg().TUNDeviceName,
+		Overlays:  overlays,
+		Routes:    routes,
+		SNAT:      n.cfg().SNATRoutes,
+		ExitNode:  n.cfg().AdvertiseExitNode,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to enable forwarding: %w", err)
+	}
+	n.gateway = gw
+	log.Printf("Forwarding overlay traffic to %v (SNAT: %t, exit node: %t)",
+		n.cfg().AdvertiseRoutes, n.cfg().SNATRoutes, n.cfg().AdvertiseExitNode)
+	return nil
+}
+
+// advertisedRoutes returns the routes to register: the subnet routes plus
+// the default routes for exit nodes, ::/0 only when IPv6 is forwarded
+func (n *Node) advertisedRoutes() []string {
+	routes := append([]string{}, n.cfg().AdvertiseRoutes...)
+	if n.cfg().AdvertiseExitNode {
+		routes = append(routes, utils.ExitRouteV4)
+		if n.gateway != nil && n.gateway.ExitIPv6() {
+			routes = append(routes, utils.ExitRouteV6)
+		}
+	}
+	return routes
+}
+
+// stopRouting removes peers' subnet routes and the forwarding setup
+func (n *Node) stopRouting() {
+	if n.router != nil {
+		if err := n.router.Stop(); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}
+
+	if n.gateway != nil {
+		if err := n.gateway.Close(); err != nil {
+			log.Printf("Warning: failed to disable forwarding: %v", err)
+		}
+		n.gateway = nil
+	}
+}
+
+// peerRoutes assigns the approved subnet routes to peers. WireGuard allowed
+// IPs can't overlap, so a route served by several peers goes to the lowest
+// peer ID. Routes this node advertises itself or that overlap the overlay
+// are skipped. Default routes are only assigned to the chosen exit node.
+func (n *Node) peerRoutes(peers []*proto.PeerInfo) map[string][]string {
+	overlays, _ := n.overlayPrefixes()
+
+	n.mu.Lock()
+	exitNode := n.cfg().ExitNode
+	n.mu.Unlock()
+
+	var local []netip.Prefix
+	for _, route := range n.cfg().AdvertiseRoutes {
+		if prefix, err := netip.ParsePrefix(route); err == nil {
+			local = append(local, prefix)
+		}
+	}
+
+	sorted := make([]*proto.PeerInfo, len(peers))
+	copy(sorted, peers)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+
+	owners := make(map[string]string)
+	assigned := make(map[string][]string)
+	var exitNodes []string
+	exitPeer := ""
+	exitName := ""
+	for _, peer := range sorted {
+		for _, route := range peer.EnabledRoutes() {
+			if utils.IsExitRoute(route) {
+				// ::/0 goes along with 0.0.0.0/0 from the same peer
+				if route != utils.ExitRouteV4 {
+					continue
+				}
+				name := nameOrID(peer.Name, peer.ID)
+				exitNodes = append(exitNodes, name)
+				if exitNode != "" && exitPeer == "" && (peer.ID == exitNode || peer.Name == exitNode) {
+					exitPeer = peer.ID
+					exitName = name
+					assigned[peer.ID] = append(assigned[peer.ID], route)
+					if slices.Contains(peer.EnabledRoutes(), utils.ExitRouteV6) {
+						assigned[peer.ID] = append(assigned[peer.ID], utils.ExitRouteV6)
+					} else {
+						log.Printf("Warning: exit node %s doesn't forward IPv6; IPv6 internet traffic is blocked while it is in use", name)
+					}
+				}
+				continue
+			}
+
+			prefix, err := netip.ParsePrefix(route)
+			if err != nil {
+				log.Printf("Warning: peer %s has invalid route %q", peer.ID, route)
+				continue
+			}
+			if overlapsAny(prefix, overlays) {
+				log.Printf("Warning: ignoring route %s of peer %s, it overlaps the overlay", route, peer.ID)
+				continue
+			}
+			if overlapsAny(prefix, local) {
+				log.Printf("Warning: ignoring route %s of peer %s, this node advertises it", route, peer.ID)
+				continue
+			}
+			if owner, taken := owners[route]; taken {
+				log.Printf("Warning: route %s is served by peers %s and %s, using %s", route, owner, peer.ID, owner)
+				continue
+			}
+
+			owners[route] = peer.ID
+			assigned[peer.ID] = append(assigned[peer.ID], route)
+		}
+	}
+
+	if exitNode != "" && exitPeer == "" {
+		log.Printf("Warning: exit node %s is not available (available: %v); internet traffic uses the physical network", exitNode, exitNodes)
+	}
+
+	n.mu.Lock()
+	n.exitNode = exitName
+	n.exitNodes = exitNodes
+	n.mu.Unlock()
+
+	return assigned
+}
+
+// syncRoutes points the kernel routes for peers' subnets at the overlay and
+// routes internet traffic through the exit node when one is assigned
+func (n *Node) syncRoutes(assigned map[string][]string) {
+	if n.router == nil {
+		return
+	}
+
+	var destinations []string
+	exit := false
+	for _, routes := range assigned {
+		for _, route := range routes {
+			if utils.IsExitRoute(route) {
+				exit = true
+				continue
+			}
+			destinations = append(destinations, route)
+		}
+	}
+
+	if err := n.router.SetRoutes(destinations); err != nil {
+		log.Printf("Warning: failed to update subnet routes: %v", err)
+	}
+
+	if err := n.router.SetDefaultRoute(exit); err != nil {
+		log.Printf("Warning: failed to update exit node route: %v", err)
+	}
+}
+
+// overlayPrefixes returns the overlay networks this node's virtual IPs are
+// in: the IPv4 network and, with IPv6, the ULA prefix
+func (n *Node) overlayPrefixes() ([]netip.Prefix, error) {
+	prefix, err := netip.ParsePrefix(n.cfg().VirtualIP + "/" + n.cfg().VirtualNetmask)
+	if err != nil {
+		return nil, fmt.Errorf("invalid virtual network: %w", err)
+	}
+
+	overlays := []netip.Prefix{prefix.Masked()}
+	if n.cfg().VirtualIPv6 != "" {
+		overlays = append(overlays, utils.OverlayIPv6Prefix)
+	}
+	return overlays, nil
+}
+
+// overlapsAny reports whether prefix overlaps any of the others
+func overlapsAny(prefix netip.Prefix, others []netip.Prefix) bool {
+	for _, other := range others {
+		if prefix.Overlaps(other) {
+			return true
+		}
+	}
+	return false
+}
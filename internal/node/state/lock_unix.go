@@ -0,0 +1,15 @@
+//go:build unix
+
+package state
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// lockFileExclusive takes an exclusive lock on f without waiting; the lock
+// is released when f is closed or the process exits
+func lockFileExclusive(f *os.File) error {
+	return unix.Flock(int(f.Fd()), unix.LOCK_EX|unix.LOCK_NB)
+}
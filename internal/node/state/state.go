@@ -0,0 +1,158 @@
+// Package state keeps what a node needs across restarts in its state
+// directory: its identity, private key and the last peer map and preshared
+// key offers it received
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/proto"
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/utils"
+)
+
+// DefaultDir is the default state directory
+const DefaultDir = "/var/lib/shadownet"
+
+// Files in the state directory
+const (
+	identityFile = "node.json"
+	peersFile    = "peers.json"
+	pskFile      = "psk.json"
+	keyFile      = "private.key"
+	lockFile     = "node.lock"
+)
+
+// Identity is what makes a node the same peer after a restart
+type Identity struct {
+	ID              string `json:"id"`
+	VirtualIP       string `json:"virtual_ip,omitempty"`
+	VirtualIPv6     string `json:"virtual_ipv6,omitempty"`
+	ControlPlaneURL string `json:"controlplane_url,omitempty"`
+}
+
+// PeerCache is the last peer map the control plane sent
+type PeerCache struct {
+	UpdatedAt time.Time         `json:"updated_at"`
+	Network   string            `json:"network,omitempty"`
+	Name      string            `json:"name,omitempty"`
+	Peers     []*proto.PeerInfo `json:"peers"`
+}
+
+// Dir is an open state directory. It is locked while open, so two nodes
+// can't share one.
+type Dir struct {
+	path string
+	lock *os.File
+}
+
+// Open creates the state directory if needed and locks it
+func Open(path string) (*Dir, error) {
+	if err := os.MkdirAll(path, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	lock, err := os.OpenFile(filepath.Join(path, lockFile), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+	if err := lockFileExclusive(lock); err != nil {
+		lock.Close()
+		return nil, fmt.Errorf("state directory %s is in use by another node: %w", path, err)
+	}
+
+	return &Dir{path: path, lock: lock}, nil
+}
+
+// Close unlocks the state directory
+func (d *Dir) Close() error {
+	return d.lock.Close()
+}
+
+// Path returns the state directory's path
+func (d *Dir) Path() string {
+	return d.path
+}
+
+// KeyPath returns the path of the node's private key in the directory
+func (d *Dir) KeyPath() string {
+	return filepath.Join(d.path, keyFile)
+}
+
+// LoadIdentity reads the saved identity; it returns nil if there is none
+func (d *Dir) LoadIdentity() (*Identity, error) {
+	var identity Identity
+	if err := d.load(identityFile, &identity); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &identity, nil
+}
+
+// SaveIdentity saves the node's identity
+func (d *Dir) SaveIdentity(identity *Identity) error {
+	return d.save(identityFile, identity)
+}
+
+// LoadPeers reads the cached peer map; it returns nil if there is none
+func (d *Dir) LoadPeers() (*PeerCache, error) {
+	var cache PeerCache
+	if err := d.load(peersFile, &cache); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &cache, nil
+}
+
+// SavePeers caches the peer map
+func (d *Dir) SavePeers(cache *PeerCache) error {
+	return d.save(peersFile, cache)
+}
+
+// LoadPSKOffers reads the cached preshared key offers; it returns nil if
+// there are none
+func (d *Dir) LoadPSKOffers() ([]proto.PSKOffer, error) {
+	var offers []proto.PSKOffer
+	if err := d.load(pskFile, &offers); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return offers, nil
+}
+
+// SavePSKOffers caches the preshared key offers. They are sealed between
+// the peers' keys, so the cache holds no more secrets than the key file.
+func (d *Dir) SavePSKOffers(offers []proto.PSKOffer) error {
+	return d.save(pskFile, offers)
+}
+
+// load decodes a JSON file in the directory
+func (d *Dir) load(name string, v any) error {
+	data, err := os.ReadFile(filepath.Join(d.path, name))
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+	return nil
+}
+
+// save atomically writes a JSON file in the directory
+func (d *Dir) save(name string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", name, err)
+	}
+	return utils.WriteFileAtomic(filepath.Join(d.path, name), append(data, '\n'), 0600)
+}
@@ -0,0 +1,123 @@
+package node
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/node/wireguard"
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/proto"
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/utils"
+)
+
+// Status returns the node's runtime status including per-peer tunnel stats
+func (n *Node) Status() (*proto.NodeStatus, error) {
+	if n.wgDevice == nil {
+		return nil, fmt.Errorf("WireGuard device not initialized")
+	}
+
+	stats, err := n.wgDevice.Stats()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read peer stats: %w", err)
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	status := &proto.NodeStatus{
+		ID:             n.cfg().ID,
+		PublicKey:      n.publicKey.String(),
+		VirtualIP:      n.cfg().VirtualIP,
+		DNSName:        n.dnsName(),
+		PublicEndpoint: utils.FormatEndpoint(n.publicIP, n.publicPort),
+		Backend:        n.wgDevice.Name(),
+		NAT:            n.natInfo,
+		ControlPlane:   n.controlPlaneStatus(),
+		Peers:          make([]proto.TunnelStats, 0, len(stats)),
+
+		AdvertisedRoutes: n.advertisedRoutes(),
+		ExitNode:         n.exitNode,
+		ExitNodes:        n.exitNodes,
+
+		VirtualIPv6: n.cfg().VirtualIPv6,
+		PQBlocked:   n.pqBlocked,
+
+		SharedSocket: n.bind != nil,
+	}
+	if n.publicIPv6 != "" {
+		status.PublicEndpointV6 = utils.FormatEndpoint(n.publicIPv6, n.publicPortV6)
+	}
+	if n.nextKey != nil {
+		status.NextPublicKey = n.nextKey.PublicKey().String()
+		status.KeySwitchAt = n.keySwitchAt.Format(time.RFC3339)
+	}
+	if n.router != nil {
+		status.Routes = n.router.Routes()
+	}
+	for i := range stats {
+		status.Peers = append(status.Peers, n.toTunnelStats(&stats[i]))
+	}
+
+	return status, nil
+}
+
+// controlPlaneStatus reports connectivity from the last heartbeats; callers
+// hold n.mu
+func (n *Node) controlPlaneStatus() *proto.ControlPlaneStatus {
+	status := &proto.ControlPlaneStatus{URL: n.client().URL()}
+	if !n.offlineSince.IsZero() {
+		status.CachedPeers = n.cachedPeersAt.UTC().Format(time.RFC3339)
+		if n.reconnectErr != nil {
+			status.LastError = n.reconnectErr.Error()
+		}
+		return status
+	}
+	if n.heartbeatSender == nil {
+		return status
+	}
+
+	lastSuccess, lastErr := n.heartbeatSender.LastResult()
+	status.Connected = lastErr == nil && !lastSuccess.IsZero()
+	if !lastSuccess.IsZero() {
+		status.LastContact = lastSuccess.UTC().Format(time.RFC3339)
+	}
+	if lastErr != nil {
+		status.LastError = lastErr.Error()
+	}
+	return status
+}
+
+// tunnelStats returns the tunnel stats sent with heartbeats; failures are
+// logged and reported as no stats
+func (n *Node) tunnelStats() []proto.TunnelStats {
+	status, err := n.Status()
+	if err != nil {
+		log.Printf("Warning: %v", err)
+		return nil
+	}
+	return status.Peers
+}
+
+// toTunnelStats converts device stats to the API form; callers hold n.mu
+func (n *Node) toTunnelStats(s *wireguard.PeerStats) proto.TunnelStats {
+	publicKey := s.PublicKey.String()
+	peerID := n.peerIDs[publicKey]
+	tunnel := proto.TunnelStats{
+		PeerID:     peerID,
+		Name:       n.peerNames[publicKey],
+		PublicKey:  publicKey,
+		Endpoint:   s.Endpoint,
+		RxBytes:    s.ReceiveBytes,
+		TxBytes:    s.TransmitBytes,
+		Keepalive:  s.Keepalive,
+		AllowedIPs: s.AllowedIPs,
+		Up:         s.Up(),
+		Strategy:   string(n.peerStrategies[peerID]),
+		PSKEpoch:   n.pskEpoch(peerID),
+	}
+	n.pqTunnelStats(&tunnel)
+	if !s.LastHandshake.IsZero() {
+		tunnel.LastHandshake = s.LastHandshake.UTC().Format(time.RFC3339)
+	}
+	return tunnel
+}
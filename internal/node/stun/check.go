@@ -0,0 +1,60 @@
+package stun
+
+import (
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/proto"
+)
+
+// Check queries every server from conn for diagnostics, reporting each
+// server's answer, the consensus mapping and, over IPv4, the NAT behaviour
+func Check(conn net.PacketConn, servers []string, opts QueryOptions) *proto.NetcheckFamily {
+	report := &proto.NetcheckFamily{}
+
+	consensus, err := DiscoverEndpoints(conn, servers, opts)
+	if err != nil {
+		report.Error = err.Error()
+		for _, server := range servers {
+			report.STUN = append(report.STUN, proto.NetcheckSTUN{Server: server, Error: err.Error()})
+		}
+		return report
+	}
+
+	var answering []string
+	for _, result := range consensus.Results {
+		entry := proto.NetcheckSTUN{Server: result.Server}
+		if result.Err != nil {
+			entry.Error = result.Err.Error()
+		} else {
+			entry.Mapped = net.JoinHostPort(result.IP, strconv.Itoa(result.Port))
+			entry.Latency = result.RTT.Round(time.Millisecond).String()
+			answering = append(answering, result.Server)
+		}
+		report.STUN = append(report.STUN, entry)
+	}
+	report.PublicEndpoint = net.JoinHostPort(consensus.IP, strconv.Itoa(consensus.Port))
+	report.ConsistentMapping = !consensus.Inconsistent
+
+	if opts.Network == "udp6" {
+		return report
+	}
+
+	behavior, err := DiscoverNATBehavior(conn, NATDiscoveryOptions{Servers: answering, Timeout: opts.Timeout})
+	if err != nil {
+		report.NATError = err.Error()
+		return report
+	}
+	if consensus.Inconsistent && !behavior.Symmetric() {
+		behavior.Mapping = MappingAddressAndPortDependent
+		behavior.Type = NATTypeSymmetric
+	}
+	report.NAT = &proto.NATInfo{
+		Type:        string(behavior.Type),
+		Mapping:     string(behavior.Mapping),
+		Filtering:   string(behavior.Filtering),
+		Hairpinning: behavior.Hairpinning,
+	}
+	return report
+}
@@ -0,0 +1,193 @@
+package stun
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/pion/stun"
+)
+
+// QueryOptions controls parallel STUN queries
+type QueryOptions struct {
+	// Timeout is how long to wait for responses after each transmission
+	Timeout time.Duration
+
+	// Retries is how many times unanswered requests are retransmitted
+	Retries int
+
+	// Network is "udp4" (the default) or "udp6"; servers are resolved and
+	// queried over that address family
+	Network string
+}
+
+// ServerResult is the answer (or failure) of a single STUN server
+type ServerResult struct {
+	Server string
+	IP     string
+	Port   int
+	RTT    time.Duration
+	Err    error
+}
+
+// Consensus is the reflexive address agreed on by the answering servers
+type Consensus struct {
+	IP   string
+	Port int
+
+	// Server is the first server that reported the consensus mapping
+	Server string
+
+	// Agreeing is the number of servers that reported the consensus mapping
+	Agreeing int
+
+	// Inconsistent is set when servers saw different mappings for the same
+	// local socket, which points to a symmetric NAT
+	Inconsistent bool
+
+	Results []ServerResult
+}
+
+// Answered returns the number of servers that responded
+func (c *Consensus) Answered() int {
+	answered := 0
+	for _, r := range c.Results {
+		if r.Err == nil {
+			answered++
+		}
+	}
+	return answered
+}
+
+// probe is an outstanding binding request to one server
+type probe struct {
+	index   int
+	addr    *net.UDPAddr
+	message *stun.Message
+	sent    time.Time
+}
+
+// DiscoverEndpoints queries all servers in parallel from the same socket
+// and returns the consensus mapping. It only fails when no server answers.
+func DiscoverEndpoints(conn net.PacketConn, servers []string, opts QueryOptions) (*Consensus, error) {
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("at least one STUN server is required")
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = 2 * time.Second
+	}
+	if opts.Network == "" {
+		opts.Network = "udp4"
+	}
+
+	consensus := &Consensus{Results: make([]ServerResult, len(servers))}
+	pending := make(map[[stun.TransactionIDSize]byte]*probe)
+
+	for i, server := range servers {
+		consensus.Results[i].Server = server
+
+		addr, err := net.ResolveUDPAddr(opts.Network, server)
+		if err != nil {
+			consensus.Results[i].Err = fmt.Errorf("failed to resolve STUN server: %w", err)
+			continue
+		}
+
+		message := stun.MustBuild(stun.TransactionID, stun.BindingRequest)
+		pending[message.TransactionID] = &probe{index: i, addr: addr, message: message}
+	}
+
+	defer conn.SetReadDeadline(time.Time{})
+
+	buf := make([]byte, 1500)
+	for attempt := 0; attempt <= opts.Retries && len(pending) > 0; attempt++ {
+		// Retransmissions reuse the transaction ID so late answers still count
+		for _, p := range pending {
+			p.sent = time.Now()
+			if _, err := conn.WriteTo(p.message.Raw, p.addr); err != nil {
+				consensus.Results[p.index].Err = fmt.Errorf("failed to send STUN request: %w", err)
+			}
+		}
+
+		conn.SetReadDeadline(time.Now().Add(opts.Timeout))
+		for len(pending) > 0 {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				var netErr net.Error
+				if errors.As(err, &netErr) && netErr.Timeout() {
+					break
+				}
+				return nil, fmt.Errorf("failed to receive STUN response: %w", err)
+			}
+
+			var response stun.Message
+			response.Raw = buf[:n]
+			if err := response.Decode(); err != nil {
+				continue
+			}
+
+			p, ok := pending[response.TransactionID]
+			if !ok {
+				continue
+			}
+			delete(pending, response.TransactionID)
+
+			result := &consensus.Results[p.index]
+			result.RTT = time.Since(p.sent)
+			res, err := parseBindingResponse(&response)
+			if err != nil {
+				result.Err = err
+				continue
+			}
+			result.Err = nil
+			result.IP = res.mapped.IP.String()
+			result.Port = res.mapped.Port
+		}
+	}
+
+	for _, p := range pending {
+		if consensus.Results[p.index].Err == nil {
+			consensus.Results[p.index].Err = errNoResponse
+		}
+	}
+
+	if err := consensus.resolve(); err != nil {
+		return nil, err
+	}
+	return consensus, nil
+}
+
+// resolve picks the most reported mapping, preferring earlier servers on ties
+func (c *Consensus) resolve() error {
+	counts := make(map[string]int)
+	for _, r := range c.Results {
+		if r.Err == nil {
+			counts[net.JoinHostPort(r.IP, fmt.Sprint(r.Port))]++
+		}
+	}
+	if len(counts) == 0 {
+		return fmt.Errorf("no STUN server answered: %w", c.firstError())
+	}
+
+	c.Inconsistent = len(counts) > 1
+	for _, r := range c.Results {
+		if r.Err != nil {
+			continue
+		}
+		if count := counts[net.JoinHostPort(r.IP, fmt.Sprint(r.Port))]; count > c.Agreeing {
+			c.IP, c.Port, c.Server, c.Agreeing = r.IP, r.Port, r.Server, count
+		}
+	}
+
+	return nil
+}
+
+// firstError returns the first server error
+func (c *Consensus) firstError() error {
+	for _, r := range c.Results {
+		if r.Err != nil {
+			return r.Err
+		}
+	}
+	return errNoResponse
+}
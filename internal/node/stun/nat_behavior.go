@@ -0,0 +1,436 @@
+package stun
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"github.com/pion/stun"
+)
+
+// MappingBehavior describes how a NAT allocates external mappings (RFC 5780 section 4.3)
+type MappingBehavior string
+
+// FilteringBehavior describes which inbound packets a NAT lets through (RFC 5780 section 4.4)
+type FilteringBehavior string
+
+// NATType is a classic summary of the mapping and filtering behaviour
+type NATType string
+
+const (
+	MappingNone                      MappingBehavior   = "none"
+	MappingEndpointIndependent       MappingBehavior   = "endpoint-independent"
+	MappingAddressDependent          MappingBehavior   = "address-dependent"
+	MappingAddressAndPortDependent   MappingBehavior   = "address-and-port-dependent"
+	MappingUnknown                   MappingBehavior   = "unknown"
+	FilteringEndpointIndependent     FilteringBehavior = "endpoint-independent"
+	FilteringAddressDependent        FilteringBehavior = "address-dependent"
+	FilteringAddressAndPortDependent FilteringBehavior = "address-and-port-dependent"
+	FilteringUnknown                 FilteringBehavior = "unknown"
+
+	NATTypeOpen               NATType = "open"
+	NATTypeFullCone           NATType = "full-cone"
+	NATTypeRestrictedCone     NATType = "restricted-cone"
+	NATTypePortRestrictedCone NATType = "port-restricted-cone"
+	NATTypeSymmetric          NATType = "symmetric"
+	NATTypeUnknown            NATType = "unknown"
+)
+
+// attrChangedAddress is the RFC 3489 predecessor of OTHER-ADDRESS
+const attrChangedAddress stun.AttrType = 0x0005
+
+// errNoResponse is returned when a probe times out
+var errNoResponse = errors.New("no response from STUN server")
+
+// ChangeRequest represents the CHANGE-REQUEST attribute (RFC 5780 section 7.2)
+type ChangeRequest struct {
+	ChangeIP   bool
+	ChangePort bool
+}
+
+// AddTo adds CHANGE-REQUEST to a STUN message
+func (c ChangeRequest) AddTo(m *stun.Message) error {
+	v := make([]byte, 4)
+	if c.ChangeIP {
+		v[3] |= 0x04
+	}
+	if c.ChangePort {
+		v[3] |= 0x02
+	}
+	m.Add(stun.AttrChangeRequest, v)
+	return nil
+}
+
+// GetFrom decodes CHANGE-REQUEST from a STUN message
+func (c *ChangeRequest) GetFrom(m *stun.Message) error {
+	v, err := m.Get(stun.AttrChangeRequest)
+	if err != nil {
+		return err
+	}
+	if len(v) != 4 {
+		return fmt.Errorf("invalid CHANGE-REQUEST length: %d", len(v))
+	}
+	c.ChangeIP = v[3]&0x04 != 0
+	c.ChangePort = v[3]&0x02 != 0
+	return nil
+}
+
+// NATBehavior holds the result of NAT behaviour discovery
+type NATBehavior struct {
+	Type            NATType
+	Mapping         MappingBehavior
+	Filtering       FilteringBehavior
+	Hairpinning     bool
+	MappingLifetime time.Duration
+	PublicIP        string
+	PublicPort      int
+}
+
+// Symmetric reports whether the NAT allocates a new mapping per destination
+func (b *NATBehavior) Symmetric() bool {
+	return b.Mapping == MappingAddressDependent || b.Mapping == MappingAddressAndPortDependent
+}
+
+// NATDiscoveryOptions controls NAT behaviour discovery
+type NATDiscoveryOptions struct {
+	// Servers are STUN servers to probe; the first one is used for
+	// CHANGE-REQUEST tests, the rest for mapping comparison when the
+	// first one does not report OTHER-ADDRESS
+	Servers []string
+
+	// Timeout is the per-probe response timeout
+	Timeout time.Duration
+}
+
+// bindingResult is the outcome of a single binding transaction
+type bindingResult struct {
+	mapped *net.UDPAddr
+	other  *net.UDPAddr
+}
+
+// DiscoverNATBehavior runs the RFC 5780 mapping, filtering and hairpinning
+// tests using an existing connection
+func DiscoverNATBehavior(conn net.PacketConn, opts NATDiscoveryOptions) (*NATBehavior, error) {
+	if len(opts.Servers) == 0 {
+		return nil, fmt.Errorf("at least one STUN server is required")
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = 3 * time.Second
+	}
+
+	primary, err := net.ResolveUDPAddr("udp4", opts.Servers[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve STUN server: %w", err)
+	}
+
+	result := &NATBehavior{
+		Type:      NATTypeUnknown,
+		Mapping:   MappingUnknown,
+		Filtering: FilteringUnknown,
+	}
+
+	// Test I: plain binding request to the primary server
+	first, err := bindingRequest(conn, primary, opts.Timeout)
+	if err != nil {
+		return nil, fmt.Errorf("mapping test I failed: %w", err)
+	}
+	result.PublicIP = first.mapped.IP.String()
+	result.PublicPort = first.mapped.Port
+
+	if isLocalAddr(first.mapped, conn) {
+		result.Mapping = MappingNone
+	} else if first.other != nil {
+		result.Mapping = discoverMappingWithOtherAddress(conn, primary, first, opts.Timeout)
+	} else {
+		result.Mapping = discoverMappingWithServers(conn, first.mapped, opts.Servers[1:], opts.Timeout)
+	}
+
+	// Filtering tests need a server that honours CHANGE-REQUEST
+	if first.other != nil {
+		result.Filtering = discoverFiltering(conn, primary, !first.other.IP.Equal(primary.IP), opts.Timeout)
+	}
+
+	if result.Mapping != MappingNone {
+		result.Hairpinning = testHairpinning(conn, first.mapped, opts.Timeout)
+	}
+
+	result.Type = classify(result.Mapping, result.Filtering)
+	return result, nil
+}
+
+// discoverMappingWithOtherAddress performs mapping tests II and III against
+// the server's alternate address
+func discoverMappingWithOtherAddress(conn net.PacketConn, primary *net.UDPAddr, first *bindingResult, timeout time.Duration) MappingBehavior {
+	// A server with only an alternate port cannot run test II, and
+	// different ports alone cannot tell address-dependent mapping apart
+	if first.other.IP.Equal(primary.IP) {
+		third, err := bindingRequest(conn, first.other, timeout)
+		if err != nil {
+			log.Printf("NAT mapping test III failed: %v", err)
+			return MappingUnknown
+		}
+		if sameAddr(first.mapped, third.mapped) {
+			return MappingEndpointIndependent
+		}
+		return MappingAddressAndPortDependent
+	}
+
+	// Test II: alternate IP, primary port
+	altIP := &net.UDPAddr{IP: first.other.IP, Port: primary.Port}
+	second, err := bindingRequest(conn, altIP, timeout)
+	if err != nil {
+		log.Printf("NAT mapping test II failed: %v", err)
+		return MappingUnknown
+	}
+	if sameAddr(first.mapped, second.mapped) {
+		return MappingEndpointIndependent
+	}
+
+	// Test III: alternate IP, alternate port
+	third, err := bindingRequest(conn, first.other, timeout)
+	if err != nil {
+		log.Printf("NAT mapping test III failed: %v", err)
+		return MappingUnknown
+	}
+	if sameAddr(second.mapped, third.mapped) {
+		return MappingAddressDependent
+	}
+	return MappingAddressAndPortDependent
+}
+
+// discoverMappingWithServers compares the mapping seen by independent
+// servers when no CHANGE-REQUEST-capable server is available
+func discoverMappingWithServers(conn net.PacketConn, mapped *net.UDPAddr, servers []string, timeout time.Duration) MappingBehavior {
+	behavior := MappingUnknown
+	for _, server := range servers {
+		addr, err := net.ResolveUDPAddr("udp4", server)
+		if err != nil {
+			log.Printf("Failed to resolve STUN server %s: %v", server, err)
+			continue
+		}
+
+		res, err := bindingRequest(conn, addr, timeout)
+		if err != nil {
+			log.Printf("NAT mapping probe to %s failed: %v", server, err)
+			continue
+		}
+
+		// Different servers cannot tell address-dependent from
+		// address-and-port-dependent, so report the stricter one
+		if !sameAddr(mapped, res.mapped) {
+			return MappingAddressAndPortDependent
+		}
+		behavior = MappingEndpointIndependent
+	}
+	return behavior
+}
+
+// discoverFiltering performs filtering tests II and III; servers without an
+// alternate IP only support test III
+func discoverFiltering(conn net.PacketConn, primary *net.UDPAddr, changeIP bool, timeout time.Duration) FilteringBehavior {
+	// Test II: ask for a response from the alternate IP and port. Servers
+	// without an alternate IP skip it, so a response in test III then only
+	// proves address-dependent filtering.
+	if changeIP {
+		_, err := bindingRequest(conn, primary, timeout, ChangeRequest{ChangeIP: true, ChangePort: true})
+		if err == nil {
+			return FilteringEndpointIndependent
+		}
+		if !errors.Is(err, errNoResponse) {
+			log.Printf("NAT filtering test II failed: %v", err)
+			return FilteringUnknown
+		}
+	}
+
+	// Test III: ask for a response from the alternate port only
+	if _, err := bindingRequest(conn, primary, timeout, ChangeRequest{ChangePort: true}); err == nil {
+		return FilteringAddressDependent
+	} else if !errors.Is(err, errNoResponse) {
+		log.Printf("NAT filtering test III failed: %v", err)
+		return FilteringUnknown
+	}
+
+	return FilteringAddressAndPortDependent
+}
+
+// testHairpinning sends a binding request from a second socket to our own
+// mapped address and checks whether it arrives on conn
+func testHairpinning(conn net.PacketConn, mapped *net.UDPAddr, timeout time.Duration) bool {
+	probe, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4zero})
+	if err != nil {
+		log.Printf("Hairpinning test failed to open socket: %v", err)
+		return false
+	}
+	defer probe.Close()
+
+	message := stun.MustBuild(stun.TransactionID, stun.BindingRequest)
+	if _, err := probe.WriteToUDP(message.Raw, mapped); err != nil {
+		return false
+	}
+
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	buf := make([]byte, 1500)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return false
+		}
+
+		var m stun.Message
+		m.Raw = buf[:n]
+		if m.Decode() == nil && m.TransactionID == message.TransactionID {
+			return true
+		}
+	}
+}
+
+// ProbeMappingLifetime estimates how long the NAT keeps an idle mapping by
+// waiting increasingly long intervals and checking whether the mapping
+// survived. NATs that preserve ports on re-allocation will report the
+// upper bound.
+func ProbeMappingLifetime(server string, max, timeout time.Duration) (time.Duration, error) {
+	serverAddr, err := net.ResolveUDPAddr("udp4", server)
+	if err != nil {
+		return 0, fmt.Errorf("failed to resolve STUN server: %w", err)
+	}
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4zero})
+	if err != nil {
+		return 0, fmt.Errorf("failed to create UDP connection: %w", err)
+	}
+	defer conn.Close()
+
+	initial, err := bindingRequest(conn, serverAddr, timeout)
+	if err != nil {
+		return 0, err
+	}
+
+	var survived time.Duration
+	for wait := 15 * time.Second; wait <= max; wait *= 2 {
+		time.Sleep(wait)
+
+		res, err := bindingRequest(conn, serverAddr, timeout)
+		if err != nil {
+			return survived, err
+		}
+		if !sameAddr(initial.mapped, res.mapped) {
+			return survived, nil
+		}
+		survived = wait
+	}
+
+	return survived, nil
+}
+
+// bindingRequest sends a binding request and waits for the matching response
+func bindingRequest(conn net.PacketConn, server *net.UDPAddr, timeout time.Duration, setters ...stun.Setter) (*bindingResult, error) {
+	message, err := stun.Build(append([]stun.Setter{stun.TransactionID, stun.BindingRequest}, setters...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build STUN request: %w", err)
+	}
+
+	if _, err := conn.WriteTo(message.Raw, server); err != nil {
+		return nil, fmt.Errorf("failed to send STUN request: %w", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	buf := make([]byte, 1500)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return nil, errNoResponse
+			}
+			return nil, fmt.Errorf("failed to receive STUN response: %w", err)
+		}
+
+		var response stun.Message
+		response.Raw = buf[:n]
+		if err := response.Decode(); err != nil || response.TransactionID != message.TransactionID {
+			// Not ours (stray or late packet), keep waiting
+			continue
+		}
+
+		return parseBindingResponse(&response)
+	}
+}
+
+// parseBindingResponse extracts the mapped and alternate addresses
+func parseBindingResponse(m *stun.Message) (*bindingResult, error) {
+	result := &bindingResult{}
+
+	var xorAddr stun.XORMappedAddress
+	if err := xorAddr.GetFrom(m); err == nil {
+		result.mapped = &net.UDPAddr{IP: xorAddr.IP, Port: xorAddr.Port}
+	} else {
+		var mappedAddr stun.MappedAddress
+		if err := mappedAddr.GetFrom(m); err != nil {
+			return nil, fmt.Errorf("failed to get mapped address: %w", err)
+		}
+		result.mapped = &net.UDPAddr{IP: mappedAddr.IP, Port: mappedAddr.Port}
+	}
+
+	var other stun.OtherAddress
+	if err := other.GetFrom(m); err == nil {
+		result.other = &net.UDPAddr{IP: other.IP, Port: other.Port}
+	} else {
+		var changed stun.MappedAddress
+		if err := changed.GetFromAs(m, attrChangedAddress); err == nil {
+			result.other = &net.UDPAddr{IP: changed.IP, Port: changed.Port}
+		}
+	}
+
+	return result, nil
+}
+
+// classify maps mapping and filtering behaviour onto a classic NAT type
+func classify(mapping MappingBehavior, filtering FilteringBehavior) NATType {
+	switch mapping {
+	case MappingNone:
+		return NATTypeOpen
+	case MappingAddressDependent, MappingAddressAndPortDependent:
+		return NATTypeSymmetric
+	case MappingEndpointIndependent:
+		switch filtering {
+		case FilteringEndpointIndependent:
+			return NATTypeFullCone
+		case FilteringAddressDependent:
+			return NATTypeRestrictedCone
+		case FilteringAddressAndPortDependent:
+			return NATTypePortRestrictedCone
+		}
+		// An inconclusive filtering test leaves the cone type open
+	}
+	return NATTypeUnknown
+}
+
+// isLocalAddr reports whether the mapped address is one of our own
+func isLocalAddr(mapped *net.UDPAddr, conn net.PacketConn) bool {
+	local, ok := conn.LocalAddr().(*net.UDPAddr)
+	if !ok || local.Port != mapped.Port {
+		return false
+	}
+
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+	for _, addr := range addrs {
+		if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.Equal(mapped.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameAddr compares two UDP addresses
+func sameAddr(a, b *net.UDPAddr) bool {
+	return a.IP.Equal(b.IP) && a.Port == b.Port
+}
@@ -35,14 +35,14 @@ func DiscoverEndpoint(stunServer string, localPort int) (string, int, error) {
 	message := stun.MustBuild(stun.TransactionID, stun.BindingRequest)
 
 	// Send request
-	_, err = conn.WriteToUDP(message.Raw, serverAddr)
+	_, err = conn.WriteTo(message.Raw, serverAddr)
 	if err != nil {
 		return "", 0, fmt.Errorf("failed to send STUN request: %w", err)
 	}
 
 	// Receive response
 	buf := make([]byte, 1024)
-	n, _, err := conn.ReadFromUDP(buf)
+	n, _, err := conn.ReadFrom(buf)
 	if err != nil {
 		return "", 0, fmt.Errorf("failed to receive STUN response: %w", err)
 	}
@@ -64,7 +64,7 @@ func DiscoverEndpoint(stunServer string, localPort int) (string, int, error) {
 }
 
 // DiscoverEndpointWithConn discovers the public endpoint using an existing connection
-func DiscoverEndpointWithConn(conn *net.UDPConn, stunServer string) (string, int, error) {
+func DiscoverEndpointWithConn(conn net.PacketConn, stunServer string) (string, int, error) {
 	// Resolve STUN server address
 	serverAddr, err := net.ResolveUDPAddr("udp4", stunServer)
 	if err != nil {
@@ -75,7 +75,7 @@ func DiscoverEndpointWithConn(conn *net.UDPConn, stunServer string) (string, int
 	message := stun.MustBuild(stun.TransactionID, stun.BindingRequest)
 
 	// Send request
-	_, err = conn.WriteToUDP(message.Raw, serverAddr)
+	_, err = conn.WriteTo(message.Raw, serverAddr)
 	if err != nil {
 		return "", 0, fmt.Errorf("failed to send STUN request: %w", err)
 	}
@@ -86,7 +86,7 @@ func DiscoverEndpointWithConn(conn *net.UDPConn, stunServer string) (string, int
 
 	// Receive response
 	buf := make([]byte, 1024)
-	n, _, err := conn.ReadFromUDP(buf)
+	n, _, err := conn.ReadFrom(buf)
 	if err != nil {
 		return "", 0, fmt.Errorf("failed to receive STUN response: %w", err)
 	}
@@ -0,0 +1,333 @@
+package transport
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+	"os"
+	"sync"
+	"time"
+
+	"golang.zx2c4.com/wireguard/conn"
+)
+
+// stunMagicCookie identifies STUN messages (RFC 5389 section 6)
+const stunMagicCookie = 0x2112A442
+
+// packet is a datagram read from the shared socket
+type packet struct {
+	data []byte
+	from *net.UDPAddr
+}
+
+// MuxBind is a WireGuard conn.Bind that shares one UDP socket between
+// WireGuard, STUN and hole punching. A single reader demultiplexes STUN
+// messages (by magic cookie), hole-punch markers and WireGuard packets, so
+// the NAT mapping discovered by STUN is the one WireGuard actually uses.
+type MuxBind struct {
+	conn *net.UDPConn
+	port int
+
+	wgPackets   chan packet
+	stunPackets chan packet
+	done        chan struct{}
+
+	mu      sync.Mutex
+	wgOpen  bool
+	wgDone  chan struct{}
+	onPunch func(from *net.UDPAddr)
+}
+
+var _ conn.Bind = (*MuxBind)(nil)
+
+// NewMuxBind binds the shared UDP socket and starts demultiplexing. With
+// ipv6 the socket is dual-stack where the host supports it, so IPv4 and
+// IPv6 peers share one port.
+func NewMuxBind(port int, ipv6 bool) (*MuxBind, error) {
+	network, addr := "udp4", &net.UDPAddr{IP: net.IPv4zero, Port: port}
+	if ipv6 {
+		network, addr = "udp", &net.UDPAddr{Port: port}
+	}
+
+	udpConn, err := net.ListenUDP(network, addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create UDP socket: %w", err)
+	}
+
+	b := &MuxBind{
+		conn:        udpConn,
+		port:        udpConn.LocalAddr().(*net.UDPAddr).Port,
+		wgPackets:   make(chan packet, 1024),
+		stunPackets: make(chan packet, 64),
+		done:        make(chan struct{}),
+	}
+
+	go b.readLoop()
+	return b, nil
+}
+
+// Port returns the bound UDP port
+func (b *MuxBind) Port() int {
+	return b.port
+}
+
+// OnPunch registers a callback for hole-punch packets received from peers
+func (b *MuxBind) OnPunch(fn func(from *net.UDPAddr)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.onPunch = fn
+}
+
+// WriteTo sends a raw datagram (used for hole punching)
+func (b *MuxBind) WriteTo(p []byte, addr *net.UDPAddr) (int, error) {
+	return b.conn.WriteToUDP(p, addr)
+}
+
+// STUNConn returns a PacketConn view of the socket that only receives STUN
+func (b *MuxBind) STUNConn() net.PacketConn {
+	return &stunConn{bind: b}
+}
+
+// Release closes the shared socket; WireGuard must be closed first
+func (b *MuxBind) Release() error {
+	select {
+	case <-b.done:
+		return nil
+	default:
+	}
+	close(b.done)
+	return b.conn.Close()
+}
+
+// readLoop reads from the socket and dispatches packets by type
+func (b *MuxBind) readLoop() {
+	buf := make([]byte, 65535)
+	for {
+		n, fromAddr, err := b.conn.ReadFromUDPAddrPort(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Printf("Shared UDP socket read error: %v", err)
+			continue
+		}
+
+		// A dual-stack socket reports IPv4 senders as IPv4-mapped addresses
+		from := net.UDPAddrFromAddrPort(netip.AddrPortFrom(fromAddr.Addr().Unmap(), fromAddr.Port()))
+
+		data := buf[:n]
+		switch {
+		case isSTUN(data):
+			b.dispatch(b.stunPackets, data, from)
+		case isPunch(data):
+			b.mu.Lock()
+			onPunch := b.onPunch
+			b.mu.Unlock()
+			if onPunch != nil {
+				onPunch(from)
+			}
+		default:
+			b.mu.Lock()
+			wgOpen := b.wgOpen
+			b.mu.Unlock()
+			if wgOpen {
+				b.dispatch(b.wgPackets, data, from)
+			}
+		}
+	}
+}
+
+// dispatch copies a packet into a queue, dropping it when the queue is full
+func (b *MuxBind) dispatch(queue chan packet, data []byte, from *net.UDPAddr) {
+	p := packet{data: append([]byte(nil), data...), from: from}
+	select {
+	case queue <- p:
+	default:
+	}
+}
+
+// isSTUN reports whether a datagram is a STUN message
+func isSTUN(data []byte) bool {
+	return len(data) >= 20 && data[0]&0xC0 == 0 &&
+		binary.BigEndian.Uint32(data[4:8]) == stunMagicCookie
+}
+
+// isPunch reports whether a datagram is a hole-punch marker (see nat.HolePuncher)
+func isPunch(data []byte) bool {
+	return len(data) == 1 && data[0] == 0x00
+}
+
+// Open implements conn.Bind. The socket is already bound, so the port must
+// be 0 or match it.
+func (b *MuxBind) Open(port uint16) ([]conn.ReceiveFunc, uint16, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.wgOpen {
+		return nil, 0, conn.ErrBindAlreadyOpen
+	}
+	if port != 0 && int(port) != b.port {
+		return nil, 0, fmt.Errorf("shared socket is bound to port %d, not %d", b.port, port)
+	}
+
+	b.wgOpen = true
+	b.wgDone = make(chan struct{})
+	return []conn.ReceiveFunc{b.makeReceiveFunc(b.wgDone)}, uint16(b.port), nil
+}
+
+// makeReceiveFunc returns a ReceiveFunc that drains the WireGuard queue
+func (b *MuxBind) makeReceiveFunc(wgDone chan struct{}) conn.ReceiveFunc {
+	return func(packets [][]byte, sizes []int, eps []conn.Endpoint) (int, error) {
+		select {
+		case <-wgDone:
+			return 0, net.ErrClosed
+		case <-b.done:
+			return 0, net.ErrClosed
+		case p := <-b.wgPackets:
+			sizes[0] = copy(packets[0], p.data)
+			eps[0] = &Endpoint{AddrPort: p.from.AddrPort()}
+			return 1, nil
+		}
+	}
+}
+
+// Close implements conn.Bind. It only detaches WireGuard; the socket stays
+// open for STUN until Release.
+func (b *MuxBind) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.wgOpen {
+		close(b.wgDone)
+		b.wgOpen = false
+	}
+	return nil
+}
+
+// SetMark implements conn.Bind
+func (b *MuxBind) SetMark(mark uint32) error {
+	return setMark(b.conn, mark)
+}
+
+// Send implements conn.Bind
+func (b *MuxBind) Send(bufs [][]byte, ep conn.Endpoint) error {
+	endpoint, ok := ep.(*Endpoint)
+	if !ok {
+		return conn.ErrWrongEndpointType
+	}
+
+	addr := net.UDPAddrFromAddrPort(endpoint.AddrPort)
+	for _, buf := range bufs {
+		if _, err := b.conn.WriteToUDP(buf, addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ParseEndpoint implements conn.Bind
+func (b *MuxBind) ParseEndpoint(s string) (conn.Endpoint, error) {
+	addrPort, err := netip.ParseAddrPort(s)
+	if err != nil {
+		return nil, err
+	}
+	return &Endpoint{AddrPort: addrPort}, nil
+}
+
+// BatchSize implements conn.Bind
+func (b *MuxBind) BatchSize() int {
+	return 1
+}
+
+// Endpoint is a conn.Endpoint for MuxBind
+type Endpoint struct {
+	netip.AddrPort
+}
+
+// ClearSrc implements conn.Endpoint
+func (e *Endpoint) ClearSrc() {}
+
+// SrcToString implements conn.Endpoint
+func (e *Endpoint) SrcToString() string { return "" }
+
+// DstToString implements conn.Endpoint
+func (e *Endpoint) DstToString() string { return e.AddrPort.String() }
+
+// DstToBytes implements conn.Endpoint
+func (e *Endpoint) DstToBytes() []byte {
+	b, _ := e.AddrPort.MarshalBinary()
+	return b
+}
+
+// DstIP implements conn.Endpoint
+func (e *Endpoint) DstIP() netip.Addr { return e.AddrPort.Addr() }
+
+// SrcIP implements conn.Endpoint
+func (e *Endpoint) SrcIP() netip.Addr { return netip.Addr{} }
+
+// stunConn is the STUN-only PacketConn view of a MuxBind
+type stunConn struct {
+	bind *MuxBind
+
+	mu       sync.Mutex
+	deadline time.Time
+}
+
+// ReadFrom returns the next STUN message received on the shared socket
+func (c *stunConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	c.mu.Lock()
+	deadline := c.deadline
+	c.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case pkt := <-c.bind.stunPackets:
+		return copy(p, pkt.data), pkt.from, nil
+	case <-timeout:
+		return 0, nil, os.ErrDeadlineExceeded
+	case <-c.bind.done:
+		return 0, nil, net.ErrClosed
+	}
+}
+
+// WriteTo sends a STUN message from the shared socket
+func (c *stunConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	return c.bind.conn.WriteTo(p, addr)
+}
+
+// Close is a no-op; the socket is owned by the MuxBind
+func (c *stunConn) Close() error {
+	return nil
+}
+
+// LocalAddr returns the shared socket's address
+func (c *stunConn) LocalAddr() net.Addr {
+	return c.bind.conn.LocalAddr()
+}
+
+// SetDeadline sets the read deadline
+func (c *stunConn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+// SetReadDeadline sets the read deadline
+func (c *stunConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deadline = t
+	return nil
+}
+
+// SetWriteDeadline is a no-op; writes to UDP do not block
+func (c *stunConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
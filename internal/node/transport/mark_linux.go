@@ -0,0 +1,56 @@
+package transport
+
+import (
+	"net"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// setMark sets SO_MARK on the socket so policy routing can match it
+func setMark(conn *net.UDPConn, mark uint32) error {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var sockErr error
+	err = raw.Control(func(fd uintptr) {
+		sockErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_MARK, int(mark))
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
+
+// MarkControl returns a net.Dialer Control function that sets SO_MARK on
+// new sockets, so their traffic bypasses the overlay default route
+func MarkControl(mark uint32) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		var sockErr error
+		err := c.Control(func(fd uintptr) {
+			sockErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_MARK, int(mark))
+		})
+		if err != nil {
+			return err
+		}
+		return sockErr
+	}
+}
+
+// DeviceControl returns a net.ListenConfig Control function that binds new
+// sockets to a network interface (SO_BINDTODEVICE), so they only receive
+// traffic that arrived on it
+func DeviceControl(name string) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		var sockErr error
+		err := c.Control(func(fd uintptr) {
+			sockErr = unix.BindToDevice(int(fd), name)
+		})
+		if err != nil {
+			return err
+		}
+		return sockErr
+	}
+}
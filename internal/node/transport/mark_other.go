@@ -0,0 +1,30 @@
+//go:build !linux
+
+package transport
+
+import (
+	"errors"
+	"net"
+	"syscall"
+)
+
+// setMark is a no-op on platforms without SO_MARK
+func setMark(conn *net.UDPConn, mark uint32) error {
+	return nil
+}
+
+// MarkControl returns a Control function that does nothing on platforms
+// without SO_MARK
+func MarkControl(mark uint32) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		return nil
+	}
+}
+
+// DeviceControl returns a Control function that fails: sockets can't be
+// bound to an interface on this platform
+func DeviceControl(name string) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		return errors.New("binding sockets to an interface is not supported on this platform")
+	}
+}
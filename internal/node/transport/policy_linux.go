@@ -0,0 +1,128 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// Priorities of the policy rules. The main table is looked up first
+// ignoring its default route, so the LAN stays reachable under an exit
+// node; then traffic without FirewallMark goes to the overlay table. Throw
+// routes for excluded destinations end that lookup, falling through to the
+// main table's default route.
+const (
+	rulePriorityMain    = 5210
+	rulePriorityOverlay = 5220
+)
+
+// policyRules returns the policy rules for a table in one address family
+func policyRules(family, table int) []*netlink.Rule {
+	main := netlink.NewRule()
+	main.Family = family
+	main.Priority = rulePriorityMain
+	main.Table = unix.RT_TABLE_MAIN
+	main.SuppressPrefixlen = 0
+
+	overlay := netlink.NewRule()
+	overlay.Family = family
+	overlay.Priority = rulePriorityOverlay
+	overlay.Mark = FirewallMark
+	mask := uint32(0xffffffff)
+	overlay.Mask = &mask
+	overlay.Invert = true
+	overlay.Table = table
+
+	return []*netlink.Rule{main, overlay}
+}
+
+// linkIndex returns the index of the named interface
+func linkIndex(iface string) (int, error) {
+	link, err := netlink.LinkByName(iface)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find interface %s: %w", iface, err)
+	}
+	return link.Attrs().Index, nil
+}
+
+// addRules installs the policy rules for both address families and reports
+// whether the IPv6 ones were installed. Hosts without IPv6 only get the
+// IPv4 rules.
+func addRules(table int) (bool, error) {
+	for _, family := range []int{netlink.FAMILY_V4, netlink.FAMILY_V6} {
+		for _, rule := range policyRules(family, table) {
+			if err := netlink.RuleAdd(rule); err != nil {
+				if family == netlink.FAMILY_V6 && errors.Is(err, unix.EAFNOSUPPORT) {
+					log.Printf("IPv6 is disabled, skipping IPv6 policy rules")
+					return false, nil
+				}
+				return false, fmt.Errorf("failed to add policy rule %d: %w", rule.Priority, err)
+			}
+		}
+	}
+	return true, nil
+}
+
+// removeRules removes every copy of the policy rules, including those a
+// crashed run left behind
+func removeRules(table int) {
+	for _, family := range []int{netlink.FAMILY_V4, netlink.FAMILY_V6} {
+		for _, rule := range policyRules(family, table) {
+			for netlink.RuleDel(rule) == nil {
+			}
+		}
+	}
+}
+
+// flushTable removes every route in the table
+func flushTable(table int) error {
+	var firstErr error
+	for _, family := range []int{netlink.FAMILY_V4, netlink.FAMILY_V6} {
+		routes, err := netlink.RouteListFiltered(family, &netlink.Route{Table: table}, netlink.RT_FILTER_TABLE)
+		if err != nil {
+			if family == netlink.FAMILY_V4 && firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		for i := range routes {
+			if err := netlink.RouteDel(&routes[i]); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// toNetlinkRoute converts a table route
+func toNetlinkRoute(table, linkIndex, metric int, route tableRoute) *netlink.Route {
+	nlRoute := &netlink.Route{
+		Dst:      &net.IPNet{IP: route.dst.Addr().AsSlice(), Mask: net.CIDRMask(route.dst.Bits(), route.dst.Addr().BitLen())},
+		Table:    table,
+		Priority: metric,
+	}
+	if route.throw {
+		nlRoute.Type = unix.RTN_THROW
+		return nlRoute
+	}
+
+	nlRoute.LinkIndex = linkIndex
+	if route.gateway.IsValid() {
+		nlRoute.Gw = route.gateway.AsSlice()
+	}
+	return nlRoute
+}
+
+// replaceRoute installs a route, replacing one left behind by a crashed run
+func replaceRoute(table, linkIndex, metric int, route tableRoute) error {
+	return netlink.RouteReplace(toNetlinkRoute(table, linkIndex, metric, route))
+}
+
+// deleteRoute removes an installed route
+func deleteRoute(table, linkIndex, metric int, route tableRoute) error {
+	return netlink.RouteDel(toNetlinkRoute(table, linkIndex, metric, route))
+}
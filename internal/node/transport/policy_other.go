@@ -0,0 +1,31 @@
+//go:build !linux
+
+package transport
+
+// linkIndex fails on this platform; Router.Start reports it
+func linkIndex(iface string) (int, error) {
+	return 0, ErrPolicyRoutingUnsupported
+}
+
+// addRules is unsupported on this platform
+func addRules(table int) (bool, error) {
+	return false, ErrPolicyRoutingUnsupported
+}
+
+// removeRules does nothing on this platform
+func removeRules(table int) {}
+
+// flushTable does nothing on this platform
+func flushTable(table int) error {
+	return nil
+}
+
+// replaceRoute is unsupported on this platform
+func replaceRoute(table, linkIndex, metric int, route tableRoute) error {
+	return ErrPolicyRoutingUnsupported
+}
+
+// deleteRoute does nothing on this platform
+func deleteRoute(table, linkIndex, metric int, route tableRoute) error {
+	return nil
+}
@@ -1,43 +1,398 @@
 package transport
 
 import (
+	"errors"
+	"fmt"
 	"log"
+	"net/netip"
+	"slices"
+	"sort"
+	"sync"
 )
 
-// Router handles packet routing between TUN and WireGuard
-// In userspace WireGuard, routing is handled by the WireGuard device itself
-// This file is a placeholder for any custom routing logic
+// FirewallMark marks the node's own underlay traffic (WireGuard, STUN and
+// control plane connections) so policy routing keeps it off the overlay
+const FirewallMark = 0x534e
 
-// Router manages packet routing
+// DefaultRouteTable is the routing table that holds overlay routes unless
+// RouterConfig.Table says otherwise
+const DefaultRouteTable = 0x534e
+
+// ErrPolicyRoutingUnsupported is returned by Router.Start on platforms
+// without policy routing
+var ErrPolicyRoutingUnsupported = errors.New("policy routing is not supported on this platform")
+
+// defaultRoutes are the default routes used for exit nodes. IPv6 goes into
+// the tunnel even when the exit node only forwards IPv4: WireGuard drops it
+// there instead of it leaking out the physical network.
+var defaultRoutes = []netip.Prefix{netip.MustParsePrefix("0.0.0.0/0"), netip.MustParsePrefix("::/0")}
+
+// RouterConfig configures a Router
+type RouterConfig struct {
+	// Interface is the WireGuard interface routes point at
+	Interface string
+
+	// Table is the routing table for overlay routes (DefaultRouteTable if
+	// zero) and Metric the metric they are installed with
+	Table  int
+	Metric int
+
+	// Include and Exclude split the tunnel: when Include is set only
+	// destinations within it use the overlay, and destinations within
+	// Exclude never do
+	Include []string
+	Exclude []string
+}
+
+// tableRoute is a route in the router's table. Throw routes end the table
+// lookup so the destination falls through to the main table.
+type tableRoute struct {
+	dst     netip.Prefix
+	gateway netip.Addr
+	throw   bool
+}
+
+// key identifies the route in the table
+func (r tableRoute) key() string {
+	if r.throw {
+		return "throw " + r.dst.String()
+	}
+	return r.dst.String()
+}
+
+// Router installs overlay routes (subnet routes and an exit node's default
+// route) in a dedicated routing table and the policy rules that consult it.
+// WireGuard then picks the peer by its allowed IPs. Routes in the main
+// table other than its default route win over the overlay table, and
+// traffic carrying FirewallMark skips it so WireGuard's own packets never
+// loop.
 type Router struct {
-	// Future: custom routing tables, policy routing, etc.
+	config RouterConfig
+
+	mu           sync.Mutex
+	linkIndex    int
+	started      bool
+	ipv6         bool
+	subnets      []netip.Prefix
+	static       map[netip.Prefix]netip.Addr
+	defaultRoute bool
+	include      []netip.Prefix
+	exclude      []netip.Prefix
+	installed    map[string]tableRoute
 }
 
-// NewRouter creates a new router
-func NewRouter() *Router {
-	return &Router{}
+// NewRouter creates a router; the split tunnel lists must be valid prefixes
+func NewRouter(cfg RouterConfig) (*Router, error) {
+	if cfg.Table == 0 {
+		cfg.Table = DefaultRouteTable
+	}
+
+	r := &Router{
+		config:    cfg,
+		static:    make(map[netip.Prefix]netip.Addr),
+		installed: make(map[string]tableRoute),
+	}
+	if err := r.setSplitTunnel(cfg.Include, cfg.Exclude); err != nil {
+		return nil, err
+	}
+	return r, nil
 }
 
-// Start starts the router
+// Start removes the rules and routes a crashed run left behind and installs
+// the policy rules
 func (r *Router) Start() error {
-	log.Println("Router started (routing handled by WireGuard device)")
-	return nil
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	linkIndex, err := linkIndex(r.config.Interface)
+	if err != nil {
+		return err
+	}
+	r.linkIndex = linkIndex
+
+	removeRules(r.config.Table)
+	if err := flushTable(r.config.Table); err != nil {
+		log.Printf("Warning: failed to remove stale routes from table %d: %v", r.config.Table, err)
+	}
+
+	ipv6, err := addRules(r.config.Table)
+	if err != nil {
+		removeRules(r.config.Table)
+		return err
+	}
+	r.ipv6 = ipv6
+	r.started = true
+
+	return r.reconcile()
 }
 
-// Stop stops the router
+// Stop removes the policy rules and every route the router installed
 func (r *Router) Stop() error {
-	log.Println("Router stopped")
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.started {
+		return nil
+	}
+	r.started = false
+
+	removeRules(r.config.Table)
+	r.installed = make(map[string]tableRoute)
+	if err := flushTable(r.config.Table); err != nil {
+		return fmt.Errorf("failed to remove routes from table %d: %w", r.config.Table, err)
+	}
 	return nil
 }
 
-// AddRoute adds a route (placeholder)
+// AddRoute routes a destination prefix through the interface, via gateway
+// if one is given. Unlike SetRoutes it ignores the split tunnel lists.
 func (r *Router) AddRoute(destination, gateway string) error {
-	// Custom routing logic could be added here
+	dst, err := parseDestination(destination)
+	if err != nil {
+		return err
+	}
+
+	var gw netip.Addr
+	if gateway != "" {
+		if gw, err = netip.ParseAddr(gateway); err != nil {
+			return fmt.Errorf("invalid gateway %q: %w", gateway, err)
+		}
+		if gw.Is4() != dst.Addr().Is4() {
+			return fmt.Errorf("gateway %s doesn't match the family of %s", gateway, destination)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.static[dst] = gw
+	if err := r.reconcile(); err != nil {
+		// Don't retry a route the kernel rejected on every later update
+		if _, ok := r.installed[tableRoute{dst: dst, gateway: gw}.key()]; !ok {
+			delete(r.static, dst)
+		}
+		return err
+	}
 	return nil
 }
 
-// RemoveRoute removes a route (placeholder)
+// RemoveRoute removes a route installed by AddRoute
 func (r *Router) RemoveRoute(destination string) error {
-	// Custom routing logic could be added here
+	dst, err := parseDestination(destination)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.static, dst)
+	return r.reconcile()
+}
+
+// SetRoutes makes the overlay subnet routes exactly the given destinations,
+// all directly through the interface
+func (r *Router) SetRoutes(destinations []string) error {
+	subnets := make([]netip.Prefix, 0, len(destinations))
+	for _, destination := range destinations {
+		dst, err := parseDestination(destination)
+		if err != nil {
+			return err
+		}
+		subnets = append(subnets, dst)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.subnets = subnets
+	return r.reconcile()
+}
+
+// SetDefaultRoute sends all traffic without FirewallMark, IPv4 and IPv6,
+// through the interface, for using an exit node. Routes in the main table other than
+// the default route still win, so the LAN and the overlay stay reachable.
+func (r *Router) SetDefaultRoute(enabled bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.defaultRoute = enabled
+	return r.reconcile()
+}
+
+// SetSplitTunnel replaces the include and exclude lists and updates the
+// installed routes to match
+func (r *Router) SetSplitTunnel(include, exclude []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.setSplitTunnel(include, exclude); err != nil {
+		return err
+	}
+	return r.reconcile()
+}
+
+// Routes returns the destinations routed through the overlay other than
+// the default routes, sorted
+func (r *Router) Routes() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	destinations := make([]string, 0, len(r.installed))
+	for _, route := range r.installed {
+		if !route.throw && !slices.Contains(defaultRoutes, route.dst) {
+			destinations = append(destinations, route.dst.String())
+		}
+	}
+	sort.Strings(destinations)
+	return destinations
+}
+
+// setSplitTunnel parses the split tunnel lists; callers hold r.mu
+func (r *Router) setSplitTunnel(include, exclude []string) error {
+	includePrefixes, err := parseDestinations(include)
+	if err != nil {
+		return fmt.Errorf("invalid split tunnel include list: %w", err)
+	}
+	excludePrefixes, err := parseDestinations(exclude)
+	if err != nil {
+		return fmt.Errorf("invalid split tunnel exclude list: %w", err)
+	}
+
+	r.include = includePrefixes
+	r.exclude = excludePrefixes
 	return nil
 }
+
+// desiredRoutes returns the table's routes for the current state: subnet
+// routes and the default route narrowed to the include list and without
+// excluded destinations, AddRoute's routes, and a throw route per exclude;
+// callers hold r.mu
+func (r *Router) desiredRoutes() map[string]tableRoute {
+	candidates := append([]netip.Prefix{}, r.subnets...)
+	if r.defaultRoute {
+		for _, dst := range defaultRoutes {
+			if dst.Addr().Is4() || r.ipv6 {
+				candidates = append(candidates, dst)
+			}
+		}
+	}
+
+	desired := make(map[string]tableRoute)
+	for _, candidate := range candidates {
+		for _, dst := range r.narrow(candidate) {
+			if !r.excluded(dst) {
+				route := tableRoute{dst: dst}
+				desired[route.key()] = route
+			}
+		}
+	}
+
+	for dst, gw := range r.static {
+		route := tableRoute{dst: dst, gateway: gw}
+		desired[route.key()] = route
+	}
+
+	for _, dst := range r.exclude {
+		route := tableRoute{dst: dst, throw: true}
+		desired[route.key()] = route
+	}
+
+	return desired
+}
+
+// narrow returns the parts of dst within the include list, or dst itself
+// when there is no include list; callers hold r.mu
+func (r *Router) narrow(dst netip.Prefix) []netip.Prefix {
+	if len(r.include) == 0 {
+		return []netip.Prefix{dst}
+	}
+
+	var narrowed []netip.Prefix
+	for _, include := range r.include {
+		switch {
+		case include.Bits() <= dst.Bits() && include.Contains(dst.Addr()):
+			narrowed = append(narrowed, dst)
+		case dst.Bits() < include.Bits() && dst.Contains(include.Addr()):
+			narrowed = append(narrowed, include)
+		}
+	}
+	return narrowed
+}
+
+// excluded reports whether dst lies entirely within the exclude list;
+// callers hold r.mu
+func (r *Router) excluded(dst netip.Prefix) bool {
+	for _, exclude := range r.exclude {
+		if exclude.Bits() <= dst.Bits() && exclude.Contains(dst.Addr()) {
+			return true
+		}
+	}
+	return false
+}
+
+// reconcile makes the installed routes match desiredRoutes; before Start
+// it only records the state. Callers hold r.mu.
+func (r *Router) reconcile() error {
+	if !r.started {
+		return nil
+	}
+
+	desired := r.desiredRoutes()
+
+	var firstErr error
+	for key, route := range r.installed {
+		if _, ok := desired[key]; ok {
+			continue
+		}
+		delete(r.installed, key)
+		if err := deleteRoute(r.config.Table, r.linkIndex, r.config.Metric, route); err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("failed to remove route %s: %w", key, err)
+			}
+			continue
+		}
+		log.Printf("Removed route %s from table %d", key, r.config.Table)
+	}
+
+	for key, route := range desired {
+		if installed, ok := r.installed[key]; ok && installed == route {
+			continue
+		}
+		if err := replaceRoute(r.config.Table, r.linkIndex, r.config.Metric, route); err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("failed to add route %s: %w", key, err)
+			}
+			continue
+		}
+		r.installed[key] = route
+		log.Printf("Added route %s via %s to table %d", key, r.config.Interface, r.config.Table)
+	}
+
+	return firstErr
+}
+
+// parseDestination parses a destination prefix in canonical form
+func parseDestination(destination string) (netip.Prefix, error) {
+	dst, err := netip.ParsePrefix(destination)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid destination %q: %w", destination, err)
+	}
+	if dst != dst.Masked() {
+		return netip.Prefix{}, fmt.Errorf("invalid destination %q: host bits set", destination)
+	}
+	return dst, nil
+}
+
+// parseDestinations parses a list of destination prefixes
+func parseDestinations(destinations []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(destinations))
+	for _, destination := range destinations {
+		dst, err := parseDestination(destination)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, dst)
+	}
+	return prefixes, nil
+}
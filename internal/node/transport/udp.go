@@ -11,14 +11,14 @@ type UDPTransport struct {
 	port int
 }
 
-// NewUDPTransport creates a new UDP transport
+// NewUDPTransport creates a new UDP transport, dual-stack where the host
+// supports IPv6
 func NewUDPTransport(port int) (*UDPTransport, error) {
 	addr := &net.UDPAddr{
-		IP:   net.IPv4zero,
 		Port: port,
 	}
 
-	conn, err := net.ListenUDP("udp4", addr)
+	conn, err := net.ListenUDP("udp", addr)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create UDP socket: %w", err)
 	}
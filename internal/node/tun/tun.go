@@ -3,6 +3,7 @@ package tun
 import (
 	"fmt"
 	"os/exec"
+	"strings"
 
 	"golang.zx2c4.com/wireguard/tun"
 )
@@ -57,6 +58,21 @@ func configureIP(name, ip, netmask string) error {
 	return nil
 }
 
+// AddAddress assigns another address in CIDR form to the device. IPv6
+// addresses skip duplicate address detection, which would delay them on a
+// point-to-point link.
+func AddAddress(name, cidr string) error {
+	args := []string{"addr", "add", cidr, "dev", name}
+	if strings.Contains(cidr, ":") {
+		args = append(args, "nodad")
+	}
+
+	if out, err := exec.Command("ip", args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to add address %s: %w: %s", cidr, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
 // Name returns the device name
 func (d *Device) Name() string {
 	return d.name
@@ -0,0 +1,233 @@
+package wireguard
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Backend names accepted by --wg-backend
+const (
+	BackendAuto      = "auto"
+	BackendKernel    = "kernel"
+	BackendUserspace = "userspace"
+)
+
+// PeerConfig is the configuration of one peer
+type PeerConfig struct {
+	PublicKey  *PublicKey
+	Endpoint   string
+	AllowedIPs []string
+
+	// Keepalive is the persistent keepalive interval in seconds (0 disables)
+	Keepalive int
+
+	// PresharedKey is the peer's preshared key, nil if it has none
+	PresharedKey *PresharedKey
+}
+
+// handshakeTimeout is how old the last handshake may be before a tunnel is
+// considered down (WireGuard's REJECT_AFTER_TIME)
+const handshakeTimeout = 180 * time.Second
+
+// PeerStats is the runtime state of one peer as read from the device
+type PeerStats struct {
+	PeerConfig
+
+	// LastHandshake is zero if no handshake has completed
+	LastHandshake time.Time
+	ReceiveBytes  int64
+	TransmitBytes int64
+}
+
+// Up reports whether the tunnel completed a handshake recently enough to
+// carry traffic
+func (s *PeerStats) Up() bool {
+	return !s.LastHandshake.IsZero() && time.Since(s.LastHandshake) < handshakeTimeout
+}
+
+// Backend is a WireGuard implementation the node can drive
+type Backend interface {
+	// Name returns the backend name (kernel or userspace)
+	Name() string
+
+	// AddPeer adds or replaces a peer; a keepalive of 0 disables
+	// persistent keepalives
+	AddPeer(publicKey *PublicKey, endpoint string, allowedIPs []string, keepalive int) error
+
+	// SyncPeers brings the device to the given peer set in one operation
+	// (like wg syncconf): peers no longer wanted are removed and the rest
+	// updated in place, keeping their sessions. It verifies the result by
+	// reading the device back.
+	SyncPeers(peers []PeerConfig) error
+
+	// Peers reads the configured peers back from the device
+	Peers() ([]PeerConfig, error)
+
+	// UpdatePeerEndpoint updates a peer's endpoint
+	UpdatePeerEndpoint(publicKey *PublicKey, endpoint string) error
+
+	// RemovePeer removes a peer
+	RemovePeer(publicKey *PublicKey) error
+
+	// GetPeerStats returns statistics for a peer
+	GetPeerStats(publicKey *PublicKey) (*PeerStats, error)
+
+	// Stats returns statistics for all peers
+	Stats() ([]PeerStats, error)
+
+	// SetPrivateKey replaces the device's private key, keeping its peers
+	SetPrivateKey(privateKey *PrivateKey) error
+
+	// SetPresharedKey replaces a peer's preshared key without touching
+	// its sessions; nil removes it
+	SetPresharedKey(publicKey *PublicKey, psk *PresharedKey) error
+
+	// SetFirewallMark sets the mark on packets sent by the device
+	SetFirewallMark(mark uint32) error
+
+	// AddAddress assigns another address in CIDR form to the interface,
+	// such as the IPv6 overlay address
+	AddAddress(cidr string) error
+
+	// Close tears the device down
+	Close() error
+
+	// Wait blocks until the device is closed
+	Wait()
+}
+
+var (
+	_ Backend = (*KernelDevice)(nil)
+	_ Backend = (*UserspaceDevice)(nil)
+)
+
+// ValidateBackend checks a --wg-backend value
+func ValidateBackend(name string) error {
+	switch name {
+	case BackendAuto, BackendKernel, BackendUserspace:
+		return nil
+	}
+	return fmt.Errorf("unknown WireGuard backend %q (expected %s, %s or %s)", name, BackendAuto, BackendKernel, BackendUserspace)
+}
+
+// KernelAvailable reports why the kernel backend cannot be used, or nil
+func KernelAvailable() error {
+	return kernelModuleAvailable()
+}
+
+// peerChanges works out how to bring a device from its current peers to
+// the desired set: the peers to remove, and the peers to add or update in
+// place. A peer's endpoint is left out when it is the one last applied, so
+// an endpoint WireGuard learned from the peer roaming is kept.
+func peerChanges(current, desired []PeerConfig, lastEndpoints map[PublicKey]string) ([]*PublicKey, []PeerConfig) {
+	wanted := make(map[PublicKey]bool, len(desired))
+	for _, peer := range desired {
+		wanted[*peer.PublicKey] = true
+	}
+
+	var remove []*PublicKey
+	existing := make(map[PublicKey]bool, len(current))
+	for _, peer := range current {
+		existing[*peer.PublicKey] = true
+		if !wanted[*peer.PublicKey] {
+			remove = append(remove, peer.PublicKey)
+		}
+	}
+
+	update := make([]PeerConfig, 0, len(desired))
+	for _, peer := range desired {
+		if existing[*peer.PublicKey] && lastEndpoints[*peer.PublicKey] == peer.Endpoint {
+			peer.Endpoint = ""
+		}
+		update = append(update, peer)
+	}
+	return remove, update
+}
+
+// peerEndpoints returns the endpoints of a peer set by public key
+func peerEndpoints(peers []PeerConfig) map[PublicKey]string {
+	endpoints := make(map[PublicKey]string, len(peers))
+	for _, peer := range peers {
+		endpoints[*peer.PublicKey] = peer.Endpoint
+	}
+	return endpoints
+}
+
+// peerConfigs strips runtime state from peer statistics
+func peerConfigs(stats []PeerStats) []PeerConfig {
+	peers := make([]PeerConfig, 0, len(stats))
+	for _, s := range stats {
+		peers = append(peers, s.PeerConfig)
+	}
+	return peers
+}
+
+// presharedKey returns a preshared key read from a device, nil if it is
+// unset (all zeros)
+func presharedKey(raw [KeyLength]byte) *PresharedKey {
+	if raw == ([KeyLength]byte{}) {
+		return nil
+	}
+	psk := PresharedKey(raw)
+	return &psk
+}
+
+// findPeerStats returns the statistics of one peer
+func findPeerStats(stats []PeerStats, publicKey *PublicKey) (*PeerStats, error) {
+	for i := range stats {
+		if *stats[i].PublicKey == *publicKey {
+			return &stats[i], nil
+		}
+	}
+	return nil, fmt.Errorf("peer %s not found", publicKey)
+}
+
+// verifyPeers checks that the peers read back from a device match the
+// peers that were applied
+func verifyPeers(want, got []PeerConfig) error {
+	applied := make(map[PublicKey]PeerConfig, len(got))
+	for _, peer := range got {
+		applied[*peer.PublicKey] = peer
+	}
+
+	for _, peer := range want {
+		actual, ok := applied[*peer.PublicKey]
+		if !ok {
+			return fmt.Errorf("peer %s missing after sync", peer.PublicKey)
+		}
+		delete(applied, *peer.PublicKey)
+
+		if canonicalPrefixes(peer.AllowedIPs) != canonicalPrefixes(actual.AllowedIPs) {
+			return fmt.Errorf("peer %s has allowed IPs %v after sync, expected %v", peer.PublicKey, actual.AllowedIPs, peer.AllowedIPs)
+		}
+		if actual.Keepalive != peer.Keepalive {
+			return fmt.Errorf("peer %s has keepalive %d after sync, expected %d", peer.PublicKey, actual.Keepalive, peer.Keepalive)
+		}
+		if (actual.PresharedKey == nil) != (peer.PresharedKey == nil) ||
+			(peer.PresharedKey != nil && *actual.PresharedKey != *peer.PresharedKey) {
+			return fmt.Errorf("peer %s has a different preshared key after sync", peer.PublicKey)
+		}
+	}
+
+	for key := range applied {
+		return fmt.Errorf("unexpected peer %s after sync", &key)
+	}
+
+	return nil
+}
+
+// canonicalPrefixes returns a comparable form of a list of CIDRs
+func canonicalPrefixes(cidrs []string) string {
+	prefixes := make([]string, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		if prefix, err := netip.ParsePrefix(cidr); err == nil {
+			cidr = prefix.Masked().String()
+		}
+		prefixes = append(prefixes, cidr)
+	}
+	sort.Strings(prefixes)
+	return strings.Join(prefixes, ",")
+}
@@ -0,0 +1,176 @@
+package wireguard
+
+import (
+	"reflect"
+	"testing"
+)
+
+var (
+	keyA = &PublicKey{1}
+	keyB = &PublicKey{2}
+	keyC = &PublicKey{3}
+)
+
+func TestPeerChanges(t *testing.T) {
+	peerA := PeerConfig{PublicKey: keyA, Endpoint: "192.0.2.1:51820", AllowedIPs: []string{"10.0.0.1/32"}, Keepalive: 25}
+	peerB := PeerConfig{PublicKey: keyB, Endpoint: "192.0.2.2:51820", AllowedIPs: []string{"10.0.0.2/32"}}
+
+	// with returns peerA changed by f
+	with := func(f func(p *PeerConfig)) PeerConfig {
+		p := peerA
+		p.AllowedIPs = append([]string(nil), peerA.AllowedIPs...)
+		f(&p)
+		return p
+	}
+	withoutEndpoint := with(func(p *PeerConfig) { p.Endpoint = "" })
+
+	tests := []struct {
+		name          string
+		current       []PeerConfig
+		desired       []PeerConfig
+		lastEndpoints map[PublicKey]string
+		remove        []*PublicKey
+		update        []PeerConfig
+	}{
+		{
+			name:    "new peer",
+			desired: []PeerConfig{peerA},
+			update:  []PeerConfig{peerA},
+		},
+		{
+			name:    "removed peer",
+			current: []PeerConfig{peerA, peerB},
+			desired: []PeerConfig{peerA},
+			remove:  []*PublicKey{keyB},
+			update:  []PeerConfig{peerA},
+		},
+		{
+			name:    "all peers removed",
+			current: []PeerConfig{peerA, peerB},
+			remove:  []*PublicKey{keyA, keyB},
+			update:  []PeerConfig{},
+		},
+		{
+			name:          "unchanged endpoint keeps the roamed one",
+			current:       []PeerConfig{with(func(p *PeerConfig) { p.Endpoint = "198.51.100.1:4000" })},
+			desired:       []PeerConfig{peerA},
+			lastEndpoints: map[PublicKey]string{*keyA: peerA.Endpoint},
+			update:        []PeerConfig{withoutEndpoint},
+		},
+		{
+			name:          "changed endpoint",
+			current:       []PeerConfig{peerA},
+			desired:       []PeerConfig{with(func(p *PeerConfig) { p.Endpoint = "192.0.2.9:51820" })},
+			lastEndpoints: map[PublicKey]string{*keyA: peerA.Endpoint},
+			update:        []PeerConfig{with(func(p *PeerConfig) { p.Endpoint = "192.0.2.9:51820" })},
+		},
+		{
+			name:    "endpoint never applied",
+			current: []PeerConfig{peerA},
+			desired: []PeerConfig{peerA},
+			update:  []PeerConfig{peerA},
+		},
+		{
+			name:          "changed allowed IPs",
+			current:       []PeerConfig{peerA},
+			desired:       []PeerConfig{with(func(p *PeerConfig) { p.AllowedIPs = append(p.AllowedIPs, "192.168.1.0/24") })},
+			lastEndpoints: map[PublicKey]string{*keyA: peerA.Endpoint},
+			update: []PeerConfig{with(func(p *PeerConfig) {
+				p.Endpoint = ""
+				p.AllowedIPs = append(p.AllowedIPs, "192.168.1.0/24")
+			})},
+		},
+		{
+			name:          "changed keepalive",
+			current:       []PeerConfig{peerA},
+			desired:       []PeerConfig{with(func(p *PeerConfig) { p.Keepalive = 0 })},
+			lastEndpoints: map[PublicKey]string{*keyA: peerA.Endpoint},
+			update:        []PeerConfig{with(func(p *PeerConfig) { p.Endpoint = ""; p.Keepalive = 0 })},
+		},
+		{
+			name:          "preshared key added",
+			current:       []PeerConfig{peerA},
+			desired:       []PeerConfig{with(func(p *PeerConfig) { p.PresharedKey = &PresharedKey{9} })},
+			lastEndpoints: map[PublicKey]string{*keyA: peerA.Endpoint},
+			update:        []PeerConfig{with(func(p *PeerConfig) { p.Endpoint = ""; p.PresharedKey = &PresharedKey{9} })},
+		},
+		{
+			name:          "preshared key removed",
+			current:       []PeerConfig{with(func(p *PeerConfig) { p.PresharedKey = &PresharedKey{9} })},
+			desired:       []PeerConfig{peerA},
+			lastEndpoints: map[PublicKey]string{*keyA: peerA.Endpoint},
+			update:        []PeerConfig{withoutEndpoint},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			remove, update := peerChanges(tt.current, tt.desired, tt.lastEndpoints)
+			if !reflect.DeepEqual(remove, tt.remove) {
+				t.Errorf("removes %v, want %v", remove, tt.remove)
+			}
+			if tt.update == nil {
+				tt.update = []PeerConfig{}
+			}
+			if !reflect.DeepEqual(update, tt.update) {
+				t.Errorf("updates %+v, want %+v", update, tt.update)
+			}
+		})
+	}
+}
+
+func TestPeerChangesKeepsDesired(t *testing.T) {
+	desired := []PeerConfig{{PublicKey: keyA, Endpoint: "192.0.2.1:51820"}}
+	peerChanges(desired, desired, map[PublicKey]string{*keyA: "192.0.2.1:51820"})
+	if desired[0].Endpoint == "" {
+		t.Fatal("peerChanges cleared the endpoint of the desired peers")
+	}
+}
+
+func TestVerifyPeers(t *testing.T) {
+	want := []PeerConfig{
+		{PublicKey: keyA, Endpoint: "192.0.2.1:51820", AllowedIPs: []string{"10.0.0.1/32", "192.168.1.0/24"}, Keepalive: 25, PresharedKey: &PresharedKey{9}},
+		{PublicKey: keyB, AllowedIPs: []string{"10.0.0.2/32"}},
+	}
+
+	// got returns the wanted peers with the first one changed by f
+	got := func(f func(p *PeerConfig)) []PeerConfig {
+		peers := []PeerConfig{want[0], want[1]}
+		f(&peers[0])
+		return peers
+	}
+
+	tests := []struct {
+		name string
+		got  []PeerConfig
+		ok   bool
+	}{
+		{"same", got(func(p *PeerConfig) {}), true},
+		{"roamed endpoint", got(func(p *PeerConfig) { p.Endpoint = "198.51.100.1:4000" }), true},
+		{"allowed IPs reordered", got(func(p *PeerConfig) { p.AllowedIPs = []string{"192.168.1.0/24", "10.0.0.1/32"} }), true},
+		{"allowed IPs unmasked", got(func(p *PeerConfig) { p.AllowedIPs = []string{"10.0.0.1/32", "192.168.1.7/24"} }), true},
+		{"preshared key copy", got(func(p *PeerConfig) { p.PresharedKey = &PresharedKey{9} }), true},
+		{"allowed IP missing", got(func(p *PeerConfig) { p.AllowedIPs = []string{"10.0.0.1/32"} }), false},
+		{"other allowed IP", got(func(p *PeerConfig) { p.AllowedIPs = []string{"10.0.0.1/32", "192.168.2.0/24"} }), false},
+		{"other keepalive", got(func(p *PeerConfig) { p.Keepalive = 0 }), false},
+		{"preshared key missing", got(func(p *PeerConfig) { p.PresharedKey = nil }), false},
+		{"other preshared key", got(func(p *PeerConfig) { p.PresharedKey = &PresharedKey{8} }), false},
+		{"peer missing", want[:1], false},
+		{"unexpected peer", append(got(func(p *PeerConfig) {}), PeerConfig{PublicKey: keyC}), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyPeers(want, tt.got)
+			if tt.ok && err != nil {
+				t.Fatalf("verifyPeers: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("verifyPeers accepted a mismatch")
+			}
+		})
+	}
+
+	// A preshared key left on the device is caught
+	if err := verifyPeers(want[1:], []PeerConfig{{PublicKey: keyB, AllowedIPs: []string{"10.0.0.2/32"}, PresharedKey: &PresharedKey{9}}}); err == nil {
+		t.Fatal("verifyPeers accepted a preshared key that should be removed")
+	}
+}
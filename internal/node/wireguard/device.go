@@ -1,122 +1,264 @@
 package wireguard
 
 import (
+	"errors"
 	"fmt"
+	"net"
 	"os"
-	"os/exec"
-	"strings"
+	"sync"
+
+	"github.com/vishvananda/netlink"
+	"golang.zx2c4.com/wireguard/wgctrl"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 )
 
-// Device represents a WireGuard device using kernel module
-type Device struct {
+// ifaFlagNoDAD is IFA_F_NODAD, which golang.org/x/sys/unix only defines on
+// Linux
+const ifaFlagNoDAD = 0x02
+
+// KernelDevice represents a WireGuard device using kernel module. The link
+// is managed over rtnetlink and configured through the WireGuard generic
+// netlink API, so neither wg nor wg-quick is needed.
+type KernelDevice struct {
 	interfaceName string
-	configPath    string
-}
+	client        *wgctrl.Client
+	link          netlink.Link
+	done          chan struct{}
 
-// NewDevice creates a new WireGuard device using kernel module
-func NewDevice(interfaceName string, privateKey *PrivateKey, virtualIP string, listenPort int) (*Device, error) {
-	// Create WireGuard config file
-	configPath := fmt.Sprintf("/etc/wireguard/%s.conf", interfaceName)
+	// The endpoints last applied by SyncPeers, by peer
+	syncMu    sync.Mutex
+	endpoints map[PublicKey]string
+}
 
-	config := fmt.Sprintf(`[Interface]
-PrivateKey = %s
-Address = %s/24
-ListenPort = %d
-`, privateKey.String(), virtualIP, listenPort)
+// NewKernelDevice creates a new WireGuard device using kernel module
+func NewKernelDevice(interfaceName string, privateKey *PrivateKey, virtualIP, netmask string, listenPort int) (*KernelDevice, error) {
+	addr, err := netlink.ParseAddr(fmt.Sprintf("%s/%s", virtualIP, netmask))
+	if err != nil {
+		return nil, fmt.Errorf("invalid virtual address: %w", err)
+	}
 
-	// Write config file
-	if err := os.MkdirAll("/etc/wireguard", 0700); err != nil {
-		return nil, fmt.Errorf("failed to create wireguard directory: %w", err)
+	// A link left behind by a crashed run would make LinkAdd fail. Only a
+	// WireGuard link can be ours; anything else belongs to someone else.
+	if stale, err := netlink.LinkByName(interfaceName); err == nil {
+		if stale.Type() != "wireguard" {
+			return nil, fmt.Errorf("interface %s already exists as a %s link; set another --tun-device", interfaceName, stale.Type())
+		}
+		if err := netlink.LinkDel(stale); err != nil {
+			return nil, fmt.Errorf("failed to remove stale interface: %w", err)
+		}
 	}
 
-	if err := os.WriteFile(configPath, []byte(config), 0600); err != nil {
-		return nil, fmt.Errorf("failed to write config: %w", err)
+	link, err := createKernelLink(interfaceName)
+	if err != nil {
+		return nil, err
 	}
 
-	// Bring up interface using wg-quick
-	cmd := exec.Command("wg-quick", "up", interfaceName)
-	if output, err := cmd.CombinedOutput(); err != nil {
-		return nil, fmt.Errorf("failed to bring up interface: %w (output: %s)", err, string(output))
+	client, err := wgctrl.New()
+	if err != nil {
+		netlink.LinkDel(link)
+		return nil, fmt.Errorf("failed to open WireGuard netlink client: %w", err)
 	}
 
-	return &Device{
+	d := &KernelDevice{
 		interfaceName: interfaceName,
-		configPath:    configPath,
-	}, nil
-}
+		client:        client,
+		link:          link,
+		done:          make(chan struct{}),
+	}
+
+	key := wgtypes.Key(*privateKey)
+	if err := client.ConfigureDevice(interfaceName, wgtypes.Config{
+		PrivateKey:   &key,
+		ListenPort:   &listenPort,
+		ReplacePeers: true,
+	}); err != nil {
+		d.teardown()
+		return nil, fmt.Errorf("failed to configure device: %w", err)
+	}
 
-// AddPeer adds a peer to the WireGuard device
-func (d *Device) AddPeer(publicKey *PublicKey, endpoint string, allowedIPs []string) error {
-	// Build wg command to add peer
-	args := []string{
-		"set", d.interfaceName,
-		"peer", publicKey.String(),
+	if err := netlink.AddrAdd(link, addr); err != nil {
+		d.teardown()
+		return nil, fmt.Errorf("failed to assign address: %w", err)
 	}
 
-	if endpoint != "" {
-		args = append(args, "endpoint", endpoint)
+	if err := netlink.LinkSetUp(link); err != nil {
+		d.teardown()
+		return nil, fmt.Errorf("failed to bring up interface: %w", err)
 	}
 
-	if len(allowedIPs) > 0 {
-		args = append(args, "allowed-ips", strings.Join(allowedIPs, ","))
+	return d, nil
+}
+
+// createKernelLink adds a WireGuard link
+func createKernelLink(interfaceName string) (netlink.Link, error) {
+	attrs := netlink.NewLinkAttrs()
+	attrs.Name = interfaceName
+	attrs.MTU = 1420
+
+	link := &netlink.Wireguard{LinkAttrs: attrs}
+	if err := netlink.LinkAdd(link); err != nil {
+		return nil, fmt.Errorf("failed to create interface: %w", err)
 	}
 
-	// Add persistent keepalive
-	args = append(args, "persistent-keepalive", "25")
+	return link, nil
+}
+
+// Name returns the backend name
+func (d *KernelDevice) Name() string {
+	return BackendKernel
+}
 
-	cmd := exec.Command("wg", args...)
-	if output, err := cmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("failed to add peer: %w (output: %s)", err, string(output))
+// AddPeer adds a peer to the WireGuard device; a keepalive of 0 disables
+// persistent keepalives
+func (d *KernelDevice) AddPeer(publicKey *PublicKey, endpoint string, allowedIPs []string, keepalive int) error {
+	peer, err := toWGPeer(PeerConfig{
+		PublicKey:  publicKey,
+		Endpoint:   endpoint,
+		AllowedIPs: allowedIPs,
+		Keepalive:  keepalive,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := d.client.ConfigureDevice(d.interfaceName, wgtypes.Config{Peers: []wgtypes.PeerConfig{peer}}); err != nil {
+		return fmt.Errorf("failed to add peer: %w", err)
 	}
 
 	return nil
 }
 
+// SyncPeers brings the device's peers to the given set in one netlink
+// operation, removing the peers no longer wanted and updating the rest in
+// place, and verifies the result
+func (d *KernelDevice) SyncPeers(peers []PeerConfig) error {
+	d.syncMu.Lock()
+	defer d.syncMu.Unlock()
+
+	current, err := d.Peers()
+	if err != nil {
+		return err
+	}
+	remove, update := peerChanges(current, peers, d.endpoints)
+
+	wgPeers := make([]wgtypes.PeerConfig, 0, len(remove)+len(update))
+	for _, publicKey := range remove {
+		wgPeers = append(wgPeers, wgtypes.PeerConfig{PublicKey: wgtypes.Key(*publicKey), Remove: true})
+	}
+	for _, peer := range update {
+		wgPeer, err := toWGPeer(peer)
+		if err != nil {
+			return err
+		}
+		wgPeers = append(wgPeers, wgPeer)
+	}
+
+	if err := d.client.ConfigureDevice(d.interfaceName, wgtypes.Config{Peers: wgPeers}); err != nil {
+		return fmt.Errorf("failed to sync peers: %w", err)
+	}
+	d.endpoints = peerEndpoints(peers)
+
+	applied, err := d.Peers()
+	if err != nil {
+		return err
+	}
+	return verifyPeers(peers, applied)
+}
+
 // UpdatePeerEndpoint updates a peer's endpoint
-func (d *Device) UpdatePeerEndpoint(publicKey *PublicKey, endpoint string) error {
-	cmd := exec.Command("wg", "set", d.interfaceName,
-		"peer", publicKey.String(),
-		"endpoint", endpoint,
-	)
+func (d *KernelDevice) UpdatePeerEndpoint(publicKey *PublicKey, endpoint string) error {
+	addr, err := net.ResolveUDPAddr("udp", endpoint)
+	if err != nil {
+		return fmt.Errorf("invalid endpoint: %w", err)
+	}
 
-	if output, err := cmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("failed to update endpoint: %w (output: %s)", err, string(output))
+	peer := wgtypes.PeerConfig{
+		PublicKey:  wgtypes.Key(*publicKey),
+		UpdateOnly: true,
+		Endpoint:   addr,
+	}
+	if err := d.client.ConfigureDevice(d.interfaceName, wgtypes.Config{Peers: []wgtypes.PeerConfig{peer}}); err != nil {
+		return fmt.Errorf("failed to update endpoint: %w", err)
 	}
 
 	return nil
 }
 
 // RemovePeer removes a peer from the WireGuard device
-func (d *Device) RemovePeer(publicKey *PublicKey) error {
-	cmd := exec.Command("wg", "set", d.interfaceName,
-		"peer", publicKey.String(),
-		"remove",
-	)
+func (d *KernelDevice) RemovePeer(publicKey *PublicKey) error {
+	peer := wgtypes.PeerConfig{
+		PublicKey: wgtypes.Key(*publicKey),
+		Remove:    true,
+	}
+	if err := d.client.ConfigureDevice(d.interfaceName, wgtypes.Config{Peers: []wgtypes.PeerConfig{peer}}); err != nil {
+		return fmt.Errorf("failed to remove peer: %w", err)
+	}
+
+	return nil
+}
 
-	if output, err := cmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("failed to remove peer: %w (output: %s)", err, string(output))
+// AddAddress assigns another address to the interface. IPv6 addresses skip
+// duplicate address detection, which would delay them on a point-to-point
+// link.
+func (d *KernelDevice) AddAddress(cidr string) error {
+	addr, err := netlink.ParseAddr(cidr)
+	if err != nil {
+		return fmt.Errorf("invalid address: %w", err)
+	}
+	if addr.IP.To4() == nil {
+		addr.Flags = ifaFlagNoDAD
 	}
 
+	if err := netlink.AddrAdd(d.link, addr); err != nil {
+		return fmt.Errorf("failed to assign address %s: %w", cidr, err)
+	}
 	return nil
 }
 
 // Close closes the WireGuard device
-func (d *Device) Close() error {
-	// Bring down interface
-	cmd := exec.Command("wg-quick", "down", d.interfaceName)
-	if output, err := cmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("failed to bring down interface: %w (output: %s)", err, string(output))
+func (d *KernelDevice) Close() error {
+	select {
+	case <-d.done:
+		return nil
+	default:
 	}
+	defer close(d.done)
+
+	return d.teardown()
+}
 
-	// Remove config file
-	if err := os.Remove(d.configPath); err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("failed to remove config: %w", err)
+// teardown deletes the link and closes the netlink client
+func (d *KernelDevice) teardown() error {
+	d.client.Close()
+
+	if err := netlink.LinkDel(d.link); err != nil {
+		return fmt.Errorf("failed to delete interface: %w", err)
 	}
 
 	return nil
 }
 
-// Wait is a no-op for kernel WireGuard
-func (d *Device) Wait() {
-	// Kernel WireGuard doesn't need to wait
+// Wait blocks until the device is closed
+func (d *KernelDevice) Wait() {
+	<-d.done
+}
+
+// kernelModuleAvailable probes for kernel WireGuard support. Loadable
+// modules show up in sysfs; built-in ones are probed by creating a
+// throwaway interface.
+func kernelModuleAvailable() error {
+	if _, err := os.Stat("/sys/module/wireguard"); err == nil {
+		return nil
+	}
+
+	link, err := createKernelLink("wgprobe0")
+	if err != nil {
+		if errors.Is(err, os.ErrPermission) {
+			return fmt.Errorf("CAP_NET_ADMIN required: %w", err)
+		}
+		return fmt.Errorf("kernel module unavailable: %w", err)
+	}
+	netlink.LinkDel(link)
+
+	return nil
 }
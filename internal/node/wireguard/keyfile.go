@@ -0,0 +1,371 @@
+package wireguard
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/shared/utils"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Key encryption modes accepted by --key-encryption
+const (
+	KeyEncryptionNone       = "none"
+	KeyEncryptionPassphrase = "passphrase"
+	KeyEncryptionKeyring    = "keyring"
+	KeyEncryptionCredential = "credential"
+)
+
+// Default secret locations for the keyring and systemd credential modes
+const (
+	DefaultKeyringKey     = "shadownet:private-key"
+	DefaultCredentialName = "shadownet-key"
+)
+
+// PassphraseEnv holds the key passphrase when no passphrase file is set
+const PassphraseEnv = "SHADOWNET_KEY_PASSPHRASE"
+
+// minSecretLength is the shortest keyring or credential secret accepted;
+// those secrets aren't stretched like passphrases, so they must be random
+const minSecretLength = 16
+
+// Argon2id parameters for new passphrase-encrypted files. They are stored
+// in the file, so they can be raised without breaking existing keys.
+const (
+	argonTime    = 3
+	argonMemory  = 64 * 1024
+	argonThreads = 4
+)
+
+// sealedKeyVersion is the format version of encrypted key files
+const sealedKeyVersion = 1
+
+// KeyEncryption says how a private key file is encrypted at rest
+type KeyEncryption struct {
+	// Mode is none (or empty), passphrase, keyring or credential
+	Mode string
+
+	// Secret locates the secret: a passphrase file (default: the
+	// SHADOWNET_KEY_PASSPHRASE environment variable), a kernel keyring key
+	// description or a systemd credential name
+	Secret string
+}
+
+// Validate checks the mode
+func (e KeyEncryption) Validate() error {
+	switch e.Mode {
+	case "", KeyEncryptionNone, KeyEncryptionPassphrase, KeyEncryptionKeyring, KeyEncryptionCredential:
+		return nil
+	}
+	return fmt.Errorf("unknown key encryption %q: use none, passphrase, keyring or credential", e.Mode)
+}
+
+// Enabled reports whether key files are encrypted
+func (e KeyEncryption) Enabled() bool {
+	return e.Mode != "" && e.Mode != KeyEncryptionNone
+}
+
+// sealedKey is the on-disk form of an encrypted private key
+type sealedKey struct {
+	Version    int      `json:"shadownet_key"`
+	Encryption string   `json:"encryption"`
+	KDF        *kdfInfo `json:"kdf,omitempty"`
+	Salt       []byte   `json:"salt"`
+	Nonce      []byte   `json:"nonce"`
+	Ciphertext []byte   `json:"ciphertext"`
+}
+
+// kdfInfo records the passphrase stretching parameters
+type kdfInfo struct {
+	Name    string `json:"name"`
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"`
+	Threads uint8  `json:"threads"`
+}
+
+// KeyFile is a private key file, optionally encrypted
+type KeyFile struct {
+	Path       string
+	Encryption KeyEncryption
+}
+
+// Load reads the private key. It refuses files readable by other users
+// and files whose encryption doesn't match the configured one.
+func (f *KeyFile) Load() (*PrivateKey, error) {
+	info, err := os.Stat(f.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	if perm := info.Mode().Perm(); runtime.GOOS != "windows" && perm&0077 != 0 {
+		return nil, fmt.Errorf("key file %s has mode %04o and is accessible by other users; run chmod 600 on it", f.Path, perm)
+	}
+
+	data, err := os.ReadFile(f.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+
+	sealed := isSealed(data)
+	switch {
+	case sealed && !f.Encryption.Enabled():
+		var s sealedKey
+		if err := json.Unmarshal(data, &s); err != nil {
+			return nil, fmt.Errorf("failed to parse encrypted key file: %w", err)
+		}
+		return nil, fmt.Errorf("key file %s is encrypted (%s); set --key-encryption to read it", f.Path, s.Encryption)
+	case !sealed && f.Encryption.Enabled():
+		return nil, fmt.Errorf("key file %s is not encrypted; encrypt it with 'shadownet encrypt-key' first", f.Path)
+	case !sealed:
+		return ParsePrivateKey(strings.TrimSpace(string(data)))
+	}
+
+	return f.open(data)
+}
+
+// Save writes the private key with mode 0600, encrypting it if configured
+func (f *KeyFile) Save(k *PrivateKey) error {
+	data := []byte(k.String())
+	if f.Encryption.Enabled() {
+		var err error
+		if data, err = f.seal(k); err != nil {
+			return err
+		}
+	}
+
+	if err := utils.WriteFileAtomic(f.Path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write key: %w", err)
+	}
+	return nil
+}
+
+// LoadOrGenerate loads the private key, or generates and saves one if the
+// file doesn't exist
+func (f *KeyFile) LoadOrGenerate() (*PrivateKey, error) {
+	key, err := f.Load()
+	if err == nil || !errors.Is(err, fs.ErrNotExist) {
+		return key, err
+	}
+
+	key, err = GeneratePrivateKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	if err := f.Save(key); err != nil {
+		return nil, fmt.Errorf("failed to save key: %w", err)
+	}
+	return key, nil
+}
+
+// seal encrypts the key with XChaCha20-Poly1305 under a key derived from
+// the configured secret
+func (f *KeyFile) seal(k *PrivateKey) ([]byte, error) {
+	s := sealedKey{
+		Version:    sealedKeyVersion,
+		Encryption: f.Encryption.Mode,
+		Salt:       make([]byte, 16),
+		Nonce:      make([]byte, chacha20poly1305.NonceSizeX),
+	}
+	if f.Encryption.Mode == KeyEncryptionPassphrase {
+		s.KDF = &kdfInfo{Name: "argon2id", Time: argonTime, Memory: argonMemory, Threads: argonThreads}
+	}
+	if _, err := rand.Read(s.Salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	if _, err := rand.Read(s.Nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	aead, err := f.aead(&s)
+	if err != nil {
+		return nil, err
+	}
+	s.Ciphertext = aead.Seal(nil, s.Nonce, k[:], s.additionalData())
+
+	return json.MarshalIndent(s, "", "  ")
+}
+
+// open decrypts an encrypted key file
+func (f *KeyFile) open(data []byte) (*PrivateKey, error) {
+	var s sealedKey
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to parse encrypted key file: %w", err)
+	}
+	if s.Version != sealedKeyVersion {
+		return nil, fmt.Errorf("unsupported encrypted key file version %d", s.Version)
+	}
+	if s.Encryption != f.Encryption.Mode {
+		return nil, fmt.Errorf("key file %s is encrypted with %s, not %s", f.Path, s.Encryption, f.Encryption.Mode)
+	}
+	if len(s.Nonce) != chacha20poly1305.NonceSizeX {
+		return nil, fmt.Errorf("invalid nonce in encrypted key file")
+	}
+
+	aead, err := f.aead(&s)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := aead.Open(nil, s.Nonce, s.Ciphertext, s.additionalData())
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt key file %s: wrong %s or corrupted file", f.Path, s.Encryption)
+	}
+	if len(plain) != KeyLength {
+		return nil, fmt.Errorf("invalid key length: expected %d, got %d", KeyLength, len(plain))
+	}
+
+	var key PrivateKey
+	copy(key[:], plain)
+	return &key, nil
+}
+
+// aead derives the file key from the configured secret
+func (f *KeyFile) aead(s *sealedKey) (cipher.AEAD, error) {
+	secret, err := f.Encryption.secret()
+	if err != nil {
+		return nil, err
+	}
+
+	// Passphrases are stretched; random secrets only need HKDF
+	if (s.Encryption == KeyEncryptionPassphrase) != (s.KDF != nil) {
+		return nil, fmt.Errorf("invalid key derivation for %s encryption", s.Encryption)
+	}
+
+	var key []byte
+	if s.KDF != nil {
+		if s.KDF.Name != "argon2id" {
+			return nil, fmt.Errorf("unsupported key derivation %q", s.KDF.Name)
+		}
+		key = argon2.IDKey(secret, s.Salt, s.KDF.Time, s.KDF.Memory, s.KDF.Threads, chacha20poly1305.KeySize)
+	} else {
+		if key, err = hkdf.Key(sha256.New, secret, s.Salt, "shadownet private key", chacha20poly1305.KeySize); err != nil {
+			return nil, fmt.Errorf("failed to derive key: %w", err)
+		}
+	}
+
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return aead, nil
+}
+
+// additionalData binds the ciphertext to the file's format and mode
+func (s *sealedKey) additionalData() []byte {
+	return fmt.Appendf(nil, "shadownet-key-v%d:%s", s.Version, s.Encryption)
+}
+
+// secret reads the secret the file key is derived from
+func (e KeyEncryption) secret() ([]byte, error) {
+	switch e.Mode {
+	case KeyEncryptionPassphrase:
+		return e.passphrase()
+	case KeyEncryptionKeyring:
+		name := e.Secret
+		if name == "" {
+			name = DefaultKeyringKey
+		}
+		secret, err := readKeyring(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key %q from the kernel keyring: %w", name, err)
+		}
+		return checkSecretLength(secret)
+	case KeyEncryptionCredential:
+		name := e.Secret
+		if name == "" {
+			name = DefaultCredentialName
+		}
+		dir := os.Getenv("CREDENTIALS_DIRECTORY")
+		if dir == "" {
+			return nil, fmt.Errorf("CREDENTIALS_DIRECTORY is not set; run the node as a systemd service with LoadCredential= or LoadCredentialEncrypted=")
+		}
+		secret, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read systemd credential %q: %w", name, err)
+		}
+		return checkSecretLength(secret)
+	}
+	return nil, fmt.Errorf("key encryption is disabled")
+}
+
+// passphrase reads the passphrase from the configured file or the
+// environment
+func (e KeyEncryption) passphrase() ([]byte, error) {
+	var passphrase []byte
+	if e.Secret != "" {
+		data, err := os.ReadFile(e.Secret)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read passphrase file: %w", err)
+		}
+		passphrase = bytes.TrimRight(data, "\r\n")
+	} else {
+		passphrase = []byte(os.Getenv(PassphraseEnv))
+	}
+
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("no key passphrase: set --key-secret to a passphrase file or %s", PassphraseEnv)
+	}
+	return passphrase, nil
+}
+
+// checkSecretLength rejects secrets too short to use without stretching
+func checkSecretLength(secret []byte) ([]byte, error) {
+	if len(secret) < minSecretLength {
+		return nil, fmt.Errorf("secret is %d bytes; use at least %d random bytes", len(secret), minSecretLength)
+	}
+	return secret, nil
+}
+
+// isSealed reports whether key file contents are an encrypted key rather
+// than a base64 key
+func isSealed(data []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(data), []byte("{"))
+}
+
+// EncryptKeyFile encrypts an existing unencrypted key file in place. The
+// file's mode isn't checked, since the rewritten file gets mode 0600.
+func EncryptKeyFile(path string, encryption KeyEncryption) (*PublicKey, error) {
+	if !encryption.Enabled() {
+		return nil, fmt.Errorf("no key encryption given")
+	}
+	if err := encryption.Validate(); err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	if isSealed(data) {
+		return nil, fmt.Errorf("key file %s is already encrypted", path)
+	}
+	key, err := ParsePrivateKey(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	f := &KeyFile{Path: path, Encryption: encryption}
+	if err := f.Save(key); err != nil {
+		return nil, err
+	}
+
+	// Make sure the key can be read back before the plaintext is gone for
+	// good
+	if _, err := f.Load(); err != nil {
+		if restoreErr := key.SaveToFile(path); restoreErr != nil {
+			return nil, fmt.Errorf("failed to read back encrypted key (%v) and to restore it: %w", err, restoreErr)
+		}
+		return nil, fmt.Errorf("failed to read back encrypted key, left it unencrypted: %w", err)
+	}
+	return key.PublicKey(), nil
+}
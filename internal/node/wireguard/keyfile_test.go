@@ -0,0 +1,224 @@
+package wireguard
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// passphraseKeyFile returns a passphrase-encrypted key file in a temporary
+// directory, with the passphrase in a file next to it
+func passphraseKeyFile(t *testing.T, passphrase string) *KeyFile {
+	t.Helper()
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "passphrase")
+	if err := os.WriteFile(secret, []byte(passphrase+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return &KeyFile{
+		Path:       filepath.Join(dir, "private.key"),
+		Encryption: KeyEncryption{Mode: KeyEncryptionPassphrase, Secret: secret},
+	}
+}
+
+// saveNewKey generates a key and saves it to f
+func saveNewKey(t *testing.T, f *KeyFile) *PrivateKey {
+	t.Helper()
+	key, err := GeneratePrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Save(key); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	return key
+}
+
+// rewriteSealed decodes the encrypted key file, applies edit and writes it
+// back
+func rewriteSealed(t *testing.T, f *KeyFile, edit func(*sealedKey)) {
+	t.Helper()
+	data, err := os.ReadFile(f.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s sealedKey
+	if err := json.Unmarshal(data, &s); err != nil {
+		t.Fatal(err)
+	}
+	edit(&s)
+	if data, err = json.Marshal(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(f.Path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKeyFilePassphraseRoundTrip(t *testing.T) {
+	f := passphraseKeyFile(t, "correct horse battery staple")
+	key := saveNewKey(t, f)
+
+	data, err := os.ReadFile(f.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), key.String()) {
+		t.Fatal("encrypted key file contains the plaintext key")
+	}
+
+	loaded, err := f.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if *loaded != *key {
+		t.Fatal("loaded key differs from the saved one")
+	}
+}
+
+func TestKeyFileWrongPassphrase(t *testing.T) {
+	f := passphraseKeyFile(t, "correct horse battery staple")
+	saveNewKey(t, f)
+
+	wrong := passphraseKeyFile(t, "incorrect horse battery staple")
+	wrong.Path = f.Path
+	if _, err := wrong.Load(); err == nil {
+		t.Fatal("Load succeeded with the wrong passphrase")
+	}
+}
+
+func TestKeyFileTampered(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(*sealedKey)
+	}{
+		{"ciphertext", func(s *sealedKey) { s.Ciphertext[0] ^= 1 }},
+		{"tag", func(s *sealedKey) { s.Ciphertext[len(s.Ciphertext)-1] ^= 1 }},
+		{"nonce", func(s *sealedKey) { s.Nonce[0] ^= 1 }},
+		{"salt", func(s *sealedKey) { s.Salt[0] ^= 1 }},
+		{"kdf parameters", func(s *sealedKey) { s.KDF.Time = 1 }},
+		{"kdf removed", func(s *sealedKey) { s.KDF = nil }},
+		{"truncated", func(s *sealedKey) { s.Ciphertext = s.Ciphertext[:len(s.Ciphertext)-1] }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := passphraseKeyFile(t, "correct horse battery staple")
+			saveNewKey(t, f)
+			rewriteSealed(t, f, tt.edit)
+			if _, err := f.Load(); err == nil {
+				t.Fatal("Load accepted a tampered key file")
+			}
+		})
+	}
+}
+
+func TestKeyFileCredentialRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("CREDENTIALS_DIRECTORY", dir)
+	if err := os.WriteFile(filepath.Join(dir, DefaultCredentialName), []byte("0123456789abcdef0123456789abcdef"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	f := &KeyFile{
+		Path:       filepath.Join(t.TempDir(), "private.key"),
+		Encryption: KeyEncryption{Mode: KeyEncryptionCredential},
+	}
+	key := saveNewKey(t, f)
+
+	loaded, err := f.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if *loaded != *key {
+		t.Fatal("loaded key differs from the saved one")
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, DefaultCredentialName), []byte("fedcba9876543210fedcba9876543210"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Load(); err == nil {
+		t.Fatal("Load succeeded with a different credential")
+	}
+}
+
+func TestKeyFileShortCredential(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("CREDENTIALS_DIRECTORY", dir)
+	if err := os.WriteFile(filepath.Join(dir, DefaultCredentialName), []byte("short"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	f := &KeyFile{
+		Path:       filepath.Join(t.TempDir(), "private.key"),
+		Encryption: KeyEncryption{Mode: KeyEncryptionCredential},
+	}
+	key, err := GeneratePrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Save(key); err == nil {
+		t.Fatal("Save accepted a credential shorter than the minimum")
+	}
+}
+
+func TestKeyFileEncryptionMismatch(t *testing.T) {
+	f := passphraseKeyFile(t, "correct horse battery staple")
+	saveNewKey(t, f)
+
+	plain := &KeyFile{Path: f.Path}
+	if _, err := plain.Load(); err == nil {
+		t.Fatal("Load read an encrypted key file without key encryption")
+	}
+
+	unencrypted := &KeyFile{Path: filepath.Join(t.TempDir(), "private.key")}
+	saveNewKey(t, unencrypted)
+	f.Path = unencrypted.Path
+	if _, err := f.Load(); err == nil {
+		t.Fatal("Load accepted an unencrypted key file with key encryption configured")
+	}
+}
+
+func TestKeyFilePermissive(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes aren't checked on Windows")
+	}
+
+	f := &KeyFile{Path: filepath.Join(t.TempDir(), "private.key")}
+	saveNewKey(t, f)
+	if err := os.Chmod(f.Path, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Load(); err == nil {
+		t.Fatal("Load accepted a key file readable by other users")
+	}
+}
+
+func TestEncryptKeyFile(t *testing.T) {
+	f := passphraseKeyFile(t, "correct horse battery staple")
+	plain := &KeyFile{Path: f.Path}
+	key := saveNewKey(t, plain)
+
+	pub, err := EncryptKeyFile(f.Path, f.Encryption)
+	if err != nil {
+		t.Fatalf("EncryptKeyFile: %v", err)
+	}
+	if *pub != *key.PublicKey() {
+		t.Fatal("EncryptKeyFile returned the wrong public key")
+	}
+
+	loaded, err := f.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if *loaded != *key {
+		t.Fatal("loaded key differs from the original one")
+	}
+
+	if _, err := EncryptKeyFile(f.Path, f.Encryption); err == nil {
+		t.Fatal("EncryptKeyFile encrypted a key file twice")
+	}
+}
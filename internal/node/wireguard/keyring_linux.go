@@ -0,0 +1,34 @@
+package wireguard
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// readKeyring reads a "user" key from the kernel keyring, searching the
+// user keyring first and then the session keyring
+func readKeyring(description string) ([]byte, error) {
+	var id int
+	var err error
+	for _, ring := range []int{unix.KEY_SPEC_USER_KEYRING, unix.KEY_SPEC_SESSION_KEYRING} {
+		if id, err = unix.KeyctlSearch(ring, "user", description, 0); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("key not found: %w", err)
+	}
+
+	// A nil buffer returns the payload's length
+	size, err := unix.KeyctlBuffer(unix.KEYCTL_READ, id, nil, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key: %w", err)
+	}
+	buf := make([]byte, size)
+	n, err := unix.KeyctlBuffer(unix.KEYCTL_READ, id, buf, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key: %w", err)
+	}
+	return buf[:min(n, size)], nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package wireguard
+
+import "fmt"
+
+// readKeyring is only supported on Linux
+func readKeyring(description string) ([]byte, error) {
+	return nil, fmt.Errorf("the kernel keyring is only available on Linux")
+}
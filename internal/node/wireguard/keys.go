@@ -4,7 +4,6 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"fmt"
-	"os"
 
 	"golang.org/x/crypto/curve25519"
 )
@@ -20,6 +19,9 @@ type PrivateKey [KeyLength]byte
 // PublicKey represents a WireGuard public key
 type PublicKey [KeyLength]byte
 
+// PresharedKey is a symmetric key mixed into the handshakes with one peer
+type PresharedKey [KeyLength]byte
+
 // GeneratePrivateKey generates a new random private key
 func GeneratePrivateKey() (*PrivateKey, error) {
 	var key PrivateKey
@@ -63,6 +65,11 @@ func (k *PublicKey) HexString() string {
 	return fmt.Sprintf("%x", k[:])
 }
 
+// HexString returns the hex-encoded preshared key (for WireGuard IPC)
+func (k *PresharedKey) HexString() string {
+	return fmt.Sprintf("%x", k[:])
+}
+
 // ParsePrivateKey parses a base64-encoded private key
 func ParsePrivateKey(encoded string) (*PrivateKey, error) {
 	decoded, err := base64.StdEncoding.DecodeString(encoded)
@@ -95,54 +102,20 @@ func ParsePublicKey(encoded string) (*PublicKey, error) {
 	return &key, nil
 }
 
-// SaveToFile saves the private key to a file
+// SaveToFile saves the private key unencrypted to a file with restricted
+// permissions (0600), replacing it atomically so a crash never leaves a
+// truncated key
 func (k *PrivateKey) SaveToFile(path string) error {
-	// Create file with restricted permissions (0600)
-	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
-	if err != nil {
-		return fmt.Errorf("failed to create key file: %w", err)
-	}
-	defer f.Close()
-
-	_, err = f.WriteString(k.String())
-	if err != nil {
-		return fmt.Errorf("failed to write key: %w", err)
-	}
-
-	return nil
+	return (&KeyFile{Path: path}).Save(k)
 }
 
-// LoadPrivateKeyFromFile loads a private key from a file
+// LoadPrivateKeyFromFile loads an unencrypted private key from a file
 func LoadPrivateKeyFromFile(path string) (*PrivateKey, error) {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read key file: %w", err)
-	}
-
-	return ParsePrivateKey(string(data))
+	return (&KeyFile{Path: path}).Load()
 }
 
-// LoadOrGeneratePrivateKey loads a private key from file or generates a new one
+// LoadOrGeneratePrivateKey loads an unencrypted private key from file or
+// generates a new one
 func LoadOrGeneratePrivateKey(path string) (*PrivateKey, error) {
-	// Try to load existing key
-	key, err := LoadPrivateKeyFromFile(path)
-	if err == nil {
-		return key, nil
-	}
-
-	// Check if file doesn't exist (unwrap the error)
-	if _, statErr := os.Stat(path); os.IsNotExist(statErr) {
-		key, err := GeneratePrivateKey()
-		if err != nil {
-			return nil, fmt.Errorf("failed to generate key: %w", err)
-		}
-
-		if err := key.SaveToFile(path); err != nil {
-			return nil, fmt.Errorf("failed to save key: %w", err)
-		}
-
-		return key, nil
-	}
-
-	return nil, err
+	return (&KeyFile{Path: path}).LoadOrGenerate()
 }
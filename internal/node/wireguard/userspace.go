@@ -0,0 +1,279 @@
+package wireguard
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Vaibhav2154/ShadowNet/internal/node/tun"
+	"golang.zx2c4.com/wireguard/conn"
+	"golang.zx2c4.com/wireguard/device"
+)
+
+// UserspaceDevice is a WireGuard device running in-process (wireguard-go)
+// on top of a TUN device and a caller-provided bind, so the UDP socket can
+// be shared with STUN and hole punching
+type UserspaceDevice struct {
+	interfaceName string
+	device        *device.Device
+
+	// The endpoints last applied by SyncPeers, by peer
+	syncMu    sync.Mutex
+	endpoints map[PublicKey]string
+}
+
+// NewUserspaceDevice creates a userspace WireGuard device
+func NewUserspaceDevice(interfaceName string, privateKey *PrivateKey, virtualIP, netmask string, listenPort int, bind conn.Bind) (*UserspaceDevice, error) {
+	tunDevice, err := tun.CreateTUN(interfaceName, virtualIP, netmask)
+	if err != nil {
+		return nil, err
+	}
+
+	logger := device.NewLogger(device.LogLevelError, fmt.Sprintf("(%s) ", tunDevice.Name()))
+	wgDevice := device.NewDevice(tunDevice.Device(), bind, logger)
+
+	config := fmt.Sprintf("private_key=%s\nlisten_port=%d\n", privateKey.HexString(), listenPort)
+	if err := wgDevice.IpcSet(config); err != nil {
+		wgDevice.Close()
+		return nil, fmt.Errorf("failed to configure device: %w", err)
+	}
+
+	if err := wgDevice.Up(); err != nil {
+		wgDevice.Close()
+		return nil, fmt.Errorf("failed to bring up device: %w", err)
+	}
+
+	return &UserspaceDevice{
+		interfaceName: tunDevice.Name(),
+		device:        wgDevice,
+	}, nil
+}
+
+// Name returns the backend name
+func (d *UserspaceDevice) Name() string {
+	return BackendUserspace
+}
+
+// AddPeer adds a peer to the WireGuard device; a keepalive of 0 disables
+// persistent keepalives
+func (d *UserspaceDevice) AddPeer(publicKey *PublicKey, endpoint string, allowedIPs []string, keepalive int) error {
+	var b strings.Builder
+	writePeerConfig(&b, PeerConfig{
+		PublicKey:  publicKey,
+		Endpoint:   endpoint,
+		AllowedIPs: allowedIPs,
+		Keepalive:  keepalive,
+	})
+
+	if err := d.device.IpcSet(b.String()); err != nil {
+		return fmt.Errorf("failed to add peer: %w", err)
+	}
+
+	return nil
+}
+
+// SyncPeers brings the device's peers to the given set in one IPC
+// transaction, removing the peers no longer wanted and updating the rest
+// in place, and verifies the result
+func (d *UserspaceDevice) SyncPeers(peers []PeerConfig) error {
+	d.syncMu.Lock()
+	defer d.syncMu.Unlock()
+
+	current, err := d.Peers()
+	if err != nil {
+		return err
+	}
+	remove, update := peerChanges(current, peers, d.endpoints)
+
+	var b strings.Builder
+	for _, publicKey := range remove {
+		fmt.Fprintf(&b, "public_key=%s\nremove=true\n", publicKey.HexString())
+	}
+	for _, peer := range update {
+		writePeerConfig(&b, peer)
+	}
+
+	if err := d.device.IpcSet(b.String()); err != nil {
+		return fmt.Errorf("failed to sync peers: %w", err)
+	}
+	d.endpoints = peerEndpoints(peers)
+
+	applied, err := d.Peers()
+	if err != nil {
+		return err
+	}
+	return verifyPeers(peers, applied)
+}
+
+// Peers reads the configured peers back from the device
+func (d *UserspaceDevice) Peers() ([]PeerConfig, error) {
+	stats, err := d.Stats()
+	if err != nil {
+		return nil, err
+	}
+	return peerConfigs(stats), nil
+}
+
+// Stats reads statistics for all peers from the device's UAPI state
+func (d *UserspaceDevice) Stats() ([]PeerStats, error) {
+	config, err := d.device.IpcGet()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read device: %w", err)
+	}
+
+	var stats []PeerStats
+	var current *PeerStats
+	var handshakeSec, handshakeNsec int64
+	scanner := bufio.NewScanner(strings.NewReader(config))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
+			continue
+		}
+
+		if key == "public_key" {
+			raw, err := hex.DecodeString(value)
+			if err != nil || len(raw) != KeyLength {
+				return nil, fmt.Errorf("invalid public key in device state: %s", value)
+			}
+			var publicKey PublicKey
+			copy(publicKey[:], raw)
+			stats = append(stats, PeerStats{PeerConfig: PeerConfig{PublicKey: &publicKey}})
+			current = &stats[len(stats)-1]
+			handshakeSec, handshakeNsec = 0, 0
+			continue
+		}
+		if current == nil {
+			continue
+		}
+
+		switch key {
+		case "endpoint":
+			current.Endpoint = value
+		case "persistent_keepalive_interval":
+			current.Keepalive, _ = strconv.Atoi(value)
+		case "preshared_key":
+			var raw [KeyLength]byte
+			if n, err := hex.Decode(raw[:], []byte(value)); err == nil && n == KeyLength {
+				current.PresharedKey = presharedKey(raw)
+			}
+		case "allowed_ip":
+			current.AllowedIPs = append(current.AllowedIPs, value)
+		case "rx_bytes":
+			current.ReceiveBytes, _ = strconv.ParseInt(value, 10, 64)
+		case "tx_bytes":
+			current.TransmitBytes, _ = strconv.ParseInt(value, 10, 64)
+		case "last_handshake_time_sec":
+			handshakeSec, _ = strconv.ParseInt(value, 10, 64)
+		case "last_handshake_time_nsec":
+			handshakeNsec, _ = strconv.ParseInt(value, 10, 64)
+		}
+
+		if handshakeSec != 0 || handshakeNsec != 0 {
+			current.LastHandshake = time.Unix(handshakeSec, handshakeNsec)
+		}
+	}
+
+	return stats, nil
+}
+
+// writePeerConfig appends a peer in UAPI format, replacing its allowed IPs
+// and preshared key
+func writePeerConfig(b *strings.Builder, peer PeerConfig) {
+	fmt.Fprintf(b, "public_key=%s\n", peer.PublicKey.HexString())
+	b.WriteString("replace_allowed_ips=true\n")
+
+	if peer.Endpoint != "" {
+		fmt.Fprintf(b, "endpoint=%s\n", peer.Endpoint)
+	}
+
+	fmt.Fprintf(b, "persistent_keepalive_interval=%d\n", peer.Keepalive)
+
+	// Always written: an all-zero key removes one the peer had before
+	psk := peer.PresharedKey
+	if psk == nil {
+		psk = &PresharedKey{}
+	}
+	fmt.Fprintf(b, "preshared_key=%s\n", psk.HexString())
+
+	for _, allowedIP := range peer.AllowedIPs {
+		fmt.Fprintf(b, "allowed_ip=%s\n", allowedIP)
+	}
+}
+
+// UpdatePeerEndpoint updates a peer's endpoint
+func (d *UserspaceDevice) UpdatePeerEndpoint(publicKey *PublicKey, endpoint string) error {
+	config := fmt.Sprintf("public_key=%s\nupdate_only=true\nendpoint=%s\n", publicKey.HexString(), endpoint)
+	if err := d.device.IpcSet(config); err != nil {
+		return fmt.Errorf("failed to update endpoint: %w", err)
+	}
+
+	return nil
+}
+
+// RemovePeer removes a peer from the WireGuard device
+func (d *UserspaceDevice) RemovePeer(publicKey *PublicKey) error {
+	config := fmt.Sprintf("public_key=%s\nremove=true\n", publicKey.HexString())
+	if err := d.device.IpcSet(config); err != nil {
+		return fmt.Errorf("failed to remove peer: %w", err)
+	}
+
+	return nil
+}
+
+// GetPeerStats returns statistics for a peer
+func (d *UserspaceDevice) GetPeerStats(publicKey *PublicKey) (*PeerStats, error) {
+	stats, err := d.Stats()
+	if err != nil {
+		return nil, err
+	}
+	return findPeerStats(stats, publicKey)
+}
+
+// SetPrivateKey replaces the device's private key, keeping its peers
+func (d *UserspaceDevice) SetPrivateKey(privateKey *PrivateKey) error {
+	if err := d.device.IpcSet(fmt.Sprintf("private_key=%s\n", privateKey.HexString())); err != nil {
+		return fmt.Errorf("failed to set private key: %w", err)
+	}
+
+	return nil
+}
+
+// SetPresharedKey replaces a peer's preshared key; nil removes it
+func (d *UserspaceDevice) SetPresharedKey(publicKey *PublicKey, psk *PresharedKey) error {
+	if psk == nil {
+		psk = &PresharedKey{}
+	}
+	config := fmt.Sprintf("public_key=%s\nupdate_only=true\npreshared_key=%s\n", publicKey.HexString(), psk.HexString())
+	if err := d.device.IpcSet(config); err != nil {
+		return fmt.Errorf("failed to set preshared key: %w", err)
+	}
+
+	return nil
+}
+
+// SetFirewallMark sets the firewall mark on the device's socket
+func (d *UserspaceDevice) SetFirewallMark(mark uint32) error {
+	return d.device.BindSetMark(mark)
+}
+
+// AddAddress assigns another address to the TUN device
+func (d *UserspaceDevice) AddAddress(cidr string) error {
+	return tun.AddAddress(d.interfaceName, cidr)
+}
+
+// Close closes the WireGuard device (also closes the TUN device and
+// detaches from the bind)
+func (d *UserspaceDevice) Close() error {
+	d.device.Close()
+	return nil
+}
+
+// Wait blocks until the device is closed
+func (d *UserspaceDevice) Wait() {
+	<-d.device.Wait()
+}
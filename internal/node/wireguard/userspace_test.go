@@ -0,0 +1,71 @@
+package wireguard
+
+import (
+	"testing"
+
+	"golang.zx2c4.com/wireguard/conn/bindtest"
+	"golang.zx2c4.com/wireguard/device"
+	"golang.zx2c4.com/wireguard/tun/tuntest"
+)
+
+// newTestDevice returns a userspace device on an in-memory TUN and bind
+func newTestDevice(t *testing.T) *UserspaceDevice {
+	t.Helper()
+	bind := bindtest.NewChannelBinds()[0]
+	wgDevice := device.NewDevice(tuntest.NewChannelTUN().TUN(), bind, device.NewLogger(device.LogLevelSilent, ""))
+	t.Cleanup(wgDevice.Close)
+
+	privateKey := newPrivateKey(t)
+	if err := wgDevice.IpcSet("private_key=" + privateKey.HexString() + "\n"); err != nil {
+		t.Fatal(err)
+	}
+	return &UserspaceDevice{interfaceName: "test", device: wgDevice}
+}
+
+// newPrivateKey generates a private key
+func newPrivateKey(t *testing.T) *PrivateKey {
+	t.Helper()
+	key, err := GeneratePrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestUserspaceSyncPeersPresharedKey(t *testing.T) {
+	d := newTestDevice(t)
+	peer := PeerConfig{
+		PublicKey:    newPrivateKey(t).PublicKey(),
+		Endpoint:     "127.0.0.1:2",
+		AllowedIPs:   []string{"10.0.0.2/32"},
+		Keepalive:    25,
+		PresharedKey: &PresharedKey{1, 2, 3},
+	}
+
+	if err := d.SyncPeers([]PeerConfig{peer}); err != nil {
+		t.Fatalf("SyncPeers with a preshared key: %v", err)
+	}
+
+	// The peer stays but drops its preshared key
+	peer.PresharedKey = nil
+	if err := d.SyncPeers([]PeerConfig{peer}); err != nil {
+		t.Fatalf("SyncPeers removing the preshared key: %v", err)
+	}
+	peers, err := d.Peers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peers) != 1 || peers[0].PresharedKey != nil {
+		t.Fatalf("device still has a preshared key after removing it: %+v", peers)
+	}
+}
+
+func TestToWGPeerRemovesPresharedKey(t *testing.T) {
+	wgPeer, err := toWGPeer(PeerConfig{PublicKey: newPrivateKey(t).PublicKey()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wgPeer.PresharedKey == nil || presharedKey(*wgPeer.PresharedKey) != nil {
+		t.Fatal("a peer without a preshared key doesn't clear the device's key")
+	}
+}
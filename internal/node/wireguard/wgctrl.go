@@ -1,14 +1,136 @@
 package wireguard
 
-// GetPeerStats returns statistics for a peer (placeholder for kernel WireGuard)
-func (d *Device) GetPeerStats(publicKey *PublicKey) (map[string]interface{}, error) {
-	// For kernel WireGuard, we could parse `wg show` output
-	// For now, return empty stats
-	return map[string]interface{}{}, nil
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// GetPeerStats returns statistics for a peer
+func (d *KernelDevice) GetPeerStats(publicKey *PublicKey) (*PeerStats, error) {
+	stats, err := d.Stats()
+	if err != nil {
+		return nil, err
+	}
+	return findPeerStats(stats, publicKey)
+}
+
+// Stats reads statistics for all peers from the kernel
+func (d *KernelDevice) Stats() ([]PeerStats, error) {
+	device, err := d.client.Device(d.interfaceName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read device: %w", err)
+	}
+
+	stats := make([]PeerStats, 0, len(device.Peers))
+	for _, p := range device.Peers {
+		publicKey := PublicKey(p.PublicKey)
+		peer := PeerStats{
+			PeerConfig: PeerConfig{
+				PublicKey: &publicKey,
+				Keepalive: int(p.PersistentKeepaliveInterval.Seconds()),
+
+				PresharedKey: presharedKey(p.PresharedKey),
+			},
+			ReceiveBytes:  p.ReceiveBytes,
+			TransmitBytes: p.TransmitBytes,
+		}
+		if !p.LastHandshakeTime.IsZero() && p.LastHandshakeTime.Unix() != 0 {
+			peer.LastHandshake = p.LastHandshakeTime
+		}
+		if p.Endpoint != nil {
+			peer.Endpoint = p.Endpoint.String()
+		}
+		for _, allowedIP := range p.AllowedIPs {
+			peer.AllowedIPs = append(peer.AllowedIPs, allowedIP.String())
+		}
+		stats = append(stats, peer)
+	}
+
+	return stats, nil
+}
+
+// SetPrivateKey replaces the device's private key, keeping its peers
+func (d *KernelDevice) SetPrivateKey(privateKey *PrivateKey) error {
+	key := wgtypes.Key(*privateKey)
+	if err := d.client.ConfigureDevice(d.interfaceName, wgtypes.Config{PrivateKey: &key}); err != nil {
+		return fmt.Errorf("failed to set private key: %w", err)
+	}
+
+	return nil
+}
+
+// SetPresharedKey replaces a peer's preshared key; nil removes it
+func (d *KernelDevice) SetPresharedKey(publicKey *PublicKey, psk *PresharedKey) error {
+	key := wgtypes.Key{}
+	if psk != nil {
+		key = wgtypes.Key(*psk)
+	}
+	peer := wgtypes.PeerConfig{
+		PublicKey:    wgtypes.Key(*publicKey),
+		UpdateOnly:   true,
+		PresharedKey: &key,
+	}
+	if err := d.client.ConfigureDevice(d.interfaceName, wgtypes.Config{Peers: []wgtypes.PeerConfig{peer}}); err != nil {
+		return fmt.Errorf("failed to set preshared key: %w", err)
+	}
+
+	return nil
 }
 
-// SetFirewallMark sets the firewall mark (placeholder for kernel WireGuard)
-func (d *Device) SetFirewallMark(mark uint32) error {
-	// Kernel WireGuard handles this via config file
+// SetFirewallMark sets the mark on packets sent by the device
+func (d *KernelDevice) SetFirewallMark(mark uint32) error {
+	fwmark := int(mark)
+	if err := d.client.ConfigureDevice(d.interfaceName, wgtypes.Config{FirewallMark: &fwmark}); err != nil {
+		return fmt.Errorf("failed to set firewall mark: %w", err)
+	}
+
 	return nil
 }
+
+// Peers reads the configured peers back from the kernel
+func (d *KernelDevice) Peers() ([]PeerConfig, error) {
+	stats, err := d.Stats()
+	if err != nil {
+		return nil, err
+	}
+	return peerConfigs(stats), nil
+}
+
+// toWGPeer converts a peer configuration to its netlink form, replacing the
+// peer's allowed IPs and preshared key
+func toWGPeer(peer PeerConfig) (wgtypes.PeerConfig, error) {
+	keepalive := time.Duration(peer.Keepalive) * time.Second
+
+	// Always set: an all-zero key removes one the peer had before
+	psk := wgtypes.Key{}
+	if peer.PresharedKey != nil {
+		psk = wgtypes.Key(*peer.PresharedKey)
+	}
+	wgPeer := wgtypes.PeerConfig{
+		PublicKey:                   wgtypes.Key(*peer.PublicKey),
+		ReplaceAllowedIPs:           true,
+		PersistentKeepaliveInterval: &keepalive,
+		PresharedKey:                &psk,
+	}
+
+	if peer.Endpoint != "" {
+		addr, err := net.ResolveUDPAddr("udp", peer.Endpoint)
+		if err != nil {
+			return wgPeer, fmt.Errorf("invalid endpoint for peer %s: %w", peer.PublicKey, err)
+		}
+		wgPeer.Endpoint = addr
+	}
+
+	for _, allowedIP := range peer.AllowedIPs {
+		_, ipNet, err := net.ParseCIDR(allowedIP)
+		if err != nil {
+			return wgPeer, fmt.Errorf("invalid allowed IP for peer %s: %w", peer.PublicKey, err)
+		}
+		wgPeer.AllowedIPs = append(wgPeer.AllowedIPs, *ipNet)
+	}
+
+	return wgPeer, nil
+}
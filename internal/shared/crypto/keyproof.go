@@ -0,0 +1,52 @@
+package crypto
+
+import (
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/curve25519"
+)
+
+// KeyProof proves possession of a WireGuard private key to the holder of a
+// challenge key: it is a MAC over transcript keyed with the X25519 shared
+// secret of privateKey and challengeKey, which only the two sides can
+// compute. WireGuard keys can't sign, so this stands in for a signature.
+func KeyProof(privateKey, challengeKey, transcript []byte) ([]byte, error) {
+	shared, err := curve25519.X25519(privateKey, challengeKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute shared secret: %w", err)
+	}
+	return proofMAC(shared, transcript)
+}
+
+// VerifyKeyProof checks a KeyProof made with the private key of publicKey
+// against the challenge's private key
+func VerifyKeyProof(challengePrivate, publicKey, transcript, proof []byte) bool {
+	shared, err := curve25519.X25519(challengePrivate, publicKey)
+	if err != nil {
+		return false
+	}
+	expected, err := proofMAC(shared, transcript)
+	return err == nil && hmac.Equal(expected, proof)
+}
+
+// proofMAC computes HMAC-SHA256 over transcript with a key derived from the
+// shared secret
+func proofMAC(shared, transcript []byte) ([]byte, error) {
+	key, err := hkdf.Key(sha256.New, shared, nil, "shadownet key proof", sha256.Size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive proof key: %w", err)
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(transcript)
+	return mac.Sum(nil), nil
+}
+
+// RotationTranscript is what both proofs of a key rotation cover: the peer,
+// the challenge and the old and new public keys (base64)
+func RotationTranscript(peerID, challengeID, oldKey, newKey string) []byte {
+	return []byte(strings.Join([]string{"shadownet key rotation v1", peerID, challengeID, oldKey, newKey}, "\n"))
+}
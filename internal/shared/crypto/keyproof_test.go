@@ -0,0 +1,98 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"golang.org/x/crypto/curve25519"
+)
+
+// keyPair is an X25519 key pair for tests
+type keyPair struct {
+	private, public []byte
+}
+
+// newKeyPair generates an X25519 key pair
+func newKeyPair(t *testing.T) keyPair {
+	t.Helper()
+	private := make([]byte, curve25519.ScalarSize)
+	if _, err := rand.Read(private); err != nil {
+		t.Fatal(err)
+	}
+	public, err := curve25519.X25519(private, curve25519.Basepoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keyPair{private: private, public: public}
+}
+
+func TestKeyProof(t *testing.T) {
+	peer := newKeyPair(t)
+	challenge := newKeyPair(t)
+	transcript := RotationTranscript("peer-1", "challenge-1", "old-key", "new-key")
+
+	proof, err := KeyProof(peer.private, challenge.public, transcript)
+	if err != nil {
+		t.Fatalf("KeyProof: %v", err)
+	}
+	if !VerifyKeyProof(challenge.private, peer.public, transcript, proof) {
+		t.Fatal("valid proof rejected")
+	}
+
+	other := newKeyPair(t)
+	tests := []struct {
+		name              string
+		challengePrivate  []byte
+		publicKey         []byte
+		transcript, proof []byte
+	}{
+		{"wrong public key", challenge.private, other.public, transcript, proof},
+		{"wrong challenge key", other.private, peer.public, transcript, proof},
+		{"other peer", challenge.private, peer.public, RotationTranscript("peer-2", "challenge-1", "old-key", "new-key"), proof},
+		{"other challenge", challenge.private, peer.public, RotationTranscript("peer-1", "challenge-2", "old-key", "new-key"), proof},
+		{"other new key", challenge.private, peer.public, RotationTranscript("peer-1", "challenge-1", "old-key", "other-key"), proof},
+		{"truncated proof", challenge.private, peer.public, transcript, proof[:len(proof)-1]},
+		{"empty proof", challenge.private, peer.public, transcript, nil},
+		{"low-order public key", challenge.private, make([]byte, curve25519.PointSize), transcript, proof},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if VerifyKeyProof(tt.challengePrivate, tt.publicKey, tt.transcript, tt.proof) {
+				t.Fatal("invalid proof accepted")
+			}
+		})
+	}
+}
+
+func TestKeyProofWrongKey(t *testing.T) {
+	peer := newKeyPair(t)
+	attacker := newKeyPair(t)
+	challenge := newKeyPair(t)
+	transcript := RotationTranscript("peer-1", "challenge-1", "old-key", "new-key")
+
+	// A proof made without the peer's private key doesn't verify for it
+	forged, err := KeyProof(attacker.private, challenge.public, transcript)
+	if err != nil {
+		t.Fatalf("KeyProof: %v", err)
+	}
+	if VerifyKeyProof(challenge.private, peer.public, transcript, forged) {
+		t.Fatal("proof made with another private key accepted")
+	}
+}
+
+func TestKeyProofLowOrderChallenge(t *testing.T) {
+	peer := newKeyPair(t)
+	if _, err := KeyProof(peer.private, make([]byte, curve25519.PointSize), []byte("transcript")); err == nil {
+		t.Fatal("KeyProof accepted a low-order challenge key")
+	}
+}
+
+func TestRotationTranscriptFields(t *testing.T) {
+	// Fields are newline-separated, so shifting text between them changes
+	// the transcript
+	a := RotationTranscript("peer", "1", "old", "new")
+	b := RotationTranscript("peer1", "", "old", "new")
+	if string(a) == string(b) {
+		t.Fatal("different fields produced the same transcript")
+	}
+}
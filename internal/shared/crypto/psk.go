@@ -0,0 +1,93 @@
+package crypto
+
+import (
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+)
+
+// PSKContext is what a sealed preshared key is bound to: the pair of peers,
+// the epoch and the public keys it is sealed between
+func PSKContext(fromID, toID string, epoch int64, fromKey, toKey string) []byte {
+	return []byte(strings.Join([]string{"shadownet psk v1", fromID, toID, strconv.FormatInt(epoch, 10), fromKey, toKey}, "\n"))
+}
+
+// PSKOffersTranscript is what a peer proves possession of its key over,
+// with KeyProof, when posting preshared key offers: the peer, the challenge
+// and each offer's PSKContext and sealed key
+func PSKOffersTranscript(peerID, challengeID string, contexts, sealed [][]byte) []byte {
+	lines := []string{"shadownet psk offers v1", peerID, challengeID}
+	for i := range contexts {
+		digest := sha256.Sum256(contexts[i])
+		lines = append(lines, base64.StdEncoding.EncodeToString(digest[:])+" "+base64.StdEncoding.EncodeToString(sealed[i]))
+	}
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// PSKAcksTranscript is what a peer proves possession of its key over when
+// acknowledging the offers it received: the peer, the challenge and each
+// offer's sender and epoch
+func PSKAcksTranscript(peerID, challengeID string, fromIDs []string, epochs []int64) []byte {
+	lines := []string{"shadownet psk acks v1", peerID, challengeID}
+	for i := range fromIDs {
+		lines = append(lines, fromIDs[i], strconv.FormatInt(epochs[i], 10))
+	}
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// SealPSK encrypts a preshared key with XChaCha20-Poly1305 under a key
+// derived from the X25519 shared secret of two peers' static keys. Unlike
+// a sealed box either peer can open it, so a restarted peer recovers the
+// key in use, while the control plane relaying it can't.
+func SealPSK(privateKey, peerPublicKey, context, psk []byte) ([]byte, error) {
+	aead, err := pskAEAD(privateKey, peerPublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(psk)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, psk, context), nil
+}
+
+// OpenPSK decrypts a preshared key sealed with SealPSK by the other peer
+// of the pair, or by this peer itself
+func OpenPSK(privateKey, peerPublicKey, context, sealed []byte) ([]byte, error) {
+	aead, err := pskAEAD(privateKey, peerPublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < aead.NonceSize()+aead.Overhead() {
+		return nil, fmt.Errorf("sealed preshared key too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	psk, err := aead.Open(nil, nonce, ciphertext, context)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open preshared key: %w", err)
+	}
+	return psk, nil
+}
+
+// pskAEAD derives the AEAD sealing preshared keys between two peers
+func pskAEAD(privateKey, peerPublicKey []byte) (cipher.AEAD, error) {
+	shared, err := curve25519.X25519(privateKey, peerPublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute shared secret: %w", err)
+	}
+	key, err := hkdf.Key(sha256.New, shared, nil, "shadownet psk seal", chacha20poly1305.KeySize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive sealing key: %w", err)
+	}
+	return chacha20poly1305.NewX(key)
+}
@@ -0,0 +1,167 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+)
+
+// newPSK returns a random 32-byte preshared key
+func newPSK(t *testing.T) []byte {
+	t.Helper()
+	psk := make([]byte, 32)
+	if _, err := rand.Read(psk); err != nil {
+		t.Fatal(err)
+	}
+	return psk
+}
+
+func TestSealPSKRoundTrip(t *testing.T) {
+	a, b := newKeyPair(t), newKeyPair(t)
+	psk := newPSK(t)
+	context := PSKContext("peer-1", "peer-2", 7, "key-1", "key-2")
+
+	sealed, err := SealPSK(a.private, b.public, context, psk)
+	if err != nil {
+		t.Fatalf("SealPSK: %v", err)
+	}
+	if bytes.Contains(sealed, psk) {
+		t.Fatal("sealed key contains the plaintext key")
+	}
+
+	// The recipient and the sender itself can open it
+	for name, opener := range map[string]struct{ private, peer []byte }{
+		"recipient": {b.private, a.public},
+		"sender":    {a.private, b.public},
+	} {
+		opened, err := OpenPSK(opener.private, opener.peer, context, sealed)
+		if err != nil {
+			t.Fatalf("OpenPSK by %s: %v", name, err)
+		}
+		if !bytes.Equal(opened, psk) {
+			t.Fatalf("OpenPSK by %s returned a different key", name)
+		}
+	}
+
+	// A fresh nonce makes every seal differ
+	again, err := SealPSK(a.private, b.public, context, psk)
+	if err != nil {
+		t.Fatalf("SealPSK: %v", err)
+	}
+	if bytes.Equal(sealed, again) {
+		t.Fatal("sealing twice produced the same ciphertext")
+	}
+}
+
+func TestOpenPSKMismatchedContext(t *testing.T) {
+	a, b := newKeyPair(t), newKeyPair(t)
+	sealed, err := SealPSK(a.private, b.public, PSKContext("peer-1", "peer-2", 7, "key-1", "key-2"), newPSK(t))
+	if err != nil {
+		t.Fatalf("SealPSK: %v", err)
+	}
+
+	contexts := map[string][]byte{
+		"other epoch":     PSKContext("peer-1", "peer-2", 8, "key-1", "key-2"),
+		"swapped peers":   PSKContext("peer-2", "peer-1", 7, "key-2", "key-1"),
+		"other recipient": PSKContext("peer-1", "peer-3", 7, "key-1", "key-2"),
+		"other key":       PSKContext("peer-1", "peer-2", 7, "key-1", "key-3"),
+		"empty":           nil,
+	}
+	for name, context := range contexts {
+		t.Run(name, func(t *testing.T) {
+			if _, err := OpenPSK(b.private, a.public, context, sealed); err == nil {
+				t.Fatal("opened with a mismatched context")
+			}
+		})
+	}
+}
+
+func TestOpenPSKTampered(t *testing.T) {
+	a, b := newKeyPair(t), newKeyPair(t)
+	context := PSKContext("peer-1", "peer-2", 7, "key-1", "key-2")
+	sealed, err := SealPSK(a.private, b.public, context, newPSK(t))
+	if err != nil {
+		t.Fatalf("SealPSK: %v", err)
+	}
+
+	for _, i := range []int{0, len(sealed) / 2, len(sealed) - 1} {
+		tampered := bytes.Clone(sealed)
+		tampered[i] ^= 1
+		if _, err := OpenPSK(b.private, a.public, context, tampered); err == nil {
+			t.Fatalf("opened with byte %d flipped", i)
+		}
+	}
+	if _, err := OpenPSK(b.private, a.public, context, sealed[:len(sealed)-1]); err == nil {
+		t.Fatal("opened a truncated key")
+	}
+	if _, err := OpenPSK(b.private, a.public, context, sealed[:10]); err == nil {
+		t.Fatal("opened a key shorter than the nonce")
+	}
+}
+
+func TestOpenPSKWrongKey(t *testing.T) {
+	a, b, c := newKeyPair(t), newKeyPair(t), newKeyPair(t)
+	context := PSKContext("peer-1", "peer-2", 7, "key-1", "key-2")
+	sealed, err := SealPSK(a.private, b.public, context, newPSK(t))
+	if err != nil {
+		t.Fatalf("SealPSK: %v", err)
+	}
+
+	// A third peer, or the relay, can't open it
+	if _, err := OpenPSK(c.private, a.public, context, sealed); err == nil {
+		t.Fatal("opened by a peer outside the pair")
+	}
+	if _, err := OpenPSK(b.private, c.public, context, sealed); err == nil {
+		t.Fatal("opened against the wrong sender key")
+	}
+}
+
+func TestPSKOffersTranscript(t *testing.T) {
+	contexts := [][]byte{PSKContext("peer-1", "peer-2", 7, "key-1", "key-2")}
+	sealed := [][]byte{[]byte("sealed")}
+	transcript := PSKOffersTranscript("peer-1", "challenge-1", contexts, sealed)
+
+	variants := map[string][]byte{
+		"other peer":      PSKOffersTranscript("peer-2", "challenge-1", contexts, sealed),
+		"other challenge": PSKOffersTranscript("peer-1", "challenge-2", contexts, sealed),
+		"other context":   PSKOffersTranscript("peer-1", "challenge-1", [][]byte{PSKContext("peer-1", "peer-2", 8, "key-1", "key-2")}, sealed),
+		"other sealed":    PSKOffersTranscript("peer-1", "challenge-1", contexts, [][]byte{[]byte("sealeD")}),
+		"no offers":       PSKOffersTranscript("peer-1", "challenge-1", nil, nil),
+	}
+	for name, variant := range variants {
+		if bytes.Equal(transcript, variant) {
+			t.Errorf("%s: same transcript", name)
+		}
+	}
+
+	// Offers proven with KeyProof verify only for their own transcript
+	peer, challenge := newKeyPair(t), newKeyPair(t)
+	proof, err := KeyProof(peer.private, challenge.public, transcript)
+	if err != nil {
+		t.Fatalf("KeyProof: %v", err)
+	}
+	if !VerifyKeyProof(challenge.private, peer.public, transcript, proof) {
+		t.Fatal("valid offer proof rejected")
+	}
+	if VerifyKeyProof(challenge.private, peer.public, variants["other context"], proof) {
+		t.Fatal("offer proof accepted for other offers")
+	}
+}
+
+func TestPSKAcksTranscript(t *testing.T) {
+	transcript := PSKAcksTranscript("peer-2", "challenge-1", []string{"peer-1"}, []int64{7})
+
+	variants := map[string][]byte{
+		"other peer":      PSKAcksTranscript("peer-3", "challenge-1", []string{"peer-1"}, []int64{7}),
+		"other challenge": PSKAcksTranscript("peer-2", "challenge-2", []string{"peer-1"}, []int64{7}),
+		"other sender":    PSKAcksTranscript("peer-2", "challenge-1", []string{"peer-0"}, []int64{7}),
+		"other epoch":     PSKAcksTranscript("peer-2", "challenge-1", []string{"peer-1"}, []int64{8}),
+		"no acks":         PSKAcksTranscript("peer-2", "challenge-1", nil, nil),
+		"offers":          PSKOffersTranscript("peer-2", "challenge-1", nil, nil),
+	}
+	for name, variant := range variants {
+		if bytes.Equal(transcript, variant) {
+			t.Errorf("%s: same transcript", name)
+		}
+	}
+}
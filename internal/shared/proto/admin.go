@@ -0,0 +1,115 @@
+package proto
+
+// DefaultNetwork is the network peers join when no join token says otherwise
+const DefaultNetwork = "default"
+
+// JoinToken authorizes new peers to register into a network. Secret is
+// only returned when the token is created.
+type JoinToken struct {
+	ID          string `json:"id"`
+	Secret      string `json:"secret,omitempty"`
+	Network     string `json:"network"`
+	Description string `json:"description,omitempty"`
+	Reusable    bool   `json:"reusable"`
+	Uses        int    `json:"uses"`
+	ExpiresAt   string `json:"expires_at,omitempty"` // RFC3339, empty if it never expires
+	CreatedAt   string `json:"created_at"`
+	Revoked     bool   `json:"revoked"`
+}
+
+// CreateTokenRequest creates a join token
+type CreateTokenRequest struct {
+	Network     string `json:"network"`
+	Description string `json:"description,omitempty"`
+	Reusable    bool   `json:"reusable"`
+	TTL         int    `json:"ttl,omitempty"` // seconds, 0 never expires
+}
+
+// TokensResponse lists join tokens
+type TokensResponse struct {
+	Tokens []JoinToken `json:"tokens"`
+	Count  int         `json:"count"`
+}
+
+// PeerKey is a WireGuard key a peer has used
+type PeerKey struct {
+	PublicKey string `json:"public_key"`
+	AddedAt   string `json:"added_at"`             // RFC3339
+	RetiredAt string `json:"retired_at,omitempty"` // RFC3339, empty while in use
+}
+
+// PeerKeysResponse lists a peer's keys, oldest first
+type PeerKeysResponse struct {
+	Keys  []PeerKey `json:"keys"`
+	Count int       `json:"count"`
+}
+
+// Network groups peers; peers only see peers of their own network that
+// its ACL policy allows
+type Network struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	ACL         *ACLPolicy `json:"acl,omitempty"`
+	CreatedAt   string     `json:"created_at,omitempty"`
+}
+
+// NetworksResponse lists networks
+type NetworksResponse struct {
+	Networks []Network `json:"networks"`
+	Count    int       `json:"count"`
+}
+
+// ACLPolicy controls which peers of a network may connect. An empty
+// policy allows everything.
+type ACLPolicy struct {
+	Rules []ACLRule `json:"rules"`
+}
+
+// ACLRule allows traffic from any source to any destination. Entries are
+// peer IDs or "*".
+type ACLRule struct {
+	Sources      []string `json:"src"`
+	Destinations []string `json:"dst"`
+}
+
+// Event is an entry in the control plane's event log
+type Event struct {
+	ID      int64  `json:"id"`
+	Time    string `json:"time"` // RFC3339
+	Type    string `json:"type"`
+	PeerID  string `json:"peer_id,omitempty"`
+	Message string `json:"message"`
+}
+
+// EventsResponse lists events, oldest first
+type EventsResponse struct {
+	Events []Event `json:"events"`
+	Count  int     `json:"count"`
+}
+
+// State is a full export of the control plane's configuration
+type State struct {
+	ExportedAt string          `json:"exported_at"`
+	Networks   []Network       `json:"networks"`
+	Peers      []PeerInfo      `json:"peers"`
+	Tokens     []ExportedToken `json:"tokens"`
+}
+
+// ExportedToken is a join token including its secret hash, so imported
+// tokens keep working
+type ExportedToken struct {
+	JoinToken
+	SecretHash string `json:"secret_hash"`
+}
+
+// ImportResponse reports what an import changed
+type ImportResponse struct {
+	Networks int `json:"networks"`
+	Peers    int `json:"peers"`
+	Tokens   int `json:"tokens"`
+}
+
+// ApproveRoutesRequest replaces a peer's approved routes
+type ApproveRoutesRequest struct {
+	ApprovedRoutes []string `json:"approved_routes"`
+}
@@ -0,0 +1,122 @@
+package proto
+
+// NodeStatus is the runtime status of a node, served by its local API
+type NodeStatus struct {
+	ID             string              `json:"id"`
+	PublicKey      string              `json:"public_key"`
+	VirtualIP      string              `json:"virtual_ip"`
+	DNSName        string              `json:"dns_name,omitempty"`
+	PublicEndpoint string              `json:"public_endpoint"`
+	Backend        string              `json:"backend"`
+	NAT            *NATInfo            `json:"nat,omitempty"`
+	ControlPlane   *ControlPlaneStatus `json:"control_plane,omitempty"`
+
+	// AdvertisedRoutes are the subnets this node offers; Routes are the
+	// approved subnets of peers routed through the overlay
+	AdvertisedRoutes []string `json:"advertised_routes,omitempty"`
+	Routes           []string `json:"routes,omitempty"`
+
+	// ExitNode is the peer internet traffic goes through, if any; ExitNodes
+	// are the peers offering to be one
+	ExitNode  string   `json:"exit_node,omitempty"`
+	ExitNodes []string `json:"exit_nodes,omitempty"`
+
+	// VirtualIPv6 is the node's IPv6 overlay address and PublicEndpointV6
+	// its IPv6 underlay endpoint, when it has them
+	VirtualIPv6      string `json:"virtual_ipv6,omitempty"`
+	PublicEndpointV6 string `json:"public_endpoint_v6,omitempty"`
+
+	// NextPublicKey is the new key of a rotation in progress, switched to
+	// at KeySwitchAt (RFC3339)
+	NextPublicKey string `json:"next_public_key,omitempty"`
+	KeySwitchAt   string `json:"key_switch_at,omitempty"`
+
+	// SharedSocket reports whether STUN and hole punching run on the
+	// WireGuard socket; with the kernel backend they can't, and tunnels
+	// behind NAT rely on keepalives alone
+	SharedSocket bool `json:"shared_socket"`
+
+	// PQBlocked are the peers left out because their tunnels require
+	// post-quantum protection and they don't support it
+	PQBlocked []string `json:"pq_blocked,omitempty"`
+
+	Peers []TunnelStats `json:"peers"`
+}
+
+// ControlPlaneStatus describes a node's connectivity to the control plane
+type ControlPlaneStatus struct {
+	URL         string `json:"url"`
+	Connected   bool   `json:"connected"`
+	LastContact string `json:"last_contact,omitempty"` // RFC3339
+	LastError   string `json:"last_error,omitempty"`
+
+	// CachedPeers is when the peer map in use was cached (RFC3339), set
+	// while the node runs offline from it
+	CachedPeers string `json:"cached_peers,omitempty"`
+}
+
+// NodePeersResponse lists a node's peers with their tunnel state
+type NodePeersResponse struct {
+	Peers []TunnelStats `json:"peers"`
+	Count int           `json:"count"`
+}
+
+// NodeEvent is an entry in a node's recent event log
+type NodeEvent struct {
+	Time    string `json:"time"` // RFC3339
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// NodeEventsResponse contains a node's recent events, oldest first
+type NodeEventsResponse struct {
+	Events []NodeEvent `json:"events"`
+}
+
+// SetExitNodeRequest chooses the exit node by peer name or ID; empty turns
+// exit node use off
+type SetExitNodeRequest struct {
+	Peer string `json:"peer"`
+}
+
+// ActionResponse is returned by local API actions
+type ActionResponse struct {
+	Success bool   `json:"success"`
+	Message string `json:"message,omitempty"`
+}
+
+// NetcheckReport is the result of a network check, run by the node on its
+// WireGuard socket or by the CLI from a new socket when no node runs
+type NetcheckReport struct {
+	// Socket describes where the STUN probes were sent from
+	Socket string `json:"socket"`
+
+	ControlPlane        string `json:"control_plane"`
+	ControlPlaneLatency string `json:"control_plane_latency,omitempty"`
+	ControlPlaneError   string `json:"control_plane_error,omitempty"`
+
+	// IPv4 and IPv6 are the STUN results per address family; IPv6 is
+	// nil when the node has it disabled
+	IPv4 *NetcheckFamily `json:"ipv4"`
+	IPv6 *NetcheckFamily `json:"ipv6,omitempty"`
+}
+
+// NetcheckFamily is the STUN result over one address family
+type NetcheckFamily struct {
+	STUN              []NetcheckSTUN `json:"stun"`
+	PublicEndpoint    string         `json:"public_endpoint,omitempty"`
+	ConsistentMapping bool           `json:"consistent_mapping"`
+	Error             string         `json:"error,omitempty"`
+
+	// NAT is the NAT behaviour, only classified over IPv4
+	NAT      *NATInfo `json:"nat,omitempty"`
+	NATError string   `json:"nat_error,omitempty"`
+}
+
+// NetcheckSTUN is one STUN server's answer
+type NetcheckSTUN struct {
+	Server  string `json:"server"`
+	Mapped  string `json:"mapped,omitempty"`
+	Latency string `json:"latency,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
@@ -1,38 +1,200 @@
 package proto
 
-import "time"
+import (
+	"slices"
+	"time"
+)
 
 // PeerInfo represents peer information exchanged via API
 type PeerInfo struct {
-	ID           string `json:"id"`
-	WGPublicKey  string `json:"wg_public_key"`
-	EndpointIP   string `json:"endpoint_ip"`
-	EndpointPort int    `json:"endpoint_port"`
-	LastSeen     string `json:"last_seen,omitempty"`
+	ID           string   `json:"id"`
+	WGPublicKey  string   `json:"wg_public_key"`
+	EndpointIP   string   `json:"endpoint_ip"`
+	EndpointPort int      `json:"endpoint_port"`
+	LastSeen     string   `json:"last_seen,omitempty"`
+	NAT          *NATInfo `json:"nat,omitempty"`
+	Network      string   `json:"network,omitempty"`
+
+	// EndpointIPv6 and EndpointPortV6 are the peer's IPv6 endpoint, if it
+	// has a global IPv6 address; peers that have one too prefer it
+	EndpointIPv6   string `json:"endpoint_ipv6,omitempty"`
+	EndpointPortV6 int    `json:"endpoint_port_v6,omitempty"`
+
+	// Name is the peer's DNS label, assigned by the control plane from its
+	// hostname and unique within its network
+	Name string `json:"name,omitempty"`
+	PeerMetadata
+
+	// AdvertisedRoutes are subnets the peer offers to route; other peers
+	// only use those an admin has also put in ApprovedRoutes
+	AdvertisedRoutes []string `json:"advertised_routes,omitempty"`
+	ApprovedRoutes   []string `json:"approved_routes,omitempty"`
+
+	// Tunnels is the peer's view of its WireGuard tunnels, from its last heartbeat
+	Tunnels []TunnelStats `json:"tunnels,omitempty"`
+
+	// NextWGPublicKey replaces WGPublicKey at KeySwitchAt (RFC3339) while
+	// the peer rotates its key; the peer and everyone else switch then
+	NextWGPublicKey string `json:"next_wg_public_key,omitempty"`
+	KeySwitchAt     string `json:"key_switch_at,omitempty"`
+}
+
+// PublicKeyAt returns the WireGuard key the peer uses at the given time
+func (p *PeerInfo) PublicKeyAt(now time.Time) string {
+	if p.NextWGPublicKey == "" {
+		return p.WGPublicKey
+	}
+	switchAt, err := time.Parse(time.RFC3339, p.KeySwitchAt)
+	if err != nil || now.Before(switchAt) {
+		return p.WGPublicKey
+	}
+	return p.NextWGPublicKey
+}
+
+// PeerMetadata is descriptive information a node reports about itself
+type PeerMetadata struct {
+	Hostname string            `json:"hostname,omitempty"`
+	OS       string            `json:"os,omitempty"`
+	Arch     string            `json:"arch,omitempty"`
+	Version  string            `json:"version,omitempty"`
+	Tags     []string          `json:"tags,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+
+	// Features are the optional protocols the node takes part in
+	Features []string `json:"features,omitempty"`
+}
+
+// Features nodes report in PeerMetadata
+const (
+	// FeaturePSK: the node uses per-pair preshared keys with peers that
+	// do too
+	FeaturePSK = "psk"
+
+	// FeaturePQ: the node runs post-quantum key exchanges with peers that
+	// do too
+	FeaturePQ = "pq"
+)
+
+// HasFeature reports whether the node takes part in an optional protocol
+func (m *PeerMetadata) HasFeature(feature string) bool {
+	return slices.Contains(m.Features, feature)
+}
+
+// NATInfo describes a peer's NAT behaviour as discovered per RFC 5780
+type NATInfo struct {
+	Type            string `json:"type"`
+	Mapping         string `json:"mapping"`
+	Filtering       string `json:"filtering"`
+	Hairpinning     bool   `json:"hairpinning"`
+	MappingLifetime int    `json:"mapping_lifetime,omitempty"` // seconds
 }
 
 type RegisterRequest struct {
-	ID           string `json:"id"`
-	WGPublicKey  string `json:"wg_public_key"`
-	EndpointIP   string `json:"endpoint_ip"`
-	EndpointPort int    `json:"endpoint_port"`
+	ID           string   `json:"id"`
+	WGPublicKey  string   `json:"wg_public_key"`
+	EndpointIP   string   `json:"endpoint_ip"`
+	EndpointPort int      `json:"endpoint_port"`
+	NAT          *NATInfo `json:"nat,omitempty"`
+	PeerMetadata
+
+	// EndpointIPv6 and EndpointPortV6 are the node's IPv6 endpoint, if any
+	EndpointIPv6   string `json:"endpoint_ipv6,omitempty"`
+	EndpointPortV6 int    `json:"endpoint_port_v6,omitempty"`
+
+	// AdvertisedRoutes are subnets behind this node it offers to route
+	AdvertisedRoutes []string `json:"advertised_routes,omitempty"`
+
+	// JoinToken is required for new peers when the control plane enforces
+	// join tokens
+	JoinToken string `json:"join_token,omitempty"`
 }
 
 // RegisterResponse is returned after successful registration
 type RegisterResponse struct {
 	Success bool   `json:"success"`
 	Message string `json:"message,omitempty"`
+	Network string `json:"network,omitempty"` // network the peer was placed in
+	Name    string `json:"name,omitempty"`    // DNS label assigned to the peer
 }
 
 // HeartbeatRequest is sent periodically to keep peer alive
 type HeartbeatRequest struct {
 	ID string `json:"id"`
+
+	// Tunnels is null when the node could not read its device, which keeps
+	// the previously reported stats
+	Tunnels []TunnelStats `json:"tunnels"`
+}
+
+// TunnelStats describes a node's WireGuard tunnel to one peer
+type TunnelStats struct {
+	PeerID        string   `json:"peer_id,omitempty"`
+	Name          string   `json:"name,omitempty"` // the peer's DNS label
+	PublicKey     string   `json:"public_key"`
+	Endpoint      string   `json:"endpoint,omitempty"`
+	LastHandshake string   `json:"last_handshake,omitempty"` // RFC3339, empty if none
+	RxBytes       int64    `json:"rx_bytes"`
+	TxBytes       int64    `json:"tx_bytes"`
+	Keepalive     int      `json:"keepalive"` // seconds, 0 if disabled
+	AllowedIPs    []string `json:"allowed_ips"`
+	Up            bool     `json:"up"`
+	Strategy      string   `json:"strategy,omitempty"`  // direct, punch or unreachable
+	PSKEpoch      int64    `json:"psk_epoch,omitempty"` // of the preshared key in use, 0 if none
+
+	// Post-quantum key exchange with the peer: active, pending or failed
+	// (empty if not used), whether it is required, when the key in use
+	// was derived (RFC3339) and the last error
+	PQState       string `json:"pq_state,omitempty"`
+	PQRequired    bool   `json:"pq_required,omitempty"`
+	PQExchangedAt string `json:"pq_exchanged_at,omitempty"`
+	PQError       string `json:"pq_error,omitempty"`
 }
 
-// HeartbeatResponse confirms heartbeat receipt
+// HeartbeatResponse confirms heartbeat receipt. PeersRevision changes
+// whenever peers may have changed (joined, moved, rekeyed, ...), so nodes
+// refetch their peer list when it does.
 type HeartbeatResponse struct {
-	Success bool   `json:"success"`
-	Message string `json:"message,omitempty"`
+	Success       bool   `json:"success"`
+	Message       string `json:"message,omitempty"`
+	PeersRevision int64  `json:"peers_revision,omitempty"`
+
+	// PSKRevision changes whenever preshared key offers to or from the
+	// peer changed, so it refetches them
+	PSKRevision int64 `json:"psk_revision,omitempty"`
+}
+
+// KeyChallengeRequest asks for a challenge to prove a peer's keys against,
+// for a key rotation or preshared key offers
+type KeyChallengeRequest struct {
+	ID string `json:"id"`
+}
+
+// KeyChallengeResponse is an ephemeral X25519 key the peer proves
+// possession of its keys against
+type KeyChallengeResponse struct {
+	ChallengeID string `json:"challenge_id"`
+	PublicKey   string `json:"public_key"`
+	ExpiresAt   string `json:"expires_at"` // RFC3339
+}
+
+// KeyRotationRequest replaces a peer's WireGuard key. The proofs are
+// crypto.KeyProof of the old and new private keys over the rotation's
+// crypto.RotationTranscript.
+type KeyRotationRequest struct {
+	ID           string `json:"id"`
+	ChallengeID  string `json:"challenge_id"`
+	OldPublicKey string `json:"old_public_key"`
+	NewPublicKey string `json:"new_public_key"`
+	OldProof     []byte `json:"old_proof"`
+	NewProof     []byte `json:"new_proof"`
+}
+
+// KeyRotationResponse says when the peer and everyone else switch to the
+// new key
+type KeyRotationResponse struct {
+	Success  bool   `json:"success"`
+	Message  string `json:"message,omitempty"`
+	SwitchAt string `json:"switch_at,omitempty"` // RFC3339
 }
 
 // PeersResponse contains list of active peers
@@ -54,3 +216,23 @@ type ErrorResponse struct {
 	Error   string `json:"error"`
 	Message string `json:"message,omitempty"`
 }
+
+// STUNResponse advertises the control plane's built-in STUN server
+type STUNResponse struct {
+	Servers       []string `json:"servers"`
+	ChangeRequest bool     `json:"change_request"`
+}
+
+// EnabledRoutes returns the advertised routes an admin has approved
+func (p *PeerInfo) EnabledRoutes() []string {
+	var enabled []string
+	for _, route := range p.AdvertisedRoutes {
+		for _, approved := range p.ApprovedRoutes {
+			if route == approved {
+				enabled = append(enabled, route)
+				break
+			}
+		}
+	}
+	return enabled
+}
@@ -0,0 +1,61 @@
+package proto
+
+// PSKOffer is a preshared key for a pair of peers, sealed so that only the
+// two peers can open it. The peer with the lower ID makes offers; both
+// install the key once the other one acknowledged it, at ActivateAt.
+type PSKOffer struct {
+	FromID string `json:"from_id"`
+	ToID   string `json:"to_id"`
+
+	// Epoch increases with every new key for the pair
+	Epoch int64 `json:"epoch"`
+
+	// FromKey and ToKey are the WireGuard public keys the key is sealed
+	// between
+	FromKey   string `json:"from_key"`
+	ToKey     string `json:"to_key"`
+	SealedPSK []byte `json:"sealed_psk"`
+
+	CreatedAt  string `json:"created_at,omitempty"`  // RFC3339
+	ActivateAt string `json:"activate_at,omitempty"` // RFC3339, empty until acknowledged
+}
+
+// PeerID returns the other peer of the pair
+func (o *PSKOffer) PeerID(self string) string {
+	if o.FromID == self {
+		return o.ToID
+	}
+	return o.FromID
+}
+
+// PSKOffersRequest posts new preshared key offers. Proof is
+// crypto.KeyProof of the sender's private key, against the key challenge
+// ChallengeID, over the offers' crypto.PSKOffersTranscript.
+type PSKOffersRequest struct {
+	ID          string     `json:"id"`
+	ChallengeID string     `json:"challenge_id"`
+	Offers      []PSKOffer `json:"offers"`
+	Proof       []byte     `json:"proof"`
+}
+
+// PSKAck acknowledges that the recipient of an offer received it
+type PSKAck struct {
+	FromID string `json:"from_id"`
+	Epoch  int64  `json:"epoch"`
+}
+
+// PSKAcksRequest acknowledges offers made to a peer, which schedules their
+// use. Proof is crypto.KeyProof of the recipient's private key, against
+// the key challenge ChallengeID, over crypto.PSKAcksTranscript.
+type PSKAcksRequest struct {
+	ID          string   `json:"id"`
+	ChallengeID string   `json:"challenge_id"`
+	Acks        []PSKAck `json:"acks"`
+	Proof       []byte   `json:"proof"`
+}
+
+// PSKOffersResponse lists the latest offer of each pair the peer is in
+type PSKOffersResponse struct {
+	Offers   []PSKOffer `json:"offers"`
+	Revision int64      `json:"revision"`
+}
@@ -0,0 +1,32 @@
+package utils
+
+import "strings"
+
+// DNSLabel turns an arbitrary name into a DNS label: lowercase letters,
+// digits and dashes, at most 63 characters. Runs of other characters
+// become a single dash; the result is empty if nothing usable is left.
+func DNSLabel(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+			dash = false
+		case !dash && b.Len() > 0:
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+
+	label := strings.TrimRight(b.String(), "-")
+	if len(label) > 63 {
+		label = strings.TrimRight(label[:63], "-")
+	}
+	return label
+}
+
+// IsDNSLabel reports whether name is already a valid DNS label
+func IsDNSLabel(name string) bool {
+	return name != "" && DNSLabel(name) == name
+}
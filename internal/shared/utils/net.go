@@ -14,6 +14,16 @@ func ValidateIP(ip string) error {
 	return nil
 }
 
+// ValidateIPv6 validates an IPv6 address string, rejecting IPv4 and
+// IPv4-mapped addresses
+func ValidateIPv6(ip string) error {
+	parsed := net.ParseIP(ip)
+	if parsed == nil || parsed.To4() != nil {
+		return fmt.Errorf("invalid IPv6 address: %s", ip)
+	}
+	return nil
+}
+
 // ValidatePort validates a port number
 func ValidatePort(port int) error {
 	if port < 1 || port > 65535 {
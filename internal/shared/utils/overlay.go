@@ -0,0 +1,20 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"net/netip"
+)
+
+// OverlayIPv6Prefix is the unique local (ULA) prefix peers' IPv6 overlay
+// addresses are taken from
+var OverlayIPv6Prefix = netip.MustParsePrefix("fd53:4e00::/64")
+
+// OverlayIPv6 returns the IPv6 overlay address of a peer ID: the overlay
+// prefix followed by 64 bits of the ID's SHA-256 hash
+func OverlayIPv6(id string) string {
+	sum := sha256.Sum256([]byte(id))
+
+	addr := OverlayIPv6Prefix.Addr().As16()
+	copy(addr[8:], sum[:8])
+	return netip.AddrFrom16(addr).String()
+}
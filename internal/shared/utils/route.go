@@ -0,0 +1,35 @@
+package utils
+
+import (
+	"fmt"
+	"net/netip"
+)
+
+// ValidateRoute validates a subnet route: a prefix in canonical form
+// ("192.168.1.0/24", not "192.168.1.5/24") that is not a default route.
+// Exit nodes advertise default routes; see IsExitRoute.
+func ValidateRoute(route string) error {
+	prefix, err := netip.ParsePrefix(route)
+	if err != nil {
+		return fmt.Errorf("invalid route %q: %w", route, err)
+	}
+	if prefix != prefix.Masked() {
+		return fmt.Errorf("invalid route %q: host bits set, use %s", route, prefix.Masked())
+	}
+	if prefix.Bits() == 0 {
+		return fmt.Errorf("invalid route %q: default routes are not subnet routes", route)
+	}
+	return nil
+}
+
+// Default routes advertised by exit nodes
+const (
+	ExitRouteV4 = "0.0.0.0/0"
+	ExitRouteV6 = "::/0"
+)
+
+// IsExitRoute reports whether route is a default route, which only exit
+// nodes advertise
+func IsExitRoute(route string) bool {
+	return route == ExitRouteV4 || route == ExitRouteV6
+}
@@ -0,0 +1,6 @@
+// Package version holds the ShadowNet release version
+package version
+
+// Version is set at build time with
+// -ldflags "-X github.com/Vaibhav2154/ShadowNet/internal/shared/version.Version=..."
+var Version = "dev"
@@ -8,26 +8,32 @@ echo ""
 
 VERSION=${VERSION:-"1.0.0"}
 BUILD_DIR="bin/release"
+LDFLAGS="-s -w -X github.com/Vaibhav2154/ShadowNet/internal/shared/version.Version=$VERSION"
 
 mkdir -p $BUILD_DIR
 
 # Build for Linux (most common)
 echo "Building for Linux AMD64..."
-GOOS=linux GOARCH=amd64 go build -ldflags="-s -w" -o $BUILD_DIR/shadownet-controlplane-linux-amd64 ./cmd/controlplane
-GOOS=linux GOARCH=amd64 go build -ldflags="-s -w" -o $BUILD_DIR/shadownet-node-linux-amd64 ./cmd/node
+GOOS=linux GOARCH=amd64 go build -ldflags="$LDFLAGS" -o $BUILD_DIR/shadownet-controlplane-linux-amd64 ./cmd/controlplane
+GOOS=linux GOARCH=amd64 go build -ldflags="$LDFLAGS" -o $BUILD_DIR/shadownet-node-linux-amd64 ./cmd/node
+GOOS=linux GOARCH=amd64 go build -ldflags="$LDFLAGS" -o $BUILD_DIR/shadownet-linux-amd64 ./cmd/shadownet
+GOOS=linux GOARCH=amd64 go build -ldflags="$LDFLAGS" -o $BUILD_DIR/shadownetctl-linux-amd64 ./cmd/shadownetctl
 
 # Build for Linux ARM64 (Raspberry Pi, etc.)
 echo "Building for Linux ARM64..."
-GOOS=linux GOARCH=arm64 go build -ldflags="-s -w" -o $BUILD_DIR/shadownet-node-linux-arm64 ./cmd/node
+GOOS=linux GOARCH=arm64 go build -ldflags="$LDFLAGS" -o $BUILD_DIR/shadownet-node-linux-arm64 ./cmd/node
+GOOS=linux GOARCH=arm64 go build -ldflags="$LDFLAGS" -o $BUILD_DIR/shadownet-linux-arm64 ./cmd/shadownet
+GOOS=linux GOARCH=arm64 go build -ldflags="$LDFLAGS" -o $BUILD_DIR/shadownetctl-linux-arm64 ./cmd/shadownetctl
 
 # Build for macOS
 echo "Building for macOS..."
-GOOS=darwin GOARCH=amd64 go build -ldflags="-s -w" -o $BUILD_DIR/shadownet-node-macos-amd64 ./cmd/node
-GOOS=darwin GOARCH=arm64 go build -ldflags="-s -w" -o $BUILD_DIR/shadownet-node-macos-arm64 ./cmd/node
+GOOS=darwin GOARCH=amd64 go build -ldflags="$LDFLAGS" -o $BUILD_DIR/shadownet-node-macos-amd64 ./cmd/node
+GOOS=darwin GOARCH=arm64 go build -ldflags="$LDFLAGS" -o $BUILD_DIR/shadownet-node-macos-arm64 ./cmd/node
+GOOS=darwin GOARCH=arm64 go build -ldflags="$LDFLAGS" -o $BUILD_DIR/shadownetctl-macos-arm64 ./cmd/shadownetctl
 
 # Build for Windows
 echo "Building for Windows..."
-GOOS=windows GOARCH=amd64 go build -ldflags="-s -w" -o $BUILD_DIR/shadownet-node-windows-amd64.exe ./cmd/node
+GOOS=windows GOARCH=amd64 go build -ldflags="$LDFLAGS" -o $BUILD_DIR/shadownet-node-windows-amd64.exe ./cmd/node
 
 echo ""
 echo "✅ Build complete!"
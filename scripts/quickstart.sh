@@ -19,6 +19,8 @@ if [ ! -f "bin/controlplane" ] || [ ! -f "bin/node" ]; then
     mkdir -p bin
     go build -o bin/controlplane ./cmd/controlplane
     go build -o bin/node ./cmd/node
+    go build -o bin/shadownet ./cmd/shadownet
+    go build -o bin/shadownetctl ./cmd/shadownetctl
     echo "✓ Binaries built successfully"
     echo ""
 fi
@@ -50,7 +52,7 @@ if [ "$1" == "node" ]; then
         --controlplane-url "$CONTROLPLANE_URL" \
         --private-key-path ./shadownet.key \
         --listen-port 51820 \
-        --stun-server stun.l.google.com:19302
+        --stun-servers stun.l.google.com:19302,stun1.l.google.com:19302
 fi
 
 # Start dashboard
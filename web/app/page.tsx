@@ -30,6 +30,23 @@ interface PeerInfo {
   endpoint_ip: string
   endpoint_port: number
   last_seen: string
+  nat?: NATInfo
+  network?: string
+  name?: string
+  hostname?: string
+  os?: string
+  arch?: string
+  version?: string
+  tags?: string[]
+  labels?: Record<string, string>
+}
+
+interface NATInfo {
+  type: string
+  mapping: string
+  filtering: string
+  hairpinning: boolean
+  mapping_lifetime?: number
 }
 
 interface Metrics {
@@ -237,8 +254,9 @@ export default function Dashboard() {
                     <thead>
                       <tr className="">
                         <th className="text-left py-3 px-4 font-medium text-neutral-500 text-xs">Status</th>
-                        <th className="text-left py-3 px-4 font-medium text-neutral-500 text-xs">Peer ID</th>
+                        <th className="text-left py-3 px-4 font-medium text-neutral-500 text-xs">Peer</th>
                         <th className="text-left py-3 px-4 font-medium text-neutral-500 text-xs">Endpoint</th>
+                        <th className="text-left py-3 px-4 font-medium text-neutral-500 text-xs">NAT</th>
                         <th className="text-left py-3 px-4 font-medium text-neutral-500 text-xs">Public Key</th>
                         <th className="text-left py-3 px-4 font-medium text-neutral-500 text-xs">Last Seen</th>
                       </tr>
@@ -257,15 +275,43 @@ export default function Dashboard() {
                               </div>
                             </td>
                             <td className="py-3 px-4">
-                              <code className="text-xs text-white font-mono bg-neutral-900 px-2 py-1 rounded">
-                                {peer.id}
-                              </code>
+                              <div className="flex flex-col gap-1">
+                                <span className="text-sm text-white" title={peer.hostname}>
+                                  {peer.name || peer.id}
+                                </span>
+                                <code className="text-xs text-neutral-500 font-mono">
+                                  {peer.id}
+                                  {peer.os && ` · ${peer.os}${peer.arch ? `/${peer.arch}` : ''}`}
+                                </code>
+                                {peer.tags && peer.tags.length > 0 && (
+                                  <div className="flex flex-wrap gap-1">
+                                    {peer.tags.map((tag) => (
+                                      <Badge key={tag} variant="outline" className="text-xs">
+                                        {tag}
+                                      </Badge>
+                                    ))}
+                                  </div>
+                                )}
+                              </div>
                             </td>
                             <td className="py-3 px-4">
                               <span className="text-xs text-neutral-300">
                                 {peer.endpoint_ip}:{peer.endpoint_port}
                               </span>
                             </td>
+                            <td className="py-3 px-4">
+                              {peer.nat ? (
+                                <span
+                                  title={`mapping: ${peer.nat.mapping}, filtering: ${peer.nat.filtering}, hairpinning: ${peer.nat.hairpinning ? 'yes' : 'no'}${peer.nat.mapping_lifetime ? `, lifetime: ${peer.nat.mapping_lifetime}s` : ''}`}
+                                >
+                                  <Badge variant={peer.nat.type === 'symmetric' ? 'destructive' : 'secondary'} className="text-xs">
+                                    {peer.nat.type}
+                                  </Badge>
+                                </span>
+                              ) : (
+                                <span className="text-xs text-neutral-600">unknown</span>
+                              )}
+                            </td>
                             <td className="py-3 px-4">
                               <code className="text-xs text-neutral-500 font-mono">
                                 {peer.wg_public_key.substring(0, 20)}...